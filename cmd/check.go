@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// driftExitCode is the exit code of the check command when the database doesn't match the schema. Errors exit with 1.
+const driftExitCode = 2
+
+var checkCmd = &cobra.Command{
+	Use:   "check [file]",
+	Short: "Check whether the database matches the schema",
+	Long:  fmt.Sprintf("Check whether the database matches the schema. Exits with %d if the database has drifted from the schema.", driftExitCode),
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			logger.Fatal("invalid format: %s", format)
+		}
+		db, protocol, changes, _, _ := rundiff(cmd, logger, args[0], false)
+		db.Close()
+		differences := diff.Differences(changes)
+		if format == "json" {
+			printJSON(struct {
+				Drift       bool              `json:"drift"`
+				Differences []diff.Difference `json:"differences"`
+			}{len(differences) > 0, differences})
+		} else if len(differences) == 0 {
+			logger.Info("database matches the schema")
+		} else {
+			if err := diff.FormatDiff(diff.FormatText, schema.DatabaseDriverType(protocol), changes, os.Stdout); err != nil {
+				logger.Fatal("%s", err)
+			}
+			fmt.Println()
+			counts := make(map[string]int)
+			var kinds []string
+			for _, difference := range differences {
+				if counts[difference.Change] == 0 {
+					kinds = append(kinds, difference.Change)
+				}
+				counts[difference.Change]++
+			}
+			summary := make([]string, len(kinds))
+			for i, kind := range kinds {
+				summary[i] = fmt.Sprintf("%d %s", counts[kind], kind)
+			}
+			logger.Warn("database has drifted from the schema with %d %s: %s", len(differences), util.Plural(len(differences), "difference", "differences"), strings.Join(summary, ", "))
+		}
+		if len(differences) > 0 {
+			os.Exit(driftExitCode)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringP("format", "f", "text", "the output format: text, json")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/export"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export for other tools",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var exportMigrationsCmd = &cobra.Command{
+	Use:   "migrations [file]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Export the diff as versioned migration files for another migration tool",
+	Long:  "Export the diff of a schema against the database or, with --from and --to, between two schemas without a database as the next versioned migration in a directory for golang-migrate, goose or flyway. The down migration undoes the diff, marking the changes which can't be undone.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		tool, _ := cmd.Flags().GetString("tool")
+		if !slices.Contains(export.Tools, export.Tool(tool)) {
+			logger.Fatal("invalid tool: %s. must be one of: golang-migrate, goose, flyway", tool)
+		}
+		protocol, changes, fromSchema, toSchema := rundiffArgs(cmd, logger, args)
+		if len(changes) == 0 {
+			logger.Info("no changes detected")
+			return
+		}
+		driver := schema.DatabaseDriverType(protocol)
+		var up, down strings.Builder
+		if err := diff.FormatDiff(diff.FormatSQL, driver, changes, &up); err != nil {
+			logger.Fatal("%s", err)
+		}
+		reverse, irreversible, err := diff.Reverse(logger, driver, toSchema, fromSchema)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		for _, change := range irreversible {
+			fmt.Fprintf(&down, "-- %s\n", change)
+		}
+		if err := diff.FormatDiff(diff.FormatSQL, driver, reverse, &down); err != nil {
+			logger.Fatal("%s", err)
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		name, _ := cmd.Flags().GetString("name")
+		paths, err := export.Write(export.Tool(tool), dir, export.Migration{Name: name, Up: up.String(), Down: down.String()}, time.Now())
+		if err != nil {
+			logger.Fatal("error writing migration: %s", err)
+		}
+		for _, path := range paths {
+			logger.Info("wrote %s", path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportMigrationsCmd)
+	addUrlFlag(exportMigrationsCmd)
+	exportMigrationsCmd.Flags().String("tool", "", "the migration tool to write the files for: golang-migrate, goose, flyway")
+	exportMigrationsCmd.Flags().String("dir", "migrations", "the directory of the migrations")
+	exportMigrationsCmd.Flags().String("name", "shift", "the name of the migration used in the file names")
+	exportMigrationsCmd.Flags().String("from", "", "the existing schema to compare instead of the database")
+	exportMigrationsCmd.Flags().String("to", "", "the new schema to compare with the schema from --from")
+	exportMigrationsCmd.Flags().String("driver", "", "the database driver for the sql when using --from and --to: postgres, mysql, sqlite (defaults to the driver of the database url)")
+}
@@ -8,16 +8,17 @@ import (
 	"net/url"
 	"os"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jhaynie/shift/internal/diff"
 	"github.com/jhaynie/shift/internal/migrator"
-	_ "github.com/jhaynie/shift/internal/migrator/mysql"
 	_ "github.com/jhaynie/shift/internal/migrator/postgres"
 	"github.com/jhaynie/shift/internal/schema"
 	"github.com/shopmonkeyus/go-common/logger"
 	csys "github.com/shopmonkeyus/go-common/sys"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
+	_ "modernc.org/sqlite"
 )
 
 var generateCmd = &cobra.Command{
@@ -36,39 +37,48 @@ var generateSchemaCmd = &cobra.Command{
 		db, protocol := connectToDB(cmd, logger, "", false)
 		defer db.Close()
 		tables, _ := cmd.Flags().GetStringSlice("table")
+		namespaces, _ := cmd.Flags().GetStringSlice("schema")
 		dbschema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{
 			Context:     context.Background(),
 			DB:          db,
 			Logger:      logger,
 			TableFilter: tables,
+			Namespaces:  namespaces,
 		})
 		if err != nil {
 			logger.Fatal("error generating schema: %s", err)
 		}
-		outSchema := schema.SchemaJsonForOutput{
-			Schema:   dbschema.Schema,
-			Version:  dbschema.Version,
-			Database: dbschema.Database,
-			Tables:   dbschema.Tables,
-		}
 		format, _ := cmd.Flags().GetString("format")
-		var buf []byte
-		switch format {
-		case "yaml", "yml":
-			buf, err = yaml.Marshal(outSchema)
-			if err == nil {
-				buf = []byte("# yaml-language-server: $schema=" + schema.DefaultSchema + "\n" + string(buf))
-			}
-		default:
-			buf, err = json.MarshalIndent(outSchema, " ", "  ")
-		}
-		if err != nil {
-			logger.Fatal("serialization error: %s", err)
-		}
-		fmt.Print(string(buf))
+		printSchema(logger, dbschema, format)
 	},
 }
 
+// printSchema prints the schema in the format, json or yaml
+func printSchema(logger logger.Logger, dbschema *schema.SchemaJson, format string) {
+	outSchema := schema.SchemaJsonForOutput{
+		Schema:   dbschema.Schema,
+		Version:  dbschema.Version,
+		Database: dbschema.Database,
+		Enums:    dbschema.Enums,
+		Tables:   dbschema.Tables,
+	}
+	var buf []byte
+	var err error
+	switch format {
+	case "yaml", "yml":
+		buf, err = yaml.Marshal(outSchema)
+		if err == nil {
+			buf = []byte("# yaml-language-server: $schema=" + schema.DefaultSchema + "\n" + string(buf))
+		}
+	default:
+		buf, err = json.MarshalIndent(outSchema, " ", "  ")
+	}
+	if err != nil {
+		logger.Fatal("serialization error: %s", err)
+	}
+	fmt.Print(string(buf))
+}
+
 var generateSQLCmd = &cobra.Command{
 	Use:   "sql [file]",
 	Args:  cobra.ExactArgs(1),
@@ -103,9 +113,10 @@ func rundiff(cmd *cobra.Command, logger logger.Logger, filename string, drop boo
 	}
 	db, protocol := connectToDB(cmd, logger, newSchema.Database.Url.(string), drop)
 	existingSchema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{
-		Context: context.Background(),
-		Logger:  logger,
-		DB:      db,
+		Context:    context.Background(),
+		Logger:     logger,
+		DB:         db,
+		Namespaces: schema.Namespaces(newSchema),
 	})
 	if err != nil {
 		logger.Fatal("%s", err)
@@ -118,23 +129,95 @@ func rundiff(cmd *cobra.Command, logger logger.Logger, filename string, drop boo
 	return db, protocol, changes, existingSchema, newSchema
 }
 
+// rundiffOffline compares two schemas without a database using the driver provided or the one from the database url
+// of the new schema
+func rundiffOffline(cmd *cobra.Command, logger logger.Logger, fromFilename string, toFilename string) (string, []migrator.MigrateChanges, *schema.SchemaJson, *schema.SchemaJson) {
+	for _, filename := range []string{fromFilename, toFilename} {
+		if !csys.Exists(filename) {
+			logger.Fatal("file %s does not exists or is not accessible", filename)
+		}
+	}
+	protocol, _ := cmd.Flags().GetString("driver")
+	if protocol == "" {
+		dbschema, err := schema.Load(toFilename)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		urlstr, _ := dbschema.Database.Url.(string)
+		if _, protocol, err = migrator.DriverFromURL(urlstr); err != nil {
+			logger.Fatal("must provide --driver since it couldn't be determined from the database url in %s: %s", toFilename, err)
+		}
+	}
+	existingSchema, err := migrator.LoadWithProtocol(fromFilename, protocol)
+	if err != nil {
+		logger.Fatal("%s", err)
+	}
+	newSchema, err := migrator.LoadWithProtocol(toFilename, protocol)
+	if err != nil {
+		logger.Fatal("%s", err)
+	}
+	changes, err := diff.Diff(logger, schema.DatabaseDriverType(protocol), newSchema, existingSchema)
+	if err != nil {
+		logger.Fatal("%s", err)
+	}
+	return protocol, changes, existingSchema, newSchema
+}
+
+// rundiffArgs compares the schema file in args against the database or, with --from and --to, two schemas without a
+// database
+func rundiffArgs(cmd *cobra.Command, logger logger.Logger, args []string) (string, []migrator.MigrateChanges, *schema.SchemaJson, *schema.SchemaJson) {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	if from != "" || to != "" {
+		if from == "" || to == "" || len(args) > 0 {
+			logger.Fatal("must provide both --from and --to without a file")
+		}
+		return rundiffOffline(cmd, logger, from, to)
+	}
+	if len(args) == 0 {
+		logger.Fatal("must provide either a file or both --from and --to")
+	}
+	db, protocol, changes, fromSchema, toSchema := rundiff(cmd, logger, args[0], false)
+	db.Close()
+	return protocol, changes, fromSchema, toSchema
+}
+
 var generateDiffCmd = &cobra.Command{
 	Use:   "diff [file]",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	Short: "Generate diff from a schema",
+	Long:  "Generate diff from a schema against the database or, with --from and --to, between two schemas without a database. With --reverse the diff which undoes the migration is generated instead.",
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := newLogger(cmd)
-		db, protocol, changes, _, _ := rundiff(cmd, logger, args[0], false)
-		db.Close()
-		if len(changes) == 0 {
+		protocol, changes, fromSchema, toSchema := rundiffArgs(cmd, logger, args)
+		driver := schema.DatabaseDriverType(protocol)
+		var irreversible []diff.Irreversible
+		if reverse, _ := cmd.Flags().GetBool("reverse"); reverse {
+			var err error
+			if changes, irreversible, err = diff.Reverse(logger, driver, toSchema, fromSchema); err != nil {
+				logger.Fatal("%s", err)
+			}
+		}
+		if len(changes) == 0 && len(irreversible) == 0 {
 			fmt.Println("no changes detected")
 			return
 		}
 		format, _ := cmd.Flags().GetString("format")
-		driver := schema.DatabaseDriverType(protocol)
-		if err := diff.FormatDiff(diff.DiffFormatType(format), driver, changes, os.Stdout); err != nil {
+		if diff.DiffFormatType(format) == diff.FormatSQL {
+			// marked as comments so the sql can still be executed
+			for _, change := range irreversible {
+				fmt.Printf("-- %s\n", change)
+			}
+		}
+		online, _ := cmd.Flags().GetBool("online")
+		if err := diff.FormatDiff(diff.DiffFormatType(format), driver, changes, os.Stdout, diff.WithOnline(online)); err != nil {
 			logger.Fatal("%s", err)
 		}
+		if diff.DiffFormatType(format) == diff.FormatText {
+			for _, change := range irreversible {
+				fmt.Println(change)
+			}
+		}
 	},
 }
 
@@ -145,10 +228,16 @@ func init() {
 	generateCmd.AddCommand(generateDiffCmd)
 
 	generateSchemaCmd.Flags().StringSlice("table", []string{}, "table to filter when generating")
+	generateSchemaCmd.Flags().StringSlice("schema", []string{}, "additional database schema (namespace) to include when generating")
 	generateSchemaCmd.Flags().StringP("format", "f", "json", "the output format: json, yaml")
 
 	addUrlFlag(generateSchemaCmd)
 	addUrlFlag(generateDiffCmd)
 
 	generateDiffCmd.Flags().StringP("format", "f", "text", "the output format: text, sql")
+	generateDiffCmd.Flags().String("from", "", "the existing schema to compare instead of the database")
+	generateDiffCmd.Flags().String("to", "", "the new schema to compare with the schema from --from")
+	generateDiffCmd.Flags().Bool("online", false, "generate the sql which alters the existing tables without long locks such as building indexes concurrently. a column whose type changes is swapped for a new column which moves it to the end of the table (postgres only)")
+	generateDiffCmd.Flags().Bool("reverse", false, "generate the diff which undoes the migration, marking the changes which can't be undone")
+	generateDiffCmd.Flags().String("driver", "", "the database driver for the output when using --from and --to: postgres, mysql, sqlite (defaults to the driver of the database url)")
 }
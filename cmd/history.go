@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [id]",
+	Short: "List the migrations run against the database or show a migration",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		db, protocol := connectToDB(cmd, logger, "", false)
+		defer db.Close()
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			logger.Fatal("invalid format: %s", format)
+		}
+		if len(args) == 1 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				logger.Fatal("invalid migration id: %s", args[0])
+			}
+			record, err := migrator.GetMigration(context.Background(), protocol, db, id)
+			if err != nil {
+				logger.Fatal("error loading migration: %s", err)
+			}
+			if record == nil {
+				logger.Fatal("migration %d not found", id)
+			}
+			if format == "json" {
+				printJSON(record)
+				return
+			}
+			fmt.Printf("Migration:   %d\n", record.ID)
+			fmt.Printf("Started:     %s\n", record.StartedAt.Local().Format(time.RFC3339))
+			fmt.Printf("Finished:    %s\n", record.FinishedAt.Local().Format(time.RFC3339))
+			fmt.Printf("Duration:    %v\n", record.Duration)
+			fmt.Printf("User:        %s\n", record.User)
+			fmt.Printf("Commit:      %s\n", record.Commit)
+			fmt.Printf("Checksum:    %s\n", record.Checksum)
+			fmt.Printf("Status:      %s\n", record.Status)
+			if record.Error != "" {
+				fmt.Printf("Error:       %s\n", record.Error)
+			}
+			if record.Plan != "" {
+				fmt.Println()
+				fmt.Print(record.Plan)
+			}
+			fmt.Println()
+			fmt.Println(record.SQL)
+			return
+		}
+		records, err := migrator.GetMigrationHistory(context.Background(), protocol, db)
+		if err != nil {
+			logger.Fatal("error loading migration history: %s", err)
+		}
+		if format == "json" {
+			printJSON(records)
+			return
+		}
+		if len(records) == 0 {
+			logger.Info("no migrations recorded")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tSTATUS\tUSER\tCOMMIT\tCHECKSUM")
+		for _, record := range records {
+			fmt.Fprintf(w, "%d\t%s\t%v\t%s\t%s\t%s\t%s\n", record.ID, record.StartedAt.Local().Format(time.RFC3339), record.Duration, record.Status, record.User, shortHash(record.Commit), shortHash(record.Checksum))
+		}
+		w.Flush()
+		logger.Info("%d %s recorded", len(records), util.Plural(len(records), "migration", "migrations"))
+	},
+}
+
+// shortHash returns the abbreviated form of a commit or checksum
+func shortHash(val string) string {
+	if len(val) > 12 {
+		return val[:12]
+	}
+	return val
+}
+
+func printJSON(val any) {
+	buf, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(buf))
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	addUrlFlag(historyCmd)
+	historyCmd.Flags().StringP("format", "f", "text", "the output format: text, json")
+}
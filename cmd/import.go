@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"slices"
+
+	"github.com/jhaynie/shift/internal/export"
+	"github.com/jhaynie/shift/internal/importer"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import from other tools",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var importMigrationsCmd = &cobra.Command{
+	Use:   "migrations",
+	Args:  cobra.NoArgs,
+	Short: "Import a schema from the migration files of another migration tool",
+	Long:  "Import a schema without a database by replaying the DDL of the up migrations for golang-migrate, goose or flyway in the directory in order. The statements which can't be interpreted are skipped with a warning.",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		tool, _ := cmd.Flags().GetString("tool")
+		if !slices.Contains(export.Tools, export.Tool(tool)) {
+			logger.Fatal("invalid tool: %s. must be one of: golang-migrate, goose, flyway", tool)
+		}
+		driver, _ := cmd.Flags().GetString("driver")
+		switch schema.DatabaseDriverType(driver) {
+		case schema.DatabaseDriverPostgres, schema.DatabaseDriverMysql, schema.DatabaseDriverSQLite:
+		default:
+			logger.Fatal("invalid driver: %s. must be one of: postgres, mysql, sqlite", driver)
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		dbschema, warnings, err := importer.Import(schema.DatabaseDriverType(driver), export.Tool(tool), dir)
+		if err != nil {
+			logger.Fatal("error reading migrations: %s", err)
+		}
+		for _, warning := range warnings {
+			logger.Warn("%s", warning)
+		}
+		format, _ := cmd.Flags().GetString("format")
+		printSchema(logger, dbschema, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importMigrationsCmd)
+	importMigrationsCmd.Flags().String("tool", "", "the migration tool the files are for: golang-migrate, goose, flyway")
+	importMigrationsCmd.Flags().String("dir", "migrations", "the directory of the migrations")
+	importMigrationsCmd.Flags().String("driver", "postgres", "the database driver the migrations are written for: postgres, mysql, sqlite")
+	importMigrationsCmd.Flags().StringP("format", "f", "json", "the output format: json, yaml")
+}
@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/erikgeiser/promptkit"
 	"github.com/erikgeiser/promptkit/selection"
@@ -12,6 +17,7 @@ import (
 	"github.com/jhaynie/shift/internal/migrator"
 	"github.com/jhaynie/shift/internal/schema"
 	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +28,11 @@ var migrateCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := newLogger(cmd)
 		drop, _ := cmd.Flags().GetBool("drop")
+		rehearsal, _ := cmd.Flags().GetBool("rehearse")
+		clone, _ := cmd.Flags().GetBool("rehearse-clone")
+		if drop && (rehearsal || clone) {
+			logger.Fatal("can't rehearse a migration which drops the database")
+		}
 		db, protocol, changes, fromSchema, toSchema := rundiff(cmd, logger, args[0], drop)
 		defer db.Close()
 		if len(changes) == 0 {
@@ -29,49 +40,232 @@ var migrateCmd = &cobra.Command{
 			return
 		}
 		confirm, _ := cmd.Flags().GetBool("confirm")
-	restart:
-		for confirm {
-			input := selection.New(fmt.Sprintf("Apply %d database %s? ", len(changes), util.Plural(len(changes), "change", "changes")), []string{"Yes", "Show Diff", "Show SQL", "No"})
-			input.Filter = nil // turn off filtering
-			ready, err := input.RunPrompt()
-			if err != nil && !errors.Is(err, promptkit.ErrAborted) {
+		if confirm && confirmRenames(logger, toSchema, changes) {
+			var err error
+			changes, err = diff.Diff(logger, schema.DatabaseDriverType(protocol), toSchema, fromSchema)
+			if err != nil {
 				logger.Fatal("%s", err)
 			}
-			switch ready {
-			case "Yes":
-				break restart
-			case "No":
-				return
-			case "Show Diff", "Show SQL":
-				fmt.Println()
-				driver := schema.DatabaseDriverType(protocol)
-				format := diff.FormatText
-				if ready == "Show SQL" {
-					format = diff.FormatSQL
-				}
-				if err := diff.FormatDiff(format, driver, changes, os.Stdout); err != nil {
-					logger.Fatal("%s", err)
-				}
-				fmt.Println()
+		}
+		online := onlineFlag(cmd, logger, protocol)
+		allowDestructive, _ := cmd.Flags().GetBool("allow-destructive")
+		var hazards []diff.Hazard
+		if !drop {
+			hazards = checkDestructive(logger, protocol, toSchema, changes, allowDestructive, online)
+		}
+		checksum, err := schemaChecksum(args[0])
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		transaction, _ := cmd.Flags().GetBool("transaction")
+		lockWait, _ := cmd.Flags().GetDuration("lock-wait")
+		commit, _ := cmd.Flags().GetString("commit")
+		if commit == "" {
+			commit = gitCommit(args[0])
+		}
+		migrateArgs := withTimeouts(cmd, migrator.MigratorArgs{
+			Context:          context.Background(),
+			Logger:           logger,
+			DB:               db,
+			FromSchema:       fromSchema,
+			ToSchema:         toSchema,
+			Diff:             changes,
+			Drop:             drop,
+			Checksum:         checksum,
+			Commit:           commit,
+			NoTransaction:    !transaction,
+			LockWait:         lockWait,
+			Online:           online,
+			AllowDestructive: allowDestructive,
+		})
+		if rehearsal || clone {
+			if err := rehearse(logger, db, databaseURL(cmd, logger, toSchema.Database.Url.(string)), protocol, migrateArgs, clone); err != nil {
+				logger.Fatal("%s", err)
 			}
 		}
-		if err := migrator.Migrate(protocol, migrator.MigratorArgs{
-			Context:    context.Background(),
-			Logger:     logger,
-			DB:         db,
-			FromSchema: fromSchema,
-			ToSchema:   toSchema,
-			Diff:       changes,
-			Drop:       drop,
-		}); err != nil {
+		if confirm && !confirmApply(logger, protocol, changes, hazards, nil, online) {
+			return
+		}
+		if err := migrator.Migrate(protocol, migrateArgs); err != nil {
 			logger.Fatal("%s", err)
 		}
 	},
 }
 
+// addTimeoutFlags adds the flags for the timeouts of the statements of a migration and, when retries is true, how many
+// times they're retried
+func addTimeoutFlags(cmd *cobra.Command, retries bool) {
+	cmd.Flags().Duration("lock-timeout", 0, "how long each statement waits for a lock before failing, no limit if 0 (postgres only)")
+	cmd.Flags().Duration("statement-timeout", 0, "how long each statement can run before failing, no limit if 0 (postgres only)")
+	if retries {
+		cmd.Flags().Int("retries", 0, "how many times to retry the statements which fail waiting for a lock (postgres only)")
+	}
+}
+
+// withTimeouts returns the args with the timeouts and retries from the flags added by addTimeoutFlags
+func withTimeouts(cmd *cobra.Command, args migrator.MigratorArgs) migrator.MigratorArgs {
+	args.LockTimeout, _ = cmd.Flags().GetDuration("lock-timeout")
+	args.StatementTimeout, _ = cmd.Flags().GetDuration("statement-timeout")
+	if cmd.Flags().Lookup("retries") != nil {
+		args.Retries, _ = cmd.Flags().GetInt("retries")
+	}
+	return args
+}
+
+// schemaChecksum returns the SHA-256 of the schema document which is recorded in the migration history
+func schemaChecksum(filename string) (string, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("error reading schema: %w", err)
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// gitCommit returns the current git commit of the repository containing the file or an empty string if it's not in one
+func gitCommit(filename string) string {
+	out, err := exec.Command("git", "-C", filepath.Dir(filename), "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// onlineFlag returns true if the changes should be applied with the online statements, warning when the database
+// doesn't have any
+func onlineFlag(cmd *cobra.Command, logger logger.Logger, protocol string) bool {
+	online, _ := cmd.Flags().GetBool("online")
+	if _, ok := migrator.GetGenerator(protocol).(migrator.OnlineGenerator); online && !ok {
+		logger.Warn("--online isn't supported for %s, the changes are applied with the usual statements", protocol)
+		return false
+	}
+	return online
+}
+
+// checkDestructive returns the hazards of the changes and exits if any of them are destructive without being allowed
+// by the schema or allowDestructive
+func checkDestructive(logger logger.Logger, protocol string, dbschema *schema.SchemaJson, changes []migrator.MigrateChanges, allowDestructive bool, online bool) []diff.Hazard {
+	hazards, disallowed := diff.Disallowed(schema.DatabaseDriverType(protocol), dbschema, changes, diff.WithOnline(online))
+	if len(disallowed) > 0 && !allowDestructive {
+		for _, hazard := range disallowed {
+			logger.Error("%s", hazard)
+		}
+		logger.Fatal("refusing to apply %d destructive %s. pass --allow-destructive, declare the dropped tables and columns in the drops of the schema or set allowDrop on the table or column", len(disallowed), util.Plural(len(disallowed), "change", "changes"))
+	}
+	return hazards
+}
+
+// riskSummary returns the count of the changes which aren't safe by risk, empty if they're all safe
+func riskSummary(hazards []diff.Hazard) string {
+	var destructive, blocking int
+	for _, hazard := range hazards {
+		switch hazard.Risk {
+		case diff.RiskDestructive:
+			destructive++
+		case diff.RiskBlocking:
+			blocking++
+		}
+	}
+	var counts []string
+	if destructive > 0 {
+		counts = append(counts, fmt.Sprintf("%d %s", destructive, diff.RiskDestructive))
+	}
+	if blocking > 0 {
+		counts = append(counts, fmt.Sprintf("%d %s", blocking, diff.RiskBlocking))
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(counts, ", ") + ")"
+}
+
+// confirmApply asks whether to apply the changes, showing the diff or sql when asked, and returns true if they should
+// be applied
+func confirmApply(logger logger.Logger, protocol string, changes []migrator.MigrateChanges, hazards []diff.Hazard, irreversible []diff.Irreversible, online bool) bool {
+	for {
+		input := selection.New(fmt.Sprintf("Apply %d database %s%s? ", len(changes), util.Plural(len(changes), "change", "changes"), riskSummary(hazards)), []string{"Yes", "Show Diff", "Show SQL", "No"})
+		input.Filter = nil // turn off filtering
+		ready, err := input.RunPrompt()
+		if err != nil && !errors.Is(err, promptkit.ErrAborted) {
+			logger.Fatal("%s", err)
+		}
+		switch ready {
+		case "Yes":
+			return true
+		case "Show Diff", "Show SQL":
+			fmt.Println()
+			driver := schema.DatabaseDriverType(protocol)
+			format := diff.FormatText
+			if ready == "Show SQL" {
+				format = diff.FormatSQL
+			}
+			if err := diff.FormatDiff(format, driver, changes, os.Stdout, diff.WithOnline(online)); err != nil {
+				logger.Fatal("%s", err)
+			}
+			if format == diff.FormatText {
+				for _, hazard := range hazards {
+					fmt.Println(hazard)
+				}
+				for _, change := range irreversible {
+					fmt.Println(change)
+				}
+			}
+			fmt.Println()
+		default:
+			return false
+		}
+	}
+}
+
+func promptYesNo(logger logger.Logger, prompt string) bool {
+	input := selection.New(prompt, []string{"Yes", "No"})
+	input.Filter = nil // turn off filtering
+	answer, err := input.RunPrompt()
+	if err != nil && !errors.Is(err, promptkit.ErrAborted) {
+		logger.Fatal("%s", err)
+	}
+	return answer == "Yes"
+}
+
+// confirmRenames asks whether each table and column which looks to be renamed was renamed and marks the ones which
+// were as renamed in the schema so they're renamed instead of dropped and created. Returns true if any were renamed.
+func confirmRenames(logger logger.Logger, dbschema *schema.SchemaJson, changes []migrator.MigrateChanges) bool {
+	var renamed bool
+	for _, changeset := range changes {
+		table := schema.FindTable(dbschema.Tables, changeset.Table)
+		if table == nil {
+			continue
+		}
+		if changeset.LikelyRenamedFrom != "" && promptYesNo(logger, fmt.Sprintf("Was table %s renamed from %s? ", changeset.Table, changeset.LikelyRenamedFrom)) {
+			table.RenamedFrom = util.Ptr(changeset.LikelyRenamedFrom)
+			renamed = true
+		}
+		for _, column := range changeset.Columns {
+			if column.LikelyRenamedFrom == "" || !promptYesNo(logger, fmt.Sprintf("Was column %s in table %s renamed from %s? ", column.Name, changeset.Table, column.LikelyRenamedFrom)) {
+				continue
+			}
+			for i, col := range table.Columns {
+				if col.Name == column.Name {
+					table.Columns[i].RenamedFrom = util.Ptr(column.LikelyRenamedFrom)
+					renamed = true
+				}
+			}
+		}
+	}
+	return renamed
+}
+
 func init() {
 	rootCmd.AddCommand(migrateCmd)
 	addUrlFlag(migrateCmd)
 	migrateCmd.Flags().Bool("drop", false, "drop the database before migration")
 	migrateCmd.Flags().Bool("confirm", true, "ask for confirmation before continuing")
+	migrateCmd.Flags().Bool("allow-destructive", false, "allow changes which lose data such as dropping tables and columns")
+	migrateCmd.Flags().Bool("transaction", true, "run the migration in a transaction, rolling back on failure (postgres only)")
+	migrateCmd.Flags().Duration("lock-wait", migrator.DefaultLockWait, "how long to wait for another migration of the database to finish")
+	addTimeoutFlags(migrateCmd, true)
+	migrateCmd.Flags().Bool("rehearse", false, "apply the migration to a scratch database with the same schema first and only continue if it succeeds (postgres only)")
+	migrateCmd.Flags().Bool("rehearse-clone", false, "rehearse on a clone of the database including its data, which requires no other connections to the database (postgres only)")
+	migrateCmd.Flags().Bool("online", false, "alter the existing tables with statements which avoid long locks such as building indexes concurrently. a column whose type changes is swapped for a new column which moves it to the end of the table (postgres only)")
+	migrateCmd.Flags().String("commit", "", "the git commit recorded in the migration history (defaults to the commit of the schema's repository)")
 }
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [file]",
+	Short: "Save the migration for the schema to a plan file which can be applied later",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		db, protocol, changes, fromSchema, toSchema := rundiff(cmd, logger, args[0], false)
+		defer db.Close()
+		if len(changes) == 0 {
+			logger.Info("no changes detected")
+			return
+		}
+		driver := schema.DatabaseDriverType(protocol)
+		online := onlineFlag(cmd, logger, protocol)
+		var queries strings.Builder
+		if err := diff.FormatDiff(diff.FormatSQL, driver, changes, &queries, diff.WithOnline(online)); err != nil {
+			logger.Fatal("%s", err)
+		}
+		plan, err := migrator.NewPlan(protocol, fromSchema, toSchema, changes, queries.String())
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		plan.Online = online
+		if plan.Checksum, err = schemaChecksum(args[0]); err != nil {
+			logger.Fatal("%s", err)
+		}
+		plan.Commit, _ = cmd.Flags().GetString("commit")
+		if plan.Commit == "" {
+			plan.Commit = gitCommit(args[0])
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if err := plan.Save(output); err != nil {
+			logger.Fatal("error saving plan: %s", err)
+		}
+		if err := diff.FormatDiff(diff.FormatText, driver, changes, os.Stdout); err != nil {
+			logger.Fatal("%s", err)
+		}
+		fmt.Println()
+		logger.Info("saved plan with %d %s to %s", len(changes), util.Plural(len(changes), "change", "changes"), output)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [planfile]",
+	Short: "Apply a plan file created by the plan command",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		plan, err := migrator.LoadPlan(args[0])
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		db, protocol := connectToDB(cmd, logger, "", false)
+		defer db.Close()
+		if protocol != plan.Driver {
+			logger.Fatal("plan was created for %s but the database is %s", plan.Driver, protocol)
+		}
+		existingSchema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{
+			Context:    context.Background(),
+			Logger:     logger,
+			DB:         db,
+			Namespaces: schema.Namespaces(plan.Schema),
+		})
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		fingerprint, err := schema.Fingerprint(existingSchema)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		if fingerprint != plan.Fingerprint {
+			logger.Fatal("%s. create a new plan to apply the changes", migrator.ErrDrift)
+		}
+		// the database is the same as when the plan was created so the changes of the plan are applied as they are,
+		// which must generate the sql that was reviewed
+		changes, err := plan.MigrateChanges()
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		var queries strings.Builder
+		if err := diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverType(protocol), changes, &queries, diff.WithOnline(plan.Online)); err != nil {
+			logger.Fatal("%s", err)
+		}
+		if queries.String() != plan.SQL {
+			logger.Fatal("the sql for the plan doesn't match the sql it was created with. create a new plan with this version of shift")
+		}
+		if len(changes) == 0 {
+			logger.Info("no changes in plan")
+			return
+		}
+		allowDestructive, _ := cmd.Flags().GetBool("allow-destructive")
+		checkDestructive(logger, protocol, plan.Schema, changes, allowDestructive, plan.Online)
+		transaction, _ := cmd.Flags().GetBool("transaction")
+		lockWait, _ := cmd.Flags().GetDuration("lock-wait")
+		if err := migrator.Migrate(protocol, withTimeouts(cmd, migrator.MigratorArgs{
+			Context:          context.Background(),
+			Logger:           logger,
+			DB:               db,
+			FromSchema:       existingSchema,
+			ToSchema:         plan.Schema,
+			Diff:             changes,
+			Checksum:         plan.Checksum,
+			Commit:           plan.Commit,
+			NoTransaction:    !transaction,
+			LockWait:         lockWait,
+			Fingerprint:      plan.Fingerprint,
+			Online:           plan.Online,
+			AllowDestructive: allowDestructive,
+		})); err != nil {
+			if errors.Is(err, migrator.ErrDrift) {
+				logger.Fatal("%s while waiting for the migration lock. create a new plan to apply the changes", err)
+			}
+			logger.Fatal("%s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringP("output", "o", "plan.json", "the file to save the plan to")
+	planCmd.Flags().Bool("online", false, "alter the existing tables with statements which avoid long locks such as building indexes concurrently. a column whose type changes is swapped for a new column which moves it to the end of the table (postgres only)")
+	planCmd.Flags().String("commit", "", "the git commit recorded with the plan (defaults to the commit of the schema's repository)")
+
+	rootCmd.AddCommand(applyCmd)
+	addUrlFlag(applyCmd)
+	applyCmd.Flags().Bool("allow-destructive", false, "allow changes which lose data such as dropping tables and columns")
+	applyCmd.Flags().Bool("transaction", true, "run the migration in a transaction, rolling back on failure (postgres only)")
+	applyCmd.Flags().Duration("lock-wait", migrator.DefaultLockWait, "how long to wait for another migration of the database to finish")
+	addTimeoutFlags(applyCmd, true)
+}
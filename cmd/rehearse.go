@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/lib/pq"
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+// defaultMaxIdleConns is the number of idle connections database/sql keeps by default
+const defaultMaxIdleConns = 2
+
+// scratchDatabaseName returns the name of the scratch database for rehearsing a migration of the database which fits
+// within the 63 characters postgres allows
+func scratchDatabaseName(name string, ts time.Time) string {
+	suffix := fmt.Sprintf("_shift_rehearsal_%d", ts.Unix())
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+	return name + suffix
+}
+
+// scratchDatabase creates a scratch database on the server of the database url and returns a connection to it along
+// with a function which drops it. The scratch database is a clone of the database made with it as a template, which
+// needs the database to have no other connections, when clone is true and empty otherwise.
+func scratchDatabase(logger logger.Logger, driver string, urlstr string, clone bool) (*sql.DB, func(), error) {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return nil, nil, err
+	}
+	currentDB := strings.TrimPrefix(u.Path, "/")
+	if currentDB == "" {
+		return nil, nil, errors.New("the database url doesn't include the name of the database")
+	}
+	name := scratchDatabaseName(currentDB, time.Now())
+	u.Path = "/postgres" // connect without providing a database
+	admin, err := sql.Open(driver, u.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	q := "CREATE DATABASE " + pq.QuoteIdentifier(name)
+	if clone {
+		q += " TEMPLATE " + pq.QuoteIdentifier(currentDB)
+	}
+	ts := time.Now()
+	logger.Trace("sql: %s", q)
+	if _, err := admin.Exec(q); err != nil {
+		admin.Close()
+		return nil, nil, fmt.Errorf("error creating scratch database %s: %w", name, err)
+	}
+	logger.Info("created scratch database %s in %v", name, time.Since(ts))
+	u.Path = "/" + name
+	db, err := sql.Open(driver, u.String())
+	drop := func() {
+		if db != nil {
+			db.Close()
+		}
+		q := "DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name)
+		logger.Trace("sql: %s", q)
+		if _, err := admin.Exec(q); err != nil {
+			logger.Error("error dropping scratch database %s: %s", name, err)
+		} else {
+			logger.Info("dropped scratch database %s", name)
+		}
+		admin.Close()
+	}
+	if err != nil {
+		drop()
+		return nil, nil, err
+	}
+	return db, drop, nil
+}
+
+// rehearse applies the migration to a scratch database with the schema of the database and returns an error if it
+// fails or the schema of the scratch database doesn't match the target schema afterwards
+func rehearse(logger logger.Logger, db *sql.DB, urlstr string, protocol string, args migrator.MigratorArgs, clone bool) error {
+	if protocol != "postgres" {
+		return fmt.Errorf("rehearsing isn't supported for %s", protocol)
+	}
+	driver, _, err := migrator.DriverFromURL(urlstr)
+	if err != nil {
+		return err
+	}
+	if clone {
+		// the idle connections to the database would keep it from being used as a template
+		db.SetMaxIdleConns(0)
+		defer db.SetMaxIdleConns(defaultMaxIdleConns)
+	}
+	scratch, drop, err := scratchDatabase(logger, driver, urlstr, clone)
+	if err != nil {
+		return err
+	}
+	defer drop()
+	ctx := args.Context
+	if !clone {
+		var out strings.Builder
+		if err := migrator.FromSchema(protocol, args.FromSchema, &out); err != nil {
+			return err
+		}
+		if _, err := scratch.ExecContext(ctx, out.String()); err != nil {
+			return fmt.Errorf("error creating the schema of the database in the scratch database: %w", err)
+		}
+	}
+	driverType := schema.DatabaseDriverType(protocol)
+	namespaces := schema.Namespaces(args.ToSchema)
+	existingSchema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{Context: ctx, Logger: logger, DB: scratch, Namespaces: namespaces})
+	if err != nil {
+		return err
+	}
+	changes, err := diff.Diff(logger, driverType, args.ToSchema, existingSchema)
+	if err != nil {
+		return err
+	}
+	if len(changes) != len(args.Diff) {
+		logger.Warn("the scratch database doesn't match the database exactly, rehearsing %d of %d %s", len(changes), len(args.Diff), util.Plural(len(args.Diff), "change", "changes"))
+	}
+	ts := time.Now()
+	args.DB = scratch
+	args.FromSchema = existingSchema
+	args.Diff = changes
+	args.Fingerprint = "" // the fingerprint is for the database which is checked when the migration is applied to it
+	if err := migrator.Migrate(protocol, args); err != nil {
+		return fmt.Errorf("rehearsal failed: %w", err)
+	}
+	rehearsedSchema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{Context: ctx, Logger: logger, DB: scratch, Namespaces: namespaces})
+	if err != nil {
+		return err
+	}
+	remaining, err := diff.Diff(logger, driverType, args.ToSchema, rehearsedSchema)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		var out strings.Builder
+		if err := diff.FormatDiff(diff.FormatText, driverType, remaining, &out); err != nil {
+			return err
+		}
+		return fmt.Errorf("rehearsal failed: %d %s remain after applying the migration:\n%s", len(remaining), util.Plural(len(remaining), "change", "changes"), out.String())
+	}
+	logger.Info("rehearsed %d %s in %v", len(changes), util.Plural(len(changes), "change", "changes"), time.Since(ts))
+	return nil
+}
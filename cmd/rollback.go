@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [id]",
+	Short: "Roll the database back to the schema it had before a migration",
+	Long:  "Roll the database back to the schema it had before the migration with the id from the history, or the last migration if no id is provided. The migrations applied after it are undone as well. Dropped tables and columns are created again without their data.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		db, protocol := connectToDB(cmd, logger, "", false)
+		defer db.Close()
+		ctx := context.Background()
+		var record *migrator.MigrationRecord
+		if len(args) == 1 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				logger.Fatal("invalid migration id: %s", args[0])
+			}
+			if record, err = migrator.GetMigration(ctx, protocol, db, id); err != nil {
+				logger.Fatal("error loading migration: %s", err)
+			}
+			if record == nil {
+				logger.Fatal("migration %d not found", id)
+			}
+		} else {
+			records, err := migrator.GetMigrationHistory(ctx, protocol, db)
+			if err != nil {
+				logger.Fatal("error loading migration history: %s", err)
+			}
+			// the failed migrations were rolled back so the last one which changed the database is rolled back
+			for i := range records {
+				if records[i].Status != migrator.MigrationFailed {
+					record = &records[i]
+					break
+				}
+			}
+			if record == nil {
+				logger.Fatal("no migrations recorded")
+			}
+		}
+		if record.Status == migrator.MigrationFailed {
+			logger.Fatal("migration %d failed and was rolled back so it can't be rolled back: %s", record.ID, record.Error)
+		}
+		if record.Status == migrator.MigrationPartial {
+			logger.Warn("migration %d was only partially applied: %s", record.ID, record.Error)
+		}
+		if record.FromSchema == nil || record.ToSchema == nil {
+			logger.Fatal("migration %d didn't record its schemas so it can't be rolled back", record.ID)
+		}
+		driver := schema.DatabaseDriverType(protocol)
+		target, irreversible, err := diff.ReverseSchema(logger, driver, record.ToSchema, record.FromSchema)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		existingSchema, err := migrator.ToSchema(protocol, migrator.ToSchemaArgs{
+			Context:    ctx,
+			Logger:     logger,
+			DB:         db,
+			Namespaces: schema.Namespaces(target),
+		})
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		changes, err := diff.Diff(logger, driver, target, existingSchema)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		if len(changes) == 0 {
+			logger.Info("no changes needed to roll back migration %d", record.ID)
+			return
+		}
+		for _, change := range irreversible {
+			logger.Warn("%s", change)
+		}
+		online := onlineFlag(cmd, logger, protocol)
+		allowDestructive, _ := cmd.Flags().GetBool("allow-destructive")
+		hazards := checkDestructive(logger, protocol, target, changes, allowDestructive, online)
+		if confirm, _ := cmd.Flags().GetBool("confirm"); confirm && !confirmApply(logger, protocol, changes, hazards, irreversible, online) {
+			return
+		}
+		transaction, _ := cmd.Flags().GetBool("transaction")
+		lockWait, _ := cmd.Flags().GetDuration("lock-wait")
+		if err := migrator.Migrate(protocol, withTimeouts(cmd, migrator.MigratorArgs{
+			Context:          ctx,
+			Logger:           logger,
+			DB:               db,
+			FromSchema:       existingSchema,
+			ToSchema:         target,
+			Diff:             changes,
+			NoTransaction:    !transaction,
+			LockWait:         lockWait,
+			Online:           online,
+			AllowDestructive: allowDestructive,
+		})); err != nil {
+			logger.Fatal("%s", err)
+		}
+		logger.Info("rolled back migration %d with %d %s", record.ID, len(changes), util.Plural(len(changes), "change", "changes"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	addUrlFlag(rollbackCmd)
+	rollbackCmd.Flags().Bool("confirm", true, "ask for confirmation before continuing")
+	rollbackCmd.Flags().Bool("allow-destructive", false, "allow changes which lose data such as dropping the tables and columns the migration created")
+	rollbackCmd.Flags().Bool("transaction", true, "run the rollback in a transaction, rolling back on failure (postgres only)")
+	rollbackCmd.Flags().Bool("online", false, "alter the existing tables with statements which avoid long locks such as building indexes concurrently. a column whose type changes is swapped for a new column which moves it to the end of the table (postgres only)")
+	rollbackCmd.Flags().Duration("lock-wait", migrator.DefaultLockWait, "how long to wait for another migration of the database to finish")
+	addTimeoutFlags(rollbackCmd, true)
+}
@@ -33,6 +33,8 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/mysql"
+	"github.com/jhaynie/shift/internal/migrator/sqlite"
 	"github.com/shopmonkeyus/go-common/logger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -139,6 +141,29 @@ func dropDatabase(logger logger.Logger, protocol string, driver string, urlstr s
 		currentDB = u.Path[1:] // get the current database from the path
 		u.Path = "/postgres"   // connect without providing a database
 		newurl = u.String()
+	case "mysql":
+		u, err := url.Parse(urlstr)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		currentDB = u.Path[1:] // get the current database from the path
+		u.Path = "/"           // connect without providing a database
+		newurl, err = mysql.DSNFromURL(u.String())
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+	case "sqlite":
+		// sqlite databases are just a file so we remove it and let the driver create a new one on connect
+		filename := strings.Split(sqlite.DSNFromURL(urlstr), "?")[0]
+		if filename == ":memory:" {
+			return
+		}
+		ts := time.Now()
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			logger.Fatal("error dropping database: %s. %s", filename, err)
+		}
+		logger.Info("dropped database %s in %v", filename, time.Since(ts))
+		return
 	default:
 		logger.Fatal("no drop database provided for %s", protocol)
 	}
@@ -163,7 +188,8 @@ func dropDatabase(logger logger.Logger, protocol string, driver string, urlstr s
 	logger.Info("created database %s in %v", currentDB, time.Since(ts))
 }
 
-func connectToDB(cmd *cobra.Command, logger logger.Logger, url string, drop bool) (*sql.DB, string) {
+// databaseURL returns the url provided or the one from the --url flag if it's empty
+func databaseURL(cmd *cobra.Command, logger logger.Logger, url string) string {
 	if url == "" {
 		urlstr, _ := cmd.Flags().GetString("url")
 		if urlstr == "" {
@@ -171,6 +197,11 @@ func connectToDB(cmd *cobra.Command, logger logger.Logger, url string, drop bool
 		}
 		url = urlstr
 	}
+	return url
+}
+
+func connectToDB(cmd *cobra.Command, logger logger.Logger, url string, drop bool) (*sql.DB, string) {
+	url = databaseURL(cmd, logger, url)
 	driver, protocol, err := migrator.DriverFromURL(url)
 	if err != nil {
 		logger.Fatal("%s", err)
@@ -178,7 +209,17 @@ func connectToDB(cmd *cobra.Command, logger logger.Logger, url string, drop bool
 	if drop {
 		dropDatabase(logger, protocol, driver, url)
 	}
-	db, err := sql.Open(driver, url)
+	dsn := url
+	switch protocol {
+	case "mysql":
+		dsn, err = mysql.DSNFromURL(url)
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+	case "sqlite":
+		dsn = sqlite.DSNFromURL(url)
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		logger.Fatal("Unable to connect to database: %v", err)
 	}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/spf13/cobra"
+)
+
+// verifyFailedExitCode is the exit code of the verify command when the migration wouldn't succeed. Errors exit with 1.
+const verifyFailedExitCode = 2
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verify the migration by applying it in a transaction which is rolled back",
+	Long:  fmt.Sprintf("Verify the migration by applying it inside a transaction, reading the schema within it and comparing it to the schema. The transaction is always rolled back. Exits with %d if a statement fails or differences remain. Only postgres is supported.", verifyFailedExitCode),
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newLogger(cmd)
+		db, protocol, changes, fromSchema, toSchema := rundiff(cmd, logger, args[0], false)
+		defer db.Close()
+		if len(changes) == 0 {
+			logger.Info("no changes detected")
+			return
+		}
+		result, err := migrator.Verify(protocol, withTimeouts(cmd, migrator.MigratorArgs{
+			Context:    context.Background(),
+			Logger:     logger,
+			DB:         db,
+			FromSchema: fromSchema,
+			ToSchema:   toSchema,
+			Diff:       changes,
+			Online:     onlineFlag(cmd, logger, protocol),
+		}))
+		if err != nil {
+			logger.Fatal("%s", err)
+		}
+		for _, serr := range result.Errors {
+			logger.Error("%s", serr)
+		}
+		if len(result.Remaining) > 0 {
+			if err := diff.FormatDiff(diff.FormatText, schema.DatabaseDriverType(protocol), result.Remaining, os.Stdout); err != nil {
+				logger.Fatal("%s", err)
+			}
+			fmt.Println()
+			logger.Error("%d %s remain after applying the migration", len(result.Remaining), util.Plural(len(result.Remaining), "change", "changes"))
+		}
+		if !result.OK() {
+			logger.Error("verification of %d %s failed with %d %s", len(changes), util.Plural(len(changes), "change", "changes"), len(result.Errors), util.Plural(len(result.Errors), "error", "errors"))
+			db.Close()
+			os.Exit(verifyFailedExitCode)
+		}
+		logger.Info("verified %d %s, the changes were rolled back", len(changes), util.Plural(len(changes), "change", "changes"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	addUrlFlag(verifyCmd)
+	verifyCmd.Flags().Bool("online", false, "verify the statements which avoid long locks that --online migrates with, building the indexes without CONCURRENTLY (postgres only)")
+	addTimeoutFlags(verifyCmd, false)
+}
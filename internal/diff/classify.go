@@ -0,0 +1,192 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+// Risk is how risky a change is to apply to a database which is in use
+type Risk int
+
+const (
+	// RiskSafe changes can be applied without blocking the database or losing data
+	RiskSafe Risk = iota
+	// RiskBlocking changes take long locks or rewrite the table while they're applied
+	RiskBlocking
+	// RiskDestructive changes lose data
+	RiskDestructive
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskBlocking:
+		return "blocking"
+	case RiskDestructive:
+		return "destructive"
+	}
+	return "safe"
+}
+
+// Hazard is the reason a change isn't safe to apply
+type Hazard struct {
+	Risk   Risk
+	Table  string
+	Column string // column of the table the hazard is for, empty if it's for the table
+	Reason string
+}
+
+func (h Hazard) String() string {
+	return fmt.Sprintf("[%s] %s", h.Risk, h.Reason)
+}
+
+// narrowsType returns true if changing a column from previous to next can lose the data of the column
+func narrowsType(previous schema.SchemaJsonTablesElemColumnsElem, next schema.SchemaJsonTablesElemColumnsElem) bool {
+	if previous.Type != next.Type {
+		// everything can be represented as a string and a float can hold an int
+		switch {
+		case next.Type == schema.SchemaJsonTablesElemColumnsElemTypeString && next.MaxLength == nil:
+			return false
+		case previous.Type == schema.SchemaJsonTablesElemColumnsElemTypeInt && next.Type == schema.SchemaJsonTablesElemColumnsElemTypeFloat:
+			return false
+		}
+		return true
+	}
+	if next.MaxLength != nil && (previous.MaxLength == nil || *next.MaxLength < *previous.MaxLength) {
+		return true
+	}
+	if next.Length != nil && previous.Length != nil {
+		if next.Length.Precision < previous.Length.Precision {
+			return true
+		}
+		if next.Length.Scale != nil && (previous.Length.Scale == nil || *next.Length.Scale < *previous.Length.Scale) {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns the hazards of applying a change, none if the change is safe. The changes which are made without
+// long locks by the online statements aren't blocking when they're used.
+func Classify(driver schema.DatabaseDriverType, changeset migrator.MigrateChanges, opts ...Option) []Hazard {
+	var hazards []Hazard
+	add := func(risk Risk, column string, format string, args ...any) {
+		hazards = append(hazards, Hazard{Risk: risk, Table: changeset.Table, Column: column, Reason: fmt.Sprintf(format, args...)})
+	}
+	switch changeset.Change {
+	case migrator.DropTable:
+		add(RiskDestructive, "", "drops table %s and its data", changeset.Table)
+	case migrator.AlterTable:
+		generator := migrator.GetGenerator(string(driver))
+		if _, ok := generator.(migrator.TableRebuilder); ok && needsRebuild(changeset) {
+			add(RiskBlocking, "", "rebuilds table %s to change it", changeset.Table)
+		}
+		alterGenerator := newOptions(opts).alterGenerator(generator)
+		online := alterGenerator != generator
+		for _, column := range changeset.Columns {
+			switch column.Change {
+			case migrator.DropColumn:
+				add(RiskDestructive, column.Name, "drops column %s from %s and its data", column.Name, changeset.Table)
+			case migrator.AlterColumn:
+				for _, change := range column.Changes {
+					switch change {
+					case migrator.ColumnTypeChanged:
+						if narrowsType(column.Previous, column.Ref) {
+							add(RiskDestructive, column.Name, "changes column %s of %s from %s to %s which can lose data", column.Name, changeset.Table, column.Previous.Type, column.Ref.Type)
+						} else if !swapsColumn(alterGenerator, changeset, column) {
+							add(RiskBlocking, column.Name, "changes the type of column %s of %s which rewrites the table", column.Name, changeset.Table)
+						}
+					case migrator.ColumnNullableChanged:
+						if !online && (column.Ref.Nullable == nil || !*column.Ref.Nullable) {
+							add(RiskBlocking, column.Name, "makes column %s of %s not null which scans the table", column.Name, changeset.Table)
+						}
+					}
+				}
+			}
+		}
+		for _, index := range changeset.Indexes {
+			if !online && (index.Change == migrator.CreateIndex || index.Change == migrator.AlterIndex) {
+				add(RiskBlocking, "", "creates index %s on %s which blocks writes while it's built", index.Name, changeset.Table)
+			}
+		}
+		for _, fk := range changeset.ForeignKeys {
+			if !online && fk.Change == migrator.CreateForeignKey {
+				add(RiskBlocking, fk.Column, "adds foreign key %s to %s which scans the table", fk.Name, changeset.Table)
+			}
+		}
+		for _, constraint := range changeset.Constraints {
+			if constraint.Change == migrator.CreateConstraint && !constraint.NotValid && (!online || constraint.Type == migrator.PrimaryKeyConstraint) {
+				add(RiskBlocking, "", "adds %s constraint to %s which scans the table", constraint.Type, changeset.Table)
+			}
+		}
+	}
+	return hazards
+}
+
+// HighestRisk returns the highest risk of the hazards
+func HighestRisk(hazards []Hazard) Risk {
+	risk := RiskSafe
+	for _, hazard := range hazards {
+		risk = max(risk, hazard.Risk)
+	}
+	return risk
+}
+
+// AllowedDrop returns true if the schema allows the destructive change of the hazard. The tables and columns which are
+// removed from the schema are allowed to be dropped by declaring them in its drops and the changes to the ones which
+// remain by an allowDrop annotation on the table or the column.
+func AllowedDrop(dbschema *schema.SchemaJson, hazard Hazard) bool {
+	for _, drop := range dbschema.Drops {
+		// dropping the table allows the changes to its columns too
+		if drop.Table == hazard.Table && (drop.Column == nil || *drop.Column == hazard.Column) {
+			return true
+		}
+	}
+	table := schema.FindTable(dbschema.Tables, hazard.Table)
+	if table == nil {
+		return false
+	}
+	if table.AllowDrop != nil && *table.AllowDrop {
+		return true
+	}
+	if hazard.Column != "" {
+		for _, column := range table.Columns {
+			if column.Name == hazard.Column {
+				return column.AllowDrop != nil && *column.AllowDrop
+			}
+		}
+	}
+	return false
+}
+
+// Disallowed returns the hazards of the changes along with the destructive ones which the schema doesn't allow
+func Disallowed(driver schema.DatabaseDriverType, dbschema *schema.SchemaJson, changes []migrator.MigrateChanges, opts ...Option) ([]Hazard, []Hazard) {
+	var hazards, disallowed []Hazard
+	for _, changeset := range changes {
+		for _, hazard := range Classify(driver, changeset, opts...) {
+			hazards = append(hazards, hazard)
+			if hazard.Risk == RiskDestructive && !AllowedDrop(dbschema, hazard) {
+				disallowed = append(disallowed, hazard)
+			}
+		}
+	}
+	return hazards, disallowed
+}
+
+// DestructiveError is returned when the database changed while a migration was waiting for the lock and the changes
+// which remain are destructive in ways which weren't checked before it started
+type DestructiveError struct {
+	Hazards []Hazard
+}
+
+func (e *DestructiveError) Error() string {
+	var msg strings.Builder
+	msg.WriteString("aborting since the database changed while waiting for the migration lock and the changes which remain are destructive without being checked:")
+	for _, hazard := range e.Hazards {
+		msg.WriteString("\n  - ")
+		msg.WriteString(hazard.Reason)
+	}
+	return msg.String()
+}
@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNarrowsType(t *testing.T) {
+	column := func(t schema.SchemaJsonTablesElemColumnsElemType, maxLength *int) schema.SchemaJsonTablesElemColumnsElem {
+		return schema.SchemaJsonTablesElemColumnsElem{Type: t, MaxLength: maxLength}
+	}
+	assert.False(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeInt, nil), column(schema.SchemaJsonTablesElemColumnsElemTypeString, nil)))
+	assert.False(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeInt, nil), column(schema.SchemaJsonTablesElemColumnsElemTypeFloat, nil)))
+	assert.True(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeFloat, nil), column(schema.SchemaJsonTablesElemColumnsElemTypeInt, nil)))
+	assert.True(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeString, nil), column(schema.SchemaJsonTablesElemColumnsElemTypeInt, nil)))
+	assert.True(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeString, util.Ptr(255)), column(schema.SchemaJsonTablesElemColumnsElemTypeString, util.Ptr(100))))
+	assert.True(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeString, nil), column(schema.SchemaJsonTablesElemColumnsElemTypeString, util.Ptr(100))))
+	assert.False(t, narrowsType(column(schema.SchemaJsonTablesElemColumnsElemTypeString, util.Ptr(100)), column(schema.SchemaJsonTablesElemColumnsElemTypeString, util.Ptr(255))))
+	assert.True(t, narrowsType(
+		schema.SchemaJsonTablesElemColumnsElem{Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat, Length: &schema.SchemaJsonTablesElemColumnsElemLength{Precision: 10, Scale: util.Ptr(2.0)}},
+		schema.SchemaJsonTablesElemColumnsElem{Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat, Length: &schema.SchemaJsonTablesElemColumnsElemLength{Precision: 10, Scale: util.Ptr(0.0)}},
+	))
+}
+
+func TestClassify(t *testing.T) {
+	assert.Empty(t, Classify(schema.DatabaseDriverPostgres, migrator.MigrateChanges{Change: migrator.CreateTable, Table: "users"}))
+	assert.Equal(t, []Hazard{
+		{Risk: RiskDestructive, Table: "users", Reason: "drops table users and its data"},
+	}, Classify(schema.DatabaseDriverPostgres, migrator.MigrateChanges{Change: migrator.DropTable, Table: "users"}))
+
+	hazards := Classify(schema.DatabaseDriverPostgres, migrator.MigrateChanges{
+		Change: migrator.AlterTable,
+		Table:  "users",
+		Columns: []migrator.MigrateColumn{
+			{Change: migrator.CreateColumn, Name: "email"},
+			{Change: migrator.DropColumn, Name: "nickname"},
+			{
+				Change:   migrator.AlterColumn,
+				Name:     "age",
+				Changes:  []migrator.MigrateColumnChangeTypeType{migrator.ColumnTypeChanged, migrator.ColumnNullableChanged},
+				Previous: schema.SchemaJsonTablesElemColumnsElem{Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Nullable: util.Ptr(true)},
+				Ref:      schema.SchemaJsonTablesElemColumnsElem{Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat},
+			},
+		},
+		Indexes:     []migrator.MigrateIndex{{Change: migrator.CreateIndex, Name: "users_email_idx"}, {Change: migrator.DropIndex, Name: "users_age_idx"}},
+		ForeignKeys: []migrator.MigrateForeignKey{{Change: migrator.CreateForeignKey, Name: "users_org_id_fkey", Column: "org_id"}},
+		Constraints: []migrator.MigrateConstraint{
+			{Change: migrator.CreateConstraint, Type: migrator.CheckConstraint},
+			{Change: migrator.CreateConstraint, Type: migrator.CheckConstraint, NotValid: true},
+		},
+	})
+	assert.Equal(t, []Hazard{
+		{Risk: RiskDestructive, Table: "users", Column: "nickname", Reason: "drops column nickname from users and its data"},
+		{Risk: RiskBlocking, Table: "users", Column: "age", Reason: "changes the type of column age of users which rewrites the table"},
+		{Risk: RiskBlocking, Table: "users", Column: "age", Reason: "makes column age of users not null which scans the table"},
+		{Risk: RiskBlocking, Table: "users", Reason: "creates index users_email_idx on users which blocks writes while it's built"},
+		{Risk: RiskBlocking, Table: "users", Column: "org_id", Reason: "adds foreign key users_org_id_fkey to users which scans the table"},
+		{Risk: RiskBlocking, Table: "users", Reason: "adds check constraint to users which scans the table"},
+	}, hazards)
+	assert.Equal(t, RiskDestructive, HighestRisk(hazards))
+	assert.Equal(t, RiskBlocking, HighestRisk(hazards[1:]))
+	assert.Equal(t, RiskSafe, HighestRisk(nil))
+	assert.Equal(t, "[destructive] drops column nickname from users and its data", hazards[0].String())
+}
+
+func TestAllowedDrop(t *testing.T) {
+	dbschema := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "nickname", AllowDrop: util.Ptr(true)}, {Name: "age"}}},
+			{Name: "orders", AllowDrop: util.Ptr(true)},
+		},
+	}
+	assert.True(t, AllowedDrop(dbschema, Hazard{Risk: RiskDestructive, Table: "users", Column: "nickname"}))
+	assert.False(t, AllowedDrop(dbschema, Hazard{Risk: RiskDestructive, Table: "users", Column: "age"}))
+	assert.False(t, AllowedDrop(dbschema, Hazard{Risk: RiskDestructive, Table: "users", Column: "email"}))
+	assert.True(t, AllowedDrop(dbschema, Hazard{Risk: RiskDestructive, Table: "orders", Column: "total"}))
+	assert.False(t, AllowedDrop(dbschema, Hazard{Risk: RiskDestructive, Table: "items"}))
+}
+
+func TestAllowedDropDeclared(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "nickname", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+				{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+			}},
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}}},
+			{Name: "items", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				// the annotation of a column which is kept doesn't allow dropping the others
+				{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, AllowDrop: util.Ptr(true)},
+			}},
+		},
+		Drops: []schema.SchemaJsonDropsElem{{Table: "orders"}, {Table: "users", Column: util.Ptr("nickname")}, {Table: "items", Column: util.Ptr("id")}},
+	}
+	changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	allowed := make(map[string]bool)
+	for _, changeset := range changes {
+		for _, hazard := range Classify(schema.DatabaseDriverPostgres, changeset) {
+			if hazard.Risk == RiskDestructive {
+				allowed[hazard.Reason] = AllowedDrop(to, hazard)
+			}
+		}
+	}
+	assert.Equal(t, map[string]bool{
+		"drops column nickname from users and its data": true,
+		"drops table orders and its data":               true,
+		"drops table items and its data":                false, // only a column of the table is declared
+	}, allowed)
+
+	// the drops are read from the schema document, which requires the table of each
+	var drops []schema.SchemaJsonDropsElem
+	assert.NoError(t, json.Unmarshal([]byte(`[{"table": "orders"}, {"table": "users", "column": "nickname"}]`), &drops))
+	assert.Equal(t, to.Drops[:2], drops)
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"column": "nickname"}`), &schema.SchemaJsonDropsElem{}), "field table in SchemaJsonDropsElem: required")
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"maps"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/fatih/color"
@@ -75,12 +78,12 @@ func toNativeType(nt *schema.SchemaJsonTablesElemColumnsElemNativeType) string {
 	return "NULL"
 }
 
-func diffColumn(from schema.SchemaJsonTablesElemColumnsElem, to schema.SchemaJsonTablesElemColumnsElem) (*migrator.MigrateColumn, error) {
+func diffColumn(driver schema.DatabaseDriverType, from schema.SchemaJsonTablesElemColumnsElem, to schema.SchemaJsonTablesElemColumnsElem) (*migrator.MigrateColumn, error) {
 	var changes []migrator.MigrateColumnChangeTypeType
-	if toNativeType(from.NativeType) != toNativeType(to.NativeType) {
+	if safeNil(schema.FromNativeType(driver, from.NativeType)) != safeNil(schema.FromNativeType(driver, to.NativeType)) {
 		changes = append(changes, migrator.ColumnTypeChanged)
 	}
-	if pointerChanged(toDefaultType(from.Default), toDefaultType(to.Default)) {
+	if pointerChanged(schema.FromNativeDefault(driver, from.Default), schema.FromNativeDefault(driver, to.Default)) {
 		changes = append(changes, migrator.ColumnDefaultChanged)
 	}
 	if pointerChanged(from.Description, to.Description) {
@@ -89,12 +92,7 @@ func diffColumn(from schema.SchemaJsonTablesElemColumnsElem, to schema.SchemaJso
 	if safeBoolNil(from.Nullable) != safeBoolNil(to.Nullable) && from.Nullable != nil && to.Nullable != nil {
 		changes = append(changes, migrator.ColumnNullableChanged)
 	}
-	if safeBoolNil(from.PrimaryKey) != safeBoolNil(to.PrimaryKey) && from.PrimaryKey != nil && to.PrimaryKey != nil {
-		return nil, fmt.Errorf("you cannot change the PRIMARY KEY of a column")
-	}
-	if safeBoolNil(from.Unique) != safeBoolNil(to.Unique) {
-		return nil, fmt.Errorf("you cannot change the UNIQUE consraint of a column")
-	}
+	// primary key and unique changes are handled as table constraint changes by diffConstraints
 	if safeBoolNil(from.AutoIncrement) != safeBoolNil(to.AutoIncrement) && from.AutoIncrement != nil && to.AutoIncrement != nil {
 		return nil, fmt.Errorf("you cannot change the AUTO INCREMENT of a column")
 	}
@@ -111,6 +109,522 @@ func diffColumn(from schema.SchemaJsonTablesElemColumnsElem, to schema.SchemaJso
 	return nil, nil
 }
 
+var castRegex = regexp.MustCompile(`::[a-z_]+( varying| precision| with(out)? time zone)?(\[\])?`)
+var expressionStripRegex = regexp.MustCompile("[\\s()`\"]")
+
+// normalizeExpression returns a loose form of a sql expression for comparison since databases will rewrite the
+// expression they were given (adding casts, parens and quotes) when returning it
+func normalizeExpression(val *string) string {
+	if val == nil {
+		return ""
+	}
+	s := strings.ToLower(*val)
+	s = castRegex.ReplaceAllString(s, "")
+	return expressionStripRegex.ReplaceAllString(s, "")
+}
+
+func indexMethod(index schema.SchemaJsonTablesElemIndexesElem) string {
+	if index.Method == nil {
+		return string(schema.SchemaJsonTablesElemIndexesElemMethodBtree)
+	}
+	return string(*index.Method)
+}
+
+func indexColumnOrder(column schema.SchemaJsonTablesElemIndexesElemColumnsElem) string {
+	if column.Order == nil {
+		return string(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderAsc)
+	}
+	return string(*column.Order)
+}
+
+func indexChanged(from schema.SchemaJsonTablesElemIndexesElem, to schema.SchemaJsonTablesElemIndexesElem) bool {
+	if (from.Unique != nil && *from.Unique) != (to.Unique != nil && *to.Unique) {
+		return true
+	}
+	if indexMethod(from) != indexMethod(to) {
+		return true
+	}
+	if normalizeExpression(from.Where) != normalizeExpression(to.Where) {
+		return true
+	}
+	if normalizeExpression(from.Expression) != normalizeExpression(to.Expression) {
+		return true
+	}
+	if len(from.Columns) != len(to.Columns) {
+		return true
+	}
+	for i, column := range from.Columns {
+		if column.Name != to.Columns[i].Name || indexColumnOrder(column) != indexColumnOrder(to.Columns[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffIndexes returns the index changes required to go from the from indexes to the to indexes
+func diffIndexes(from []schema.SchemaJsonTablesElemIndexesElem, to []schema.SchemaJsonTablesElemIndexesElem) []migrator.MigrateIndex {
+	var changes []migrator.MigrateIndex
+	processed := make(map[string]bool)
+	for _, toIndex := range to {
+		processed[toIndex.Name] = true
+		var found bool
+		for _, fromIndex := range from {
+			if fromIndex.Name == toIndex.Name {
+				found = true
+				if indexChanged(fromIndex, toIndex) {
+					changes = append(changes, migrator.MigrateIndex{
+						Change:   migrator.AlterIndex,
+						Name:     toIndex.Name,
+						Ref:      toIndex,
+						Previous: fromIndex,
+					})
+				}
+				break
+			}
+		}
+		if !found {
+			changes = append(changes, migrator.MigrateIndex{
+				Change: migrator.CreateIndex,
+				Name:   toIndex.Name,
+				Ref:    toIndex,
+			})
+		}
+	}
+	for _, fromIndex := range from {
+		if !processed[fromIndex.Name] {
+			changes = append(changes, migrator.MigrateIndex{
+				Change: migrator.DropIndex,
+				Name:   fromIndex.Name,
+				Ref:    fromIndex,
+			})
+		}
+	}
+	return changes
+}
+
+func referenceAction[T ~string](val *T) string {
+	if val == nil {
+		return string(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteNoAction)
+	}
+	return string(*val)
+}
+
+func foreignKeyChanged(from schema.SchemaJsonTablesElemColumnsElemReferences, to schema.SchemaJsonTablesElemColumnsElemReferences) bool {
+	if from.Table != to.Table || from.Column != to.Column {
+		return true
+	}
+	if referenceAction(from.OnDelete) != referenceAction(to.OnDelete) || referenceAction(from.OnUpdate) != referenceAction(to.OnUpdate) {
+		return true
+	}
+	if (from.Deferrable != nil && *from.Deferrable) != (to.Deferrable != nil && *to.Deferrable) {
+		return true
+	}
+	// only compare the names when both are set since a constraint created outside of shift may have a different name
+	if from.Name != nil && to.Name != nil && *from.Name != *to.Name {
+		return true
+	}
+	return false
+}
+
+// diffForeignKeys returns the foreign key changes required to go from the from table to the to table. a changed
+// foreign key is dropped and added again since constraints can't be altered in place
+func diffForeignKeys(from schema.SchemaJsonTablesElem, to schema.SchemaJsonTablesElem) []migrator.MigrateForeignKey {
+	var changes []migrator.MigrateForeignKey
+	fromRefs := make(map[string]schema.SchemaJsonTablesElemColumnsElemReferences)
+	for _, col := range from.Columns {
+		if col.References != nil {
+			fromRefs[col.Name] = *col.References
+		}
+	}
+	processed := make(map[string]bool)
+	for _, col := range to.Columns {
+		if col.References == nil {
+			continue
+		}
+		processed[col.Name] = true
+		if ref, ok := fromRefs[col.Name]; ok {
+			if !foreignKeyChanged(ref, *col.References) {
+				continue
+			}
+			changes = append(changes, migrator.MigrateForeignKey{
+				Change: migrator.DropForeignKey,
+				Name:   schema.ForeignKeyName(from.Name, col.Name, ref),
+				Column: col.Name,
+				Ref:    ref,
+			})
+		}
+		changes = append(changes, migrator.MigrateForeignKey{
+			Change: migrator.CreateForeignKey,
+			Name:   schema.ForeignKeyName(to.Name, col.Name, *col.References),
+			Column: col.Name,
+			Ref:    *col.References,
+		})
+	}
+	for _, col := range from.Columns {
+		if col.References != nil && !processed[col.Name] {
+			changes = append(changes, migrator.MigrateForeignKey{
+				Change: migrator.DropForeignKey,
+				Name:   schema.ForeignKeyName(from.Name, col.Name, *col.References),
+				Column: col.Name,
+				Ref:    *col.References,
+			})
+		}
+	}
+	return changes
+}
+
+// diffConstraints returns the primary key, unique and check constraint changes required to go from the from table to
+// the to table. a changed constraint is dropped and added again since constraints can't be altered in place
+func diffConstraints(from schema.SchemaJsonTablesElem, to schema.SchemaJsonTablesElem) []migrator.MigrateConstraint {
+	var changes []migrator.MigrateConstraint
+	fromPrimaryKey := schema.TablePrimaryKey(from)
+	toPrimaryKey := schema.TablePrimaryKey(to)
+	if !slices.Equal(fromPrimaryKey, toPrimaryKey) {
+		if len(fromPrimaryKey) > 0 {
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:  migrator.DropConstraint,
+				Type:    migrator.PrimaryKeyConstraint,
+				Columns: fromPrimaryKey,
+			})
+		}
+		if len(toPrimaryKey) > 0 {
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:  migrator.CreateConstraint,
+				Type:    migrator.PrimaryKeyConstraint,
+				Columns: toPrimaryKey,
+			})
+		}
+	}
+	fromUniques := schema.TableUniqueConstraints(from)
+	processed := make(map[string]bool)
+	for _, toUnique := range schema.TableUniqueConstraints(to) {
+		processed[toUnique.Name] = true
+		i := slices.IndexFunc(fromUniques, func(unique schema.SchemaJsonTablesElemUniqueConstraintsElem) bool {
+			return unique.Name == toUnique.Name
+		})
+		if i >= 0 {
+			if slices.Equal(fromUniques[i].Columns, toUnique.Columns) {
+				continue
+			}
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:  migrator.DropConstraint,
+				Type:    migrator.UniqueConstraint,
+				Name:    fromUniques[i].Name,
+				Columns: fromUniques[i].Columns,
+			})
+		}
+		changes = append(changes, migrator.MigrateConstraint{
+			Change:  migrator.CreateConstraint,
+			Type:    migrator.UniqueConstraint,
+			Name:    toUnique.Name,
+			Columns: toUnique.Columns,
+		})
+	}
+	for _, fromUnique := range fromUniques {
+		if !processed[fromUnique.Name] {
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:  migrator.DropConstraint,
+				Type:    migrator.UniqueConstraint,
+				Name:    fromUnique.Name,
+				Columns: fromUnique.Columns,
+			})
+		}
+	}
+	return append(changes, diffChecks(from, to)...)
+}
+
+// diffChecks returns the check constraint changes which are matched by name and compared using the normalized
+// expression since the database rewrites the expression it was given
+func diffChecks(from schema.SchemaJsonTablesElem, to schema.SchemaJsonTablesElem) []migrator.MigrateConstraint {
+	var changes []migrator.MigrateConstraint
+	fromChecks := schema.TableChecks(from)
+	processed := make(map[string]bool)
+	for _, toCheck := range schema.TableChecks(to) {
+		processed[toCheck.Name] = true
+		i := slices.IndexFunc(fromChecks, func(check schema.SchemaJsonTablesElemChecksElem) bool {
+			return check.Name == toCheck.Name
+		})
+		if i >= 0 {
+			if normalizeExpression(&fromChecks[i].Expression) == normalizeExpression(&toCheck.Expression) {
+				continue
+			}
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:     migrator.DropConstraint,
+				Type:       migrator.CheckConstraint,
+				Name:       fromChecks[i].Name,
+				Expression: fromChecks[i].Expression,
+			})
+		}
+		changes = append(changes, migrator.MigrateConstraint{
+			Change:     migrator.CreateConstraint,
+			Type:       migrator.CheckConstraint,
+			Name:       toCheck.Name,
+			Expression: toCheck.Expression,
+			NotValid:   toCheck.NotValid != nil && *toCheck.NotValid,
+		})
+	}
+	for _, fromCheck := range fromChecks {
+		if !processed[fromCheck.Name] {
+			changes = append(changes, migrator.MigrateConstraint{
+				Change:     migrator.DropConstraint,
+				Type:       migrator.CheckConstraint,
+				Name:       fromCheck.Name,
+				Expression: fromCheck.Expression,
+			})
+		}
+	}
+	return changes
+}
+
+// diffEnumValues returns the values which need to be added to the from enum to match the to enum. postgres can only
+// add values to an existing enum so removing or reordering the values is an error.
+func diffEnumValues(from schema.SchemaJsonEnumsElem, to schema.SchemaJsonEnumsElem) ([]migrator.MigrateEnumValue, error) {
+	var res []migrator.MigrateEnumValue
+	var offset int
+	for i, value := range to.Values {
+		if offset < len(from.Values) && from.Values[offset] == value {
+			offset++
+			continue
+		}
+		if slices.Contains(from.Values, value) {
+			return nil, fmt.Errorf("enum %s can't reorder the value %s", to.Name, value)
+		}
+		change := migrator.MigrateEnumValue{Value: value}
+		switch {
+		case i == 0 && len(to.Values) > 1:
+			change.Before = to.Values[1]
+		case i < len(to.Values)-1:
+			change.After = to.Values[i-1]
+		}
+		res = append(res, change)
+	}
+	if offset < len(from.Values) {
+		return nil, fmt.Errorf("enum %s can't remove the value %s", to.Name, from.Values[offset])
+	}
+	return res, nil
+}
+
+// diffEnums returns the enum changes needed which should be applied before the table changes and the enum drops which
+// should be applied after the table changes
+func diffEnums(from []schema.SchemaJsonEnumsElem, to []schema.SchemaJsonEnumsElem) ([]migrator.MigrateChanges, []migrator.MigrateChanges, error) {
+	var changes, drops []migrator.MigrateChanges
+	for _, toEnum := range to {
+		fromEnum := schema.FindEnum(from, toEnum.Name)
+		if fromEnum == nil {
+			changes = append(changes, migrator.MigrateChanges{
+				Change: migrator.CreateEnum,
+				Enum:   &migrator.MigrateEnum{Name: toEnum.Name, Ref: toEnum},
+			})
+			continue
+		}
+		values, err := diffEnumValues(*fromEnum, toEnum)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(values) > 0 {
+			changes = append(changes, migrator.MigrateChanges{
+				Change: migrator.AlterEnum,
+				Enum:   &migrator.MigrateEnum{Name: toEnum.Name, Ref: toEnum, Values: values},
+			})
+		}
+	}
+	for _, fromEnum := range from {
+		if schema.FindEnum(to, fromEnum.Name) == nil {
+			drops = append(drops, migrator.MigrateChanges{
+				Change: migrator.DropEnum,
+				Enum:   &migrator.MigrateEnum{Name: fromEnum.Name, Ref: fromEnum},
+			})
+		}
+	}
+	return changes, drops, nil
+}
+
+// renameTables returns a copy of the existing tables with the tables and columns renamed in the new schema renamed so
+// they're compared by their new name. The renamed tables are returned keyed by the new qualified name with the previous
+// qualified name and the renamed columns keyed by the new qualified table name and the previous column name with the
+// new column name. A rename is skipped once the new name exists since it has already been applied.
+func renameTables(from []schema.SchemaJsonTablesElem, to []schema.SchemaJsonTablesElem) ([]schema.SchemaJsonTablesElem, map[string]string, map[string]map[string]string) {
+	tables := make([]schema.SchemaJsonTablesElem, len(from))
+	existing := make(map[string]int)
+	for i, table := range from {
+		table.Columns = slices.Clone(table.Columns)
+		for c, col := range table.Columns {
+			if col.References != nil {
+				ref := *col.References
+				table.Columns[c].References = &ref
+			}
+		}
+		table.Indexes = slices.Clone(table.Indexes)
+		for x, index := range table.Indexes {
+			table.Indexes[x].Columns = slices.Clone(index.Columns)
+		}
+		table.PrimaryKey = slices.Clone(table.PrimaryKey)
+		table.UniqueConstraints = slices.Clone(table.UniqueConstraints)
+		for u, unique := range table.UniqueConstraints {
+			table.UniqueConstraints[u].Columns = slices.Clone(unique.Columns)
+		}
+		tables[i] = table
+		existing[schema.TableQualifiedName(table)] = i
+	}
+	tableRenames := make(map[string]string)
+	columnRenames := make(map[string]map[string]string)
+	for _, table := range to {
+		name := schema.TableQualifiedName(table)
+		i, ok := existing[name]
+		if !ok {
+			previous := schema.TableRenamedFrom(table)
+			if i, ok = existing[previous]; previous == "" || !ok {
+				continue
+			}
+			delete(existing, previous)
+			tableRenames[name] = previous
+			tables[i].Name = table.Name
+		}
+		for _, col := range table.Columns {
+			if col.RenamedFrom == nil || slices.ContainsFunc(tables[i].Columns, func(c schema.SchemaJsonTablesElemColumnsElem) bool { return c.Name == col.Name }) {
+				continue
+			}
+			c := slices.IndexFunc(tables[i].Columns, func(c schema.SchemaJsonTablesElemColumnsElem) bool { return c.Name == *col.RenamedFrom })
+			if c < 0 {
+				continue
+			}
+			if columnRenames[name] == nil {
+				columnRenames[name] = make(map[string]string)
+			}
+			columnRenames[name][*col.RenamedFrom] = col.Name
+			tables[i].Columns[c].Name = col.Name
+		}
+	}
+	// the indexes, keys and references which use a renamed table or column are renamed along with it
+	renameColumn := func(table string, column string) string {
+		if name, ok := columnRenames[table][column]; ok {
+			return name
+		}
+		return column
+	}
+	previousTables := make(map[string]string)
+	for name, previous := range tableRenames {
+		previousTables[previous] = name
+	}
+	for _, table := range tables {
+		name := schema.TableQualifiedName(table)
+		for x, index := range table.Indexes {
+			for c, col := range index.Columns {
+				table.Indexes[x].Columns[c].Name = renameColumn(name, col.Name)
+			}
+		}
+		for c, col := range table.PrimaryKey {
+			table.PrimaryKey[c] = renameColumn(name, col)
+		}
+		for _, unique := range table.UniqueConstraints {
+			for c, col := range unique.Columns {
+				unique.Columns[c] = renameColumn(name, col)
+			}
+		}
+		for _, col := range table.Columns {
+			if col.References == nil {
+				continue
+			}
+			if refTable, ok := previousTables[col.References.Table]; ok {
+				col.References.Table = refTable
+			}
+			col.References.Column = renameColumn(col.References.Table, col.References.Column)
+		}
+	}
+	return tables, tableRenames, columnRenames
+}
+
+// likelyColumnRenames marks the created columns which look to be a rename of a dropped column since the dropped column
+// has the same type and was in the same position
+func likelyColumnRenames(from []schema.SchemaJsonTablesElemColumnsElem, to []schema.SchemaJsonTablesElemColumnsElem, changes []migrator.MigrateColumn) {
+	dropped := make(map[string]bool)
+	for _, change := range changes {
+		if change.Change == migrator.DropColumn {
+			dropped[change.Name] = true
+		}
+	}
+	for i, change := range changes {
+		if change.Change != migrator.CreateColumn {
+			continue
+		}
+		position := slices.IndexFunc(to, func(col schema.SchemaJsonTablesElemColumnsElem) bool { return col.Name == change.Name })
+		if position < len(from) && dropped[from[position].Name] && from[position].Type == change.Ref.Type {
+			changes[i].LikelyRenamedFrom = from[position].Name
+		}
+	}
+}
+
+// sameColumns returns true if the tables have the same columns by name and type in the same order
+func sameColumns(a schema.SchemaJsonTablesElem, b schema.SchemaJsonTablesElem) bool {
+	return slices.EqualFunc(a.Columns, b.Columns, func(x schema.SchemaJsonTablesElemColumnsElem, y schema.SchemaJsonTablesElemColumnsElem) bool {
+		return x.Name == y.Name && x.Type == y.Type
+	})
+}
+
+// likelyTableRenames marks the created tables which look to be a rename of a dropped table in the same schema since
+// they have the same columns and no other created or dropped table does
+func likelyTableRenames(drops []migrator.MigrateChanges, creates []migrator.MigrateChanges) {
+	matches := func(a migrator.MigrateChanges, b migrator.MigrateChanges) bool {
+		return safeNil(a.Ref.Schema) == safeNil(b.Ref.Schema) && sameColumns(a.Ref, b.Ref)
+	}
+	for i, created := range creates {
+		var candidates []migrator.MigrateChanges
+		for _, dropped := range drops {
+			if matches(created, dropped) {
+				candidates = append(candidates, dropped)
+			}
+		}
+		if len(candidates) != 1 {
+			continue
+		}
+		var count int
+		for _, other := range creates {
+			if matches(other, candidates[0]) {
+				count++
+			}
+		}
+		if count == 1 {
+			creates[i].LikelyRenamedFrom = candidates[0].Ref.Name
+		}
+	}
+}
+
+// sortByDependencies returns the table changes ordered so a table comes after the tables in the changes it references
+// with a foreign key. The changes are expected in name order which is kept for the tables which don't depend on each
+// other or are part of a cycle.
+func sortByDependencies(changes []migrator.MigrateChanges) []migrator.MigrateChanges {
+	tables := make(map[string]bool)
+	for _, changeset := range changes {
+		tables[changeset.Table] = true
+	}
+	ready := func(changeset migrator.MigrateChanges, added map[string]bool) bool {
+		for _, col := range changeset.Ref.Columns {
+			if col.References != nil && col.References.Table != changeset.Table && tables[col.References.Table] && !added[col.References.Table] {
+				return false
+			}
+		}
+		return true
+	}
+	res := make([]migrator.MigrateChanges, 0, len(changes))
+	added := make(map[string]bool)
+	for len(res) < len(changes) {
+		next := -1
+		for i, changeset := range changes {
+			if !added[changeset.Table] && ready(changeset, added) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			// a cycle so take the first remaining table since the foreign keys are added after the tables anyway
+			next = slices.IndexFunc(changes, func(changeset migrator.MigrateChanges) bool { return !added[changeset.Table] })
+		}
+		res = append(res, changes[next])
+		added[changes[next].Table] = true
+	}
+	return res
+}
+
 func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.SchemaJson, from *schema.SchemaJson) ([]migrator.MigrateChanges, error) {
 	processedTables := make(map[string]bool)
 	var res []migrator.MigrateChanges
@@ -119,14 +633,46 @@ func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.Sch
 	fromTables := make(map[string]*schema.SchemaJsonTablesElem)
 	toTables := make(map[string]*schema.SchemaJsonTablesElem)
 
-	for _, table := range from.Tables {
-		fromTables[table.Name] = &table
+	// the tables are keyed by their qualified name since tables in different schemas can have the same name
+	fromRenamed, tableRenames, columnRenames := renameTables(from.Tables, to.Tables)
+	for _, table := range fromRenamed {
+		fromTables[schema.TableQualifiedName(table)] = &table
 	}
 	for _, table := range to.Tables {
-		toTables[table.Name] = &table
+		toTables[schema.TableQualifiedName(table)] = &table
+	}
+
+	// the schemas are created first since the tables are created in them, they're never dropped since they may
+	// contain objects which aren't managed
+	fromNamespaces := schema.Namespaces(from)
+	for _, namespace := range schema.Namespaces(to) {
+		if !slices.Contains(fromNamespaces, namespace) {
+			logger.Debug("found schema %s to be missing, need to create", namespace)
+			res = append(res, migrator.MigrateChanges{
+				Change:    migrator.CreateNamespace,
+				Namespace: namespace,
+			})
+		}
 	}
 
-	for table, detail := range fromTables {
+	// only postgres has enum types, the other databases define the enum values inline with the column
+	var enumDrops []migrator.MigrateChanges
+	if driver == schema.DatabaseDriverPostgres {
+		var enumChanges []migrator.MigrateChanges
+		enumChanges, enumDrops, err = diffEnums(from.Enums, to.Enums)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range append(enumChanges, enumDrops...) {
+			logger.Debug("enum %s needs %s", change.Enum.Name, change.Change)
+		}
+		res = append(res, enumChanges...)
+	}
+
+	// the tables are compared in name order and the changes are grouped by type so the plan is the same each time
+	var drops, creates, alters []migrator.MigrateChanges
+	for _, table := range slices.Sorted(maps.Keys(fromTables)) {
+		detail := fromTables[table]
 		if ref, ok := toTables[table]; ok {
 			processedTables[table] = true
 			logger.Debug("found table %s to already exist, need to validate", table)
@@ -138,6 +684,26 @@ func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.Sch
 					To:   ref.Description,
 				}
 			}
+			if previous, ok := tableRenames[table]; ok {
+				logger.Debug("table %s renamed from %s", table, previous)
+			}
+			// the renames come first since the other changes use the new name of the column
+			for _, toColumn := range ref.Columns {
+				if toColumn.RenamedFrom != nil && columnRenames[table][*toColumn.RenamedFrom] == toColumn.Name {
+					logger.Debug("column %s renamed from %s for %s", toColumn.Name, *toColumn.RenamedFrom, table)
+					var previous schema.SchemaJsonTablesElemColumnsElem
+					if i := slices.IndexFunc(detail.Columns, func(col schema.SchemaJsonTablesElemColumnsElem) bool { return col.Name == toColumn.Name }); i >= 0 {
+						previous = detail.Columns[i]
+					}
+					previous.Name = *toColumn.RenamedFrom
+					changes = append(changes, migrator.MigrateColumn{
+						Change:   migrator.RenameColumn,
+						Name:     toColumn.Name,
+						Ref:      toColumn,
+						Previous: previous,
+					})
+				}
+			}
 			processedColumns := make(map[string]bool)
 			for _, toColumn := range ref.Columns {
 				processedColumns[toColumn.Name] = true
@@ -146,7 +712,7 @@ func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.Sch
 				for _, fromColumn := range detail.Columns {
 					if fromColumn.Name == toColumn.Name {
 						found = true
-						changedRef, err = diffColumn(fromColumn, toColumn)
+						changedRef, err = diffColumn(driver, fromColumn, toColumn)
 						if err != nil {
 							return nil, fmt.Errorf("column %s for table %s encountered an error: %s", table, toColumn.Name, err)
 						}
@@ -178,26 +744,40 @@ func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.Sch
 					})
 				}
 			}
-			if len(changes) > 0 {
-				res = append(res, migrator.MigrateChanges{
+			likelyColumnRenames(detail.Columns, ref.Columns, changes)
+			for _, change := range changes {
+				if change.LikelyRenamedFrom != "" {
+					logger.Warn("column %s for %s looks to be renamed from %s, set renamedFrom on the column to rename it instead of dropping it", change.Name, table, change.LikelyRenamedFrom)
+				}
+			}
+			indexes := diffIndexes(detail.Indexes, ref.Indexes)
+			for _, index := range indexes {
+				logger.Debug("index %s needs %s for %s", index.Name, index.Change, table)
+			}
+			foreignKeys := diffForeignKeys(*detail, *ref)
+			for _, fk := range foreignKeys {
+				logger.Debug("foreign key %s needs %s for %s", fk.Name, fk.Change, table)
+			}
+			constraints := diffConstraints(*detail, *ref)
+			for _, constraint := range constraints {
+				logger.Debug("%s constraint %s needs %s for %s", constraint.Type, constraint.Name, constraint.Change, table)
+			}
+			if len(changes) > 0 || len(indexes) > 0 || len(foreignKeys) > 0 || len(constraints) > 0 || descriptionChange != nil || tableRenames[table] != "" {
+				alters = append(alters, migrator.MigrateChanges{
 					Change:      migrator.AlterTable,
 					Table:       table,
 					Columns:     changes,
+					Indexes:     indexes,
+					ForeignKeys: foreignKeys,
+					Constraints: constraints,
 					Ref:         *detail,
 					Description: descriptionChange,
-				})
-			} else if descriptionChange != nil {
-				res = append(res, migrator.MigrateChanges{
-					Change:      migrator.AlterTable,
-					Table:       table,
-					Columns:     nil,
-					Ref:         *detail,
-					Description: descriptionChange,
+					RenamedFrom: tableRenames[table],
 				})
 			}
 		} else {
 			logger.Debug("found table %s to no longer exist, need to drop", table)
-			res = append(res, migrator.MigrateChanges{
+			drops = append(drops, migrator.MigrateChanges{
 				Change: migrator.DropTable,
 				Table:  table,
 				Ref:    *detail,
@@ -205,17 +785,87 @@ func Diff(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.Sch
 		}
 	}
 
-	for table, detail := range toTables {
+	for _, table := range slices.Sorted(maps.Keys(toTables)) {
+		detail := toTables[table]
 		if _, ok := processedTables[table]; !ok {
 			logger.Debug("found table %s to be missing, need to create", table)
-			res = append(res, migrator.MigrateChanges{
+			creates = append(creates, migrator.MigrateChanges{
 				Change: migrator.CreateTable,
 				Table:  table,
 				Ref:    *detail,
 			})
 		}
 	}
-	return res, nil
+	likelyTableRenames(drops, creates)
+	for _, change := range creates {
+		if change.LikelyRenamedFrom != "" {
+			logger.Warn("table %s looks to be renamed from %s, set renamedFrom on the table to rename it instead of dropping it", change.Table, change.LikelyRenamedFrom)
+		}
+	}
+	// the tables are dropped before the ones they reference and created after them, the foreign keys themselves are
+	// dropped first and added last when formatted
+	drops = sortByDependencies(drops)
+	slices.Reverse(drops)
+	res = append(res, drops...)
+	res = append(res, sortByDependencies(creates)...)
+	res = append(res, alters...)
+	return append(res, enumDrops...), nil
+}
+
+// Refresh recomputes the changes of a migration against the schema of the database. A migration calls it once it holds
+// the migration lock since another migration may have applied some or all of the changes while it was waiting. If the
+// migration has a fingerprint, ErrDrift is returned when the database schema no longer matches it and otherwise the
+// changes are kept as they were planned since the database is the one they were computed against. A DestructiveError
+// is returned when the changes have destructive ones which weren't in the changes the migration was started with and
+// which aren't allowed by the schema or the migration.
+func Refresh(args *migrator.MigratorArgs, driver schema.DatabaseDriverType) error {
+	if args.ToSchema == nil {
+		return nil
+	}
+	from, err := migrator.ToSchema(string(driver), migrator.ToSchemaArgs{
+		Context:    args.Context,
+		Logger:     args.Logger,
+		DB:         args.DB,
+		Namespaces: schema.Namespaces(args.ToSchema),
+	})
+	if err != nil {
+		return err
+	}
+	if args.Fingerprint != "" {
+		fingerprint, err := schema.Fingerprint(from)
+		if err != nil {
+			return err
+		}
+		if fingerprint != args.Fingerprint {
+			return migrator.ErrDrift
+		}
+		args.FromSchema = from
+		return nil
+	}
+	changes, err := Diff(args.Logger, driver, args.ToSchema, from)
+	if err != nil {
+		return err
+	}
+	if len(changes) != len(args.Diff) {
+		args.Logger.Warn("the database changed while waiting for the migration lock, %d of %d %s remain", len(changes), len(args.Diff), util.Plural(len(args.Diff), "change", "changes"))
+	}
+	if !args.AllowDestructive {
+		// the changes the migration was started with were checked (and confirmed) by the caller
+		checked, _ := Disallowed(driver, args.ToSchema, args.Diff, WithOnline(args.Online))
+		_, disallowed := Disallowed(driver, args.ToSchema, changes, WithOnline(args.Online))
+		var unchecked []Hazard
+		for _, hazard := range disallowed {
+			if !slices.Contains(checked, hazard) {
+				unchecked = append(unchecked, hazard)
+			}
+		}
+		if len(unchecked) > 0 {
+			return &DestructiveError{Hazards: unchecked}
+		}
+	}
+	args.FromSchema = from
+	args.Diff = changes
+	return nil
 }
 
 var (
@@ -241,27 +891,329 @@ const (
 	FormatSQL  DiffFormatType = "sql"
 )
 
-func FormatDiff(format DiffFormatType, driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, out io.Writer) error {
+func FormatDiff(format DiffFormatType, driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, out io.Writer, opts ...Option) error {
 	switch format {
 	case FormatText:
 		return formatTextDiff(changes, out)
 	case FormatSQL:
-		return formatSQLDiff(driver, changes, out)
+		return formatSQLDiff(driver, changes, out, newOptions(opts))
 	default:
 		return fmt.Errorf("unsupported diff format: %s", string(format))
 	}
 }
 
-func formatSQLDiff(driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, out io.Writer) error {
+// Difference is a change between the database and the schema in a form suited for reporting
+type Difference struct {
+	Change  string   `json:"change"`            // type of change such as create table
+	Name    string   `json:"name"`              // name of the table, enum or schema (namespace) changed
+	Details []string `json:"details,omitempty"` // changes to the parts of the table or enum
+}
+
+// Differences returns the differences for the changes
+func Differences(changes []migrator.MigrateChanges) []Difference {
+	differences := make([]Difference, 0, len(changes))
+	for _, changeset := range changes {
+		difference := Difference{Change: string(changeset.Change), Name: changeset.Name()}
+		if changeset.RenamedFrom != "" {
+			difference.Details = append(difference.Details, "renamed from "+changeset.RenamedFrom)
+		}
+		if changeset.Description != nil {
+			difference.Details = append(difference.Details, "description changed")
+		}
+		if changeset.Enum != nil {
+			for _, value := range changeset.Enum.Values {
+				difference.Details = append(difference.Details, "add value "+value.Value)
+			}
+		}
+		if changeset.Change == migrator.AlterTable {
+			for _, column := range changeset.Columns {
+				detail := fmt.Sprintf("%s %s", column.Change, column.Name)
+				switch column.Change {
+				case migrator.RenameColumn:
+					detail = fmt.Sprintf("%s %s to %s", column.Change, column.Previous.Name, column.Name)
+				case migrator.AlterColumn:
+					var columnChanges []string
+					for _, change := range column.Changes {
+						columnChanges = append(columnChanges, string(change))
+					}
+					detail += ": " + strings.Join(columnChanges, ", ")
+				}
+				difference.Details = append(difference.Details, detail)
+			}
+			for _, index := range changeset.Indexes {
+				difference.Details = append(difference.Details, fmt.Sprintf("%s %s", index.Change, index.Name))
+			}
+			for _, fk := range changeset.ForeignKeys {
+				difference.Details = append(difference.Details, fmt.Sprintf("%s %s", fk.Change, fk.Name))
+			}
+			for _, constraint := range changeset.Constraints {
+				difference.Details = append(difference.Details, strings.TrimSpace(fmt.Sprintf("%s %s %s", constraint.Change, constraint.Type, constraint.Name)))
+			}
+		}
+		differences = append(differences, difference)
+	}
+	return differences
+}
+
+var ansiColors = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// FormatPlan returns the text diff of the changes without colors so it can be stored
+func FormatPlan(changes []migrator.MigrateChanges) (string, error) {
+	var out strings.Builder
+	if err := formatTextDiff(changes, &out); err != nil {
+		return "", err
+	}
+	return ansiColors.ReplaceAllString(out.String(), ""), nil
+}
+
+// needsRebuild returns true if the changes alter a column in a way other than its description or change a foreign key
+// or constraint
+func needsRebuild(changeset migrator.MigrateChanges) bool {
+	if len(changeset.ForeignKeys) > 0 || len(changeset.Constraints) > 0 {
+		return true
+	}
+	for _, column := range changeset.Columns {
+		if column.Change == migrator.AlterColumn {
+			for _, change := range column.Changes {
+				if change != migrator.ColumnDescriptionChanged {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// toRebuildTable applies the column changes to the existing table and returns the new table definition along
+// with the columns which exist in both the old and new table
+func toRebuildTable(driver schema.DatabaseDriverType, generator migrator.TableGenerator, changeset migrator.MigrateChanges) (*types.TableDetail, []string, error) {
+	changed := make(map[string]migrator.MigrateColumn)
+	for _, column := range changeset.Columns {
+		changed[column.Name] = column
+	}
+	var columns []schema.SchemaJsonTablesElemColumnsElem
+	var existing []string
+	for _, col := range changeset.Ref.Columns {
+		if column, ok := changed[col.Name]; ok {
+			switch column.Change {
+			case migrator.DropColumn:
+				continue
+			case migrator.AlterColumn:
+				col = column.Ref
+			}
+		}
+		columns = append(columns, col)
+		existing = append(existing, col.Name)
+	}
+	for _, column := range changeset.Columns {
+		if column.Change == migrator.CreateColumn {
+			columns = append(columns, column.Ref)
+		}
+	}
+	refs := make(map[string]schema.SchemaJsonTablesElemColumnsElemReferences)
+	for _, col := range columns {
+		if col.References != nil {
+			refs[col.Name] = *col.References
+		}
+	}
+	for _, fk := range changeset.ForeignKeys {
+		if fk.Change == migrator.DropForeignKey {
+			delete(refs, fk.Column)
+		}
+	}
+	for _, fk := range changeset.ForeignKeys {
+		if fk.Change == migrator.CreateForeignKey {
+			refs[fk.Column] = fk.Ref
+		}
+	}
+	for i, col := range columns {
+		col.References = nil
+		if ref, ok := refs[col.Name]; ok {
+			col.References = &ref
+		}
+		columns[i] = col
+	}
+	var detail types.TableDetail
+	detail.ForeignKeys = schema.SchemaTableForeignKeys(schema.SchemaJsonTablesElem{Name: changeset.Table, Columns: columns})
+	detail.Description = changeset.Ref.Description
+	detail.Indexes = schema.SchemaIndexesToIndexes(toRebuildIndexes(changeset))
+	if changeset.Description != nil {
+		detail.Description = changeset.Description.To
+	}
+	detail.Columns = make([]types.ColumnDetail, len(columns))
+	for i, col := range columns {
+		val, err := schema.SchemaColumnToColumn(driver, col, i+1, generator.ToNativeType(col))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error converting column %s for table %s to native type: %s", col.Name, changeset.Table, err)
+		}
+		val.IsPrimaryKey = false // the primary key comes from the table detail below
+		detail.Columns[i] = *val
+	}
+	detail.PrimaryKey, detail.UniqueConstraints, detail.Checks = toRebuildConstraints(changeset)
+	return &detail, existing, nil
+}
+
+// toRebuildConstraints applies the constraint changes to the existing table primary key, unique and check constraints
+func toRebuildConstraints(changeset migrator.MigrateChanges) ([]string, []types.UniqueConstraintDetail, []types.CheckConstraintDetail) {
+	primaryKey := schema.TablePrimaryKey(changeset.Ref)
+	uniques := schema.SchemaTableUniqueConstraints(changeset.Ref)
+	checks := schema.SchemaTableChecks(changeset.Ref)
+	for _, constraint := range changeset.Constraints {
+		if constraint.Change == migrator.DropConstraint {
+			switch constraint.Type {
+			case migrator.PrimaryKeyConstraint:
+				primaryKey = nil
+			case migrator.UniqueConstraint:
+				uniques = slices.DeleteFunc(uniques, func(unique types.UniqueConstraintDetail) bool {
+					return unique.Name == constraint.Name
+				})
+			case migrator.CheckConstraint:
+				checks = slices.DeleteFunc(checks, func(check types.CheckConstraintDetail) bool {
+					return check.Name == constraint.Name
+				})
+			}
+		}
+	}
+	for _, constraint := range changeset.Constraints {
+		if constraint.Change == migrator.CreateConstraint {
+			switch constraint.Type {
+			case migrator.PrimaryKeyConstraint:
+				primaryKey = constraint.Columns
+			case migrator.UniqueConstraint:
+				uniques = append(uniques, types.UniqueConstraintDetail{Name: constraint.Name, Columns: constraint.Columns})
+			case migrator.CheckConstraint:
+				checks = append(checks, types.CheckConstraintDetail{Name: constraint.Name, Expression: constraint.Expression})
+			}
+		}
+	}
+	return primaryKey, uniques, checks
+}
+
+// toRebuildIndexes applies the index changes to the existing table indexes since rebuilding the table drops them
+func toRebuildIndexes(changeset migrator.MigrateChanges) []schema.SchemaJsonTablesElemIndexesElem {
+	changed := make(map[string]migrator.MigrateIndex)
+	for _, index := range changeset.Indexes {
+		changed[index.Name] = index
+	}
+	var indexes []schema.SchemaJsonTablesElemIndexesElem
+	for _, index := range changeset.Ref.Indexes {
+		if change, ok := changed[index.Name]; ok {
+			switch change.Change {
+			case migrator.DropIndex:
+				continue
+			case migrator.AlterIndex:
+				index = change.Ref
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	for _, index := range changeset.Indexes {
+		if index.Change == migrator.CreateIndex {
+			indexes = append(indexes, index.Ref)
+		}
+	}
+	return indexes
+}
+
+// sqlWriter collects the sql generated for each change so it can be written as is or split into statements
+type sqlWriter struct {
+	change int // index of the change the sql is being generated for
+	chunks []sqlChunk
+}
+
+type sqlChunk struct {
+	change int
+	sql    strings.Builder
+}
+
+func (w *sqlWriter) Write(buf []byte) (int, error) {
+	return w.WriteString(string(buf))
+}
+
+func (w *sqlWriter) WriteString(val string) (int, error) {
+	if len(w.chunks) == 0 || w.chunks[len(w.chunks)-1].change != w.change {
+		w.chunks = append(w.chunks, sqlChunk{change: w.change})
+	}
+	return w.chunks[len(w.chunks)-1].sql.WriteString(val)
+}
+
+func formatSQLDiff(driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, out io.Writer, config *options) error {
+	var w sqlWriter
+	if err := generateSQL(driver, changes, &w, config); err != nil {
+		return err
+	}
+	for _, chunk := range w.chunks {
+		io.WriteString(out, chunk.sql.String())
+	}
+	return nil
+}
+
+// GenerateStatements returns the individual sql statements for the changes in the order they need to be executed
+func GenerateStatements(driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, opts ...Option) ([]migrator.Statement, error) {
+	var w sqlWriter
+	if err := generateSQL(driver, changes, &w, newOptions(opts)); err != nil {
+		return nil, err
+	}
+	var statements []migrator.Statement
+	for _, chunk := range w.chunks {
+		for _, sql := range util.SplitSQL(chunk.sql.String()) {
+			statements = append(statements, migrator.Statement{Change: chunk.change, SQL: sql})
+		}
+	}
+	return statements, nil
+}
+
+func generateSQL(driver schema.DatabaseDriverType, changes []migrator.MigrateChanges, out *sqlWriter, config *options) error {
 	generator := migrator.GetGenerator(string(driver))
 	if generator == nil {
 		panic("no generator registered for " + driver)
 	}
-	for _, changeset := range changes {
+	alterGenerator := config.alterGenerator(generator)
+	// rename the tables and columns first since the statements below use their new names
+	for i, changeset := range changes {
+		out.change = i
+		if changeset.Change != migrator.AlterTable {
+			continue
+		}
+		if changeset.RenamedFrom != "" {
+			io.WriteString(out, generator.GenerateRenameTable(changeset.RenamedFrom, changeset.Ref.Name))
+			io.WriteString(out, "\n")
+		}
+		for _, column := range changeset.Columns {
+			if column.Change == migrator.RenameColumn {
+				io.WriteString(out, generator.GenerateRenameColumn(changeset.Table, column.Previous.Name, column.Name))
+				io.WriteString(out, "\n")
+			}
+		}
+	}
+	// drop the foreign keys first since the columns and tables they depend on may be dropped below
+	for i, changeset := range changes {
+		out.change = i
+		for _, fk := range changeset.ForeignKeys {
+			if fk.Change == migrator.DropForeignKey {
+				if statement := generator.GenerateDropForeignKey(changeset.Table, fk.Name); statement != "" {
+					io.WriteString(out, statement)
+					io.WriteString(out, "\n")
+				}
+			}
+		}
+	}
+	for i, changeset := range changes {
+		out.change = i
 		switch changeset.Change {
+		case migrator.CreateNamespace:
+			if namespacer, ok := generator.(migrator.NamespaceGenerator); ok {
+				io.WriteString(out, namespacer.GenerateCreateNamespace(changeset.Namespace))
+				io.WriteString(out, "\n")
+			}
 		case migrator.CreateTable:
 			var detail types.TableDetail
 			detail.Description = changeset.Ref.Description
+			detail.Indexes = schema.SchemaIndexesToIndexes(changeset.Ref.Indexes)
+			detail.ForeignKeys = schema.SchemaTableForeignKeys(changeset.Ref)
+			detail.PrimaryKey = schema.TablePrimaryKey(changeset.Ref)
+			detail.UniqueConstraints = schema.SchemaTableUniqueConstraints(changeset.Ref)
+			detail.Checks = schema.SchemaTableChecks(changeset.Ref)
 			detail.Columns = make([]types.ColumnDetail, len(changeset.Ref.Columns))
 			for i, col := range changeset.Ref.Columns {
 				val, err := schema.SchemaColumnToColumn(driver, col, i+1, generator.ToNativeType(col))
@@ -272,18 +1224,71 @@ func formatSQLDiff(driver schema.DatabaseDriverType, changes []migrator.MigrateC
 			}
 			io.WriteString(out, migrator.GenerateCreateStatement(changeset.Table, detail, generator))
 		case migrator.DropTable:
-			io.WriteString(out, "DROP TABLE IF EXISTS ")
-			io.WriteString(out, generator.QuoteTable(changeset.Table))
-			io.WriteString(out, " CASCADE")
-			io.WriteString(out, ";\n")
+			io.WriteString(out, generator.GenerateDropTable(changeset.Table))
+			io.WriteString(out, "\n")
+		case migrator.CreateEnum:
+			if statement := generator.GenerateCreateEnum(changeset.Enum.Name, changeset.Enum.Ref.Values); statement != "" {
+				io.WriteString(out, statement)
+				io.WriteString(out, "\n")
+			}
+		case migrator.AlterEnum:
+			for _, value := range changeset.Enum.Values {
+				if statement := generator.GenerateAddEnumValue(changeset.Enum.Name, value); statement != "" {
+					io.WriteString(out, statement)
+					io.WriteString(out, "\n")
+				}
+			}
+		case migrator.DropEnum:
+			if statement := generator.GenerateDropEnum(changeset.Enum.Name); statement != "" {
+				io.WriteString(out, statement)
+				io.WriteString(out, "\n")
+			}
 		case migrator.AlterTable:
+			generator := alterGenerator
 			if changeset.Description != nil {
+				var comment string
 				if changeset.Description.To == nil {
-					io.WriteString(out, generator.GenerateTableComment(changeset.Table, ""))
+					comment = generator.GenerateTableComment(changeset.Table, "")
 				} else {
-					io.WriteString(out, generator.GenerateTableComment(changeset.Table, *changeset.Description.To))
+					comment = generator.GenerateTableComment(changeset.Table, *changeset.Description.To)
+				}
+				if comment != "" {
+					io.WriteString(out, comment)
+					io.WriteString(out, "\n")
+				}
+			}
+			if rebuilder, ok := generator.(migrator.TableRebuilder); ok && needsRebuild(changeset) {
+				detail, columns, err := toRebuildTable(driver, generator, changeset)
+				if err != nil {
+					return err
+				}
+				for _, statement := range rebuilder.GenerateRebuildTable(changeset.Table, *detail, columns) {
+					io.WriteString(out, statement)
+					io.WriteString(out, "\n")
+				}
+				continue
+			}
+			// drop the indexes first since some databases won't drop a column which is still indexed
+			for _, index := range changeset.Indexes {
+				if index.Change == migrator.DropIndex || index.Change == migrator.AlterIndex {
+					io.WriteString(out, generator.GenerateDropIndex(changeset.Table, index.Name))
+					io.WriteString(out, "\n")
+				}
+			}
+			for _, constraint := range changeset.Constraints {
+				if constraint.Change == migrator.DropConstraint {
+					var statement string
+					switch constraint.Type {
+					case migrator.PrimaryKeyConstraint:
+						statement = generator.GenerateDropPrimaryKey(changeset.Table)
+					case migrator.UniqueConstraint:
+						statement = generator.GenerateDropUniqueConstraint(changeset.Table, constraint.Name)
+					case migrator.CheckConstraint:
+						statement = generator.GenerateDropCheckConstraint(changeset.Table, constraint.Name)
+					}
+					io.WriteString(out, statement)
+					io.WriteString(out, "\n")
 				}
-				io.WriteString(out, "\n")
 			}
 			for _, column := range changeset.Columns {
 				switch column.Change {
@@ -292,83 +1297,72 @@ func formatSQLDiff(driver schema.DatabaseDriverType, changes []migrator.MigrateC
 					if err != nil {
 						return fmt.Errorf("error converting column %s for table %s to native type: %s", column.Name, changeset.Table, err)
 					}
+					val.IsPrimaryKey = false // the primary key is added below as a constraint change
 					io.WriteString(out, "ALTER TABLE ")
 					io.WriteString(out, generator.QuoteTable(changeset.Table))
 					io.WriteString(out, " ")
 					io.WriteString(out, "ADD COLUMN ")
-					io.WriteString(out, migrator.GenerateColumnStatement(*val, generator, nil))
+					io.WriteString(out, migrator.GenerateColumnStatement(*val, generator))
 					io.WriteString(out, ";\n")
 				case migrator.DropColumn:
-					io.WriteString(out, "ALTER TABLE ")
-					io.WriteString(out, generator.QuoteTable(changeset.Table))
-					io.WriteString(out, " ")
-					io.WriteString(out, "DROP COLUMN ")
-					io.WriteString(out, generator.QuoteColumn(column.Name))
-					io.WriteString(out, " CASCADE")
-					io.WriteString(out, ";\n")
+					io.WriteString(out, generator.GenerateDropColumn(changeset.Table, column.Name))
+					io.WriteString(out, "\n")
 				case migrator.AlterColumn:
-					var processed int
-					for _, change := range column.Changes {
-						if change == migrator.ColumnDescriptionChanged {
-							val := column.Ref.Description
-							if val == nil || *val == "" {
-								io.WriteString(out, generator.GenerateColumnComment(changeset.Table, column.Name, ""))
-							} else {
-								io.WriteString(out, generator.GenerateColumnComment(changeset.Table, column.Name, *val))
-							}
-							io.WriteString(out, "\n")
-							processed++
-						}
+					val, err := schema.SchemaColumnToColumn(driver, column.Ref, 0, generator.ToNativeType(column.Ref))
+					if err != nil {
+						return fmt.Errorf("error converting column %s for table %s to native type: %s", column.Name, changeset.Table, err)
 					}
-					if processed != len(column.Changes) {
-						io.WriteString(out, "ALTER TABLE ")
-						io.WriteString(out, generator.QuoteTable(changeset.Table))
-						io.WriteString(out, " ")
-						statements := make([]string, 0)
-						for _, change := range column.Changes {
-							var sout strings.Builder
-							switch change {
-							case migrator.ColumnTypeChanged:
-								io.WriteString(&sout, "ALTER COLUMN ")
-								io.WriteString(&sout, generator.QuoteColumn(column.Name))
-								io.WriteString(&sout, " TYPE ")
-								io.WriteString(&sout, toNativeType(column.Ref.NativeType))
-							case migrator.ColumnDefaultChanged:
-								io.WriteString(&sout, "ALTER TABLE ")
-								io.WriteString(&sout, generator.QuoteTable(changeset.Table))
-								io.WriteString(&sout, " ")
-								io.WriteString(&sout, "ALTER COLUMN ")
-								io.WriteString(&sout, generator.QuoteColumn(column.Name))
-								def := toDefaultType(column.Ref.Default)
-								if def == nil || *def == "" {
-									io.WriteString(&sout, " DROP DEFAULT")
-								} else {
-									io.WriteString(&sout, " SET DEFAULT ")
-									val, err := schema.SchemaColumnToColumn(driver, column.Ref, 0, generator.ToNativeType(column.Ref))
-									if err != nil {
-										return fmt.Errorf("error converting column %s for table %s to native type: %s", column.Name, changeset.Table, err)
-									}
-									io.WriteString(&sout, generator.QuoteDefaultValue(*def, *val))
-								}
-							case migrator.ColumnNullableChanged:
-								io.WriteString(&sout, "ALTER TABLE ")
-								io.WriteString(&sout, generator.QuoteTable(changeset.Table))
-								io.WriteString(&sout, " ")
-								io.WriteString(&sout, "ALTER COLUMN ")
-								io.WriteString(&sout, generator.QuoteColumn(column.Name))
-								if column.Ref.Nullable == nil || !*column.Ref.Nullable {
-									io.WriteString(&sout, " SET NOT NULL")
-								} else {
-									io.WriteString(&sout, " DROP NOT NULL")
-								}
-							case migrator.ColumnDescriptionChanged:
-							default:
-								panic("change " + change + " not handled")
-							}
-							statements = append(statements, sout.String())
-						}
-						io.WriteString(out, strings.Join(statements, ", "))
-						io.WriteString(out, ";\n")
+					var statements []string
+					if swapper, ok := generator.(migrator.ColumnSwapper); ok && swapsColumn(generator, changeset, column) {
+						// the column of the new type is swapped in with the rest of its definition so the other
+						// changes to the column are made along with it
+						statements = swapper.GenerateSwapColumn(changeset.Table, *val)
+					} else {
+						statements = generator.GenerateAlterColumn(changeset.Table, *val, column.Changes)
+					}
+					for _, statement := range statements {
+						io.WriteString(out, statement)
+						io.WriteString(out, "\n")
+					}
+				}
+			}
+			for _, constraint := range changeset.Constraints {
+				if constraint.Change == migrator.CreateConstraint {
+					var statements []string
+					switch constraint.Type {
+					case migrator.PrimaryKeyConstraint:
+						statements = []string{generator.GenerateAddPrimaryKey(changeset.Table, constraint.Columns)}
+					case migrator.UniqueConstraint:
+						statements = []string{generator.GenerateAddUniqueConstraint(changeset.Table, types.UniqueConstraintDetail{Name: constraint.Name, Columns: constraint.Columns})}
+					case migrator.CheckConstraint:
+						statements = generator.GenerateAddCheckConstraint(changeset.Table, types.CheckConstraintDetail{Name: constraint.Name, Expression: constraint.Expression, IsNotValid: constraint.NotValid})
+					}
+					for _, statement := range statements {
+						io.WriteString(out, statement)
+						io.WriteString(out, "\n")
+					}
+				}
+			}
+			for _, index := range changeset.Indexes {
+				if index.Change == migrator.CreateIndex || index.Change == migrator.AlterIndex {
+					io.WriteString(out, generator.GenerateCreateIndex(changeset.Table, schema.SchemaIndexToIndex(index.Ref)))
+					io.WriteString(out, "\n")
+				}
+			}
+		}
+	}
+	// add the foreign keys last since they can reference the tables and columns created above
+	for i, changeset := range changes {
+		out.change = i
+		switch changeset.Change {
+		case migrator.CreateTable:
+			io.WriteString(out, migrator.GenerateAddForeignKeys(changeset.Table, types.TableDetail{ForeignKeys: schema.SchemaTableForeignKeys(changeset.Ref)}, generator))
+		case migrator.AlterTable:
+			for _, fk := range changeset.ForeignKeys {
+				if fk.Change == migrator.CreateForeignKey {
+					if statement := alterGenerator.GenerateAddForeignKey(changeset.Table, schema.ReferencesToForeignKey(changeset.Ref.Name, fk.Column, fk.Ref)); statement != "" {
+						io.WriteString(out, statement)
+						io.WriteString(out, "\n")
 					}
 				}
 			}
@@ -384,18 +1378,60 @@ func formatTextDiff(changes []migrator.MigrateChanges, out io.Writer) error {
 		case migrator.CreateTable:
 			green(out, "%s Create ", createSymbol)
 			magenta(out, "%s", changeset.Table)
-			green(out, " with %d %s:\n", len(changeset.Ref.Columns), util.Plural(len(changeset.Ref.Columns), "column", "columns"))
+			green(out, " with %d %s", len(changeset.Ref.Columns), util.Plural(len(changeset.Ref.Columns), "column", "columns"))
+			if changeset.LikelyRenamedFrom != "" {
+				io.WriteString(out, color.YellowString(" (likely renamed from %s)", changeset.LikelyRenamedFrom))
+			}
+			green(out, ":\n")
 			formatAddColumnsDiff(changeset, out)
+			formatAddIndexesDiff(changeset, out)
+			formatAddForeignKeysDiff(changeset, out)
+			formatAddConstraintsDiff(changeset, out)
 		case migrator.DropTable:
 			red(out, "%s Drop ", dropSymbol)
 			magenta(out, "%s", changeset.Table)
 			red(out, " with %d %s:\n", len(changeset.Ref.Columns), util.Plural(len(changeset.Ref.Columns), "column", "columns"))
 			formatDropColumnsDiff(changeset, out)
+		case migrator.CreateNamespace:
+			green(out, "%s Create schema ", createSymbol)
+			magenta(out, "%s", changeset.Namespace)
+			io.WriteString(out, "\n")
+		case migrator.CreateEnum:
+			green(out, "%s Create enum ", createSymbol)
+			magenta(out, "%s", changeset.Enum.Name)
+			green(out, " with %d %s: ", len(changeset.Enum.Ref.Values), util.Plural(len(changeset.Enum.Ref.Values), "value", "values"))
+			white(out, "%s\n", strings.Join(changeset.Enum.Ref.Values, ", "))
+		case migrator.AlterEnum:
+			blue(out, "%s Alter enum ", alterSymbol)
+			magenta(out, "%s", changeset.Enum.Name)
+			blue(out, " with %d %s:\n", len(changeset.Enum.Values), util.Plural(len(changeset.Enum.Values), "value", "values"))
+			formatAddEnumValuesDiff(changeset, out)
+		case migrator.DropEnum:
+			red(out, "%s Drop enum ", dropSymbol)
+			magenta(out, "%s", changeset.Enum.Name)
+			io.WriteString(out, "\n")
 		case migrator.AlterTable:
 			blue(out, "%s Alter ", alterSymbol)
 			magenta(out, "%s", changeset.Table)
-			if len(changeset.Columns) > 0 {
-				blue(out, " with %d %s:\n", len(changeset.Columns), util.Plural(len(changeset.Columns), "column", "columns"))
+			if changeset.RenamedFrom != "" {
+				blue(out, " renamed from ")
+				magenta(out, "%s", changeset.RenamedFrom)
+			}
+			if len(changeset.Columns) > 0 || len(changeset.Indexes) > 0 || len(changeset.ForeignKeys) > 0 || len(changeset.Constraints) > 0 {
+				var counts []string
+				if len(changeset.Columns) > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", len(changeset.Columns), util.Plural(len(changeset.Columns), "column", "columns")))
+				}
+				if len(changeset.Indexes) > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", len(changeset.Indexes), util.Plural(len(changeset.Indexes), "index", "indexes")))
+				}
+				if len(changeset.ForeignKeys) > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", len(changeset.ForeignKeys), util.Plural(len(changeset.ForeignKeys), "foreign key", "foreign keys")))
+				}
+				if len(changeset.Constraints) > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", len(changeset.Constraints), util.Plural(len(changeset.Constraints), "constraint", "constraints")))
+				}
+				blue(out, " with %s:\n", strings.Join(counts, " and "))
 				formatAlterColumnsDiff(changeset, out)
 			} else if changeset.Description != nil {
 				blue(out, " with description changed from ")
@@ -430,6 +1466,178 @@ func formatDropColumnsDiff(change migrator.MigrateChanges, out io.Writer) {
 	}
 }
 
+// describeIndex returns a short human readable description of an index
+func describeIndex(index schema.SchemaJsonTablesElemIndexesElem) string {
+	var val strings.Builder
+	if index.Unique != nil && *index.Unique {
+		val.WriteString("unique ")
+	}
+	val.WriteString(indexMethod(index))
+	val.WriteString(" (")
+	if index.Expression != nil && *index.Expression != "" {
+		val.WriteString(*index.Expression)
+	} else {
+		columns := make([]string, len(index.Columns))
+		for i, column := range index.Columns {
+			columns[i] = column.Name
+			if indexColumnOrder(column) == string(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc) {
+				columns[i] += " desc"
+			}
+		}
+		val.WriteString(strings.Join(columns, ", "))
+	}
+	val.WriteString(")")
+	if index.Where != nil && *index.Where != "" {
+		val.WriteString(" where ")
+		val.WriteString(*index.Where)
+	}
+	return val.String()
+}
+
+func formatAddIndexesDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, index := range change.Ref.Indexes {
+		green(out, "    %s ", createSymbol)
+		whiteBold(out, "%-15s ", index.Name)
+		white(out, "index ")
+		io.WriteString(out, color.YellowString(describeIndex(index)))
+		io.WriteString(out, "\n")
+	}
+}
+
+func formatAlterIndexesDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, index := range change.Indexes {
+		switch index.Change {
+		case migrator.CreateIndex:
+			blue(out, "    %s ", createSymbol)
+			whiteBold(out, "%-15s ", index.Name)
+			white(out, "add index ")
+			io.WriteString(out, color.YellowString(describeIndex(index.Ref)))
+		case migrator.DropIndex:
+			blue(out, "    %s ", dropSymbol)
+			whiteBold(out, "%-15s ", index.Name)
+			white(out, "drop index")
+		case migrator.AlterIndex:
+			blue(out, "    %s ", alterSymbol)
+			whiteBold(out, "%-15s ", index.Name)
+			white(out, "index changed from ")
+			io.WriteString(out, color.YellowString(describeIndex(index.Previous)))
+			white(out, " to ")
+			io.WriteString(out, color.YellowString(describeIndex(index.Ref)))
+		}
+		io.WriteString(out, "\n")
+	}
+}
+
+// describeReference returns a short human readable description of a foreign key reference
+func describeReference(ref schema.SchemaJsonTablesElemColumnsElemReferences) string {
+	var val strings.Builder
+	val.WriteString(ref.Table)
+	val.WriteString("(")
+	val.WriteString(ref.Column)
+	val.WriteString(")")
+	if ref.OnDelete != nil {
+		val.WriteString(" on delete ")
+		val.WriteString(string(*ref.OnDelete))
+	}
+	if ref.OnUpdate != nil {
+		val.WriteString(" on update ")
+		val.WriteString(string(*ref.OnUpdate))
+	}
+	if ref.Deferrable != nil && *ref.Deferrable {
+		val.WriteString(" deferrable")
+	}
+	return val.String()
+}
+
+func formatAddForeignKeysDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, column := range change.Ref.Columns {
+		if column.References != nil {
+			green(out, "    %s ", createSymbol)
+			whiteBold(out, "%-15s ", column.Name)
+			white(out, "references ")
+			io.WriteString(out, color.YellowString(describeReference(*column.References)))
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
+func formatAlterForeignKeysDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, fk := range change.ForeignKeys {
+		switch fk.Change {
+		case migrator.CreateForeignKey:
+			blue(out, "    %s ", createSymbol)
+			whiteBold(out, "%-15s ", fk.Column)
+			white(out, "add foreign key %s references ", fk.Name)
+			io.WriteString(out, color.YellowString(describeReference(fk.Ref)))
+		case migrator.DropForeignKey:
+			blue(out, "    %s ", dropSymbol)
+			whiteBold(out, "%-15s ", fk.Column)
+			white(out, "drop foreign key %s", fk.Name)
+		}
+		io.WriteString(out, "\n")
+	}
+}
+
+// describeConstraint returns a short human readable description of a primary key, unique or check constraint
+func describeConstraint(constraint migrator.MigrateConstraint) string {
+	detail := strings.Join(constraint.Columns, ", ")
+	if constraint.Type == migrator.CheckConstraint {
+		detail = constraint.Expression
+	}
+	if constraint.Name == "" {
+		return fmt.Sprintf("%s (%s)", constraint.Type, detail)
+	}
+	return fmt.Sprintf("%s %s (%s)", constraint.Type, constraint.Name, detail)
+}
+
+func formatAddConstraintsDiff(change migrator.MigrateChanges, out io.Writer) {
+	// a single column primary key is already shown as part of the column
+	if primaryKey := schema.TablePrimaryKey(change.Ref); len(primaryKey) > 1 {
+		green(out, "    %s ", createSymbol)
+		white(out, "add %s", describeConstraint(migrator.MigrateConstraint{Type: migrator.PrimaryKeyConstraint, Columns: primaryKey}))
+		io.WriteString(out, "\n")
+	}
+	for _, unique := range schema.TableUniqueConstraints(change.Ref) {
+		green(out, "    %s ", createSymbol)
+		white(out, "add %s", describeConstraint(migrator.MigrateConstraint{Type: migrator.UniqueConstraint, Name: unique.Name, Columns: unique.Columns}))
+		io.WriteString(out, "\n")
+	}
+	for _, check := range schema.TableChecks(change.Ref) {
+		green(out, "    %s ", createSymbol)
+		white(out, "add %s", describeConstraint(migrator.MigrateConstraint{Type: migrator.CheckConstraint, Name: check.Name, Expression: check.Expression}))
+		io.WriteString(out, "\n")
+	}
+}
+
+func formatAlterConstraintsDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, constraint := range change.Constraints {
+		switch constraint.Change {
+		case migrator.CreateConstraint:
+			blue(out, "    %s ", createSymbol)
+			white(out, "add %s", describeConstraint(constraint))
+		case migrator.DropConstraint:
+			blue(out, "    %s ", dropSymbol)
+			white(out, "drop %s", describeConstraint(constraint))
+		}
+		io.WriteString(out, "\n")
+	}
+}
+
+func formatAddEnumValuesDiff(change migrator.MigrateChanges, out io.Writer) {
+	for _, value := range change.Enum.Values {
+		blue(out, "    %s ", createSymbol)
+		switch {
+		case value.Before != "":
+			white(out, "add %s before %s", value.Value, value.Before)
+		case value.After != "":
+			white(out, "add %s after %s", value.Value, value.After)
+		default:
+			white(out, "add %s", value.Value)
+		}
+		io.WriteString(out, "\n")
+	}
+}
+
 func prettyDiff(diffs []diffmatchpatch.Diff) string {
 	var buff bytes.Buffer
 	for _, diff := range diffs {
@@ -477,10 +1685,15 @@ func formatAlterColumnsDiff(change migrator.MigrateChanges, out io.Writer) {
 			white(out, "add column ")
 			val.WriteString(color.YellowString(string(column.Ref.Type)))
 			val.WriteString(color.BlackString(" (" + toNativeType(column.Ref.NativeType) + ")"))
+			if column.LikelyRenamedFrom != "" {
+				val.WriteString(color.YellowString(" likely renamed from " + column.LikelyRenamedFrom))
+			}
 			blue(out, val.String())
 			io.WriteString(out, "\n")
 		case migrator.DropColumn:
 			white(out, "drop column\n")
+		case migrator.RenameColumn:
+			white(out, "rename column from %s\n", column.Previous.Name)
 		case migrator.AlterColumn:
 			changes := make([]string, 0)
 			for _, change := range column.Changes {
@@ -535,6 +1748,9 @@ func formatAlterColumnsDiff(change migrator.MigrateChanges, out io.Writer) {
 			}
 		}
 	}
+	formatAlterIndexesDiff(change, out)
+	formatAlterForeignKeysDiff(change, out)
+	formatAlterConstraintsDiff(change, out)
 	if change.Description != nil {
 		io.WriteString(out, "\n")
 		io.WriteString(out, color.BlueString("    table description changed from "))
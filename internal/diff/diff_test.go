@@ -2,11 +2,554 @@ package diff
 
 import (
 	"testing"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestIndexName(t *testing.T) {
-	// assert.Equal(t, "idx_a_b", getIndexName("a", "b"))
-	// assert.Equal(t, "idx_a_b", getIndexName("A", "b"))
-	// assert.Equal(t, "idx_a_b", getIndexName("A", "B"))
-	// assert.Equal(t, "idx_a_b", getIndexName("a", "B"))
+func TestNormalizeExpression(t *testing.T) {
+	assert.Equal(t, "", normalizeExpression(nil))
+	assert.Equal(t, normalizeExpression(util.Ptr("lower(email)")), normalizeExpression(util.Ptr("lower((email)::text)")))
+	assert.Equal(t, normalizeExpression(util.Ptr("lower(email)")), normalizeExpression(util.Ptr("lower(`email`)")))
+	assert.Equal(t, normalizeExpression(util.Ptr("deleted_at IS NULL")), normalizeExpression(util.Ptr("(deleted_at IS NULL)")))
+	assert.Equal(t, normalizeExpression(util.Ptr("status = 'active'")), normalizeExpression(util.Ptr("((status)::character varying = 'active'::text)")))
+	assert.NotEqual(t, normalizeExpression(util.Ptr("lower(email)")), normalizeExpression(util.Ptr("upper(email)")))
+}
+
+func TestDiffIndexes(t *testing.T) {
+	from := []schema.SchemaJsonTablesElemIndexesElem{
+		{Name: "a_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "a"}}, Method: util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodBtree)},
+		{Name: "b_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "b"}}},
+		{Name: "c_idx", Expression: util.Ptr("lower((c)::text)"), Where: util.Ptr("(c IS NOT NULL)")},
+	}
+	to := []schema.SchemaJsonTablesElemIndexesElem{
+		{Name: "a_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "a", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderAsc)}}},
+		{Name: "c_idx", Expression: util.Ptr("lower(c)"), Where: util.Ptr("c IS NOT NULL")},
+		{Name: "d_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "d"}}},
+	}
+	assert.Empty(t, diffIndexes(from, from))
+	changes := diffIndexes(from, to)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, migrator.CreateIndex, changes[0].Change)
+	assert.Equal(t, "d_idx", changes[0].Name)
+	assert.Equal(t, migrator.DropIndex, changes[1].Change)
+	assert.Equal(t, "b_idx", changes[1].Name)
+
+	to[0].Unique = util.Ptr(true)
+	to[1].Method = util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodGin)
+	changes = diffIndexes(from, to)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, migrator.AlterIndex, changes[0].Change)
+	assert.Equal(t, "a_idx", changes[0].Name)
+	assert.Equal(t, from[0], changes[0].Previous)
+	assert.Equal(t, migrator.AlterIndex, changes[1].Change)
+	assert.Equal(t, "c_idx", changes[1].Name)
+}
+
+func TestIndexChangedColumns(t *testing.T) {
+	a := schema.SchemaJsonTablesElemIndexesElem{Name: "a", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "a"}, {Name: "b"}}}
+	b := schema.SchemaJsonTablesElemIndexesElem{Name: "a", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "b"}, {Name: "a"}}}
+	c := schema.SchemaJsonTablesElemIndexesElem{Name: "a", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "a"}, {Name: "b", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)}}}
+	assert.False(t, indexChanged(a, a))
+	assert.True(t, indexChanged(a, b))
+	assert.True(t, indexChanged(a, c))
+	assert.True(t, indexChanged(a, schema.SchemaJsonTablesElemIndexesElem{Name: "a", Columns: a.Columns[:1]}))
+}
+
+func TestDescribeIndex(t *testing.T) {
+	assert.Equal(t, "btree (a, b desc)", describeIndex(schema.SchemaJsonTablesElemIndexesElem{Name: "a", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "a"}, {Name: "b", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)}}}))
+	assert.Equal(t, "unique gin (lower(a)) where a IS NOT NULL", describeIndex(schema.SchemaJsonTablesElemIndexesElem{Name: "a", Expression: util.Ptr("lower(a)"), Unique: util.Ptr(true), Method: util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodGin), Where: util.Ptr("a IS NOT NULL")}))
+}
+
+func TestDiffForeignKeys(t *testing.T) {
+	from := schema.SchemaJsonTablesElem{
+		Name: "order",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "user_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", Name: util.Ptr("order_user_id_fkey")}},
+			{Name: "item_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "item", Column: "id", Name: util.Ptr("order_item_fk")}},
+			{Name: "store_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "store", Column: "id"}},
+		},
+	}
+	to := schema.SchemaJsonTablesElem{
+		Name: "order",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "user_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", OnDelete: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteNoAction)}},
+			{Name: "item_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "item", Column: "id", OnDelete: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade)}},
+			{Name: "store_id"},
+			{Name: "team_id", References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "team", Column: "id"}},
+		},
+	}
+	assert.Empty(t, diffForeignKeys(from, from))
+	changes := diffForeignKeys(from, to)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, migrator.DropForeignKey, changes[0].Change)
+	assert.Equal(t, "order_item_fk", changes[0].Name)
+	assert.Equal(t, migrator.CreateForeignKey, changes[1].Change)
+	assert.Equal(t, "order_item_id_fkey", changes[1].Name)
+	assert.Equal(t, migrator.CreateForeignKey, changes[2].Change)
+	assert.Equal(t, "order_team_id_fkey", changes[2].Name)
+	assert.Equal(t, migrator.DropForeignKey, changes[3].Change)
+	assert.Equal(t, "order_store_id_fkey", changes[3].Name)
+}
+
+func TestForeignKeyChanged(t *testing.T) {
+	a := schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id"}
+	assert.False(t, foreignKeyChanged(a, a))
+	assert.False(t, foreignKeyChanged(a, schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", Name: util.Ptr("a_fk"), Deferrable: util.Ptr(false)}))
+	assert.True(t, foreignKeyChanged(a, schema.SchemaJsonTablesElemColumnsElemReferences{Table: "team", Column: "id"}))
+	assert.True(t, foreignKeyChanged(a, schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", OnUpdate: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnUpdateCascade)}))
+	assert.True(t, foreignKeyChanged(a, schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", Deferrable: util.Ptr(true)}))
+	assert.True(t, foreignKeyChanged(schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", Name: util.Ptr("b_fk")}, schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", Name: util.Ptr("a_fk")}))
+}
+
+func TestDescribeReference(t *testing.T) {
+	assert.Equal(t, "user(id)", describeReference(schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id"}))
+	assert.Equal(t, "user(id) on delete cascade deferrable", describeReference(schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id", OnDelete: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade), Deferrable: util.Ptr(true)}))
+}
+
+func TestDiffConstraints(t *testing.T) {
+	from := schema.SchemaJsonTablesElem{
+		Name: "membership",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "team_id", PrimaryKey: util.Ptr(true)},
+			{Name: "user_id", PrimaryKey: util.Ptr(true)},
+			{Name: "email", Unique: util.Ptr(true)},
+			{Name: "role"},
+		},
+		UniqueConstraints: []schema.SchemaJsonTablesElemUniqueConstraintsElem{
+			{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+		},
+	}
+	assert.Empty(t, diffConstraints(from, from))
+
+	// the same constraints defined at the table level aren't a change
+	to := schema.SchemaJsonTablesElem{
+		Name: "membership",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "team_id"},
+			{Name: "user_id"},
+			{Name: "email"},
+			{Name: "role"},
+		},
+		PrimaryKey: []string{"team_id", "user_id"},
+		UniqueConstraints: []schema.SchemaJsonTablesElemUniqueConstraintsElem{
+			{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+			{Name: "membership_email_key", Columns: []string{"email"}},
+		},
+	}
+	assert.Empty(t, diffConstraints(from, to))
+
+	to.PrimaryKey = []string{"user_id", "team_id"}
+	to.UniqueConstraints = []schema.SchemaJsonTablesElemUniqueConstraintsElem{
+		{Name: "membership_team_role_key", Columns: []string{"role", "team_id"}},
+		{Name: "membership_user_role_key", Columns: []string{"user_id", "role"}},
+	}
+	changes := diffConstraints(from, to)
+	assert.Equal(t, []migrator.MigrateConstraint{
+		{Change: migrator.DropConstraint, Type: migrator.PrimaryKeyConstraint, Columns: []string{"team_id", "user_id"}},
+		{Change: migrator.CreateConstraint, Type: migrator.PrimaryKeyConstraint, Columns: []string{"user_id", "team_id"}},
+		{Change: migrator.DropConstraint, Type: migrator.UniqueConstraint, Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+		{Change: migrator.CreateConstraint, Type: migrator.UniqueConstraint, Name: "membership_team_role_key", Columns: []string{"role", "team_id"}},
+		{Change: migrator.CreateConstraint, Type: migrator.UniqueConstraint, Name: "membership_user_role_key", Columns: []string{"user_id", "role"}},
+		{Change: migrator.DropConstraint, Type: migrator.UniqueConstraint, Name: "membership_email_key", Columns: []string{"email"}},
+	}, changes)
+}
+
+func TestDiffChecks(t *testing.T) {
+	from := schema.SchemaJsonTablesElem{
+		Name: "orders",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "quantity", Checks: []schema.SchemaJsonTablesElemColumnsElemChecksElem{{Name: "orders_quantity_check", Expression: "quantity > 0"}}},
+			{Name: "price"},
+			{Name: "discount"},
+		},
+		Checks: []schema.SchemaJsonTablesElemChecksElem{
+			{Name: "orders_discount_check", Expression: "discount <= price"},
+		},
+	}
+	assert.Empty(t, diffConstraints(from, from))
+
+	// the database rewrites the expressions and a column check is the same as a table check
+	to := schema.SchemaJsonTablesElem{
+		Name: "orders",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "quantity"},
+			{Name: "price"},
+			{Name: "discount"},
+		},
+		Checks: []schema.SchemaJsonTablesElemChecksElem{
+			{Name: "orders_discount_check", Expression: "(discount <= price)"},
+			{Name: "orders_quantity_check", Expression: "((quantity)::integer > 0)"},
+		},
+	}
+	assert.Empty(t, diffConstraints(from, to))
+
+	to.Checks = []schema.SchemaJsonTablesElemChecksElem{
+		{Name: "orders_discount_check", Expression: "discount < price", NotValid: util.Ptr(true)},
+		{Name: "orders_price_check", Expression: "price >= 0"},
+	}
+	assert.Equal(t, []migrator.MigrateConstraint{
+		{Change: migrator.DropConstraint, Type: migrator.CheckConstraint, Name: "orders_discount_check", Expression: "discount <= price"},
+		{Change: migrator.CreateConstraint, Type: migrator.CheckConstraint, Name: "orders_discount_check", Expression: "discount < price", NotValid: true},
+		{Change: migrator.CreateConstraint, Type: migrator.CheckConstraint, Name: "orders_price_check", Expression: "price >= 0"},
+		{Change: migrator.DropConstraint, Type: migrator.CheckConstraint, Name: "orders_quantity_check", Expression: "quantity > 0"},
+	}, diffConstraints(from, to))
+}
+
+func TestDescribeConstraint(t *testing.T) {
+	assert.Equal(t, "primary key (a, b)", describeConstraint(migrator.MigrateConstraint{Type: migrator.PrimaryKeyConstraint, Columns: []string{"a", "b"}}))
+	assert.Equal(t, "unique a_key (a)", describeConstraint(migrator.MigrateConstraint{Type: migrator.UniqueConstraint, Name: "a_key", Columns: []string{"a"}}))
+	assert.Equal(t, "check a_check (a > 0)", describeConstraint(migrator.MigrateConstraint{Type: migrator.CheckConstraint, Name: "a_check", Expression: "a > 0"}))
+}
+
+func TestDiffEnumValues(t *testing.T) {
+	from := schema.SchemaJsonEnumsElem{Name: "status", Values: []string{"pending", "shipped"}}
+	values, err := diffEnumValues(from, from)
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	values, err = diffEnumValues(from, schema.SchemaJsonEnumsElem{Name: "status", Values: []string{"new", "pending", "paid", "shipped", "delivered", "returned"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []migrator.MigrateEnumValue{
+		{Value: "new", Before: "pending"},
+		{Value: "paid", After: "pending"},
+		{Value: "delivered", After: "shipped"},
+		{Value: "returned"},
+	}, values)
+
+	_, err = diffEnumValues(from, schema.SchemaJsonEnumsElem{Name: "status", Values: []string{"pending"}})
+	assert.EqualError(t, err, "enum status can't remove the value shipped")
+
+	_, err = diffEnumValues(from, schema.SchemaJsonEnumsElem{Name: "status", Values: []string{"shipped", "pending"}})
+	assert.EqualError(t, err, "enum status can't reorder the value shipped")
+}
+
+func TestDiffEnums(t *testing.T) {
+	from := []schema.SchemaJsonEnumsElem{
+		{Name: "status", Values: []string{"pending", "shipped"}},
+		{Name: "color", Values: []string{"red"}},
+	}
+	changes, drops, err := diffEnums(from, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, drops)
+
+	to := []schema.SchemaJsonEnumsElem{
+		{Name: "status", Values: []string{"pending", "shipped", "delivered"}},
+		{Name: "size", Values: []string{"small", "large"}},
+	}
+	changes, drops, err = diffEnums(from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []migrator.MigrateChanges{
+		{Change: migrator.AlterEnum, Enum: &migrator.MigrateEnum{Name: "status", Ref: to[0], Values: []migrator.MigrateEnumValue{{Value: "delivered"}}}},
+		{Change: migrator.CreateEnum, Enum: &migrator.MigrateEnum{Name: "size", Ref: to[1]}},
+	}, changes)
+	assert.Equal(t, []migrator.MigrateChanges{
+		{Change: migrator.DropEnum, Enum: &migrator.MigrateEnum{Name: "color", Ref: from[1]}},
+	}, drops)
+}
+
+func TestDiffEnumsOnlyPostgres(t *testing.T) {
+	from := &schema.SchemaJson{Enums: []schema.SchemaJsonEnumsElem{{Name: "status", Values: []string{"pending"}}}}
+	to := &schema.SchemaJson{Enums: []schema.SchemaJsonEnumsElem{{Name: "status", Values: []string{"shipped"}}}}
+	_, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.EqualError(t, err, "enum status can't remove the value pending")
+
+	changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverMysql, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiffNamespaces(t *testing.T) {
+	columns := []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}}
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{{Name: "orders", Columns: columns}},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: columns},
+			{Name: "orders", Schema: util.Ptr("sales"), Columns: columns},
+		},
+	}
+	changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, migrator.CreateNamespace, changes[0].Change)
+	assert.Equal(t, "sales", changes[0].Namespace)
+	assert.Equal(t, migrator.CreateTable, changes[1].Change)
+	assert.Equal(t, "sales.orders", changes[1].Table)
+
+	// the namespace already exists so only the table is created
+	from.Database.Schemas = []string{"sales"}
+	changes, err = Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, migrator.CreateTable, changes[0].Change)
+
+	from.Tables = to.Tables
+	changes, err = Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestRenameTables(t *testing.T) {
+	from := []schema.SchemaJsonTablesElem{
+		{
+			Name: "user",
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+			},
+			Indexes: []schema.SchemaJsonTablesElemIndexesElem{{Name: "user_email_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "email"}}}},
+		},
+		{
+			Name: "order",
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "user", Column: "id"}},
+			},
+		},
+	}
+	to := []schema.SchemaJsonTablesElem{
+		{
+			Name:        "account",
+			RenamedFrom: util.Ptr("user"),
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "account_id", RenamedFrom: util.Ptr("id"), Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+			},
+		},
+		{
+			Name: "order",
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "account", Column: "account_id"}},
+			},
+		},
+	}
+	tables, tableRenames, columnRenames := renameTables(from, to)
+	assert.Equal(t, map[string]string{"account": "user"}, tableRenames)
+	assert.Equal(t, map[string]map[string]string{"account": {"id": "account_id"}}, columnRenames)
+	assert.Equal(t, "account", tables[0].Name)
+	assert.Equal(t, "account_id", tables[0].Columns[0].Name)
+	assert.Equal(t, "account", tables[1].Columns[0].References.Table)
+	assert.Equal(t, "account_id", tables[1].Columns[0].References.Column)
+
+	// the existing tables aren't changed
+	assert.Equal(t, "user", from[0].Name)
+	assert.Equal(t, "id", from[0].Columns[0].Name)
+	assert.Equal(t, "user", from[1].Columns[0].References.Table)
+
+	// once applied the renames are skipped
+	_, tableRenames, columnRenames = renameTables(tables, to)
+	assert.Empty(t, tableRenames)
+	assert.Empty(t, columnRenames)
+}
+
+func TestDiffRenames(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+				},
+			},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:        "account",
+				RenamedFrom: util.Ptr("user"),
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "full_name", RenamedFrom: util.Ptr("name"), Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Description: util.Ptr("the full name")},
+				},
+			},
+		},
+	}
+	changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, migrator.AlterTable, changes[0].Change)
+	assert.Equal(t, "account", changes[0].Table)
+	assert.Equal(t, "user", changes[0].RenamedFrom)
+	assert.Len(t, changes[0].Columns, 2)
+	assert.Equal(t, migrator.RenameColumn, changes[0].Columns[0].Change)
+	assert.Equal(t, "full_name", changes[0].Columns[0].Name)
+	assert.Equal(t, "name", changes[0].Columns[0].Previous.Name)
+	assert.Equal(t, migrator.AlterColumn, changes[0].Columns[1].Change)
+	assert.Equal(t, "full_name", changes[0].Columns[1].Name)
+}
+
+func TestLikelyRenames(t *testing.T) {
+	columns := []schema.SchemaJsonTablesElemColumnsElem{
+		{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+		{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+		{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+	}
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "user", Columns: columns},
+			{Name: "item", Columns: columns[:1]},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "full_name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+					{Name: "age_in_days", Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat},
+				},
+			},
+			{Name: "product", Columns: columns[:1]},
+		},
+	}
+	changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+	for _, change := range changes {
+		switch change.Change {
+		case migrator.AlterTable:
+			for _, column := range change.Columns {
+				switch column.Name {
+				case "full_name":
+					assert.Equal(t, "name", column.LikelyRenamedFrom)
+				default:
+					assert.Empty(t, column.LikelyRenamedFrom, column.Name) // the type changed
+				}
+			}
+		case migrator.CreateTable:
+			assert.Equal(t, "item", change.LikelyRenamedFrom)
+		case migrator.DropTable:
+			assert.Equal(t, "item", change.Table)
+		}
+	}
+
+	// a second table with the same columns makes it ambiguous
+	to.Tables = append(to.Tables, schema.SchemaJsonTablesElem{Name: "category", Columns: columns[:1]})
+	changes, err = Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	for _, change := range changes {
+		assert.Empty(t, change.LikelyRenamedFrom)
+	}
+}
+
+func TestSortByDependencies(t *testing.T) {
+	table := func(name string, refs ...string) migrator.MigrateChanges {
+		ref := schema.SchemaJsonTablesElem{Name: name, Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}}}
+		for _, r := range refs {
+			ref.Columns = append(ref.Columns, schema.SchemaJsonTablesElemColumnsElem{Name: r + "_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: r, Column: "id"}})
+		}
+		return migrator.MigrateChanges{Change: migrator.CreateTable, Table: name, Ref: ref}
+	}
+	names := func(changes []migrator.MigrateChanges) []string {
+		var res []string
+		for _, changeset := range changes {
+			res = append(res, changeset.Table)
+		}
+		return res
+	}
+	// tables referencing tables outside the changes or themselves keep their order
+	assert.Equal(t, []string{"a", "b", "c"}, names(sortByDependencies([]migrator.MigrateChanges{table("a", "x"), table("b", "b"), table("c")})))
+	assert.Equal(t, []string{"c", "b", "a", "d"}, names(sortByDependencies([]migrator.MigrateChanges{table("a", "b"), table("b", "c"), table("c"), table("d", "a")})))
+	// a cycle falls back to the name order
+	assert.Equal(t, []string{"a", "b", "c"}, names(sortByDependencies([]migrator.MigrateChanges{table("a", "b"), table("b", "a"), table("c", "a")})))
+}
+
+func TestDiffOrder(t *testing.T) {
+	columns := []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}}
+	ref := func(table string) []schema.SchemaJsonTablesElemColumnsElem {
+		return append(columns, schema.SchemaJsonTablesElemColumnsElem{Name: table + "_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: table, Column: "id"}})
+	}
+	from := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{{Name: "color", Values: []string{"red"}}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "b_old", Columns: columns},
+			{Name: "a_old", Columns: ref("b_old")},
+			{Name: "kept", Columns: columns},
+		},
+	}
+	to := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{{Name: "size", Values: []string{"small"}}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "a_new", Columns: ref("b_new")},
+			{Name: "b_new", Columns: append(ref("c_new"), schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString})},
+			{Name: "c_new", Schema: util.Ptr("other"), Columns: append(columns, schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString})},
+			{Name: "kept", Columns: append(columns, schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString})},
+		},
+	}
+	to.Tables[1].Columns[1].References.Table = "other.c_new"
+	var expect []string
+	for i := 0; i < 10; i++ {
+		changes, err := Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+		assert.NoError(t, err)
+		var order []string
+		for _, changeset := range changes {
+			switch changeset.Change {
+			case migrator.CreateNamespace:
+				order = append(order, string(changeset.Change)+" "+changeset.Namespace)
+			case migrator.CreateEnum, migrator.AlterEnum, migrator.DropEnum:
+				order = append(order, string(changeset.Change)+" "+changeset.Enum.Name)
+			default:
+				order = append(order, string(changeset.Change)+" "+changeset.Table)
+			}
+		}
+		if expect == nil {
+			expect = order
+		}
+		assert.Equal(t, expect, order)
+	}
+	assert.Equal(t, []string{
+		"create schema other",
+		"create enum size",
+		"drop table a_old",
+		"drop table b_old",
+		"create table other.c_new",
+		"create table b_new",
+		"create table a_new",
+		"alter table kept",
+		"drop enum color",
+	}, expect)
+}
+
+func TestDifferences(t *testing.T) {
+	changes := []migrator.MigrateChanges{
+		{Change: migrator.CreateNamespace, Namespace: "sales"},
+		{Change: migrator.AlterEnum, Enum: &migrator.MigrateEnum{Name: "status", Values: []migrator.MigrateEnumValue{{Value: "archived"}}}},
+		{Change: migrator.CreateTable, Table: "items"},
+		{
+			Change:      migrator.AlterTable,
+			Table:       "orders",
+			RenamedFrom: "purchases",
+			Columns: []migrator.MigrateColumn{
+				{Change: migrator.CreateColumn, Name: "email"},
+				{Change: migrator.AlterColumn, Name: "age", Changes: []migrator.MigrateColumnChangeTypeType{migrator.ColumnTypeChanged, migrator.ColumnNullableChanged}},
+				{Change: migrator.RenameColumn, Name: "full_name", Previous: schema.SchemaJsonTablesElemColumnsElem{Name: "name"}},
+			},
+			Indexes:     []migrator.MigrateIndex{{Change: migrator.DropIndex, Name: "orders_age_idx"}},
+			ForeignKeys: []migrator.MigrateForeignKey{{Change: migrator.CreateForeignKey, Name: "orders_item_id_fkey"}},
+			Constraints: []migrator.MigrateConstraint{{Change: migrator.DropConstraint, Type: migrator.PrimaryKeyConstraint}},
+		},
+	}
+	assert.Equal(t, []Difference{
+		{Change: "create schema", Name: "sales"},
+		{Change: "alter enum", Name: "status", Details: []string{"add value archived"}},
+		{Change: "create table", Name: "items"},
+		{Change: "alter table", Name: "orders", Details: []string{
+			"renamed from purchases",
+			"create column email",
+			"alter column age: type changed, nullable changed",
+			"rename column name to full_name",
+			"drop index orders_age_idx",
+			"add constraint orders_item_id_fkey",
+			"drop constraint primary key",
+		}},
+	}, Differences(changes))
+	assert.Empty(t, Differences(nil))
 }
@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+type options struct {
+	online bool
+}
+
+// Option changes how the sql for the changes is generated and how they're classified
+type Option func(config *options)
+
+// WithOnline alters the existing tables with the statements which avoid long locks for the drivers which support
+// them, such as building indexes concurrently and validating constraints separately, when online is true
+func WithOnline(online bool) Option {
+	return func(config *options) {
+		config.online = online
+	}
+}
+
+func newOptions(opts []Option) *options {
+	var config options
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &config
+}
+
+// alterGenerator returns the generator for the statements which alter the existing tables. The online generator is
+// only used for them since the tables which are created aren't in use yet.
+func (config *options) alterGenerator(generator migrator.TableGenerator) migrator.TableGenerator {
+	if online, ok := generator.(migrator.OnlineGenerator); ok && config.online {
+		return online.Online()
+	}
+	return generator
+}
+
+// swapsColumn returns true if the generator changes the type of the column by swapping in a column of the new type,
+// which is only done when nothing else on the table depends on the column since it would be dropped along with it
+func swapsColumn(generator migrator.TableGenerator, changeset migrator.MigrateChanges, column migrator.MigrateColumn) bool {
+	if _, ok := generator.(migrator.ColumnSwapper); !ok || !slices.Contains(column.Changes, migrator.ColumnTypeChanged) {
+		return false
+	}
+	col := column.Ref
+	if (col.PrimaryKey != nil && *col.PrimaryKey) || (col.Unique != nil && *col.Unique) || (col.AutoIncrement != nil && *col.AutoIncrement) || col.References != nil {
+		return false
+	}
+	if slices.Contains(schema.TablePrimaryKey(changeset.Ref), column.Name) {
+		return false
+	}
+	for _, unique := range schema.TableUniqueConstraints(changeset.Ref) {
+		if slices.Contains(unique.Columns, column.Name) {
+			return false
+		}
+	}
+	// expressions aren't parsed so any mention of the column is taken to use it
+	for _, check := range schema.TableChecks(changeset.Ref) {
+		if strings.Contains(check.Expression, column.Name) {
+			return false
+		}
+	}
+	for _, index := range changeset.Ref.Indexes {
+		if (index.Expression != nil && strings.Contains(*index.Expression, column.Name)) || (index.Where != nil && strings.Contains(*index.Where, column.Name)) {
+			return false
+		}
+		for _, indexColumn := range index.Columns {
+			if indexColumn.Name == column.Name {
+				return false
+			}
+		}
+	}
+	return true
+}
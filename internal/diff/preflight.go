@@ -0,0 +1,194 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+// preflightTable is the table of a change as it exists before the change is applied, which is where the checks of
+// its rows are run
+type preflightTable struct {
+	generator migrator.TableGenerator
+	name      string
+	renamed   map[string]string // previous names of the renamed columns
+	created   []string          // columns which don't exist yet
+	keys      []string          // primary key which identifies the rows, empty if the table doesn't have one yet
+}
+
+func newPreflightTable(generator migrator.TableGenerator, changeset migrator.MigrateChanges) *preflightTable {
+	t := &preflightTable{generator: generator, name: changeset.Table, renamed: make(map[string]string)}
+	if changeset.RenamedFrom != "" {
+		t.name = changeset.RenamedFrom
+	}
+	for _, column := range changeset.Columns {
+		switch column.Change {
+		case migrator.RenameColumn:
+			t.renamed[column.Name] = column.Previous.Name
+		case migrator.CreateColumn:
+			t.created = append(t.created, column.Name)
+		}
+	}
+	if keys := schema.TablePrimaryKey(changeset.Ref); t.exists(keys) {
+		t.keys = keys
+	}
+	return t
+}
+
+// exists returns true if the columns exist before the change is applied
+func (t *preflightTable) exists(columns []string) bool {
+	for _, column := range columns {
+		if slices.Contains(t.created, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// columns returns the quoted names of the columns before the change is applied
+func (t *preflightTable) columns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		if previous, ok := t.renamed[column]; ok {
+			column = previous
+		}
+		quoted[i] = t.generator.QuoteColumn(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// check returns a check for the rows which match the condition, sampling the keys of the rows or the columns when the
+// table doesn't have a primary key
+func (t *preflightTable) check(change int, reason string, where string, sample ...string) migrator.PreflightCheck {
+	check := migrator.PreflightCheck{
+		Change: change,
+		Reason: reason,
+		Count:  fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", t.generator.QuoteTable(t.name), where),
+	}
+	if len(t.keys) > 0 {
+		sample = t.keys
+	}
+	if len(sample) > 0 {
+		check.Sample = fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT %d", t.columns(sample), t.generator.QuoteTable(t.name), where, migrator.PreflightSampleSize)
+	}
+	return check
+}
+
+// duplicates returns a check for the rows which have the same values for the columns, sampling the values
+func (t *preflightTable) duplicates(change int, reason string, columns []string, where string) migrator.PreflightCheck {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = t.columns([]string{column}) + " IS NOT NULL"
+	}
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+	query := fmt.Sprintf("FROM %s WHERE %s GROUP BY %s HAVING COUNT(*) > 1", t.generator.QuoteTable(t.name), strings.Join(conditions, " AND "), t.columns(columns))
+	return migrator.PreflightCheck{
+		Change: change,
+		Reason: reason,
+		Count:  fmt.Sprintf("SELECT COALESCE(SUM(n), 0) FROM (SELECT COUNT(*) AS n %s) d", query),
+		Sample: fmt.Sprintf("SELECT %s %s LIMIT %d", t.columns(columns), query, migrator.PreflightSampleSize),
+	}
+}
+
+// PreflightChecks returns the checks of the existing rows which would make the changes fail when they're applied:
+// nulls in a column becoming not null, values longer than a shrinking max length, values which can't be converted to
+// the new type of a column and duplicates in the columns gaining a unique constraint, primary key or unique index.
+// The checks run before any of the changes so they use the names of the tables and columns before they're renamed.
+func PreflightChecks(driver schema.DatabaseDriverType, changes []migrator.MigrateChanges) ([]migrator.PreflightCheck, error) {
+	generator := migrator.GetGenerator(string(driver))
+	if generator == nil {
+		panic("no generator registered for " + driver)
+	}
+	preflight, _ := generator.(migrator.PreflightGenerator)
+	// the values of the enums which are created or changed can't be checked since they're added by the migration
+	var enums []string
+	for _, changeset := range changes {
+		if changeset.Enum != nil && (changeset.Change == migrator.CreateEnum || changeset.Change == migrator.AlterEnum) {
+			enums = append(enums, changeset.Enum.Name)
+		}
+	}
+	var checks []migrator.PreflightCheck
+	for i, changeset := range changes {
+		if changeset.Change != migrator.AlterTable {
+			continue
+		}
+		table := newPreflightTable(generator, changeset)
+		for _, column := range changeset.Columns {
+			if column.Change != migrator.AlterColumn {
+				continue
+			}
+			name := table.columns([]string{column.Name})
+			if slices.Contains(column.Changes, migrator.ColumnNullableChanged) && column.Ref.Nullable != nil && !*column.Ref.Nullable {
+				checks = append(checks, table.check(i, fmt.Sprintf("column %s of %s is becoming not null but has nulls", column.Name, changeset.Table), name+" IS NULL"))
+			}
+			if !slices.Contains(column.Changes, migrator.ColumnTypeChanged) || preflight == nil {
+				continue
+			}
+			previous, next := column.Previous, column.Ref
+			if previous.Type == next.Type && next.Type == schema.SchemaJsonTablesElemColumnsElemTypeString && next.MaxLength != nil && (previous.MaxLength == nil || *next.MaxLength < *previous.MaxLength) {
+				reason := fmt.Sprintf("column %s of %s is shrinking to a max length of %d but has longer values", column.Name, changeset.Table, *next.MaxLength)
+				checks = append(checks, table.check(i, reason, fmt.Sprintf("%s > %d", preflight.GenerateLength(name), *next.MaxLength), column.Name))
+				continue
+			}
+			if previous.Type == next.Type && safeNil(previous.Enum) == safeNil(next.Enum) {
+				continue
+			}
+			if next.Enum != nil && slices.Contains(enums, *next.Enum) {
+				continue
+			}
+			val, err := schema.SchemaColumnToColumn(driver, next, 0, generator.ToNativeType(next))
+			if err != nil {
+				return nil, fmt.Errorf("error converting column %s for table %s to native type: %s", column.Name, changeset.Table, err)
+			}
+			if invalid := preflight.GenerateInvalidCast(name, *val); invalid != "" {
+				check := table.check(i, fmt.Sprintf("column %s of %s is changing to %s but has values which can't be converted", column.Name, changeset.Table, generator.GenerateColumnType(*val)), name+" IS NOT NULL AND "+invalid, column.Name)
+				check.SkipOnError = true
+				checks = append(checks, check)
+			}
+		}
+		for _, constraint := range changeset.Constraints {
+			if constraint.Change != migrator.CreateConstraint || !table.exists(constraint.Columns) {
+				continue
+			}
+			switch constraint.Type {
+			case migrator.UniqueConstraint:
+				checks = append(checks, table.duplicates(i, fmt.Sprintf("unique constraint %s is being added to %s but (%s) has duplicates", constraint.Name, changeset.Table, strings.Join(constraint.Columns, ", ")), constraint.Columns, ""))
+			case migrator.PrimaryKeyConstraint:
+				checks = append(checks, table.duplicates(i, fmt.Sprintf("primary key is being added to %s but (%s) has duplicates", changeset.Table, strings.Join(constraint.Columns, ", ")), constraint.Columns, ""))
+			}
+		}
+		for _, index := range changeset.Indexes {
+			if (index.Change != migrator.CreateIndex && index.Change != migrator.AlterIndex) || index.Ref.Unique == nil || !*index.Ref.Unique || index.Ref.Expression != nil {
+				continue
+			}
+			columns := make([]string, len(index.Ref.Columns))
+			for c, column := range index.Ref.Columns {
+				columns[c] = column.Name
+			}
+			if len(columns) == 0 || !table.exists(columns) {
+				continue
+			}
+			var where string
+			if index.Ref.Where != nil {
+				where = *index.Ref.Where
+			}
+			checks = append(checks, table.duplicates(i, fmt.Sprintf("unique index %s is being created on %s but (%s) has duplicates", index.Name, changeset.Table, strings.Join(columns, ", ")), columns, where))
+		}
+	}
+	return checks, nil
+}
+
+// Preflight runs the preflight checks of the changes against the database and returns a migrator.PreflightError if
+// the existing rows would make the changes fail
+func Preflight(args migrator.MigratorArgs, driver schema.DatabaseDriverType) error {
+	checks, err := PreflightChecks(driver, args.Diff)
+	if err != nil {
+		return err
+	}
+	return migrator.Preflight(args.Context, args.Logger, args.DB, checks)
+}
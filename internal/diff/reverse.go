@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+// Irreversible is a change of a migration which reversing the migration can't undo
+type Irreversible struct {
+	Name   string // name of the table, enum or schema (namespace) changed
+	Reason string
+}
+
+func (i Irreversible) String() string {
+	return "irreversible: " + i.Reason
+}
+
+// ReverseSchema returns the schema which migrates a database with the changes from the schema from to the schema to
+// applied back to the schema from. The tables and columns which were renamed are renamed back and the values added to
+// an enum are kept since they can't be removed. The changes which can't be undone are returned with the schema.
+func ReverseSchema(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.SchemaJson, from *schema.SchemaJson) (*schema.SchemaJson, []Irreversible, error) {
+	changes, err := Diff(logger, driver, to, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := *from
+	target.Enums = slices.Clone(from.Enums)
+	target.Tables = slices.Clone(from.Tables)
+	for i, table := range target.Tables {
+		target.Tables[i].Columns = slices.Clone(table.Columns)
+	}
+	var irreversible []Irreversible
+	add := func(name string, format string, args ...any) {
+		irreversible = append(irreversible, Irreversible{Name: name, Reason: fmt.Sprintf(format, args...)})
+	}
+	for _, changeset := range changes {
+		switch changeset.Change {
+		case migrator.CreateNamespace:
+			add(changeset.Namespace, "schema %s is left in place since schemas aren't dropped", changeset.Namespace)
+		case migrator.AlterEnum:
+			var values []string
+			for _, value := range changeset.Enum.Values {
+				values = append(values, value.Value)
+			}
+			add(changeset.Enum.Name, "%s %s added to enum %s can't be removed", util.Plural(len(values), "value", "values"), strings.Join(values, ", "), changeset.Enum.Name)
+			if enum := schema.FindEnum(target.Enums, changeset.Enum.Name); enum != nil {
+				enum.Values = slices.Clone(changeset.Enum.Ref.Values)
+			}
+		case migrator.DropTable:
+			add(changeset.Table, "table %s is created again without its data", changeset.Table)
+		case migrator.AlterTable:
+			name := changeset.Table
+			if changeset.RenamedFrom != "" {
+				name = changeset.RenamedFrom
+			}
+			table := schema.FindTable(target.Tables, name)
+			if table == nil {
+				continue
+			}
+			if changeset.RenamedFrom != "" {
+				table.RenamedFrom = util.Ptr(changeset.Ref.Name)
+			}
+			for _, column := range changeset.Columns {
+				switch column.Change {
+				case migrator.RenameColumn:
+					if i := slices.IndexFunc(table.Columns, func(col schema.SchemaJsonTablesElemColumnsElem) bool { return col.Name == column.Previous.Name }); i >= 0 {
+						table.Columns[i].RenamedFrom = util.Ptr(column.Name)
+					}
+				case migrator.DropColumn:
+					add(changeset.Table, "column %s of %s is created again without its data", column.Name, changeset.Table)
+				case migrator.AlterColumn:
+					if slices.Contains(column.Changes, migrator.ColumnTypeChanged) && narrowsType(column.Previous, column.Ref) {
+						add(changeset.Table, "column %s of %s can't get back the data lost changing it from %s to %s", column.Name, changeset.Table, column.Previous.Type, column.Ref.Type)
+					}
+				}
+			}
+		}
+	}
+	return &target, irreversible, nil
+}
+
+// Reverse returns the changes which undo migrating a database from the schema from to the schema to along with the
+// changes which can't be undone
+func Reverse(logger logger.Logger, driver schema.DatabaseDriverType, to *schema.SchemaJson, from *schema.SchemaJson) ([]migrator.MigrateChanges, []Irreversible, error) {
+	target, irreversible, err := ReverseSchema(logger, driver, to, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, err := Diff(logger, driver, target, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return changes, irreversible, nil
+}
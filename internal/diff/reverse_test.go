@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverse(t *testing.T) {
+	from := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{{Name: "status", Values: []string{"active"}}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+					{Name: "nickname", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+				},
+			},
+			{
+				Name:    "audit",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}},
+			},
+		},
+	}
+	to := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{{Name: "status", Values: []string{"active", "banned"}}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:        "account",
+				RenamedFrom: util.Ptr("user"),
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "full_name", RenamedFrom: util.Ptr("name"), Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+					{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				},
+			},
+		},
+	}
+	changes, irreversible, err := Reverse(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Equal(t, []Irreversible{
+		{Name: "status", Reason: "value banned added to enum status can't be removed"},
+		{Name: "audit", Reason: "table audit is created again without its data"},
+		{Name: "account", Reason: "column nickname of account is created again without its data"},
+	}, irreversible)
+	assert.Equal(t, "irreversible: table audit is created again without its data", irreversible[1].String())
+	assert.Len(t, changes, 2)
+	assert.Equal(t, migrator.CreateTable, changes[0].Change)
+	assert.Equal(t, "audit", changes[0].Table)
+	assert.Equal(t, migrator.AlterTable, changes[1].Change)
+	assert.Equal(t, "user", changes[1].Table)
+	assert.Equal(t, "account", changes[1].RenamedFrom)
+	assert.Equal(t, []Difference{
+		{Change: "create table", Name: "audit"},
+		{Change: "alter table", Name: "user", Details: []string{
+			"renamed from account",
+			"rename column full_name to name",
+			"create column nickname",
+			"drop column age",
+		}},
+	}, Differences(changes))
+
+	// the schemas passed aren't changed
+	assert.Nil(t, from.Tables[0].RenamedFrom)
+	assert.Nil(t, from.Tables[0].Columns[1].RenamedFrom)
+	assert.Equal(t, []string{"active"}, from.Enums[0].Values)
+
+	changes, irreversible, err = Reverse(logger.NewTestLogger(), schema.DatabaseDriverPostgres, from, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, irreversible)
+}
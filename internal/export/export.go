@@ -0,0 +1,166 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tool is a migration tool which versioned migration files are written for
+type Tool string
+
+const (
+	GolangMigrate Tool = "golang-migrate"
+	Goose         Tool = "goose"
+	Flyway        Tool = "flyway"
+)
+
+// Tools are the supported migration tools
+var Tools = []Tool{GolangMigrate, Goose, Flyway}
+
+// timestampLayout is the version format golang-migrate and goose use by default
+const timestampLayout = "20060102150405"
+
+var (
+	golangMigrateFile = regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`)
+	gooseFile         = regexp.MustCompile(`^(\d+)_.*\.(sql|go)$`)
+	flywayFile        = regexp.MustCompile(`^[VU](\d+)__.*\.sql$`)
+	nameInvalidChars  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Migration is a migration with the sql to apply it and to undo it
+type Migration struct {
+	Name string // description used in the file names
+	Up   string
+	Down string // empty if the migration can't be undone
+}
+
+// slug returns the name in the form used in file names
+func slug(name string) string {
+	val := strings.Trim(nameInvalidChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if val == "" {
+		return "migration"
+	}
+	return val
+}
+
+func (t Tool) pattern() (*regexp.Regexp, error) {
+	switch t {
+	case GolangMigrate:
+		return golangMigrateFile, nil
+	case Goose:
+		return gooseFile, nil
+	case Flyway:
+		return flywayFile, nil
+	}
+	return nil, fmt.Errorf("unsupported migration tool: %s", t)
+}
+
+// NextVersion returns the version of the next migration in the directory. The version after the last one is used when
+// the existing migrations are numbered sequentially. Otherwise the time is used for golang-migrate and goose, like
+// their create commands, and flyway starts at 1.
+func NextVersion(tool Tool, dir string, now time.Time) (string, error) {
+	pattern, err := tool.pattern()
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var last uint64
+	var width int
+	var found bool
+	for _, entry := range entries {
+		match := pattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		if !found || version > last {
+			last = version
+			width = len(match[1])
+		}
+		found = true
+	}
+	timestamp := now.UTC().Format(timestampLayout)
+	switch {
+	case found && width < len(timestampLayout):
+		return fmt.Sprintf("%0*d", width, last+1), nil
+	case found:
+		// timestamps must still increase when the last one is in the future
+		if version, _ := strconv.ParseUint(timestamp, 10, 64); version <= last {
+			return strconv.FormatUint(last+1, 10), nil
+		}
+		return timestamp, nil
+	case tool == Flyway:
+		return "1", nil
+	}
+	return timestamp, nil
+}
+
+// Files returns the files to write for the migration with the version keyed by file name
+func Files(tool Tool, version string, migration Migration) (map[string]string, error) {
+	name := slug(migration.Name)
+	switch tool {
+	case GolangMigrate:
+		// golang-migrate expects both files even when the down migration is empty
+		return map[string]string{
+			fmt.Sprintf("%s_%s.up.sql", version, name):   migration.Up,
+			fmt.Sprintf("%s_%s.down.sql", version, name): migration.Down,
+		}, nil
+	case Goose:
+		var out strings.Builder
+		out.WriteString("-- +goose Up\n")
+		out.WriteString(migration.Up)
+		out.WriteString("\n-- +goose Down\n")
+		out.WriteString(migration.Down)
+		return map[string]string{fmt.Sprintf("%s_%s.sql", version, name): out.String()}, nil
+	case Flyway:
+		files := map[string]string{fmt.Sprintf("V%s__%s.sql", version, name): migration.Up}
+		if migration.Down != "" {
+			// undo migrations are only run by the editions of flyway which support them
+			files[fmt.Sprintf("U%s__%s.sql", version, name)] = migration.Down
+		}
+		return files, nil
+	}
+	return nil, fmt.Errorf("unsupported migration tool: %s", tool)
+}
+
+// Write writes the files of the migration to the directory with the next version and returns the paths written
+func Write(tool Tool, dir string, migration Migration, now time.Time) ([]string, error) {
+	version, err := NextVersion(tool, dir, now)
+	if err != nil {
+		return nil, err
+	}
+	files, err := Files(tool, version, migration)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("migration %s already exists", path)
+		}
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte(files[filepath.Base(path)]), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,103 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTime = time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+
+func touch(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "add_users_table", slug("Add users table"))
+	assert.Equal(t, "v2_email", slug("  v2: email! "))
+	assert.Equal(t, "migration", slug("--"))
+}
+
+func TestNextVersion(t *testing.T) {
+	dir := t.TempDir()
+	version, err := NextVersion(GolangMigrate, filepath.Join(dir, "missing"), testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, "20240305103000", version)
+	version, err = NextVersion(Flyway, dir, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", version)
+
+	sequential := t.TempDir()
+	touch(t, sequential, "000001_init.up.sql", "000001_init.down.sql", "000009_users.up.sql", "README.md")
+	version, err = NextVersion(GolangMigrate, sequential, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, "000010", version)
+
+	timestamps := t.TempDir()
+	touch(t, timestamps, "20240101000000_init.sql", "20250101000000_future.sql")
+	version, err = NextVersion(Goose, timestamps, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, "20250101000001", version)
+	version, err = NextVersion(Goose, timestamps, testTime.AddDate(2, 0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "20260305103000", version)
+
+	flyway := t.TempDir()
+	touch(t, flyway, "V1__init.sql", "V2__users.sql", "U2__users.sql")
+	version, err = NextVersion(Flyway, flyway, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", version)
+
+	_, err = NextVersion(Tool("liquibase"), dir, testTime)
+	assert.EqualError(t, err, "unsupported migration tool: liquibase")
+}
+
+func TestFiles(t *testing.T) {
+	migration := Migration{Name: "Add email", Up: "ALTER TABLE users ADD COLUMN email text;\n", Down: "ALTER TABLE users DROP COLUMN email;\n"}
+	files, err := Files(GolangMigrate, "000002", migration)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"000002_add_email.up.sql":   migration.Up,
+		"000002_add_email.down.sql": migration.Down,
+	}, files)
+
+	files, err = Files(Goose, "20240305103000", migration)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"20240305103000_add_email.sql": "-- +goose Up\nALTER TABLE users ADD COLUMN email text;\n\n-- +goose Down\nALTER TABLE users DROP COLUMN email;\n",
+	}, files)
+
+	files, err = Files(Flyway, "3", migration)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"V3__add_email.sql": migration.Up,
+		"U3__add_email.sql": migration.Down,
+	}, files)
+	files, err = Files(Flyway, "3", Migration{Name: "Add email", Up: migration.Up})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"V3__add_email.sql": migration.Up}, files)
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	migration := Migration{Name: "init", Up: "CREATE TABLE users (id int);\n", Down: "DROP TABLE users;\n"}
+	paths, err := Write(GolangMigrate, dir, migration, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "20240305103000_init.down.sql"),
+		filepath.Join(dir, "20240305103000_init.up.sql"),
+	}, paths)
+	buf, err := os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Equal(t, migration.Up, string(buf))
+
+	// the next migration gets the next version even at the same time
+	paths, err = Write(GolangMigrate, dir, migration, testTime)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "20240305103001_init.down.sql"), paths[0])
+}
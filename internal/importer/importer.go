@@ -0,0 +1,228 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/export"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+)
+
+var (
+	golangMigrateFile = regexp.MustCompile(`^(\d+)_.*\.up\.sql$`)
+	gooseFile         = regexp.MustCompile(`^(\d+)_.*\.(sql|go)$`)
+	flywayFile        = regexp.MustCompile(`^V(\d+(?:[._]\d+)*)__.*\.sql$`)
+	flywayRepeatable  = regexp.MustCompile(`^R__.*\.sql$`)
+)
+
+// maxStatementLength is the length the statement of a warning is truncated to
+const maxStatementLength = 80
+
+// File is a migration file with the sql which applies it
+type File struct {
+	Name string
+	SQL  string
+}
+
+// Warning is a statement or file which couldn't be interpreted and was skipped
+type Warning struct {
+	File      string
+	Statement string // empty when the warning is for the whole file
+	Reason    string
+}
+
+func (w Warning) String() string {
+	if w.Statement == "" {
+		return w.File + ": " + w.Reason
+	}
+	return w.File + ": " + w.Reason + ": " + w.Statement
+}
+
+// version is the parsed version of a migration file used to sort them
+type version struct {
+	parts []uint64
+	file  File
+}
+
+func parseVersion(val string) ([]uint64, error) {
+	var parts []uint64
+	for _, part := range strings.FieldsFunc(val, func(r rune) bool { return r == '.' || r == '_' }) {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+func compareVersions(a []uint64, b []uint64) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// gooseUp returns the sql of the up section of a goose migration
+func gooseUp(sql string) (string, error) {
+	var up strings.Builder
+	var found, inUp bool
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(sql)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if annotation, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose "); ok {
+			switch strings.ToLower(strings.TrimSpace(annotation)) {
+			case "up":
+				found = true
+				inUp = true
+			case "down":
+				inUp = false
+			}
+			continue
+		}
+		if inUp {
+			up.WriteString(line)
+			up.WriteString("\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.New("missing -- +goose Up annotation")
+	}
+	return up.String(), nil
+}
+
+// ReadMigrations returns the up migrations in the directory for the tool in the order they're applied along with
+// warnings for the migrations which can't be replayed
+func ReadMigrations(tool export.Tool, dir string) ([]File, []Warning, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var versions []version
+	var warnings []Warning
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		var match []string
+		switch tool {
+		case export.GolangMigrate:
+			match = golangMigrateFile.FindStringSubmatch(name)
+		case export.Goose:
+			match = gooseFile.FindStringSubmatch(name)
+			if match != nil && match[2] == "go" {
+				warnings = append(warnings, Warning{File: name, Reason: "go migrations can't be replayed"})
+				continue
+			}
+		case export.Flyway:
+			if flywayRepeatable.MatchString(name) {
+				warnings = append(warnings, Warning{File: name, Reason: "repeatable migrations aren't replayed"})
+				continue
+			}
+			match = flywayFile.FindStringSubmatch(name)
+		default:
+			return nil, nil, fmt.Errorf("unsupported migration tool: %s", tool)
+		}
+		if match == nil {
+			continue
+		}
+		parts, err := parseVersion(match[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+		buf, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		sql := string(buf)
+		if tool == export.Goose {
+			if sql, err = gooseUp(sql); err != nil {
+				warnings = append(warnings, Warning{File: name, Reason: err.Error()})
+				continue
+			}
+		}
+		versions = append(versions, version{parts, File{Name: name, SQL: sql}})
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareVersions(versions[i].parts, versions[j].parts) < 0
+	})
+	files := make([]File, len(versions))
+	for i, v := range versions {
+		files[i] = v.file
+	}
+	return files, warnings, nil
+}
+
+// statementText returns the statement for a warning, truncated when it's long
+func statementText(src string, tokens []token) string {
+	val := util.CleanSQL(src[tokens[0].start:tokens[len(tokens)-1].end])
+	if len(val) > maxStatementLength {
+		return val[:maxStatementLength-3] + "..."
+	}
+	return val
+}
+
+// Replay applies the sql of the migration files in order to an empty schema and returns the resulting schema along
+// with warnings for the statements which couldn't be interpreted
+func Replay(driver schema.DatabaseDriverType, files []File) (*schema.SchemaJson, []Warning) {
+	m := &model{driver: driver, dbschema: &schema.SchemaJson{}}
+	for _, file := range files {
+		tokens, err := lex(driver, file.SQL)
+		if err != nil {
+			m.warnings = append(m.warnings, Warning{File: file.Name, Reason: err.Error()})
+			continue
+		}
+		for _, statement := range splitStatements(tokens) {
+			m.file = file.Name
+			m.statement = statementText(file.SQL, statement)
+			p := &parser{src: file.SQL, tokens: statement, fold: driver == schema.DatabaseDriverPostgres}
+			if err := m.apply(p); err != nil {
+				m.warn(err.Error())
+			}
+		}
+	}
+	dbschema := m.dbschema
+	dbschema.Schema = schema.DefaultSchema
+	dbschema.Version = schema.DefaultVersion
+	dbschema.Database.Url = "${DATABASE_URL}"
+	if dbschema.Tables == nil {
+		dbschema.Tables = make([]schema.SchemaJsonTablesElem, 0)
+	}
+	// the tables are sorted by name like the schema generated from a database
+	sort.SliceStable(dbschema.Tables, func(i, j int) bool {
+		return schema.TableQualifiedName(dbschema.Tables[i]) < schema.TableQualifiedName(dbschema.Tables[j])
+	})
+	sort.SliceStable(dbschema.Enums, func(i, j int) bool {
+		return dbschema.Enums[i].Name < dbschema.Enums[j].Name
+	})
+	return dbschema, m.warnings
+}
+
+// Import returns the schema which results from replaying the migrations in the directory for the tool along with
+// warnings for the migrations and statements which couldn't be interpreted
+func Import(driver schema.DatabaseDriverType, tool export.Tool, dir string) (*schema.SchemaJson, []Warning, error) {
+	files, warnings, err := ReadMigrations(tool, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbschema, replayWarnings := Replay(driver, files)
+	return dbschema, append(warnings, replayWarnings...), nil
+}
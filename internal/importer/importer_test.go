@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhaynie/shift/internal/export"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func fileNames(files []File) []string {
+	var res []string
+	for _, file := range files {
+		res = append(res, file.Name)
+	}
+	return res
+}
+
+func TestReadMigrations(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"10_users.up.sql":   "CREATE TABLE users (id int);",
+		"10_users.down.sql": "DROP TABLE users;",
+		"9_init.up.sql":     "CREATE SCHEMA app;",
+		"README.md":         "",
+	})
+	files, warnings, err := ReadMigrations(export.GolangMigrate, dir)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, []string{"9_init.up.sql", "10_users.up.sql"}, fileNames(files))
+
+	dir = t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"20240101000000_init.sql":  "-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE users (id int);\n-- +goose StatementEnd\n\n-- +goose Down\nDROP TABLE users;\n",
+		"20240102000000_seed.go":   "package migrations",
+		"20240103000000_plain.sql": "CREATE TABLE other (id int);",
+	})
+	files, warnings, err = ReadMigrations(export.Goose, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Warning{
+		{File: "20240102000000_seed.go", Reason: "go migrations can't be replayed"},
+		{File: "20240103000000_plain.sql", Reason: "missing -- +goose Up annotation"},
+	}, warnings)
+	assert.Equal(t, []File{{Name: "20240101000000_init.sql", SQL: "CREATE TABLE users (id int);\n\n"}}, files)
+
+	dir = t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"V1_10__later.sql":  "",
+		"V1_2__early.sql":   "",
+		"V1__init.sql":      "",
+		"U1__init.sql":      "",
+		"R__views.sql":      "",
+		"V2.0__release.sql": "",
+	})
+	files, warnings, err = ReadMigrations(export.Flyway, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Warning{{File: "R__views.sql", Reason: "repeatable migrations aren't replayed"}}, warnings)
+	assert.Equal(t, []string{"V1__init.sql", "V1_2__early.sql", "V1_10__later.sql", "V2.0__release.sql"}, fileNames(files))
+
+	_, _, err = ReadMigrations(export.Tool("liquibase"), dir)
+	assert.EqualError(t, err, "unsupported migration tool: liquibase")
+}
+
+func TestReplayPostgres(t *testing.T) {
+	dbschema, warnings := Replay(schema.DatabaseDriverPostgres, []File{
+		{Name: "1_init.up.sql", SQL: `
+BEGIN;
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+CREATE TYPE status AS ENUM ('active', 'disabled');
+CREATE TABLE public.users (
+	id serial PRIMARY KEY,
+	email character varying(255) NOT NULL UNIQUE,
+	nickname text,
+	status status DEFAULT 'active'::status NOT NULL,
+	balance numeric(10,2) DEFAULT 0,
+	created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+CREATE TABLE posts (
+	id bigint GENERATED ALWAYS AS IDENTITY,
+	user_id integer,
+	title text NOT NULL DEFAULT 'untitled',
+	tags text[],
+	PRIMARY KEY (id),
+	CONSTRAINT posts_user_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX CONCURRENTLY posts_title_idx ON posts USING gin (title);
+CREATE UNIQUE INDEX users_lower_email_idx ON users (lower(email)) WHERE status = 'active';
+COMMENT ON TABLE users IS 'the users';
+CREATE VIEW active_users AS SELECT * FROM users;
+COMMIT;
+`},
+		{Name: "2_rename.up.sql", SQL: `
+ALTER TABLE users RENAME TO people;
+ALTER TABLE people RENAME COLUMN email TO email_address;
+ALTER TABLE people DROP COLUMN nickname, ADD COLUMN age int CHECK (age > 0);
+ALTER TABLE people ALTER COLUMN balance TYPE double precision, ALTER COLUMN balance DROP DEFAULT;
+ALTER TYPE status ADD VALUE 'banned' BEFORE 'disabled';
+COMMENT ON COLUMN people.age IS 'in years';
+DROP INDEX IF EXISTS missing_idx;
+ALTER TABLE people ADD CONSTRAINT people_age_max CHECK (age < 200) NOT VALID;
+`},
+	})
+	assert.Equal(t, []Warning{{File: "1_init.up.sql", Statement: "CREATE VIEW active_users AS SELECT * FROM users", Reason: "unsupported statement"}}, warnings)
+	assert.Equal(t, schema.DefaultSchema, dbschema.Schema)
+	assert.Equal(t, schema.DefaultVersion, dbschema.Version)
+	assert.Equal(t, "${DATABASE_URL}", dbschema.Database.Url)
+	assert.Equal(t, []schema.SchemaJsonEnumsElem{{Name: "status", Values: []string{"active", "banned", "disabled"}}}, dbschema.Enums)
+	assert.Equal(t, []schema.SchemaJsonTablesElem{
+		{
+			Name:        "people",
+			Description: util.Ptr("the users"),
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "int4"), AutoIncrement: util.Ptr(true), PrimaryKey: util.Ptr(true), Nullable: util.Ptr(false)},
+				{Name: "email_address", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "varchar(255)"), MaxLength: util.Ptr(255), Unique: util.Ptr(true), Nullable: util.Ptr(false)},
+				{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "status"), Enum: util.Ptr("status"), Default: schema.ToNativeDefault(schema.DatabaseDriverPostgres, util.Ptr("active")), Nullable: util.Ptr(false)},
+				{Name: "balance", Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "float8"), Nullable: util.Ptr(true)},
+				{Name: "created_at", Type: schema.SchemaJsonTablesElemColumnsElemTypeDatetime, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "timestamptz"), Default: schema.ToNativeDefault(schema.DatabaseDriverPostgres, util.Ptr("now()")), Nullable: util.Ptr(false)},
+				{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "int4"), Description: util.Ptr("in years"), Checks: []schema.SchemaJsonTablesElemColumnsElemChecksElem{{Name: "people_age_check", Expression: "age > 0"}}, Nullable: util.Ptr(true)},
+			},
+			Indexes: []schema.SchemaJsonTablesElemIndexesElem{
+				{Name: "users_lower_email_idx", Unique: util.Ptr(true), Expression: util.Ptr("lower(email)"), Where: util.Ptr("status = 'active'")},
+			},
+			Checks: []schema.SchemaJsonTablesElemChecksElem{{Name: "people_age_max", Expression: "age < 200", NotValid: util.Ptr(true)}},
+		},
+		{
+			Name: "posts",
+			Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "int8"), AutoIncrement: util.Ptr(true), PrimaryKey: util.Ptr(true), Nullable: util.Ptr(false)},
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "int4"), Nullable: util.Ptr(true), References: &schema.SchemaJsonTablesElemColumnsElemReferences{
+					Name:     util.Ptr("posts_user_fk"),
+					Table:    "people",
+					Column:   "id",
+					OnDelete: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade),
+				}},
+				{Name: "title", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "text"), Default: schema.ToNativeDefault(schema.DatabaseDriverPostgres, util.Ptr("untitled")), Nullable: util.Ptr(false)},
+				{Name: "tags", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverPostgres, "text[]"), IsArray: true, Nullable: util.Ptr(true)},
+			},
+			Indexes: []schema.SchemaJsonTablesElemIndexesElem{
+				{Name: "posts_title_idx", Method: util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodGin), Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "title"}}},
+			},
+		},
+	}, dbschema.Tables)
+}
+
+func TestReplayWarnings(t *testing.T) {
+	dbschema, warnings := Replay(schema.DatabaseDriverPostgres, []File{
+		{Name: "1.sql", SQL: `CREATE TABLE a (id int, v geometry);
+ALTER TABLE missing ADD COLUMN x int;
+ALTER TABLE a ALTER COLUMN id SET STATISTICS 100;
+CREATE TABLE b (name text COLLATE "C", total int GENERATED ALWAYS AS (1) STORED);
+ALTER TABLE a DROP COLUMN id;
+CREATE TEMP TABLE scratch (id int);`},
+		{Name: "2.sql", SQL: "CREATE TABLE c (id int); SELECT 'unterminated"},
+	})
+	assert.Equal(t, []Warning{
+		{File: "1.sql", Statement: "CREATE TABLE a (id int, v geometry)", Reason: "unknown type geometry of column v is imported as a string"},
+		{File: "1.sql", Statement: "ALTER TABLE missing ADD COLUMN x int", Reason: "table missing doesn't exist"},
+		{File: "1.sql", Statement: "ALTER TABLE a ALTER COLUMN id SET STATISTICS 100", Reason: "unsupported alter column action SET"},
+		{File: "1.sql", Statement: "CREATE TABLE b (name text COLLATE \"C\", total int GENERATED ALWAYS AS (1) STORED)", Reason: "generated column total isn't supported"},
+		{File: "1.sql", Statement: "CREATE TEMP TABLE scratch (id int)", Reason: "temporary table is skipped"},
+		{File: "2.sql", Reason: "unterminated quote starting at offset 32"},
+	}, warnings)
+	assert.Equal(t, "1.sql: table missing doesn't exist: ALTER TABLE missing ADD COLUMN x int", warnings[1].String())
+	assert.Equal(t, "2.sql: unterminated quote starting at offset 32", warnings[5].String())
+	assert.Len(t, dbschema.Tables, 1)
+	assert.Len(t, dbschema.Tables[0].Columns, 1)
+	assert.Equal(t, "v", dbschema.Tables[0].Columns[0].Name)
+}
+
+func TestReplayMysql(t *testing.T) {
+	dbschema, warnings := Replay(schema.DatabaseDriverMysql, []File{
+		{Name: "V1__init.sql", SQL: "CREATE TABLE `orders` (\n" +
+			"  `id` int unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `code` varchar(20) CHARACTER SET utf8mb4 NOT NULL COMMENT 'order code',\n" +
+			"  `paid` tinyint(1) NOT NULL DEFAULT '0',\n" +
+			"  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  UNIQUE KEY `orders_code_uniq` (`code`),\n" +
+			"  KEY `orders_updated` (`updated_at` DESC)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='all orders';\n" +
+			"ALTER TABLE `orders` CHANGE `code` `reference` varchar(40) NOT NULL, DROP INDEX `orders_updated`;\n"},
+	})
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, "on update CURRENT_TIMESTAMP of column updated_at is ignored", warnings[0].Reason)
+	assert.Len(t, dbschema.Tables, 1)
+	table := dbschema.Tables[0]
+	assert.Equal(t, "orders", table.Name)
+	assert.Equal(t, util.Ptr("all orders"), table.Description)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElem{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, NativeType: schema.ToNativeType(schema.DatabaseDriverMysql, "int unsigned"), AutoIncrement: util.Ptr(true), PrimaryKey: util.Ptr(true), Nullable: util.Ptr(false)}, table.Columns[0])
+	assert.Equal(t, "reference", table.Columns[1].Name)
+	assert.Equal(t, util.Ptr(40), table.Columns[1].MaxLength)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeBoolean, table.Columns[2].Type)
+	assert.Equal(t, schema.ToNativeDefault(schema.DatabaseDriverMysql, util.Ptr("0")), table.Columns[2].Default)
+	assert.Equal(t, []schema.SchemaJsonTablesElemUniqueConstraintsElem{{Name: "orders_code_uniq", Columns: []string{"reference"}}}, table.UniqueConstraints)
+	assert.Empty(t, table.Indexes)
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"1_users.up.sql": "CREATE TABLE users (id integer PRIMARY KEY, name text);",
+		"2_drop.up.sql":  "DROP TABLE users; CREATE TABLE accounts (id integer PRIMARY KEY);",
+	})
+	dbschema, warnings, err := Import(schema.DatabaseDriverSQLite, export.GolangMigrate, dir)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Len(t, dbschema.Tables, 1)
+	assert.Equal(t, "accounts", dbschema.Tables[0].Name)
+	assert.Equal(t, schema.ToNativeType(schema.DatabaseDriverSQLite, "integer"), dbschema.Tables[0].Columns[0].NativeType)
+
+	_, _, err = Import(schema.DatabaseDriverSQLite, export.GolangMigrate, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,1673 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+)
+
+var errUnsupported = errors.New("unsupported statement")
+
+// ignoredStatements are the statements which don't change the schema
+var ignoredStatements = []string{"begin", "commit", "end", "start", "rollback", "set", "reset", "grant", "revoke", "insert", "update", "delete", "select", "analyze", "vacuum", "lock", "pragma", "use"}
+
+var castLiteral = regexp.MustCompile(`^('(?:[^']|'')*')::.+$`)
+
+// model is the schema the statements are applied to
+type model struct {
+	driver    schema.DatabaseDriverType
+	dbschema  *schema.SchemaJson
+	file      string // file of the statement being applied
+	statement string // statement being applied
+	warnings  []Warning
+}
+
+func (m *model) warn(format string, args ...any) {
+	m.warnings = append(m.warnings, Warning{File: m.file, Statement: m.statement, Reason: fmt.Sprintf(format, args...)})
+}
+
+// namespace returns the namespace of a name, empty for the default namespace of the database
+func (m *model) namespace(val string) string {
+	switch {
+	case m.driver == schema.DatabaseDriverPostgres && val == "public",
+		m.driver == schema.DatabaseDriverSQLite && (val == "main" || val == "temp"),
+		m.driver == schema.DatabaseDriverMysql:
+		return ""
+	}
+	return val
+}
+
+// tableName returns the qualified name of the next table in the statement
+func (m *model) tableName(p *parser) (string, error) {
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return "", err
+	}
+	return schema.QualifiedName(m.namespace(namespace), name), nil
+}
+
+func (m *model) table(name string) (*schema.SchemaJsonTablesElem, error) {
+	if table := schema.FindTable(m.dbschema.Tables, name); table != nil {
+		return table, nil
+	}
+	return nil, fmt.Errorf("table %s doesn't exist", name)
+}
+
+func findColumn(table *schema.SchemaJsonTablesElem, name string) (*schema.SchemaJsonTablesElemColumnsElem, error) {
+	for i, col := range table.Columns {
+		if col.Name == name {
+			return &table.Columns[i], nil
+		}
+	}
+	return nil, fmt.Errorf("column %s doesn't exist in table %s", name, table.Name)
+}
+
+// apply applies the statement to the schema
+func (m *model) apply(p *parser) error {
+	for _, keyword := range ignoredStatements {
+		if p.is(keyword) {
+			return nil
+		}
+	}
+	var err error
+	switch {
+	case p.accept("create"):
+		p.acceptAny("global", "local")
+		temporary := p.acceptAny("temporary", "temp") != ""
+		p.accept("unlogged")
+		switch {
+		case p.accept("table"):
+			if temporary {
+				// temporary tables only last for the session which created them so they aren't part of the schema
+				return errors.New("temporary table is skipped")
+			}
+			err = m.createTable(p)
+		case p.accept("unique", "index"):
+			err = m.createIndex(p, true)
+		case p.accept("index"):
+			err = m.createIndex(p, false)
+		case p.accept("type"):
+			err = m.createType(p)
+		case p.accept("schema"):
+			err = m.createSchema(p)
+		case p.accept("extension"):
+			return nil
+		default:
+			return errUnsupported
+		}
+	case p.accept("alter"):
+		switch {
+		case p.accept("table"):
+			err = m.alterTable(p)
+		case p.accept("index"):
+			err = m.alterIndex(p)
+		case p.accept("type"):
+			err = m.alterType(p)
+		default:
+			return errUnsupported
+		}
+	case p.accept("drop"):
+		switch {
+		case p.accept("table"):
+			err = m.dropTables(p)
+		case p.accept("index"):
+			err = m.dropIndexes(p)
+		case p.accept("type"):
+			err = m.dropTypes(p)
+		case p.accept("schema"):
+			err = m.dropSchemas(p)
+		case p.accept("extension"):
+			return nil
+		default:
+			return errUnsupported
+		}
+	case p.accept("comment", "on"):
+		err = m.comment(p)
+	default:
+		return errUnsupported
+	}
+	if err == nil && !p.done() {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	return err
+}
+
+// isTableConstraint returns true if the next element in a table definition is a constraint instead of a column
+func (m *model) isTableConstraint(p *parser) bool {
+	if p.is("constraint") || p.is("primary", "key") || p.is("unique") || p.is("foreign", "key") || p.is("check") || p.is("exclude") {
+		return true
+	}
+	return m.driver == schema.DatabaseDriverMysql && (p.is("key") || p.is("index") || p.is("fulltext") || p.is("spatial"))
+}
+
+func (m *model) createTable(p *parser) error {
+	ifNotExists := p.accept("if", "not", "exists")
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	namespace = m.namespace(namespace)
+	qualifiedName := schema.QualifiedName(namespace, name)
+	if schema.FindTable(m.dbschema.Tables, qualifiedName) != nil {
+		if ifNotExists {
+			p.pos = len(p.tokens)
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", qualifiedName)
+	}
+	if !p.is("(") {
+		return fmt.Errorf("only tables defined with columns are supported")
+	}
+	p.next()
+	table := schema.SchemaJsonTablesElem{Name: name, Columns: make([]schema.SchemaJsonTablesElemColumnsElem, 0)}
+	if namespace != "" {
+		table.Schema = util.Ptr(namespace)
+	}
+	// the table constraints are applied after the columns since they can come before the columns they reference
+	var constraints []int
+	for !p.is(")") {
+		if m.isTableConstraint(p) {
+			constraints = append(constraints, p.pos)
+			p.skipElement()
+		} else {
+			col, err := m.column(p, &table)
+			if err != nil {
+				return err
+			}
+			table.Columns = append(table.Columns, col)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+	end := p.pos
+	for _, pos := range constraints {
+		p.pos = pos
+		if err := m.tableConstraint(p, &table); err != nil {
+			return err
+		}
+	}
+	p.pos = end
+	// the table options, of which only the comment is kept
+	for !p.done() {
+		if p.accept("comment") {
+			p.accept("=")
+			description, err := p.str()
+			if err != nil {
+				return err
+			}
+			table.Description = util.Ptr(description)
+			continue
+		}
+		p.next()
+	}
+	m.dbschema.Tables = append(m.dbschema.Tables, table)
+	return nil
+}
+
+// dataType is a column type as written in a statement
+type dataType struct {
+	name      string // lower case name with the words of multiple word types joined with a space
+	args      []string
+	modifiers string // trailing mysql modifiers such as unsigned
+	isArray   bool
+}
+
+// typeWords are the words which continue a type name with multiple words
+var typeWords = []string{"varying", "precision", "with", "without", "time", "zone"}
+
+// typeModifiers are the words which follow the mysql numeric types
+var typeModifiers = []string{"unsigned", "signed", "zerofill"}
+
+func (p *parser) dataType() (dataType, error) {
+	var dt dataType
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return dt, err
+	}
+	if namespace != "" && namespace != "public" && namespace != "pg_catalog" {
+		name = namespace + "." + name
+	}
+	words := []string{strings.ToLower(name)}
+	for {
+		if word := p.acceptAny(typeWords...); word != "" {
+			words = append(words, word)
+			continue
+		}
+		if p.is("(") && len(dt.args) == 0 {
+			args, err := p.group()
+			if err != nil {
+				return dt, err
+			}
+			for _, arg := range strings.Split(args, ",") {
+				dt.args = append(dt.args, strings.TrimSpace(arg))
+			}
+			continue
+		}
+		break
+	}
+	dt.name = strings.Join(words, " ")
+	for {
+		modifier := p.acceptAny(typeModifiers...)
+		if modifier == "" {
+			break
+		}
+		dt.modifiers += " " + modifier
+	}
+	for {
+		switch {
+		case p.accept("["):
+			if p.peek().kind == tokenNumber {
+				p.next()
+			}
+			if err := p.expect("]"); err != nil {
+				return dt, err
+			}
+			dt.isArray = true
+			continue
+		case p.accept("array"):
+			dt.isArray = true
+			continue
+		}
+		break
+	}
+	return dt, nil
+}
+
+// postgresTypes are the names introspection returns for the postgres types which have aliases
+var postgresTypes = map[string]string{
+	"character varying":           "varchar",
+	"character":                   "bpchar",
+	"char":                        "bpchar",
+	"integer":                     "int4",
+	"int":                         "int4",
+	"bigint":                      "int8",
+	"smallint":                    "int2",
+	"serial":                      "int4",
+	"serial4":                     "int4",
+	"bigserial":                   "int8",
+	"serial8":                     "int8",
+	"smallserial":                 "int2",
+	"serial2":                     "int2",
+	"boolean":                     "bool",
+	"timestamp with time zone":    "timestamptz",
+	"timestamp without time zone": "timestamp",
+	"time with time zone":         "timetz",
+	"time without time zone":      "time",
+	"real":                        "float4",
+	"double precision":            "float8",
+	"float":                       "float8",
+	"decimal":                     "numeric",
+	"bit varying":                 "varbit",
+}
+
+var (
+	intTypes       = []string{"int", "int2", "int4", "int8", "integer", "smallint", "bigint", "tinyint", "mediumint", "serial", "serial2", "serial4", "serial8", "smallserial", "bigserial"}
+	floatTypes     = []string{"float", "float4", "float8", "real", "double", "double precision", "numeric", "decimal", "money"}
+	datetimeTypes  = []string{"date", "time", "timetz", "timestamp", "timestamptz", "datetime", "year", "interval"}
+	booleanTypes   = []string{"bool", "boolean"}
+	stringTypes    = []string{"text", "varchar", "bpchar", "char", "character", "nchar", "nvarchar", "tinytext", "mediumtext", "longtext", "clob", "uuid", "json", "jsonb", "xml", "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary", "bit", "varbit", "inet", "cidr", "macaddr", "macaddr8", "tsvector", "tsquery", "enum", "set", "citext"}
+	maxLengthTypes = []string{"varchar", "bpchar", "char", "character", "nchar", "nvarchar", "binary", "varbinary"}
+)
+
+// sqliteType returns the type for a sqlite column using its type affinity rules
+func sqliteType(name string) schema.SchemaJsonTablesElemColumnsElemType {
+	dt := strings.ToUpper(name)
+	switch {
+	case strings.Contains(dt, "BOOL"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeBoolean
+	case strings.Contains(dt, "DATE"), strings.Contains(dt, "TIME"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeDatetime
+	case strings.Contains(dt, "INT"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeInt
+	case strings.Contains(dt, "REAL"), strings.Contains(dt, "FLOA"), strings.Contains(dt, "DOUB"), strings.Contains(dt, "NUMERIC"), strings.Contains(dt, "DECIMAL"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeFloat
+	}
+	return schema.SchemaJsonTablesElemColumnsElemTypeString
+}
+
+// setType sets the type of the column from the type in the statement
+func (m *model) setType(col *schema.SchemaJsonTablesElemColumnsElem, dt dataType) {
+	col.IsArray = dt.isArray
+	col.Enum = nil
+	col.MaxLength = nil
+	col.Length = nil
+	suffix := ""
+	if dt.isArray {
+		suffix = "[]"
+	}
+	if enum := schema.FindEnum(m.dbschema.Enums, dt.name); enum != nil {
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeString
+		col.Enum = util.Ptr(enum.Name)
+		col.NativeType = schema.ToNativeType(m.driver, enum.Name+suffix)
+		return
+	}
+	name := dt.name
+	if m.driver == schema.DatabaseDriverPostgres {
+		if strings.Contains(name, "serial") {
+			col.AutoIncrement = util.Ptr(true)
+		}
+		if alias, ok := postgresTypes[name]; ok {
+			name = alias
+		}
+	}
+	native := name
+	if len(dt.args) > 0 {
+		native += "(" + strings.Join(dt.args, ",") + ")"
+	}
+	col.NativeType = schema.ToNativeType(m.driver, native+dt.modifiers+suffix)
+	switch {
+	case m.driver == schema.DatabaseDriverMysql && native == "tinyint(1)":
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeBoolean
+	case slices.Contains(intTypes, name):
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeInt
+	case slices.Contains(floatTypes, name):
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeFloat
+	case slices.Contains(datetimeTypes, name):
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeDatetime
+	case slices.Contains(booleanTypes, name):
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeBoolean
+	case slices.Contains(stringTypes, name):
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeString
+	case m.driver == schema.DatabaseDriverSQLite:
+		col.Type = sqliteType(name)
+	default:
+		m.warn("unknown type %s of column %s is imported as a string", dt.name, col.Name)
+		col.Type = schema.SchemaJsonTablesElemColumnsElemTypeString
+	}
+	switch {
+	case slices.Contains(maxLengthTypes, name) && len(dt.args) == 1:
+		if n, err := strconv.Atoi(dt.args[0]); err == nil {
+			col.MaxLength = util.Ptr(n)
+		}
+	case (name == "numeric" || name == "decimal") && len(dt.args) > 0:
+		precision, err := strconv.Atoi(dt.args[0])
+		if err != nil {
+			break
+		}
+		col.Length = &schema.SchemaJsonTablesElemColumnsElemLength{Precision: precision}
+		if len(dt.args) > 1 {
+			if scale, err := strconv.ParseFloat(dt.args[1], 64); err == nil && scale != 0 {
+				col.Length.Scale = util.Ptr(scale)
+			}
+		}
+	}
+}
+
+// setDefault sets the default of the column from the expression in the statement
+func (m *model) setDefault(col *schema.SchemaJsonTablesElemColumnsElem, expr string) {
+	val := strings.TrimSpace(expr)
+	lower := strings.ToLower(val)
+	switch {
+	case lower == "null" || strings.HasPrefix(lower, "null::"):
+		col.Default = nil
+		return
+	case strings.HasPrefix(lower, "nextval("):
+		// a sequence is how postgres auto increments a column
+		col.AutoIncrement = util.Ptr(true)
+		col.Default = nil
+		return
+	case lower == "true" || lower == "false":
+		val = lower
+	}
+	if match := castLiteral.FindStringSubmatch(val); match != nil {
+		val = match[1]
+	}
+	if len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'' {
+		val = strings.ReplaceAll(val[1:len(val)-1], "''", "'")
+	}
+	col.Default = schema.ToNativeDefault(m.driver, util.Ptr(val))
+}
+
+// isColumnConstraint returns true if the next token starts a column constraint and so ends a default expression
+func isColumnConstraint(p *parser) bool {
+	for _, keyword := range []string{"not", "null", "primary", "unique", "references", "check", "constraint", "collate", "generated", "auto_increment", "autoincrement", "comment", "on", "character", "charset", "first", "after", "default"} {
+		if p.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// column returns the column defined by the next element of a table definition. the unique constraints with a name
+// of their own are added to the table.
+func (m *model) column(p *parser, table *schema.SchemaJsonTablesElem) (schema.SchemaJsonTablesElemColumnsElem, error) {
+	var col schema.SchemaJsonTablesElemColumnsElem
+	name, err := p.name()
+	if err != nil {
+		return col, err
+	}
+	col.Name = name
+	dt, err := p.dataType()
+	if err != nil {
+		return col, err
+	}
+	m.setType(&col, dt)
+	nullable := true
+	var constraintName string
+	for !p.done() && !p.is(",") && !p.is(")") {
+		named := constraintName
+		constraintName = ""
+		switch {
+		case p.accept("constraint"):
+			if constraintName, err = p.name(); err != nil {
+				return col, err
+			}
+		case p.accept("not", "null"):
+			nullable = false
+		case p.accept("null"):
+			nullable = true
+		case p.accept("default"):
+			m.setDefault(&col, p.expression(isColumnConstraint))
+		case p.accept("primary", "key"):
+			p.acceptAny("asc", "desc")
+			col.PrimaryKey = util.Ptr(true)
+			nullable = false
+		case p.accept("unique"):
+			p.accept("key")
+			m.addUnique(table, &col, named, []string{col.Name})
+		case p.accept("references"):
+			ref, err := m.references(p)
+			if err != nil {
+				return col, err
+			}
+			if named != "" && named != schema.ForeignKeyName(table.Name, col.Name, *ref) {
+				ref.Name = util.Ptr(named)
+			}
+			col.References = ref
+		case p.accept("check"):
+			expr, err := p.group()
+			if err != nil {
+				return col, err
+			}
+			if named == "" {
+				named = table.Name + "_" + col.Name + "_check"
+			}
+			check := schema.SchemaJsonTablesElemColumnsElemChecksElem{Name: named, Expression: expr}
+			if p.accept("not", "valid") {
+				check.NotValid = util.Ptr(true)
+			}
+			col.Checks = append(col.Checks, check)
+		case p.accept("collate"):
+			if _, err := p.name(); err != nil {
+				return col, err
+			}
+		case p.acceptAny("auto_increment", "autoincrement") != "":
+			col.AutoIncrement = util.Ptr(true)
+		case p.accept("generated"):
+			if !p.accept("always") && !p.accept("by", "default") {
+				return col, fmt.Errorf("expected always or by default but found %s", p.peek())
+			}
+			if err := p.expect("as"); err != nil {
+				return col, err
+			}
+			if !p.accept("identity") {
+				return col, fmt.Errorf("generated column %s isn't supported", col.Name)
+			}
+			if p.is("(") {
+				if _, err := p.group(); err != nil {
+					return col, err
+				}
+			}
+			col.AutoIncrement = util.Ptr(true)
+		case p.accept("comment"):
+			description, err := p.str()
+			if err != nil {
+				return col, err
+			}
+			col.Description = util.Ptr(description)
+		case p.accept("on", "update"):
+			expr := p.expression(isColumnConstraint)
+			m.warn("on update %s of column %s is ignored", expr, col.Name)
+		case p.accept("character", "set"), p.accept("charset"):
+			if _, err := p.name(); err != nil {
+				return col, err
+			}
+		case p.accept("first"):
+		case p.accept("after"):
+			if _, err := p.name(); err != nil {
+				return col, err
+			}
+		default:
+			return col, fmt.Errorf("unexpected %s in column %s", p.peek(), col.Name)
+		}
+	}
+	col.Nullable = util.Ptr(nullable)
+	return col, nil
+}
+
+// addUnique adds a unique constraint for the columns. a constraint on only the column with the default name is the
+// same as marking the column unique.
+func (m *model) addUnique(table *schema.SchemaJsonTablesElem, col *schema.SchemaJsonTablesElemColumnsElem, name string, columns []string) {
+	if len(columns) == 1 && (name == "" || name == schema.UniqueConstraintName(table.Name, columns[0])) {
+		if col == nil {
+			var err error
+			if col, err = findColumn(table, columns[0]); err != nil {
+				col = nil
+			}
+		}
+		if col != nil {
+			col.Unique = util.Ptr(true)
+			return
+		}
+	}
+	if name == "" {
+		name = table.Name + "_" + strings.Join(columns, "_") + "_key"
+	}
+	table.UniqueConstraints = append(table.UniqueConstraints, schema.SchemaJsonTablesElemUniqueConstraintsElem{Name: name, Columns: columns})
+}
+
+// referenceAction returns the action of an on delete or on update clause
+func (p *parser) referenceAction() (string, error) {
+	switch {
+	case p.accept("cascade"):
+		return "cascade", nil
+	case p.accept("restrict"):
+		return "restrict", nil
+	case p.accept("no", "action"):
+		return "no action", nil
+	case p.accept("set", "null"):
+		return "set null", nil
+	case p.accept("set", "default"):
+		return "set default", nil
+	}
+	return "", fmt.Errorf("expected a reference action but found %s", p.peek())
+}
+
+// references returns the reference which follows the references keyword
+func (m *model) references(p *parser) (*schema.SchemaJsonTablesElemColumnsElemReferences, error) {
+	tableName, err := m.tableName(p)
+	if err != nil {
+		return nil, err
+	}
+	ref := &schema.SchemaJsonTablesElemColumnsElemReferences{Table: tableName}
+	if p.is("(") {
+		columns, err := p.names()
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("foreign keys with more than one column aren't supported")
+		}
+		ref.Column = columns[0]
+	} else {
+		// the primary key of the table is referenced when there are no columns
+		table, err := m.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+		primaryKey := schema.TablePrimaryKey(*table)
+		if len(primaryKey) != 1 {
+			return nil, fmt.Errorf("table %s doesn't have a primary key with one column to reference", tableName)
+		}
+		ref.Column = primaryKey[0]
+	}
+	for {
+		switch {
+		case p.accept("on", "delete"):
+			action, err := p.referenceAction()
+			if err != nil {
+				return nil, err
+			}
+			if action != string(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteNoAction) {
+				ref.OnDelete = util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDelete(action))
+			}
+		case p.accept("on", "update"):
+			action, err := p.referenceAction()
+			if err != nil {
+				return nil, err
+			}
+			if action != string(schema.SchemaJsonTablesElemColumnsElemReferencesOnUpdateNoAction) {
+				ref.OnUpdate = util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnUpdate(action))
+			}
+		case p.accept("deferrable"):
+			ref.Deferrable = util.Ptr(true)
+		case p.accept("not", "deferrable"):
+			ref.Deferrable = nil
+		case p.accept("initially"):
+			p.acceptAny("deferred", "immediate")
+		case p.accept("match"):
+			p.acceptAny("full", "partial", "simple")
+		default:
+			return ref, nil
+		}
+	}
+}
+
+// tableConstraint adds the constraint defined by the next element of a table definition to the table
+func (m *model) tableConstraint(p *parser, table *schema.SchemaJsonTablesElem) error {
+	var name string
+	if p.accept("constraint") {
+		var err error
+		if name, err = p.name(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.accept("primary", "key"):
+		columns, err := p.names()
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			col, err := findColumn(table, column)
+			if err != nil {
+				return err
+			}
+			col.Nullable = util.Ptr(false)
+			if len(columns) == 1 {
+				col.PrimaryKey = util.Ptr(true)
+			}
+		}
+		if len(columns) > 1 {
+			table.PrimaryKey = columns
+		}
+	case p.accept("unique"):
+		if p.acceptAny("key", "index") != "" || (m.driver == schema.DatabaseDriverMysql && !p.is("(")) {
+			if !p.is("(") {
+				var err error
+				if name, err = p.name(); err != nil {
+					return err
+				}
+			}
+		}
+		columns, err := p.names()
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if _, err := findColumn(table, column); err != nil {
+				return err
+			}
+		}
+		m.addUnique(table, nil, name, columns)
+	case p.accept("foreign", "key"):
+		if !p.is("(") {
+			// mysql allows the name after the keywords
+			var err error
+			if name, err = p.name(); err != nil {
+				return err
+			}
+		}
+		columns, err := p.names()
+		if err != nil {
+			return err
+		}
+		if len(columns) != 1 {
+			return fmt.Errorf("foreign keys with more than one column aren't supported")
+		}
+		if err := p.expect("references"); err != nil {
+			return err
+		}
+		ref, err := m.references(p)
+		if err != nil {
+			return err
+		}
+		col, err := findColumn(table, columns[0])
+		if err != nil {
+			return err
+		}
+		if name != "" && name != schema.ForeignKeyName(table.Name, col.Name, *ref) {
+			ref.Name = util.Ptr(name)
+		}
+		col.References = ref
+	case p.accept("check"):
+		expr, err := p.group()
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = table.Name + "_check"
+		}
+		check := schema.SchemaJsonTablesElemChecksElem{Name: name, Expression: expr}
+		if p.accept("not", "valid") {
+			check.NotValid = util.Ptr(true)
+		}
+		table.Checks = append(table.Checks, check)
+	case m.driver == schema.DatabaseDriverMysql && (p.is("key") || p.is("index") || p.is("fulltext") || p.is("spatial")):
+		if kind := p.acceptAny("fulltext", "spatial"); kind != "" {
+			m.warn("%s index of table %s is imported as a regular index", kind, table.Name)
+		}
+		p.acceptAny("key", "index")
+		if !p.is("(") {
+			var err error
+			if name, err = p.name(); err != nil {
+				return err
+			}
+		}
+		return m.addIndex(p, table, name, false)
+	default:
+		return fmt.Errorf("unsupported constraint %s", p.peek())
+	}
+	if !p.done() && !p.is(",") && !p.is(")") {
+		return fmt.Errorf("unexpected %s in constraint of table %s", p.peek(), table.Name)
+	}
+	return nil
+}
+
+// addIndex adds the index on the columns or expression in the parens which follow to the table
+func (m *model) addIndex(p *parser, table *schema.SchemaJsonTablesElem, name string, unique bool) error {
+	index := schema.SchemaJsonTablesElemIndexesElem{Name: name}
+	if unique {
+		index.Unique = util.Ptr(true)
+	}
+	if p.accept("using") {
+		method := strings.ToLower(p.next().val)
+		switch schema.SchemaJsonTablesElemIndexesElemMethod(method) {
+		case schema.SchemaJsonTablesElemIndexesElemMethodBtree:
+		case schema.SchemaJsonTablesElemIndexesElemMethodGin, schema.SchemaJsonTablesElemIndexesElemMethodGist, schema.SchemaJsonTablesElemIndexesElemMethodHash:
+			index.Method = util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethod(method))
+		default:
+			m.warn("index method %s of %s isn't supported and is imported as btree", method, table.Name)
+		}
+	}
+	start := p.pos
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	var columns []string
+	var isExpression bool
+	for {
+		tok := p.peek()
+		next := p.peekAt(1)
+		if (tok.kind == tokenWord || tok.kind == tokenIdent) && (next.matches(",") || next.matches(")") || next.matches("asc") || next.matches("desc") || next.matches("nulls")) {
+			column, _ := p.name()
+			col := schema.SchemaJsonTablesElemIndexesElemColumnsElem{Name: column}
+			if p.acceptAny("asc", "desc") == "desc" {
+				col.Order = util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)
+			}
+			if p.accept("nulls") {
+				p.acceptAny("first", "last")
+			}
+			index.Columns = append(index.Columns, col)
+			columns = append(columns, column)
+		} else {
+			isExpression = true
+			p.expression(nil)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+	if isExpression {
+		end := p.pos
+		p.pos = start
+		expr, err := p.group()
+		if err != nil {
+			return err
+		}
+		p.pos = end
+		index.Columns = nil
+		index.Expression = util.Ptr(expr)
+	} else {
+		for _, column := range columns {
+			if _, err := findColumn(table, column); err != nil {
+				return err
+			}
+		}
+	}
+	if index.Name == "" {
+		if isExpression {
+			index.Name = table.Name + "_expr_idx"
+		} else {
+			index.Name = table.Name + "_" + strings.Join(columns, "_") + "_idx"
+		}
+	}
+	for !p.done() && !p.is(",") && !p.is(")") {
+		switch {
+		case p.accept("where"):
+			index.Where = util.Ptr(p.expression(nil))
+		case p.accept("using"):
+			p.next()
+		case p.accept("include"), p.accept("with"):
+			if _, err := p.group(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected %s in index %s", p.peek(), index.Name)
+		}
+	}
+	table.Indexes = append(table.Indexes, index)
+	return nil
+}
+
+// findIndex returns the table and offset of the index with the name in the namespace
+func (m *model) findIndex(namespace string, name string) (*schema.SchemaJsonTablesElem, int) {
+	for i, table := range m.dbschema.Tables {
+		if table.Schema != nil && *table.Schema != namespace || table.Schema == nil && namespace != "" {
+			continue
+		}
+		for j, index := range table.Indexes {
+			if index.Name == name {
+				return &m.dbschema.Tables[i], j
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (m *model) createIndex(p *parser, unique bool) error {
+	p.accept("concurrently")
+	ifNotExists := p.accept("if", "not", "exists")
+	var name string
+	if !p.is("on") {
+		var err error
+		if _, name, err = p.qualifiedName(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("on"); err != nil {
+		return err
+	}
+	p.accept("only")
+	tableName, err := m.tableName(p)
+	if err != nil {
+		return err
+	}
+	table, err := m.table(tableName)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		namespace := ""
+		if table.Schema != nil {
+			namespace = *table.Schema
+		}
+		if existing, _ := m.findIndex(namespace, name); existing != nil {
+			if ifNotExists {
+				p.pos = len(p.tokens)
+				return nil
+			}
+			return fmt.Errorf("index %s already exists", name)
+		}
+	}
+	return m.addIndex(p, table, name, unique)
+}
+
+// dropIndex removes the index with the name, returning false if it doesn't exist
+func (m *model) dropIndex(namespace string, name string) bool {
+	table, i := m.findIndex(namespace, name)
+	if table == nil {
+		return false
+	}
+	table.Indexes = slices.Delete(table.Indexes, i, i+1)
+	return true
+}
+
+func (m *model) dropIndexes(p *parser) error {
+	p.accept("concurrently")
+	ifExists := p.accept("if", "exists")
+	for {
+		namespace, name, err := p.qualifiedName()
+		if err != nil {
+			return err
+		}
+		namespace = m.namespace(namespace)
+		if p.accept("on") {
+			// mysql names the table of the index
+			tableName, err := m.tableName(p)
+			if err != nil {
+				return err
+			}
+			table, err := m.table(tableName)
+			if err != nil {
+				return err
+			}
+			if table.Schema != nil {
+				namespace = *table.Schema
+			}
+		}
+		if !m.dropIndex(namespace, name) && !ifExists {
+			return fmt.Errorf("index %s doesn't exist", name)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.acceptAny("cascade", "restrict")
+	return nil
+}
+
+func (m *model) alterIndex(p *parser) error {
+	ifExists := p.accept("if", "exists")
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("rename", "to"); err != nil {
+		return err
+	}
+	newName, err := p.name()
+	if err != nil {
+		return err
+	}
+	table, i := m.findIndex(m.namespace(namespace), name)
+	if table == nil {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("index %s doesn't exist", name)
+	}
+	table.Indexes[i].Name = newName
+	return nil
+}
+
+// renameColumn renames the column along with the keys, indexes and references which use it
+func (m *model) renameColumn(table *schema.SchemaJsonTablesElem, name string, newName string) error {
+	col, err := findColumn(table, name)
+	if err != nil {
+		return err
+	}
+	col.Name = newName
+	rename := func(columns []string) {
+		for i, column := range columns {
+			if column == name {
+				columns[i] = newName
+			}
+		}
+	}
+	rename(table.PrimaryKey)
+	for _, unique := range table.UniqueConstraints {
+		rename(unique.Columns)
+	}
+	for _, index := range table.Indexes {
+		for i, column := range index.Columns {
+			if column.Name == name {
+				index.Columns[i].Name = newName
+			}
+		}
+	}
+	qualifiedName := schema.TableQualifiedName(*table)
+	for i := range m.dbschema.Tables {
+		for j, col := range m.dbschema.Tables[i].Columns {
+			if col.References != nil && col.References.Table == qualifiedName && col.References.Column == name {
+				m.dbschema.Tables[i].Columns[j].References.Column = newName
+			}
+		}
+	}
+	return nil
+}
+
+// dropColumn removes the column along with the keys and indexes which use it
+func (m *model) dropColumn(table *schema.SchemaJsonTablesElem, name string) error {
+	if _, err := findColumn(table, name); err != nil {
+		return err
+	}
+	table.Columns = slices.DeleteFunc(table.Columns, func(col schema.SchemaJsonTablesElemColumnsElem) bool {
+		return col.Name == name
+	})
+	table.PrimaryKey = slices.DeleteFunc(table.PrimaryKey, func(column string) bool { return column == name })
+	table.UniqueConstraints = slices.DeleteFunc(table.UniqueConstraints, func(unique schema.SchemaJsonTablesElemUniqueConstraintsElem) bool {
+		return slices.Contains(unique.Columns, name)
+	})
+	table.Indexes = slices.DeleteFunc(table.Indexes, func(index schema.SchemaJsonTablesElemIndexesElem) bool {
+		return slices.ContainsFunc(index.Columns, func(col schema.SchemaJsonTablesElemIndexesElemColumnsElem) bool { return col.Name == name })
+	})
+	m.dropReferences(schema.TableQualifiedName(*table), name)
+	return nil
+}
+
+// dropReferences removes the references to the column of the table, or to any of its columns when column is empty
+func (m *model) dropReferences(table string, column string) {
+	for i := range m.dbschema.Tables {
+		for j, col := range m.dbschema.Tables[i].Columns {
+			if col.References != nil && col.References.Table == table && (column == "" || col.References.Column == column) {
+				m.dbschema.Tables[i].Columns[j].References = nil
+			}
+		}
+	}
+}
+
+// dropConstraint removes the constraint with the name from the table
+func (m *model) dropConstraint(table *schema.SchemaJsonTablesElem, name string) error {
+	if name == table.Name+"_pkey" || (m.driver == schema.DatabaseDriverMysql && strings.EqualFold(name, "primary")) {
+		dropPrimaryKey(table)
+		return nil
+	}
+	for i, unique := range table.UniqueConstraints {
+		if unique.Name == name {
+			table.UniqueConstraints = slices.Delete(table.UniqueConstraints, i, i+1)
+			return nil
+		}
+	}
+	for i, check := range table.Checks {
+		if check.Name == name {
+			table.Checks = slices.Delete(table.Checks, i, i+1)
+			return nil
+		}
+	}
+	for i, col := range table.Columns {
+		if col.Unique != nil && *col.Unique && schema.UniqueConstraintName(table.Name, col.Name) == name {
+			table.Columns[i].Unique = nil
+			return nil
+		}
+		if col.References != nil && schema.ForeignKeyName(table.Name, col.Name, *col.References) == name {
+			table.Columns[i].References = nil
+			return nil
+		}
+		for j, check := range col.Checks {
+			if check.Name == name {
+				table.Columns[i].Checks = slices.Delete(col.Checks, j, j+1)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("constraint %s doesn't exist in table %s", name, table.Name)
+}
+
+func dropPrimaryKey(table *schema.SchemaJsonTablesElem) {
+	table.PrimaryKey = nil
+	for i, col := range table.Columns {
+		if col.PrimaryKey != nil && *col.PrimaryKey {
+			table.Columns[i].PrimaryKey = nil
+		}
+	}
+}
+
+// validateConstraint marks the check constraint with the name as valid
+func (m *model) validateConstraint(table *schema.SchemaJsonTablesElem, name string) {
+	for i, check := range table.Checks {
+		if check.Name == name {
+			table.Checks[i].NotValid = nil
+		}
+	}
+	for i, col := range table.Columns {
+		for j, check := range col.Checks {
+			if check.Name == name {
+				table.Columns[i].Checks[j].NotValid = nil
+			}
+		}
+	}
+}
+
+// renameTable renames the table along with the references to it
+func (m *model) renameTable(table *schema.SchemaJsonTablesElem, newName string) error {
+	namespace := ""
+	if table.Schema != nil {
+		namespace = *table.Schema
+	}
+	qualifiedName := schema.QualifiedName(namespace, newName)
+	if schema.FindTable(m.dbschema.Tables, qualifiedName) != nil {
+		return fmt.Errorf("table %s already exists", qualifiedName)
+	}
+	previous := schema.TableQualifiedName(*table)
+	table.Name = newName
+	for i := range m.dbschema.Tables {
+		for j, col := range m.dbschema.Tables[i].Columns {
+			if col.References != nil && col.References.Table == previous {
+				m.dbschema.Tables[i].Columns[j].References.Table = qualifiedName
+			}
+		}
+	}
+	return nil
+}
+
+func (m *model) alterTable(p *parser) error {
+	ifExists := p.accept("if", "exists")
+	p.accept("only")
+	tableName, err := m.tableName(p)
+	if err != nil {
+		return err
+	}
+	table := schema.FindTable(m.dbschema.Tables, tableName)
+	if table == nil {
+		if ifExists {
+			p.pos = len(p.tokens)
+			return nil
+		}
+		return fmt.Errorf("table %s doesn't exist", tableName)
+	}
+	for {
+		if err := m.alterTableAction(p, table); err != nil {
+			return err
+		}
+		if !p.accept(",") {
+			return nil
+		}
+	}
+}
+
+func (m *model) alterTableAction(p *parser, table *schema.SchemaJsonTablesElem) error {
+	switch {
+	case p.accept("add"):
+		if m.isTableConstraint(p) {
+			return m.tableConstraint(p, table)
+		}
+		p.accept("column")
+		if p.accept("if", "not", "exists") {
+			if name := p.peek(); name.kind == tokenWord || name.kind == tokenIdent {
+				if _, err := findColumn(table, strings.ToLower(name.val)); err == nil {
+					p.skipElement()
+					return nil
+				}
+			}
+		}
+		col, err := m.column(p, table)
+		if err != nil {
+			return err
+		}
+		if _, err := findColumn(table, col.Name); err == nil {
+			return fmt.Errorf("column %s already exists in table %s", col.Name, table.Name)
+		}
+		table.Columns = append(table.Columns, col)
+	case p.accept("drop"):
+		switch {
+		case p.accept("constraint"):
+			ifExists := p.accept("if", "exists")
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := m.dropConstraint(table, name); err != nil && !ifExists {
+				return err
+			}
+		case p.accept("primary", "key"):
+			dropPrimaryKey(table)
+		case p.accept("foreign", "key"), p.accept("check"):
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := m.dropConstraint(table, name); err != nil {
+				return err
+			}
+		case p.acceptAny("index", "key") != "":
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if i := slices.IndexFunc(table.Indexes, func(index schema.SchemaJsonTablesElemIndexesElem) bool { return index.Name == name }); i >= 0 {
+				table.Indexes = slices.Delete(table.Indexes, i, i+1)
+			} else if err := m.dropConstraint(table, name); err != nil {
+				// mysql unique constraints are indexes
+				return fmt.Errorf("index %s doesn't exist in table %s", name, table.Name)
+			}
+		default:
+			p.accept("column")
+			ifExists := p.accept("if", "exists")
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := m.dropColumn(table, name); err != nil && !ifExists {
+				return err
+			}
+		}
+		p.acceptAny("cascade", "restrict")
+	case p.accept("rename"):
+		switch {
+		case p.acceptAny("to", "as") != "":
+			_, newName, err := p.qualifiedName()
+			if err != nil {
+				return err
+			}
+			return m.renameTable(table, newName)
+		case p.accept("constraint"):
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("to"); err != nil {
+				return err
+			}
+			newName, err := p.name()
+			if err != nil {
+				return err
+			}
+			return m.renameConstraint(table, name, newName)
+		case p.acceptAny("index", "key") != "":
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("to"); err != nil {
+				return err
+			}
+			newName, err := p.name()
+			if err != nil {
+				return err
+			}
+			i := slices.IndexFunc(table.Indexes, func(index schema.SchemaJsonTablesElemIndexesElem) bool { return index.Name == name })
+			if i < 0 {
+				return fmt.Errorf("index %s doesn't exist in table %s", name, table.Name)
+			}
+			table.Indexes[i].Name = newName
+		default:
+			p.accept("column")
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("to"); err != nil {
+				return err
+			}
+			newName, err := p.name()
+			if err != nil {
+				return err
+			}
+			return m.renameColumn(table, name, newName)
+		}
+	case p.accept("alter"):
+		p.accept("column")
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		col, err := findColumn(table, name)
+		if err != nil {
+			return err
+		}
+		return m.alterColumn(p, col)
+	case p.accept("modify"):
+		p.accept("column")
+		col, err := m.column(p, table)
+		if err != nil {
+			return err
+		}
+		existing, err := findColumn(table, col.Name)
+		if err != nil {
+			return err
+		}
+		*existing = col
+	case p.accept("change"):
+		p.accept("column")
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		col, err := m.column(p, table)
+		if err != nil {
+			return err
+		}
+		if col.Name != name {
+			if err := m.renameColumn(table, name, col.Name); err != nil {
+				return err
+			}
+		}
+		existing, err := findColumn(table, col.Name)
+		if err != nil {
+			return err
+		}
+		*existing = col
+	case p.accept("validate", "constraint"):
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		m.validateConstraint(table, name)
+	default:
+		return fmt.Errorf("unsupported alter table action %s", p.peek())
+	}
+	return nil
+}
+
+// renameConstraint renames the constraint with the name in the table
+func (m *model) renameConstraint(table *schema.SchemaJsonTablesElem, name string, newName string) error {
+	for i, unique := range table.UniqueConstraints {
+		if unique.Name == name {
+			table.UniqueConstraints[i].Name = newName
+			return nil
+		}
+	}
+	for i, check := range table.Checks {
+		if check.Name == name {
+			table.Checks[i].Name = newName
+			return nil
+		}
+	}
+	for i, col := range table.Columns {
+		if col.Unique != nil && *col.Unique && schema.UniqueConstraintName(table.Name, col.Name) == name {
+			table.Columns[i].Unique = nil
+			table.UniqueConstraints = append(table.UniqueConstraints, schema.SchemaJsonTablesElemUniqueConstraintsElem{Name: newName, Columns: []string{col.Name}})
+			return nil
+		}
+		if col.References != nil && schema.ForeignKeyName(table.Name, col.Name, *col.References) == name {
+			table.Columns[i].References.Name = util.Ptr(newName)
+			return nil
+		}
+		for j, check := range col.Checks {
+			if check.Name == name {
+				table.Columns[i].Checks[j].Name = newName
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("constraint %s doesn't exist in table %s", name, table.Name)
+}
+
+func (m *model) alterColumn(p *parser, col *schema.SchemaJsonTablesElemColumnsElem) error {
+	switch {
+	case p.accept("type"), p.accept("set", "data", "type"):
+		dt, err := p.dataType()
+		if err != nil {
+			return err
+		}
+		m.setType(col, dt)
+		if p.accept("collate") {
+			if _, err := p.name(); err != nil {
+				return err
+			}
+		}
+		if p.accept("using") {
+			p.expression(nil)
+		}
+	case p.accept("set", "not", "null"):
+		col.Nullable = util.Ptr(false)
+	case p.accept("drop", "not", "null"):
+		col.Nullable = util.Ptr(true)
+	case p.accept("set", "default"):
+		m.setDefault(col, p.expression(nil))
+	case p.accept("drop", "default"):
+		col.Default = nil
+	case p.accept("add", "generated"):
+		if !p.accept("always") && !p.accept("by", "default") {
+			return fmt.Errorf("expected always or by default but found %s", p.peek())
+		}
+		if err := p.expect("as", "identity"); err != nil {
+			return err
+		}
+		if p.is("(") {
+			if _, err := p.group(); err != nil {
+				return err
+			}
+		}
+		col.AutoIncrement = util.Ptr(true)
+	case p.accept("drop", "identity"):
+		p.accept("if", "exists")
+		col.AutoIncrement = nil
+	default:
+		return fmt.Errorf("unsupported alter column action %s", p.peek())
+	}
+	return nil
+}
+
+func (m *model) dropTables(p *parser) error {
+	ifExists := p.accept("if", "exists")
+	for {
+		tableName, err := m.tableName(p)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(m.dbschema.Tables, func(table schema.SchemaJsonTablesElem) bool {
+			return schema.TableQualifiedName(table) == tableName
+		})
+		switch {
+		case i >= 0:
+			m.dbschema.Tables = slices.Delete(m.dbschema.Tables, i, i+1)
+			m.dropReferences(tableName, "")
+		case !ifExists:
+			return fmt.Errorf("table %s doesn't exist", tableName)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.acceptAny("cascade", "restrict")
+	return nil
+}
+
+func (m *model) createType(p *parser) error {
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	name = schema.QualifiedName(m.namespace(namespace), name)
+	if err := p.expect("as", "enum", "("); err != nil {
+		return err
+	}
+	var values []string
+	for !p.is(")") {
+		value, err := p.str()
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+	if schema.FindEnum(m.dbschema.Enums, name) != nil {
+		return fmt.Errorf("type %s already exists", name)
+	}
+	m.dbschema.Enums = append(m.dbschema.Enums, schema.SchemaJsonEnumsElem{Name: name, Values: values})
+	return nil
+}
+
+func (m *model) enum(p *parser) (*schema.SchemaJsonEnumsElem, error) {
+	namespace, name, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	name = schema.QualifiedName(m.namespace(namespace), name)
+	enum := schema.FindEnum(m.dbschema.Enums, name)
+	if enum == nil {
+		return nil, fmt.Errorf("type %s doesn't exist", name)
+	}
+	return enum, nil
+}
+
+func (m *model) alterType(p *parser) error {
+	enum, err := m.enum(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.accept("add", "value"):
+		ifNotExists := p.accept("if", "not", "exists")
+		value, err := p.str()
+		if err != nil {
+			return err
+		}
+		if slices.Contains(enum.Values, value) {
+			if ifNotExists {
+				p.pos = len(p.tokens)
+				return nil
+			}
+			return fmt.Errorf("value %s already exists in type %s", value, enum.Name)
+		}
+		i := len(enum.Values)
+		if position := p.acceptAny("before", "after"); position != "" {
+			other, err := p.str()
+			if err != nil {
+				return err
+			}
+			if i = slices.Index(enum.Values, other); i < 0 {
+				return fmt.Errorf("value %s doesn't exist in type %s", other, enum.Name)
+			}
+			if position == "after" {
+				i++
+			}
+		}
+		enum.Values = slices.Insert(enum.Values, i, value)
+	case p.accept("rename", "value"):
+		value, err := p.str()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("to"); err != nil {
+			return err
+		}
+		newValue, err := p.str()
+		if err != nil {
+			return err
+		}
+		i := slices.Index(enum.Values, value)
+		if i < 0 {
+			return fmt.Errorf("value %s doesn't exist in type %s", value, enum.Name)
+		}
+		enum.Values[i] = newValue
+	case p.accept("rename", "to"):
+		newName, err := p.name()
+		if err != nil {
+			return err
+		}
+		for i := range m.dbschema.Tables {
+			for j, col := range m.dbschema.Tables[i].Columns {
+				if col.Enum != nil && *col.Enum == enum.Name {
+					suffix := ""
+					if col.IsArray {
+						suffix = "[]"
+					}
+					m.dbschema.Tables[i].Columns[j].Enum = util.Ptr(newName)
+					m.dbschema.Tables[i].Columns[j].NativeType = schema.ToNativeType(m.driver, newName+suffix)
+				}
+			}
+		}
+		enum.Name = newName
+	default:
+		return fmt.Errorf("unsupported alter type action %s", p.peek())
+	}
+	return nil
+}
+
+func (m *model) dropTypes(p *parser) error {
+	ifExists := p.accept("if", "exists")
+	for {
+		namespace, name, err := p.qualifiedName()
+		if err != nil {
+			return err
+		}
+		name = schema.QualifiedName(m.namespace(namespace), name)
+		i := slices.IndexFunc(m.dbschema.Enums, func(enum schema.SchemaJsonEnumsElem) bool { return enum.Name == name })
+		switch {
+		case i >= 0:
+			m.dbschema.Enums = slices.Delete(m.dbschema.Enums, i, i+1)
+		case !ifExists:
+			return fmt.Errorf("type %s doesn't exist", name)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.acceptAny("cascade", "restrict")
+	return nil
+}
+
+func (m *model) createSchema(p *parser) error {
+	ifNotExists := p.accept("if", "not", "exists")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if p.accept("authorization") {
+		if _, err := p.name(); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(m.dbschema.Database.Schemas, name) {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("schema %s already exists", name)
+	}
+	m.dbschema.Database.Schemas = append(m.dbschema.Database.Schemas, name)
+	return nil
+}
+
+func (m *model) dropSchemas(p *parser) error {
+	ifExists := p.accept("if", "exists")
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	cascade := p.acceptAny("cascade", "restrict") == "cascade"
+	for _, name := range names {
+		i := slices.Index(m.dbschema.Database.Schemas, name)
+		if i < 0 && !ifExists {
+			return fmt.Errorf("schema %s doesn't exist", name)
+		}
+		if i >= 0 {
+			m.dbschema.Database.Schemas = slices.Delete(m.dbschema.Database.Schemas, i, i+1)
+		}
+		for _, table := range slices.Clone(m.dbschema.Tables) {
+			if table.Schema == nil || *table.Schema != name {
+				continue
+			}
+			if !cascade {
+				return fmt.Errorf("schema %s isn't empty", name)
+			}
+			m.dbschema.Tables = slices.DeleteFunc(m.dbschema.Tables, func(t schema.SchemaJsonTablesElem) bool {
+				return schema.TableQualifiedName(t) == schema.TableQualifiedName(table)
+			})
+			m.dropReferences(schema.TableQualifiedName(table), "")
+		}
+	}
+	return nil
+}
+
+func (m *model) comment(p *parser) error {
+	kind := p.acceptAny("table", "column")
+	if kind == "" {
+		return errUnsupported
+	}
+	parts := []string{}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		parts = append(parts, name)
+		if !p.accept(".") {
+			break
+		}
+	}
+	if err := p.expect("is"); err != nil {
+		return err
+	}
+	var description *string
+	if !p.accept("null") {
+		val, err := p.str()
+		if err != nil {
+			return err
+		}
+		description = util.Ptr(val)
+	}
+	var column string
+	if kind == "column" {
+		if len(parts) < 2 {
+			return fmt.Errorf("expected the table of column %s", parts[0])
+		}
+		column = parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+	tableName := parts[len(parts)-1]
+	if len(parts) > 1 {
+		tableName = schema.QualifiedName(m.namespace(parts[len(parts)-2]), tableName)
+	}
+	table, err := m.table(tableName)
+	if err != nil {
+		return err
+	}
+	if kind == "table" {
+		table.Description = description
+		return nil
+	}
+	col, err := findColumn(table, column)
+	if err != nil {
+		return err
+	}
+	col.Description = description
+	return nil
+}
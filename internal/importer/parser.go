@@ -0,0 +1,379 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // keyword or unquoted identifier
+	tokenIdent            // quoted identifier
+	tokenString           // string literal with the quotes removed
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	val   string
+	start int // offset of the token in the source
+	end   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of statement"
+	case tokenString:
+		return "'" + t.val + "'"
+	}
+	return t.val
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// quoted returns the offset after the closing quote of the quoted value starting at offset start along with the value
+// without the quotes. A doubled quote is an escaped quote and so is a quote after a backslash if backslash is true.
+func quoted(src string, start int, closing byte, backslash bool) (int, string, error) {
+	var val strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case backslash && c == '\\' && i+1 < len(src):
+			i++
+			val.WriteByte(src[i])
+		case c == closing && i+1 < len(src) && src[i+1] == closing:
+			i++
+			val.WriteByte(c)
+		case c == closing:
+			return i + 1, val.String(), nil
+		default:
+			val.WriteByte(c)
+		}
+	}
+	return 0, "", fmt.Errorf("unterminated quote starting at offset %d", start)
+}
+
+// lex returns the tokens of the sql without the whitespace and comments using the quoting rules of the driver
+func lex(driver schema.DatabaseDriverType, src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(src[i:], "--"), c == '#' && driver == schema.DatabaseDriverMysql:
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment starting at offset %d", i)
+			}
+			i += end + 4
+		case c == '\'' || (c == '"' && driver == schema.DatabaseDriverMysql):
+			end, val, err := quoted(src, i, c, driver == schema.DatabaseDriverMysql)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, val, i, end})
+			i = end
+		case (c == 'E' || c == 'e' || c == 'N' || c == 'n') && i+1 < len(src) && src[i+1] == '\'':
+			end, val, err := quoted(src, i+1, '\'', c == 'E' || c == 'e' || driver == schema.DatabaseDriverMysql)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, val, i, end})
+			i = end
+		case c == '"' || c == '`' || (c == '[' && driver == schema.DatabaseDriverSQLite):
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end, val, err := quoted(src, i, closing, false)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenIdent, val, i, end})
+			i = end
+		case c == '$' && driver == schema.DatabaseDriverPostgres:
+			// dollar quoted string such as $$value$$ or $tag$value$tag$
+			end := i + 1
+			for end < len(src) && isWordChar(src[end]) && src[end] != '$' {
+				end++
+			}
+			if end >= len(src) || src[end] != '$' {
+				tokens = append(tokens, token{tokenSymbol, "$", i, i + 1})
+				i++
+				continue
+			}
+			tag := src[i : end+1]
+			closing := strings.Index(src[end+1:], tag)
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated dollar quote starting at offset %d", i)
+			}
+			tokens = append(tokens, token{tokenString, src[end+1 : end+1+closing], i, end + 1 + closing + len(tag)})
+			i = end + 1 + closing + len(tag)
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			end := i + 1
+			for end < len(src) && (isDigit(src[end]) || src[end] == '.' || src[end] == 'e' || src[end] == 'E') {
+				end++
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:end], i, end})
+			i = end
+		case isWordStart(c):
+			end := i + 1
+			for end < len(src) && isWordChar(src[end]) {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, src[i:end], i, end})
+			i = end
+		case c == ':' && strings.HasPrefix(src[i:], "::"):
+			tokens = append(tokens, token{tokenSymbol, "::", i, i + 2})
+			i += 2
+		default:
+			tokens = append(tokens, token{tokenSymbol, string(c), i, i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// splitStatements returns the tokens of each statement which are separated by semicolons
+func splitStatements(tokens []token) [][]token {
+	var statements [][]token
+	var start int
+	for i, tok := range tokens {
+		if tok.kind == tokenSymbol && tok.val == ";" {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// parser reads the tokens of a statement
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	fold   bool // unquoted identifiers are folded to lower case
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return token{kind: tokenEOF, start: len(p.src), end: len(p.src)}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if !p.done() {
+		p.pos++
+	}
+	return tok
+}
+
+// matches returns true if the token is the keyword or symbol. quoted identifiers never match a keyword.
+func (t token) matches(val string) bool {
+	switch t.kind {
+	case tokenWord:
+		return strings.EqualFold(t.val, val)
+	case tokenSymbol:
+		return t.val == val
+	}
+	return false
+}
+
+// is returns true if the next tokens are the keywords or symbols
+func (p *parser) is(vals ...string) bool {
+	for i, val := range vals {
+		if !p.peekAt(i).matches(val) {
+			return false
+		}
+	}
+	return true
+}
+
+// accept consumes the next tokens if they're the keywords or symbols and returns true if they were
+func (p *parser) accept(vals ...string) bool {
+	if p.is(vals...) {
+		p.pos += len(vals)
+		return true
+	}
+	return false
+}
+
+// acceptAny consumes the next token if it's one of the keywords and returns it in lower case, empty if it's not
+func (p *parser) acceptAny(vals ...string) string {
+	for _, val := range vals {
+		if p.accept(val) {
+			return strings.ToLower(val)
+		}
+	}
+	return ""
+}
+
+func (p *parser) expect(vals ...string) error {
+	for _, val := range vals {
+		if !p.accept(val) {
+			return fmt.Errorf("expected %s but found %s", val, p.peek())
+		}
+	}
+	return nil
+}
+
+// name returns the next identifier
+func (p *parser) name() (string, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenIdent:
+		p.pos++
+		return tok.val, nil
+	case tokenWord:
+		p.pos++
+		if p.fold {
+			return strings.ToLower(tok.val), nil
+		}
+		return tok.val, nil
+	}
+	return "", fmt.Errorf("expected a name but found %s", tok)
+}
+
+// qualifiedName returns the namespace, empty if there isn't one, and the name of the next identifier
+func (p *parser) qualifiedName() (string, string, error) {
+	name, err := p.name()
+	if err != nil {
+		return "", "", err
+	}
+	var namespace string
+	for p.accept(".") {
+		namespace = name
+		if name, err = p.name(); err != nil {
+			return "", "", err
+		}
+	}
+	return namespace, name, nil
+}
+
+// str returns the next string literal
+func (p *parser) str() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenString {
+		return "", fmt.Errorf("expected a string but found %s", tok)
+	}
+	p.pos++
+	return tok.val, nil
+}
+
+// raw returns the source of the tokens from start up to the current token
+func (p *parser) raw(start int) string {
+	if start >= p.pos {
+		return ""
+	}
+	return strings.TrimSpace(p.src[p.tokens[start].start:p.tokens[p.pos-1].end])
+}
+
+// expression consumes the tokens up to a comma or closing paren which isn't nested or up to a token after the first one
+// for which stop returns true and returns their source
+func (p *parser) expression(stop func(p *parser) bool) string {
+	start := p.pos
+	var depth int
+	for !p.done() {
+		tok := p.peek()
+		if depth == 0 && (tok.matches(",") || tok.matches(")") || (stop != nil && p.pos > start && stop(p))) {
+			break
+		}
+		switch {
+		case tok.matches("("):
+			depth++
+		case tok.matches(")"):
+			depth--
+		}
+		p.pos++
+	}
+	return p.raw(start)
+}
+
+// group consumes a parenthesized expression and returns the source inside the parens
+func (p *parser) group() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	start := p.pos
+	for depth := 1; ; {
+		tok := p.next()
+		switch {
+		case tok.kind == tokenEOF:
+			return "", fmt.Errorf("missing closing paren")
+		case tok.matches("("):
+			depth++
+		case tok.matches(")"):
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	p.pos--
+	val := p.raw(start)
+	p.pos++
+	return val, nil
+}
+
+// names returns the parenthesized list of names, ignoring the sort order of each name
+func (p *parser) names() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		p.acceptAny("asc", "desc")
+		if !p.accept(",") {
+			break
+		}
+	}
+	return names, p.expect(")")
+}
+
+// skipElement consumes the tokens up to the comma or closing paren which ends the current element of a list
+func (p *parser) skipElement() {
+	p.expression(nil)
+}
@@ -0,0 +1,75 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenValues(tokens []token) []string {
+	var res []string
+	for _, tok := range tokens {
+		res = append(res, tok.val)
+	}
+	return res
+}
+
+func TestLex(t *testing.T) {
+	tokens, err := lex(schema.DatabaseDriverPostgres, `SELECT 'it''s', "Name", $$a;b$$, $fn$x$fn$, 1.5, x::text -- comment
+	/* block; comment */ FROM t;`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT", "it's", ",", "Name", ",", "a;b", ",", "x", ",", "1.5", ",", "x", "::", "text", "FROM", "t", ";"}, tokenValues(tokens))
+	assert.Equal(t, tokenIdent, tokens[3].kind)
+	assert.Equal(t, tokenString, tokens[5].kind)
+
+	tokens, err = lex(schema.DatabaseDriverMysql, "CREATE TABLE `t` (a text DEFAULT \"x\\\"y\") # comment")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CREATE", "TABLE", "t", "(", "a", "text", "DEFAULT", `x"y`, ")"}, tokenValues(tokens))
+
+	tokens, err = lex(schema.DatabaseDriverSQLite, "CREATE TABLE [order] (id int)")
+	assert.NoError(t, err)
+	assert.Equal(t, token{tokenIdent, "order", 13, 20}, tokens[2])
+
+	_, err = lex(schema.DatabaseDriverPostgres, "SELECT 'abc")
+	assert.EqualError(t, err, "unterminated quote starting at offset 7")
+}
+
+func TestSplitStatements(t *testing.T) {
+	tokens, err := lex(schema.DatabaseDriverPostgres, "CREATE TABLE a (id int);; COMMENT ON TABLE a IS 'x;y'; DROP TABLE a")
+	assert.NoError(t, err)
+	statements := splitStatements(tokens)
+	assert.Len(t, statements, 3)
+	assert.Equal(t, []string{"COMMENT", "ON", "TABLE", "a", "IS", "x;y"}, tokenValues(statements[1]))
+	assert.Equal(t, []string{"DROP", "TABLE", "a"}, tokenValues(statements[2]))
+}
+
+func TestParser(t *testing.T) {
+	src := `public.Users (id DESC, "Name") CHECK (a > (1 + 2)), x`
+	tokens, err := lex(schema.DatabaseDriverPostgres, src)
+	assert.NoError(t, err)
+	p := &parser{src: src, tokens: tokens, fold: true}
+	namespace, name, err := p.qualifiedName()
+	assert.NoError(t, err)
+	assert.Equal(t, "public", namespace)
+	assert.Equal(t, "users", name)
+	names, err := p.names()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "Name"}, names)
+	assert.True(t, p.accept("check"))
+	expr, err := p.group()
+	assert.NoError(t, err)
+	assert.Equal(t, "a > (1 + 2)", expr)
+	assert.True(t, p.is(","))
+	assert.False(t, p.accept(",", "y"))
+	assert.EqualError(t, p.expect("on"), "expected on but found ,")
+
+	src = `now() NOT NULL, 'x'`
+	tokens, err = lex(schema.DatabaseDriverPostgres, src)
+	assert.NoError(t, err)
+	p = &parser{src: src, tokens: tokens}
+	assert.Equal(t, "now()", p.expression(isColumnConstraint))
+	assert.True(t, p.accept("not", "null", ","))
+	assert.Equal(t, "'x'", p.expression(nil))
+	assert.True(t, p.done())
+}
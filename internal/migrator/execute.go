@@ -0,0 +1,211 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+// StatementError is returned when a statement of a migration fails
+type StatementError struct {
+	Index      int // index of the change the statement was generated for
+	Change     MigrateChanges
+	Statement  string
+	RolledBack bool // the statements executed in the same transaction were rolled back
+	Err        error
+}
+
+func (e *StatementError) Error() string {
+	msg := fmt.Sprintf("error applying change %d (%s %s): %s. statement: %s", e.Index+1, e.Change.Change, e.Change.Name(), e.Err, e.Statement)
+	if e.RolledBack {
+		msg += " (rolled back)"
+	}
+	return msg
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned when a migration fails after some of its changes were applied
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// Phase is a set of statements which are executed together
+type Phase struct {
+	Transaction bool // the statements are executed in a transaction
+	Repeat      bool // the phase is executed again until its statements affect no rows
+	Statements  []Statement
+}
+
+// Phases splits the statements into the phases they're executed in. Consecutive statements are executed in the same
+// transaction and each statement which is isolated, repeated or can't be executed in a transaction is a phase of its
+// own. No transactions are used if transactional is false.
+func Phases(statements []Statement, transactional bool) []Phase {
+	var phases []Phase
+	for _, statement := range statements {
+		inTransaction := transactional && !statement.NoTransaction
+		alone := statement.Isolated || statement.Repeat
+		if len(phases) > 0 && inTransaction && !alone && phases[len(phases)-1].Transaction && !phases[len(phases)-1].Statements[0].Isolated && !phases[len(phases)-1].Repeat {
+			phases[len(phases)-1].Statements = append(phases[len(phases)-1].Statements, statement)
+			continue
+		}
+		phases = append(phases, Phase{Transaction: inTransaction, Repeat: statement.Repeat, Statements: []Statement{statement}})
+	}
+	return phases
+}
+
+// ExecuteOptions control how the statements of a migration are executed
+type ExecuteOptions struct {
+	Transactional bool                 // execute consecutive statements in a transaction, see Phases
+	Setup         []string             // statements executed on the connection before the phases such as setting timeouts
+	Teardown      []string             // statements executed on the connection after the phases to undo the setup
+	Retries       int                  // how many times a phase is retried when it fails with an error which is retryable
+	Retryable     func(err error) bool // returns true if the phase can be retried after the error such as a lock timeout
+}
+
+// retryBaseDelay is the delay before the first retry of a phase which doubles with each retry up to retryMaxDelay
+var retryBaseDelay = time.Second
+
+const retryMaxDelay = 30 * time.Second
+
+// retryDelay returns the delay before the retry of a phase with jitter so the retries don't line up with the
+// transactions holding the lock
+func retryDelay(attempt int) time.Duration {
+	// the delay is doubled until it reaches the maximum rather than shifted by the attempt which would overflow
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, retryMaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// ExecuteStatements executes the statements generated for the changes in phases on a single connection, rolling back
+// the transaction of the phase which fails. A phase which is repeated is executed until it affects no rows, each time
+// in a transaction of its own. A StatementError is returned for the statement which failed, wrapped in a PartialError
+// if the phases before it were applied.
+func ExecuteStatements(ctx context.Context, logger logger.Logger, db *sql.DB, changes []MigrateChanges, statements []Statement, opts ExecuteOptions) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, statement := range opts.Setup {
+		logger.Trace("sql: %s", statement)
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("error preparing the connection: %w", err)
+		}
+	}
+	// the setup is undone before the connection goes back to the pool, even when a phase fails
+	defer func() {
+		for _, statement := range opts.Teardown {
+			if _, err := conn.ExecContext(context.Background(), statement); err != nil {
+				logger.Warn("error resetting the connection: %s", err)
+			}
+		}
+	}()
+	phases := Phases(statements, opts.Transactional)
+	for i, phase := range phases {
+		ts := time.Now()
+		for batch := 1; ; batch++ {
+			affected, err := executePhaseWithRetries(ctx, logger, conn, changes, phase, i, len(phases), opts)
+			if err != nil {
+				if i > 0 {
+					logger.Error("%d of %d phases were applied before the failure", i, len(phases))
+					return &PartialError{Err: err}
+				}
+				return err
+			}
+			if !phase.Repeat || affected == 0 {
+				break
+			}
+			logger.Debug("batch %d of phase %d of %d affected %d rows", batch, i+1, len(phases), affected)
+		}
+		logger.Debug("executed phase %d of %d with %d statements in %v", i+1, len(phases), len(phase.Statements), time.Since(ts))
+	}
+	return nil
+}
+
+// executePhaseWithRetries executes the phase, retrying it when it fails with an error which is retryable, and returns
+// the number of rows affected by its statements
+func executePhaseWithRetries(ctx context.Context, logger logger.Logger, conn *sql.Conn, changes []MigrateChanges, phase Phase, index int, count int, opts ExecuteOptions) (int64, error) {
+	for attempt := 1; ; attempt++ {
+		affected, err := executePhase(ctx, logger, conn, changes, phase)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("applied phase %d of %d on attempt %d", index+1, count, attempt)
+			}
+			return affected, nil
+		}
+		if attempt > opts.Retries || opts.Retryable == nil || !opts.Retryable(err) {
+			return 0, err
+		}
+		delay := retryDelay(attempt)
+		logger.Warn("attempt %d of %d for phase %d of %d failed, retrying in %v: %s", attempt, opts.Retries+1, index+1, count, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func executePhase(ctx context.Context, logger logger.Logger, db *sql.Conn, changes []MigrateChanges, phase Phase) (int64, error) {
+	var conn execer = db
+	var tx *sql.Tx
+	if phase.Transaction {
+		var err error
+		if tx, err = db.BeginTx(ctx, nil); err != nil {
+			return 0, fmt.Errorf("error starting transaction: %w", err)
+		}
+		conn = tx
+	}
+	var affected int64
+	for _, statement := range phase.Statements {
+		logger.Trace("sql: %s", statement.SQL)
+		res, err := conn.ExecContext(ctx, statement.SQL)
+		if err != nil {
+			serr := &StatementError{Index: statement.Change, Statement: statement.SQL, Err: err}
+			if statement.Change < len(changes) {
+				serr.Change = changes[statement.Change]
+			}
+			if tx != nil {
+				if rerr := tx.Rollback(); rerr != nil {
+					logger.Error("error rolling back transaction: %s", rerr)
+				} else {
+					serr.RolledBack = true
+				}
+			}
+			return 0, serr
+		}
+		if phase.Repeat {
+			if affected, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("error committing transaction: %w", err)
+		}
+	}
+	return affected, nil
+}
@@ -0,0 +1,159 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhases(t *testing.T) {
+	statements := []Statement{
+		{Change: 0, SQL: "ALTER TYPE status ADD VALUE 'a';", NoTransaction: true},
+		{Change: 1, SQL: "CREATE TABLE a (id int);"},
+		{Change: 1, SQL: "CREATE INDEX a_id_idx ON a (id);"},
+		{Change: 2, SQL: "CREATE INDEX CONCURRENTLY b_id_idx ON b (id);", NoTransaction: true},
+		{Change: 3, SQL: "DROP TABLE c;"},
+	}
+	assert.Equal(t, []Phase{
+		{Statements: statements[0:1]},
+		{Transaction: true, Statements: statements[1:3]},
+		{Statements: statements[3:4]},
+		{Transaction: true, Statements: statements[4:5]},
+	}, Phases(statements, true))
+
+	// without transactions each statement is executed on its own
+	phases := Phases(statements, false)
+	assert.Len(t, phases, len(statements))
+	for i, phase := range phases {
+		assert.False(t, phase.Transaction)
+		assert.Equal(t, statements[i:i+1], phase.Statements)
+	}
+}
+
+func TestStatementError(t *testing.T) {
+	err := &StatementError{
+		Index:     1,
+		Change:    MigrateChanges{Change: AlterEnum, Enum: &MigrateEnum{Name: "status"}},
+		Statement: "ALTER TYPE status ADD VALUE 'a';",
+		Err:       assert.AnError,
+	}
+	assert.EqualError(t, err, "error applying change 2 (alter enum status): "+assert.AnError.Error()+". statement: ALTER TYPE status ADD VALUE 'a';")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestPhasesIsolated(t *testing.T) {
+	statements := []Statement{
+		{Change: 0, SQL: "ALTER TABLE a ADD CONSTRAINT a_id_check CHECK (id > 0) NOT VALID;"},
+		{Change: 0, SQL: "ALTER TABLE a VALIDATE CONSTRAINT a_id_check;", Isolated: true},
+		{Change: 1, SQL: "UPDATE b SET id = 1;", Isolated: true},
+		{Change: 2, SQL: "DROP TABLE c;"},
+		{Change: 3, SQL: "DROP TABLE d;"},
+	}
+	assert.Equal(t, []Phase{
+		{Transaction: true, Statements: statements[0:1]},
+		{Transaction: true, Statements: statements[1:2]},
+		{Transaction: true, Statements: statements[2:3]},
+		{Transaction: true, Statements: statements[3:5]},
+	}, Phases(statements, true))
+}
+
+func TestExecuteStatementsRepeat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	statements := []Statement{
+		{Change: 0, SQL: "ALTER TABLE a ADD COLUMN b int;"},
+		{Change: 0, SQL: "UPDATE a SET b = c WHERE ctid = ANY(ARRAY(SELECT ctid FROM a WHERE b IS NULL LIMIT 2));", Isolated: true, Repeat: true},
+		{Change: 0, SQL: "ALTER TABLE a DROP COLUMN c;"},
+	}
+	phases := Phases(statements, true)
+	assert.Len(t, phases, 3)
+	assert.True(t, phases[1].Repeat)
+
+	// each batch is committed on its own until one updates no rows
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a ADD COLUMN b int;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	for _, affected := range []int64{2, 1, 0} {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE a SET b = c")).WillReturnResult(sqlmock.NewResult(0, affected))
+		mock.ExpectCommit()
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a DROP COLUMN c;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	changes := []MigrateChanges{{Change: AlterTable, Table: "a"}}
+	assert.NoError(t, ExecuteStatements(context.Background(), logger.NewTestLogger(), db, changes, statements, ExecuteOptions{Transactional: true}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteStatementsRetries(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	errLock := errors.New("canceling statement due to lock timeout")
+	statements := []Statement{
+		{Change: 0, SQL: "DROP TABLE a;"},
+		{Change: 1, SQL: "DROP TABLE b;"},
+	}
+	opts := ExecuteOptions{
+		Transactional: true,
+		Setup:         []string{"SET lock_timeout = 3000;"},
+		Teardown:      []string{"RESET lock_timeout;"},
+		Retries:       2,
+		Retryable:     func(err error) bool { return errors.Is(err, errLock) },
+	}
+	// the phase is rolled back and retried until it's applied
+	mock.ExpectExec(regexp.QuoteMeta("SET lock_timeout = 3000;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE a;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b;")).WillReturnError(errLock)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE a;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("RESET lock_timeout;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	changes := []MigrateChanges{{Change: DropTable, Table: "a"}, {Change: DropTable, Table: "b"}}
+	assert.NoError(t, ExecuteStatements(context.Background(), logger.NewTestLogger(), db, changes, statements, opts))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// the error is returned once the retries are used up
+	mock.ExpectExec(regexp.QuoteMeta("SET lock_timeout = 3000;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	for range opts.Retries + 1 {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DROP TABLE a;")).WillReturnError(errLock)
+		mock.ExpectRollback()
+	}
+	mock.ExpectExec(regexp.QuoteMeta("RESET lock_timeout;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = ExecuteStatements(context.Background(), logger.NewTestLogger(), db, changes, statements, opts)
+	assert.ErrorIs(t, err, errLock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// errors which aren't retryable fail right away
+	mock.ExpectExec(regexp.QuoteMeta("SET lock_timeout = 3000;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE a;")).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta("RESET lock_timeout;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	err = ExecuteStatements(context.Background(), logger.NewTestLogger(), db, changes, statements, opts)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt <= 100; attempt++ {
+		delay := retryDelay(attempt)
+		expected := min(retryBaseDelay<<min(attempt-1, 10), retryMaxDelay)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
@@ -0,0 +1,330 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+)
+
+// HistoryTable is the table each migration applied to the database is recorded in. It's managed by shift so it's
+// excluded when generating a schema from the database.
+const HistoryTable = "shift_migrations"
+
+// MigrationStatus is how a migration recorded in the history table ended
+type MigrationStatus string
+
+const (
+	// MigrationApplied migrations applied all of their changes
+	MigrationApplied MigrationStatus = "applied"
+	// MigrationFailed migrations failed without applying any of their changes
+	MigrationFailed MigrationStatus = "failed"
+	// MigrationPartial migrations failed after some of their changes were applied
+	MigrationPartial MigrationStatus = "partial"
+)
+
+// MigrationRecord is a migration recorded in the history table
+type MigrationRecord struct {
+	ID         int64
+	Checksum   string // SHA-256 of the target schema document
+	Plan       string // text diff of the changes applied
+	SQL        string // sql executed
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+	User       string             // OS user which ran the migration
+	Commit     string             // git commit of the schema, empty if unknown
+	FromSchema *schema.SchemaJson // schema of the database before the migration, nil if not recorded
+	ToSchema   *schema.SchemaJson // target schema of the migration, nil if not recorded
+	Status     MigrationStatus
+	Error      string // error the migration failed with, empty if it was applied
+}
+
+func historySchema() *schema.SchemaJson {
+	longtext := &schema.SchemaJsonTablesElemColumnsElemNativeType{Mysql: util.Ptr("longtext")}
+	return &schema.SchemaJson{
+		Version: "1",
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:        HistoryTable,
+				Description: util.Ptr("migrations applied by shift"),
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true), AutoIncrement: util.Ptr(true)},
+					{Name: "checksum", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(64)},
+					{Name: "plan", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: longtext},
+					{Name: "statements", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: longtext},
+					{Name: "started_at", Type: schema.SchemaJsonTablesElemColumnsElemTypeDatetime},
+					{Name: "finished_at", Type: schema.SchemaJsonTablesElemColumnsElemTypeDatetime},
+					{Name: "duration_ms", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "os_user", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(255)},
+					{Name: "git_commit", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(64), Nullable: util.Ptr(true)},
+					{Name: "from_schema", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: longtext, Nullable: util.Ptr(true)},
+					{Name: "to_schema", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: longtext, Nullable: util.Ptr(true)},
+					// the migrations recorded before the status was added were all applied
+					{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(16), Nullable: util.Ptr(true)},
+					{Name: "error_message", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: longtext, Nullable: util.Ptr(true)},
+				},
+			},
+		},
+	}
+}
+
+const historyColumns = "id, checksum, plan, statements, started_at, finished_at, duration_ms, os_user, git_commit, from_schema, to_schema, status, error_message"
+
+// historyAddedColumns are the columns of the history table which were added after it was first created. They're added
+// to the tables created before them.
+var historyAddedColumns = []string{"status", "error_message"}
+
+// placeholder returns the bind parameter for the nth (starting at 1) parameter of a query for the protocol
+func placeholder(protocol string, n int) string {
+	switch protocol {
+	case "postgres", "postgresql":
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// CreateHistoryTable creates the history table if it doesn't already exist, adding the columns it's missing if it was
+// created by an earlier version
+func CreateHistoryTable(ctx context.Context, protocol string, db *sql.DB) error {
+	dbschema := historySchema()
+	if err := Process(protocol, dbschema); err != nil {
+		return err
+	}
+	var out strings.Builder
+	if err := FromSchema(protocol, dbschema, &out); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, out.String()); err != nil {
+		return fmt.Errorf("error creating %s table: %w", HistoryTable, err)
+	}
+	generator := GetGenerator(protocol)
+	for _, column := range dbschema.Tables[0].Columns {
+		if !slices.Contains(historyAddedColumns, column.Name) {
+			continue
+		}
+		// selecting the column fails if the table doesn't have it. it's qualified by the table since sqlite treats a
+		// quoted column which doesn't exist as a string.
+		table := generator.QuoteTable(HistoryTable)
+		rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s.%s FROM %s WHERE 1 = 0", table, generator.QuoteColumn(column.Name), table))
+		if err == nil {
+			rows.Close()
+			continue
+		}
+		val, err := schema.SchemaColumnToColumn(schema.DatabaseDriverType(protocol), column, 0, generator.ToNativeType(column))
+		if err != nil {
+			return err
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", generator.QuoteTable(HistoryTable), GenerateColumnStatement(*val, generator))); err != nil {
+			return fmt.Errorf("error adding column %s to %s table: %w", column.Name, HistoryTable, err)
+		}
+	}
+	return nil
+}
+
+// HistoryTableExists returns true if the history table has been created in the database
+func HistoryTableExists(ctx context.Context, protocol string, db *sql.DB) (bool, error) {
+	var query string
+	switch protocol {
+	case "postgres", "postgresql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	case "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	default:
+		return false, fmt.Errorf("protocol: %s not supported", protocol)
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, query, HistoryTable).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// currentUser returns the name of the OS user running the migration
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, key := range []string{"USER", "USERNAME"} {
+		if val := os.Getenv(key); val != "" {
+			return val
+		}
+	}
+	return "unknown"
+}
+
+// encodeSchema returns the schema as json to record in the history table or nil if there's no schema. The database url
+// isn't recorded since it may have credentials.
+func encodeSchema(dbschema *schema.SchemaJson) (*string, error) {
+	if dbschema == nil {
+		return nil, nil
+	}
+	val := *dbschema
+	val.Database.Url = "${DATABASE_URL}"
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding schema: %w", err)
+	}
+	return util.Ptr(string(buf)), nil
+}
+
+// decodeSchema returns the schema recorded in the history table or nil if none was recorded
+func decodeSchema(val sql.NullString) (*schema.SchemaJson, error) {
+	if !val.Valid || val.String == "" {
+		return nil, nil
+	}
+	// decoded without the validation of a schema document since the database may not have had any tables
+	type plain schema.SchemaJson
+	var dbschema plain
+	if err := json.Unmarshal([]byte(val.String), &dbschema); err != nil {
+		return nil, fmt.Errorf("error decoding recorded schema: %w", err)
+	}
+	return (*schema.SchemaJson)(&dbschema), nil
+}
+
+// RecordMigration records the migration which applied the plan by executing the sql starting at started in the
+// history table, creating the table if needed. A migration which failed with failure is recorded as failed, or as
+// partial if it's a PartialError, and failure is returned.
+func RecordMigration(args MigratorArgs, protocol string, plan string, sql string, started time.Time, failure error) error {
+	if failure == nil {
+		return recordMigration(args, protocol, plan, sql, started, MigrationApplied, nil)
+	}
+	status := MigrationFailed
+	var partial *PartialError
+	if errors.As(failure, &partial) {
+		status = MigrationPartial
+	}
+	// the failure is still recorded when the migration was canceled
+	args.Context = context.WithoutCancel(args.Context)
+	if err := recordMigration(args, protocol, plan, sql, started, status, util.Ptr(failure.Error())); err != nil {
+		args.Logger.Error("%s", err)
+	}
+	return failure
+}
+
+func recordMigration(args MigratorArgs, protocol string, plan string, sql string, started time.Time, status MigrationStatus, failure *string) error {
+	if err := CreateHistoryTable(args.Context, protocol, args.DB); err != nil {
+		return err
+	}
+	finished := time.Now()
+	var commit *string
+	if args.Commit != "" {
+		commit = &args.Commit
+	}
+	fromSchema, err := encodeSchema(args.FromSchema)
+	if err != nil {
+		return err
+	}
+	toSchema, err := encodeSchema(args.ToSchema)
+	if err != nil {
+		return err
+	}
+	params := make([]string, 12)
+	for i := range params {
+		params[i] = placeholder(protocol, i+1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (checksum, plan, statements, started_at, finished_at, duration_ms, os_user, git_commit, from_schema, to_schema, status, error_message) VALUES (%s)", HistoryTable, strings.Join(params, ", "))
+	args.Logger.Trace("sql: %s", query)
+	if _, err := args.DB.ExecContext(args.Context, query, args.Checksum, plan, sql, started.UTC(), finished.UTC(), finished.Sub(started).Milliseconds(), currentUser(), commit, fromSchema, toSchema, string(status), failure); err != nil {
+		return fmt.Errorf("error recording migration: %w", err)
+	}
+	return nil
+}
+
+// parseTime returns the time from a scanned value since not all drivers return a time.Time for datetime columns
+func parseTime(val any) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		return parseTime(string(v))
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST", "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"} {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid time: %s", v)
+	case nil:
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %v", val)
+}
+
+func scanMigrationRecords(rows *sql.Rows) ([]MigrationRecord, error) {
+	defer rows.Close()
+	var records []MigrationRecord
+	for rows.Next() {
+		var record MigrationRecord
+		var startedAt, finishedAt any
+		var durationMs int64
+		var commit, fromSchema, toSchema, status, failure sql.NullString
+		if err := rows.Scan(&record.ID, &record.Checksum, &record.Plan, &record.SQL, &startedAt, &finishedAt, &durationMs, &record.User, &commit, &fromSchema, &toSchema, &status, &failure); err != nil {
+			return nil, err
+		}
+		var err error
+		if record.StartedAt, err = parseTime(startedAt); err != nil {
+			return nil, err
+		}
+		if record.FinishedAt, err = parseTime(finishedAt); err != nil {
+			return nil, err
+		}
+		record.Duration = time.Duration(durationMs) * time.Millisecond
+		record.Commit = commit.String
+		record.Status = MigrationApplied
+		if status.Valid {
+			record.Status = MigrationStatus(status.String)
+		}
+		record.Error = failure.String
+		if record.FromSchema, err = decodeSchema(fromSchema); err != nil {
+			return nil, err
+		}
+		if record.ToSchema, err = decodeSchema(toSchema); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// GetMigrationHistory returns the migrations recorded in the history table with the most recent first. Nothing is
+// returned if the history table doesn't exist.
+func GetMigrationHistory(ctx context.Context, protocol string, db *sql.DB) ([]MigrationRecord, error) {
+	exists, err := HistoryTableExists(ctx, protocol, db)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY id DESC", historyColumns, HistoryTable))
+	if err != nil {
+		return nil, err
+	}
+	return scanMigrationRecords(rows)
+}
+
+// GetMigration returns the migration recorded in the history table with the id or nil if not found
+func GetMigration(ctx context.Context, protocol string, db *sql.DB, id int64) (*MigrationRecord, error) {
+	exists, err := HistoryTableExists(ctx, protocol, db)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE id = %s", historyColumns, HistoryTable, placeholder(protocol, 1)), id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanMigrationRecords(rows)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
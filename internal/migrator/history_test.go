@@ -0,0 +1,28 @@
+package migrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2024, 11, 5, 10, 30, 15, 0, time.UTC)
+	for _, val := range []any{expected, "2024-11-05T10:30:15Z", []byte("2024-11-05 10:30:15"), "2024-11-05 10:30:15 +0000 UTC"} {
+		ts, err := parseTime(val)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equal(ts), "%v", val)
+	}
+	ts, err := parseTime(nil)
+	assert.NoError(t, err)
+	assert.True(t, ts.IsZero())
+	_, err = parseTime("yesterday")
+	assert.EqualError(t, err, "invalid time: yesterday")
+}
+
+func TestPlaceholder(t *testing.T) {
+	assert.Equal(t, "$2", placeholder("postgres", 2))
+	assert.Equal(t, "?", placeholder("mysql", 2))
+	assert.Equal(t, "?", placeholder("sqlite", 2))
+}
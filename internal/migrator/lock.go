@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+// LockTable is the table holding the migration lock for the databases without a locking function. Like the history
+// table it's managed by shift so it's excluded when generating a schema from the database.
+const LockTable = "shift_lock"
+
+// DefaultLockWait is how long a migration waits for the lock held by another migration when no wait is provided
+const DefaultLockWait = 5 * time.Minute
+
+// ErrLockTimeout is returned when the migration lock couldn't be acquired before the wait elapsed
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// lockPollInterval is how often an unavailable lock is retried
+var lockPollInterval = time.Second
+
+// IsShiftTable returns true if the table is managed by shift and isn't part of the schema
+func IsShiftTable(name string) bool {
+	return name == HistoryTable || name == LockTable
+}
+
+// WaitForLock calls acquire until it returns true or the wait elapses. The lock is held by another migration while
+// acquire returns false.
+func WaitForLock(ctx context.Context, logger logger.Logger, wait time.Duration, acquire func() (bool, error)) error {
+	if wait <= 0 {
+		wait = DefaultLockWait
+	}
+	started := time.Now()
+	var waiting bool
+	for {
+		ok, err := acquire()
+		if err != nil {
+			return fmt.Errorf("error acquiring the migration lock: %w", err)
+		}
+		if ok {
+			if waiting {
+				logger.Info("acquired the migration lock after %v", time.Since(started).Round(time.Millisecond))
+			}
+			return nil
+		}
+		if time.Since(started) >= wait {
+			return fmt.Errorf("%w after %v", ErrLockTimeout, wait)
+		}
+		if !waiting {
+			logger.Info("waiting for another migration to finish ...")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(lockPollInterval, wait)):
+		}
+	}
+}
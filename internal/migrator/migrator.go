@@ -3,8 +3,10 @@ package migrator
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/jhaynie/shift/internal/schema"
 	"github.com/shopmonkeyus/go-common/logger"
@@ -13,6 +15,9 @@ import (
 type MigrateTableChangeType string
 type MigrateColumnChangeType string
 type MigrateIndexChangeType string
+type MigrateForeignKeyChangeType string
+type MigrateConstraintChangeType string
+type MigrateConstraintType string
 type MigrateColumnChangeTypeType string
 
 const (
@@ -20,14 +25,33 @@ const (
 	AlterTable  MigrateTableChangeType = "alter table"
 	DropTable   MigrateTableChangeType = "drop table"
 
+	// enums are schema level types which are changed alongside the tables that use them
+	CreateEnum MigrateTableChangeType = "create enum"
+	AlterEnum  MigrateTableChangeType = "alter enum"
+	DropEnum   MigrateTableChangeType = "drop enum"
+
+	// schemas (namespaces) are only created since they may contain objects which aren't managed
+	CreateNamespace MigrateTableChangeType = "create schema"
+
 	CreateColumn MigrateColumnChangeType = "create column"
 	AlterColumn  MigrateColumnChangeType = "alter column"
 	DropColumn   MigrateColumnChangeType = "drop column"
+	RenameColumn MigrateColumnChangeType = "rename column"
 
 	CreateIndex MigrateIndexChangeType = "create index"
 	AlterIndex  MigrateIndexChangeType = "alter index"
 	DropIndex   MigrateIndexChangeType = "drop index"
 
+	CreateForeignKey MigrateForeignKeyChangeType = "add constraint"
+	DropForeignKey   MigrateForeignKeyChangeType = "drop constraint"
+
+	CreateConstraint MigrateConstraintChangeType = "add constraint"
+	DropConstraint   MigrateConstraintChangeType = "drop constraint"
+
+	PrimaryKeyConstraint MigrateConstraintType = "primary key"
+	UniqueConstraint     MigrateConstraintType = "unique"
+	CheckConstraint      MigrateConstraintType = "check"
+
 	ColumnTypeChanged        MigrateColumnChangeTypeType = "type changed"
 	ColumnDescriptionChanged MigrateColumnChangeTypeType = "description changed"
 	ColumnNullableChanged    MigrateColumnChangeTypeType = "nullable changed"
@@ -35,17 +59,59 @@ const (
 )
 
 type MigrateColumn struct {
-	Change   MigrateColumnChangeType
-	Name     string // column name
-	Ref      schema.SchemaJsonTablesElemColumnsElem
-	Previous schema.SchemaJsonTablesElemColumnsElem
-	Changes  []MigrateColumnChangeTypeType
+	Change            MigrateColumnChangeType
+	Name              string // column name
+	Ref               schema.SchemaJsonTablesElemColumnsElem
+	Previous          schema.SchemaJsonTablesElemColumnsElem
+	Changes           []MigrateColumnChangeTypeType
+	LikelyRenamedFrom string // dropped column which looks to be renamed to this created column
+}
+
+// MarshalJSON omits the previous column of a created column since the empty column isn't valid and can't be decoded
+func (c MigrateColumn) MarshalJSON() ([]byte, error) {
+	type column MigrateColumn
+	if c.Previous.Name != "" {
+		return json.Marshal(column(c))
+	}
+	return json.Marshal(struct {
+		column
+		Previous *schema.SchemaJsonTablesElemColumnsElem `json:",omitempty"`
+	}{column: column(c)})
 }
 
 type MigrateIndex struct {
-	Change  MigrateIndexChangeType
-	Name    string   // index name
-	Columns []string // columns in the index
+	Change   MigrateIndexChangeType
+	Name     string // index name
+	Ref      schema.SchemaJsonTablesElemIndexesElem
+	Previous schema.SchemaJsonTablesElemIndexesElem
+}
+
+type MigrateForeignKey struct {
+	Change MigrateForeignKeyChangeType
+	Name   string // constraint name
+	Column string // column with the reference
+	Ref    schema.SchemaJsonTablesElemColumnsElemReferences
+}
+
+type MigrateConstraint struct {
+	Change     MigrateConstraintChangeType
+	Type       MigrateConstraintType
+	Name       string   // constraint name, empty for a primary key
+	Columns    []string // ordered columns of the constraint
+	Expression string   // expression of a check constraint
+	NotValid   bool     // whether a check constraint is validated separately from being added
+}
+
+type MigrateEnumValue struct {
+	Value  string
+	Before string // existing value the new value is added before, empty if not added before a value
+	After  string // existing value the new value is added after, empty if not added after a value
+}
+
+type MigrateEnum struct {
+	Name   string // enum name
+	Ref    schema.SchemaJsonEnumsElem
+	Values []MigrateEnumValue // values added to an existing enum in the order they're added
 }
 
 type MigrateTableDescription struct {
@@ -58,25 +124,69 @@ type MigrateChanges struct {
 	Table       string
 	Ref         schema.SchemaJsonTablesElem
 	Columns     []MigrateColumn
-	Indexes     []MigrateIndex // TODO
+	Indexes     []MigrateIndex
+	ForeignKeys []MigrateForeignKey
+	Constraints []MigrateConstraint
 	Description *MigrateTableDescription
+	Enum        *MigrateEnum // set for the enum changes
+	Namespace   string       // set for the schema (namespace) changes
+	RenamedFrom string       // previous name of a renamed table
+
+	LikelyRenamedFrom string // dropped table which looks to be renamed to this created table
+}
+
+// Name returns the name of the table, enum or schema (namespace) changed
+func (c MigrateChanges) Name() string {
+	switch {
+	case c.Enum != nil:
+		return c.Enum.Name
+	case c.Namespace != "":
+		return c.Namespace
+	}
+	return c.Table
+}
+
+// Statement is a sql statement generated for a change
+type Statement struct {
+	Change        int // index of the change the statement was generated for
+	SQL           string
+	NoTransaction bool // the statement can't be executed inside a transaction
+	Isolated      bool // the statement is executed in a transaction of its own so the locks it takes are released once it's done
+	Repeat        bool // the statement is executed again in a transaction of its own until it affects no rows, such as a batch of a backfill
 }
 
 type MigratorArgs struct {
-	Context    context.Context
-	Logger     logger.Logger
-	FromSchema *schema.SchemaJson
-	ToSchema   *schema.SchemaJson
-	DB         *sql.DB
-	Drop       bool
-	Diff       []MigrateChanges
+	Context          context.Context
+	Logger           logger.Logger
+	FromSchema       *schema.SchemaJson
+	ToSchema         *schema.SchemaJson
+	DB               *sql.DB
+	Drop             bool
+	Diff             []MigrateChanges
+	Checksum         string        // SHA-256 of the target schema document recorded in the history
+	Commit           string        // git commit of the target schema recorded in the history, optional
+	NoTransaction    bool          // execute the statements without a transaction for the databases which support them
+	LockWait         time.Duration // how long to wait for the migration lock held by another migration, DefaultLockWait if not set
+	Fingerprint      string        // fingerprint of the database schema the changes must be applied to, checked once the lock is held
+	Online           bool          // alter the existing tables with statements which avoid long locks for the databases which support them
+	LockTimeout      time.Duration // how long a statement waits for a lock on a table before failing, no limit if not set
+	StatementTimeout time.Duration // how long a statement can run before failing, no limit if not set
+	Retries          int           // how many times the statements which failed waiting for a lock are retried
+	AllowDestructive bool          // allow the destructive changes found once the lock is held which weren't in Diff, see diff.Refresh
+}
+
+// Queryer is the part of a *sql.DB or *sql.Tx used to read the schema of a database
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 type ToSchemaArgs struct {
 	Context     context.Context
 	Logger      logger.Logger
-	DB          *sql.DB
+	DB          Queryer // a transaction can be used to read the schema as it is within it
 	TableFilter []string
+	Namespaces  []string // additional schemas (namespaces) to read the tables from for the databases which support them
 }
 
 type Migrator interface {
@@ -127,6 +237,14 @@ func FromSchema(protocol string, schema *schema.SchemaJson, out io.Writer) error
 	return migrator.FromSchema(schema, out)
 }
 
+func Process(protocol string, schema *schema.SchemaJson) error {
+	migrator := migrators[protocol]
+	if migrator == nil {
+		return fmt.Errorf("protocol: %s not supported", protocol)
+	}
+	return migrator.Process(schema)
+}
+
 func Load(filename string) (*schema.SchemaJson, error) {
 	dbschema, err := schema.Load(filename)
 	if err != nil {
@@ -136,10 +254,17 @@ func Load(filename string) (*schema.SchemaJson, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error determining protocol from database url: %s", err)
 	}
-	migrator := migrators[protocol]
-	if migrator == nil {
-		return nil, fmt.Errorf("protocol: %s not supported", protocol)
+	err = Process(protocol, dbschema)
+	return dbschema, err
+}
+
+// LoadWithProtocol loads a schema and processes it for the protocol instead of the one from the database url which
+// allows a schema to be used without a database
+func LoadWithProtocol(filename string, protocol string) (*schema.SchemaJson, error) {
+	dbschema, err := schema.Load(filename)
+	if err != nil {
+		return nil, err
 	}
-	err = migrator.Process(dbschema)
+	err = Process(protocol, dbschema)
 	return dbschema, err
 }
@@ -1,33 +1,427 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/jhaynie/shift/internal/diff"
 	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
 	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
 )
 
 type MysqlMigrator struct {
 }
 
 var _ migrator.Migrator = (*MysqlMigrator)(nil)
+var _ migrator.TableGenerator = (*MysqlMigrator)(nil)
+var _ migrator.PreflightGenerator = (*MysqlMigrator)(nil)
 
-func (p *MysqlMigrator) Process(schema *schema.SchemaJson) error {
+func (p *MysqlMigrator) Process(dbschema *schema.SchemaJson) error {
+	if len(dbschema.Database.Schemas) > 0 {
+		return fmt.Errorf("database has schemas but mysql doesn't support schemas")
+	}
+	resolveEnums(dbschema)
+	for _, table := range dbschema.Tables {
+		if table.Schema != nil && *table.Schema != "" {
+			return fmt.Errorf("table %s has schema %s but mysql doesn't support schemas", table.Name, *table.Schema)
+		}
+		for i, col := range table.Columns {
+			col.NativeType = ToNativeType(col)
+			if col.References != nil && col.References.Deferrable != nil && *col.References.Deferrable {
+				return fmt.Errorf("column %s for table %s has a deferrable reference but mysql doesn't support deferred constraints", col.Name, table.Name)
+			}
+			table.Columns[i] = col
+		}
+		for _, index := range table.Indexes {
+			if index.Where != nil && *index.Where != "" {
+				return fmt.Errorf("index %s for table %s has a where predicate but mysql doesn't support partial indexes", index.Name, table.Name)
+			}
+			if index.Method != nil {
+				switch *index.Method {
+				case schema.SchemaJsonTablesElemIndexesElemMethodBtree, schema.SchemaJsonTablesElemIndexesElemMethodHash:
+				default:
+					return fmt.Errorf("index %s for table %s has method %s which isn't supported by mysql", index.Name, table.Name, *index.Method)
+				}
+			}
+		}
+	}
 	return nil
 }
 
 func (p *MysqlMigrator) Migrate(args migrator.MigratorArgs) error {
-	return nil
+	unlock, err := p.lock(args)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if args.Drop {
+		var out strings.Builder
+		ts := time.Now()
+		if err := p.FromSchema(args.ToSchema, &out); err != nil {
+			return err
+		}
+		args.Logger.Info("generated sql in %v", time.Since(ts))
+		ts = time.Now()
+		// mysql commits each change to the schema as it's made so the statements are executed one at a time to know
+		// whether any were applied before the one which failed
+		for i, statement := range util.SplitSQL(out.String()) {
+			args.Logger.Trace("sql: %s", statement)
+			if _, err := args.DB.ExecContext(args.Context, statement); err != nil {
+				if i > 0 {
+					err = &migrator.PartialError{Err: err}
+				}
+				return recordMigration(args, out.String(), ts, err)
+			}
+		}
+		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, out.String(), ts, nil)
+	} else {
+		if err := diff.Refresh(&args, schema.DatabaseDriverMysql); err != nil {
+			return err
+		}
+		if len(args.Diff) == 0 {
+			args.Logger.Info("no changes remain after acquiring the migration lock")
+			return nil
+		}
+		if err := diff.Preflight(args, schema.DatabaseDriverMysql); err != nil {
+			return err
+		}
+		var queries strings.Builder
+		if err := diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverMysql, args.Diff, &queries); err != nil {
+			return err
+		}
+		statements, err := diff.GenerateStatements(schema.DatabaseDriverMysql, args.Diff)
+		if err != nil {
+			return err
+		}
+		ts := time.Now()
+		// mysql commits each change to the schema as it's made so the statements are executed outside of a transaction,
+		// which returns a migrator.PartialError if the statements before the one which failed were applied
+		if err := migrator.ExecuteStatements(args.Context, args.Logger, args.DB, args.Diff, statements, migrator.ExecuteOptions{}); err != nil {
+			return recordMigration(args, queries.String(), ts, err)
+		}
+		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, queries.String(), ts, nil)
+	}
+}
+
+// lockName is the name of the lock held while migrating the current database. Locks are server wide so the name
+// includes a hash of the database name which keeps it under the maximum length.
+const lockName = "CONCAT('shift:', SHA1(DATABASE()))"
+
+// lock takes a named lock on a dedicated connection since the lock is held by the session which took it
+func (p *MysqlMigrator) lock(args migrator.MigratorArgs) (func(), error) {
+	conn, err := args.DB.Conn(args.Context)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.WaitForLock(args.Context, args.Logger, args.LockWait, func() (bool, error) {
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(args.Context, "SELECT GET_LOCK("+lockName+", 0)").Scan(&ok); err != nil {
+			return false, err
+		}
+		if !ok.Valid {
+			return false, fmt.Errorf("error getting lock")
+		}
+		return ok.Int64 == 1, nil
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK("+lockName+")").Scan(&ok); err != nil {
+			args.Logger.Warn("error releasing the migration lock: %s", err)
+		}
+		conn.Close()
+	}, nil
 }
 
 func (p *MysqlMigrator) ToSchema(args migrator.ToSchemaArgs) (*schema.SchemaJson, error) {
-	return nil, nil
+	tables, err := getInfoTables(args.Context, args.Logger, args.DB, args.TableFilter)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table schema: %w", err)
+	}
+	tableComments, err := GetTableDescriptions(args.Context, args.DB)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table descriptions: %w", err)
+	}
+	columnComments, err := GetColumnDescriptions(args.Context, args.DB)
+	if err != nil {
+		return nil, fmt.Errorf("error generating column descriptions: %w", err)
+	}
+	for table, detail := range tables {
+		if tableComment, ok := tableComments[table]; ok && tableComment != "" {
+			detail.Description = &tableComment
+		}
+		for i, column := range detail.Columns {
+			if comments, ok := columnComments[table]; ok {
+				if columnComment, ok := comments[column.Name]; ok && columnComment != "" {
+					column.Description = &columnComment
+				}
+			}
+			dt, err := dataTypeToType(column.DataType, column.UDTName)
+			if err != nil {
+				return nil, fmt.Errorf("error converting column %s with table: %s. %s", column.Name, table, err)
+			}
+			column = normalizeColumn(column, column.DataType)
+			column.DataType = string(dt)
+			for _, constraint := range detail.Constraints {
+				if constraint.Column == column.Name && constraint.Type == "PRIMARY KEY" {
+					column.IsPrimaryKey = true
+					break
+				}
+			}
+			column.Default, err = formatDefault(column)
+			if err != nil {
+				return nil, fmt.Errorf("error validating column: %s table: %s default value: %s", column.Name, table, err)
+			}
+			detail.Columns[i] = column
+		}
+	}
+	res, err := schema.GenerateSchemaJsonFromInfoTables(args.Logger, schema.DatabaseDriverMysql, tables)
+	if err != nil {
+		return nil, err
+	}
+	// mysql enums are defined inline with the column so each one becomes an enum named for the table and column
+	for _, table := range res.Tables {
+		for i, col := range table.Columns {
+			if nt := schema.FromNativeType(schema.DatabaseDriverMysql, col.NativeType); nt != nil && strings.HasPrefix(*nt, "enum(") {
+				name := table.Name + "_" + col.Name
+				res.Enums = append(res.Enums, schema.SchemaJsonEnumsElem{Name: name, Values: parseEnumValues(*nt)})
+				table.Columns[i].Enum = &name
+			}
+		}
+	}
+	sort.Slice(res.Enums, func(i, j int) bool { return res.Enums[i].Name < res.Enums[j].Name })
+	return res, nil
 }
 
-func (p *MysqlMigrator) FromSchema(schema *schema.SchemaJson, out io.Writer) error {
+func (p *MysqlMigrator) FromSchema(schemajson *schema.SchemaJson, out io.Writer) error {
+	resolveEnums(schemajson)
+	details := make([]types.TableDetail, len(schemajson.Tables))
+	for t, table := range schemajson.Tables {
+		columns := make([]types.ColumnDetail, 0)
+		for i, col := range table.Columns {
+			val, err := schema.SchemaColumnToColumn(schema.DatabaseDriverMysql, col, i+1, ToNativeType(col))
+			if err != nil {
+				return fmt.Errorf("error creating column: %s for table: %s. %s", col.Name, table.Name, err)
+			}
+			columns = append(columns, *val)
+		}
+		details[t] = types.TableDetail{
+			Columns:           columns,
+			Description:       table.Description,
+			Constraints:       make([]types.ConstraintDetail, 0),
+			Indexes:           schema.SchemaIndexesToIndexes(table.Indexes),
+			ForeignKeys:       schema.SchemaTableForeignKeys(table),
+			PrimaryKey:        schema.TablePrimaryKey(table),
+			UniqueConstraints: schema.SchemaTableUniqueConstraints(table),
+			Checks:            schema.SchemaTableChecks(table),
+		}
+		io.WriteString(out, migrator.GenerateCreateStatement(table.Name, details[t], p))
+	}
+	// the foreign keys are added once all the tables exist since the tables can reference each other
+	for t, table := range schemajson.Tables {
+		io.WriteString(out, migrator.GenerateAddForeignKeys(table.Name, details[t], p))
+	}
 	return nil
 }
 
+// ------------- TableGenerator ------------
+
+func (p *MysqlMigrator) QuoteTable(val string) string {
+	return quoteIdentifier(val)
+}
+
+func (p *MysqlMigrator) QuoteColumn(val string) string {
+	return quoteIdentifier(val)
+}
+
+func (p *MysqlMigrator) QuoteLiteral(val string) string {
+	return quoteLiteral(val)
+}
+
+func (p *MysqlMigrator) QuoteDefaultValue(val string, column types.ColumnDetail) string {
+	if column.DataType == "string" && !util.IsFunctionCall(val) {
+		val = p.QuoteLiteral(val)
+		switch column.UDTName {
+		case "json", "text", "blob":
+			// mysql only allows defaults for these types as expressions
+			val = "(" + val + ")"
+		}
+	}
+	return val
+}
+
+func (p *MysqlMigrator) GenerateTableComment(table string, val string) string {
+	return fmt.Sprintf("ALTER TABLE %s COMMENT = %s;", p.QuoteTable(table), p.QuoteLiteral(val))
+}
+
+func (p *MysqlMigrator) GenerateColumnComment(table string, column string, val string) string {
+	// mysql column comments are part of the column definition, see GenerateColumnAttributes
+	return ""
+}
+
+func (p *MysqlMigrator) GenerateColumnType(column types.ColumnDetail) string {
+	return column.UDTName
+}
+
+func (p *MysqlMigrator) GenerateLength(column string) string {
+	return "CHAR_LENGTH(" + column + ")"
+}
+
+// GenerateInvalidCast doesn't check the values since mysql has no way of testing a conversion without making it
+func (p *MysqlMigrator) GenerateInvalidCast(column string, to types.ColumnDetail) string {
+	return ""
+}
+
+func (p *MysqlMigrator) GenerateColumnAttributes(column types.ColumnDetail) []string {
+	var attrs []string
+	if column.IsAutoIncrementing {
+		attrs = append(attrs, "AUTO_INCREMENT")
+	}
+	if column.Description != nil && *column.Description != "" {
+		attrs = append(attrs, "COMMENT "+p.QuoteLiteral(*column.Description))
+	}
+	return attrs
+}
+
+func (p *MysqlMigrator) GenerateAlterColumn(table string, column types.ColumnDetail, changes []migrator.MigrateColumnChangeTypeType) []string {
+	if len(changes) == 1 && changes[0] == migrator.ColumnDefaultChanged {
+		if column.Default == nil || *column.Default == "" {
+			return []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;", p.QuoteTable(table), p.QuoteColumn(column.Name))}
+		}
+		return []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", p.QuoteTable(table), p.QuoteColumn(column.Name), p.QuoteDefaultValue(*column.Default, column))}
+	}
+	// mysql requires the full column definition to change the type, nullability or comment. the keys are
+	// left out since they are already defined on the table and would otherwise be added a second time
+	column.IsPrimaryKey = false
+	column.IsUnique = false
+	statement := migrator.GenerateColumnStatement(column, p)
+	if !column.IsNullable && column.Default != nil {
+		// the column statement leaves out NOT NULL when there's a default but MODIFY makes a column nullable without it
+		definition := p.QuoteColumn(column.Name) + " " + p.GenerateColumnType(column)
+		statement = definition + " NOT NULL" + strings.TrimPrefix(statement, definition)
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;", p.QuoteTable(table), statement)}
+}
+
+func (p *MysqlMigrator) GenerateDropColumn(table string, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", p.QuoteTable(table), p.QuoteColumn(column))
+}
+
+func (p *MysqlMigrator) GenerateRenameColumn(table string, column string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", p.QuoteTable(table), p.QuoteColumn(column), p.QuoteColumn(name))
+}
+
+func (p *MysqlMigrator) GenerateDropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", p.QuoteTable(table))
+}
+
+func (p *MysqlMigrator) GenerateRenameTable(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", p.QuoteTable(table), p.QuoteTable(name))
+}
+
+func (p *MysqlMigrator) GenerateCreateIndex(table string, index types.IndexDetail) string {
+	var sql strings.Builder
+	sql.WriteString("CREATE ")
+	if index.IsUnique {
+		sql.WriteString("UNIQUE ")
+	}
+	sql.WriteString("INDEX ")
+	sql.WriteString(quoteIdentifier(index.Name))
+	sql.WriteString(" ON ")
+	sql.WriteString(p.QuoteTable(table))
+	sql.WriteString(" (")
+	if index.Expression != nil && *index.Expression != "" {
+		// mysql requires functional key parts to be wrapped in parens
+		sql.WriteString("(" + *index.Expression + ")")
+	} else {
+		sql.WriteString(migrator.GenerateIndexKeys(index, p))
+	}
+	sql.WriteString(")")
+	if index.Method != nil && *index.Method != "" {
+		sql.WriteString(" USING ")
+		sql.WriteString(strings.ToUpper(*index.Method))
+	}
+	sql.WriteString(";")
+	return sql.String()
+}
+
+func (p *MysqlMigrator) GenerateDropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s;", quoteIdentifier(index), p.QuoteTable(table))
+}
+
+func (p *MysqlMigrator) GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateForeignKeyConstraint(fk, p))
+}
+
+func (p *MysqlMigrator) GenerateDropForeignKey(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *MysqlMigrator) GenerateAddPrimaryKey(table string, columns []string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", p.QuoteTable(table), migrator.GenerateColumnList(columns, p))
+}
+
+func (p *MysqlMigrator) GenerateDropPrimaryKey(table string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY;", p.QuoteTable(table))
+}
+
+func (p *MysqlMigrator) GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateUniqueConstraint(unique, p))
+}
+
+func (p *MysqlMigrator) GenerateDropUniqueConstraint(table string, name string) string {
+	// mysql implements a unique constraint as a unique index
+	return fmt.Sprintf("ALTER TABLE %s DROP INDEX %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *MysqlMigrator) GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string {
+	// mysql always validates the existing rows when the constraint is added
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateCheckConstraint(check, p))}
+}
+
+func (p *MysqlMigrator) GenerateDropCheckConstraint(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CHECK %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *MysqlMigrator) GenerateCreateEnum(name string, values []string) string {
+	return "" // mysql enums are defined inline with the column, see resolveEnums
+}
+
+func (p *MysqlMigrator) GenerateAddEnumValue(name string, value migrator.MigrateEnumValue) string {
+	return "" // mysql enums are defined inline with the column so adding a value changes the column type
+}
+
+func (p *MysqlMigrator) GenerateDropEnum(name string) string {
+	return "" // mysql enums are defined inline with the column, see resolveEnums
+}
+
+func (p *MysqlMigrator) ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType {
+	return ToNativeType(column)
+}
+
+// recordMigration records the migration in the history table along with the error it failed with, which is returned
+func recordMigration(args migrator.MigratorArgs, sql string, started time.Time, failure error) error {
+	plan, err := diff.FormatPlan(args.Diff)
+	if err != nil {
+		return errors.Join(failure, err)
+	}
+	return migrator.RecordMigration(args, "mysql", plan, sql, started, failure)
+}
+
 func init() {
-	migrator.Register("mysql", &MysqlMigrator{})
+	var m MysqlMigrator
+	migrator.Register("mysql", &m)
+	migrator.RegisterGenerator("mysql", &m)
 }
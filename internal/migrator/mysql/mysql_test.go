@@ -0,0 +1,340 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+var infoTablesColumns = []string{"TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_DEFAULT", "IS_NULLABLE", "DATA_TYPE", "CHARACTER_MAXIMUM_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE", "COLUMN_TYPE", "EXTRA"}
+
+func TestToSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(infoTablesSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows(infoTablesColumns).
+		AddRow("user", "id", int64(1), nil, "NO", "bigint", nil, int64(19), int64(0), "bigint", "auto_increment").
+		AddRow("user", "name", int64(2), nil, "YES", "varchar", int64(255), nil, nil, "varchar(255)", "").
+		AddRow("user", "active", int64(3), "1", "NO", "tinyint", nil, int64(3), int64(0), "tinyint(1)", "").
+		AddRow("user", "created", int64(4), "CURRENT_TIMESTAMP", "NO", "datetime", nil, nil, nil, "datetime", "DEFAULT_GENERATED").
+		AddRow("user", "status", int64(5), nil, "NO", "enum", int64(9), nil, nil, "enum('Active','it''s off')", "").
+		AddRow("other", "id", int64(1), nil, "NO", "int", nil, int64(10), int64(0), "int", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(infoConstraintsSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"CONSTRAINT_NAME", "TABLE_NAME", "COLUMN_NAME", "CONSTRAINT_TYPE"}).
+		AddRow("PRIMARY", "user", "id", "PRIMARY KEY"))
+	mock.ExpectQuery(regexp.QuoteMeta(infoIndexesSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "INDEX_NAME", "NON_UNIQUE", "COLUMN_NAME", "COLLATION", "INDEX_TYPE", "EXPRESSION"}).
+		AddRow("user", "user_name_created_idx", int64(1), "name", "A", "BTREE", nil).
+		AddRow("user", "user_name_created_idx", int64(1), "created", "D", "BTREE", nil).
+		AddRow("user", "user_lower_name_idx", int64(0), nil, "A", "BTREE", "lower(`name`)").
+		AddRow("user", "user_name_ft", int64(1), "name", nil, "FULLTEXT", nil))
+	mock.ExpectQuery(regexp.QuoteMeta(infoForeignKeysSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME", "DELETE_RULE", "UPDATE_RULE", "COMPOSITE"}).
+		AddRow("user", "user_id_fk", "id", "other", "id", "CASCADE", "NO ACTION", int64(0)).
+		AddRow("other", "other_id_fkey", "id", "user", "id", "NO ACTION", "NO ACTION", int64(0)).
+		AddRow("other", "other_user_fkey", "id", "user", "id", "NO ACTION", "NO ACTION", int64(1)))
+	mock.ExpectQuery(regexp.QuoteMeta(infoChecksSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "CONSTRAINT_NAME", "CHECK_CLAUSE"}).
+		AddRow("user", "user_name_check", "(`name` <> _utf8mb4'')"))
+	mock.ExpectQuery(regexp.QuoteMeta(tableCommentSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_COMMENT"}).AddRow("user", "the users"))
+	mock.ExpectQuery(regexp.QuoteMeta(columnCommentSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "COLUMN_COMMENT"}).AddRow("user", "name", "the name"))
+	var m MysqlMigrator
+	res, err := m.ToSchema(migrator.ToSchemaArgs{
+		Context:     context.Background(),
+		Logger:      logger.NewTestLogger(),
+		DB:          db,
+		TableFilter: []string{"user"},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Len(t, res.Tables, 1)
+	table := res.Tables[0]
+	assert.Equal(t, "user", table.Name)
+	assert.Equal(t, "the users", *table.Description)
+	assert.Len(t, table.Columns, 5)
+
+	assert.Equal(t, "id", table.Columns[0].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeInt, table.Columns[0].Type)
+	assert.Equal(t, "bigint", *table.Columns[0].NativeType.Mysql)
+	assert.True(t, *table.Columns[0].PrimaryKey)
+	assert.True(t, *table.Columns[0].AutoIncrement)
+	assert.Equal(t, 64, table.Columns[0].Length.Precision)
+
+	assert.Equal(t, "name", table.Columns[1].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeString, table.Columns[1].Type)
+	assert.Equal(t, 255, *table.Columns[1].MaxLength)
+	assert.Equal(t, "the name", *table.Columns[1].Description)
+	assert.True(t, *table.Columns[1].Nullable)
+
+	assert.Equal(t, "active", table.Columns[2].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeBoolean, table.Columns[2].Type)
+	assert.Equal(t, "true", *table.Columns[2].Default.Mysql)
+	assert.Nil(t, table.Columns[2].Length)
+
+	assert.Equal(t, "created", table.Columns[3].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeDatetime, table.Columns[3].Type)
+	assert.Equal(t, "CURRENT_TIMESTAMP", *table.Columns[3].Default.Mysql)
+
+	assert.Len(t, table.Indexes, 2)
+	assert.Equal(t, "user_name_created_idx", table.Indexes[0].Name)
+	assert.Nil(t, table.Indexes[0].Method)
+	assert.Nil(t, table.Indexes[0].Unique)
+	assert.Equal(t, []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "name"}, {Name: "created", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)}}, table.Indexes[0].Columns)
+	assert.Equal(t, "user_lower_name_idx", table.Indexes[1].Name)
+	assert.True(t, *table.Indexes[1].Unique)
+	assert.Equal(t, "lower(`name`)", *table.Indexes[1].Expression)
+
+	assert.NotNil(t, table.Columns[0].References)
+	assert.Equal(t, "other", table.Columns[0].References.Table)
+	assert.Equal(t, "id", table.Columns[0].References.Column)
+	assert.Equal(t, "user_id_fk", *table.Columns[0].References.Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade, *table.Columns[0].References.OnDelete)
+	assert.Nil(t, table.Columns[0].References.OnUpdate)
+	assert.Nil(t, table.Columns[1].References)
+
+	assert.Equal(t, "status", table.Columns[4].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeString, table.Columns[4].Type)
+	assert.Equal(t, "enum('Active','it''s off')", *table.Columns[4].NativeType.Mysql)
+	assert.Equal(t, "user_status", *table.Columns[4].Enum)
+	assert.Equal(t, []schema.SchemaJsonEnumsElem{{Name: "user_status", Values: []string{"Active", "it's off"}}}, res.Enums)
+
+	assert.Equal(t, []schema.SchemaJsonTablesElemChecksElem{{Name: "user_name_check", Expression: "`name` <> _utf8mb4''"}}, table.Checks)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestToSchemaNoRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(infoTablesSQL)).WithoutArgs().WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(tableCommentSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery(regexp.QuoteMeta(columnCommentSQL)).WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	var m MysqlMigrator
+	res, err := m.ToSchema(migrator.ToSchemaArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Tables)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFromSchema(t *testing.T) {
+	var m MysqlMigrator
+	dbschema := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:        "user",
+				Description: util.Ptr("the users"),
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true), AutoIncrement: util.Ptr(true)},
+					{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(64), Description: util.Ptr("the user's name")},
+					{Name: "active", Type: schema.SchemaJsonTablesElemColumnsElemTypeBoolean, Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Mysql: util.Ptr("true")}},
+				},
+			},
+		},
+	}
+	assert.NoError(t, m.Process(dbschema))
+	var out strings.Builder
+	assert.NoError(t, m.FromSchema(dbschema, &out))
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `user` ( `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT, `name` varchar(64) NOT NULL COMMENT 'the user''s name', `active` tinyint(1) DEFAULT true ); ALTER TABLE `user` COMMENT = 'the users';", util.CleanSQL(out.String()))
+}
+
+func TestFromSchemaWithIndexes(t *testing.T) {
+	var m MysqlMigrator
+	dbschema := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+					{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(255)},
+				},
+				Indexes: []schema.SchemaJsonTablesElemIndexesElem{
+					{Name: "user_email_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "email", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)}}, Method: util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodHash)},
+					{Name: "user_lower_email_idx", Expression: util.Ptr("lower(email)"), Unique: util.Ptr(true)},
+				},
+			},
+		},
+	}
+	assert.NoError(t, m.Process(dbschema))
+	var out strings.Builder
+	assert.NoError(t, m.FromSchema(dbschema, &out))
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `user` ( `id` bigint NOT NULL PRIMARY KEY, `email` varchar(255) NOT NULL ); CREATE INDEX `user_email_idx` ON `user` (`email` DESC) USING HASH; CREATE UNIQUE INDEX `user_lower_email_idx` ON `user` ((lower(email)));", util.CleanSQL(out.String()))
+}
+
+func TestProcessUnsupportedIndexes(t *testing.T) {
+	var m MysqlMigrator
+	dbschema := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:    "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}},
+				Indexes: []schema.SchemaJsonTablesElemIndexesElem{{Name: "user_id_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "id"}}, Where: util.Ptr("id > 0")}},
+			},
+		},
+	}
+	assert.EqualError(t, m.Process(dbschema), "index user_id_idx for table user has a where predicate but mysql doesn't support partial indexes")
+	dbschema.Tables[0].Indexes[0].Where = nil
+	dbschema.Tables[0].Indexes[0].Method = util.Ptr(schema.SchemaJsonTablesElemIndexesElemMethodGin)
+	assert.EqualError(t, m.Process(dbschema), "index user_id_idx for table user has method gin which isn't supported by mysql")
+}
+
+func TestProcessUnsupportedSchemas(t *testing.T) {
+	var m MysqlMigrator
+	dbschema := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name:    "orders",
+				Schema:  util.Ptr("sales"),
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt}},
+			},
+		},
+	}
+	assert.EqualError(t, m.Process(dbschema), "table orders has schema sales but mysql doesn't support schemas")
+	dbschema.Database.Schemas = []string{"sales"}
+	assert.EqualError(t, m.Process(dbschema), "database has schemas but mysql doesn't support schemas")
+}
+
+func TestFormatSQLDiff(t *testing.T) {
+	previous := schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverMysql, "varchar(64)"), Nullable: util.Ptr(true)}
+	current := schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverMysql, "varchar(128)"), Nullable: util.Ptr(false)}
+	changes := []migrator.MigrateChanges{
+		{
+			Change: migrator.AlterTable,
+			Table:  "user",
+			Columns: []migrator.MigrateColumn{
+				{Change: migrator.AlterColumn, Name: "name", Ref: current, Previous: previous, Changes: []migrator.MigrateColumnChangeTypeType{migrator.ColumnTypeChanged, migrator.ColumnNullableChanged}},
+				{Change: migrator.AlterColumn, Name: "status", Ref: schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Mysql: util.Ptr("new")}}, Changes: []migrator.MigrateColumnChangeTypeType{migrator.ColumnDefaultChanged}},
+				{Change: migrator.DropColumn, Name: "old"},
+			},
+		},
+		{
+			Change: migrator.DropTable,
+			Table:  "other",
+		},
+	}
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverMysql, changes, &out))
+	assert.Equal(t, "ALTER TABLE `user` MODIFY COLUMN `name` varchar(128) NOT NULL;\nALTER TABLE `user` ALTER COLUMN `status` SET DEFAULT ('new');\nALTER TABLE `user` DROP COLUMN `old`;\nDROP TABLE IF EXISTS `other`;\n", out.String())
+}
+
+func TestFormatSQLDiffNotNullDefault(t *testing.T) {
+	previous := schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, NativeType: schema.ToNativeType(schema.DatabaseDriverMysql, "varchar(16)"), Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Mysql: util.Ptr("new")}}
+	current := previous
+	current.NativeType = schema.ToNativeType(schema.DatabaseDriverMysql, "varchar(32)")
+	current.Description = util.Ptr("the status")
+	changes := []migrator.MigrateChanges{{
+		Change:  migrator.AlterTable,
+		Table:   "user",
+		Columns: []migrator.MigrateColumn{{Change: migrator.AlterColumn, Name: "status", Ref: current, Previous: previous, Changes: []migrator.MigrateColumnChangeTypeType{migrator.ColumnTypeChanged}}},
+	}}
+	// the column stays not null with its default since the definition replaces the existing one
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverMysql, changes, &out))
+	assert.Equal(t, "ALTER TABLE `user` MODIFY COLUMN `status` varchar(32) NOT NULL DEFAULT 'new' COMMENT 'the status';\n", out.String())
+
+	changes[0].Columns[0].Ref.Nullable = util.Ptr(true)
+	out.Reset()
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverMysql, changes, &out))
+	assert.Equal(t, "ALTER TABLE `user` MODIFY COLUMN `status` varchar(32) DEFAULT 'new' COMMENT 'the status';\n", out.String())
+}
+
+func TestGenerateConstraints(t *testing.T) {
+	var m MysqlMigrator
+	assert.Equal(t, "ALTER TABLE `membership` ADD PRIMARY KEY (`team_id`, `user_id`);", m.GenerateAddPrimaryKey("membership", []string{"team_id", "user_id"}))
+	assert.Equal(t, "ALTER TABLE `membership` DROP PRIMARY KEY;", m.GenerateDropPrimaryKey("membership"))
+	assert.Equal(t, "ALTER TABLE `membership` ADD CONSTRAINT `membership_team_email_key` UNIQUE (`team_id`, `email`);", m.GenerateAddUniqueConstraint("membership", types.UniqueConstraintDetail{Name: "membership_team_email_key", Columns: []string{"team_id", "email"}}))
+	assert.Equal(t, "ALTER TABLE `membership` DROP INDEX `membership_team_email_key`;", m.GenerateDropUniqueConstraint("membership", "membership_team_email_key"))
+	assert.Equal(t, []string{"ALTER TABLE `orders` ADD CONSTRAINT `orders_price_check` CHECK (price >= 0);"}, m.GenerateAddCheckConstraint("orders", types.CheckConstraintDetail{Name: "orders_price_check", Expression: "price >= 0", IsNotValid: true}))
+	assert.Equal(t, "ALTER TABLE `orders` DROP CHECK `orders_price_check`;", m.GenerateDropCheckConstraint("orders", "orders_price_check"))
+}
+
+func TestLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(" + lockName + ", 0)")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(" + lockName + ", 0)")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(" + lockName + ")")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	var m MysqlMigrator
+	unlock, err := m.lock(migrator.MigratorArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db, LockWait: time.Minute})
+	assert.NoError(t, err)
+	unlock()
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// an error getting the lock returns null
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(" + lockName + ", 0)")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(nil))
+	_, err = m.lock(migrator.MigratorArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db, LockWait: time.Minute})
+	assert.EqualError(t, err, "error acquiring the migration lock: error getting lock")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectHistory expects the history table to be created and the migration to be recorded with the status
+func expectHistory(mock sqlmock.Sqlmock, status string, failure any) {
+	var m MysqlMigrator
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS " + m.QuoteTable(migrator.HistoryTable))).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, column := range []string{"status", "error_message"} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT " + m.QuoteTable(migrator.HistoryTable) + "." + m.QuoteColumn(column) + " FROM")).WillReturnRows(sqlmock.NewRows([]string{column}))
+	}
+	args := make([]driver.Value, 10)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO " + migrator.HistoryTable)).WithArgs(append(args, status, failure)...).WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestMigrateRecordsFailure(t *testing.T) {
+	changes := []migrator.MigrateChanges{
+		{Change: migrator.DropTable, Table: "orders"},
+		{Change: migrator.DropTable, Table: "users"},
+	}
+	migrate := func(t *testing.T, mock sqlmock.Sqlmock, db *sql.DB) error {
+		var m MysqlMigrator
+		err := m.Migrate(migrator.MigratorArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db, Diff: changes})
+		assert.NoError(t, mock.ExpectationsWereMet())
+		return err
+	}
+
+	// nothing was applied when the first statement fails
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(" + lockName + ", 0)")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS `orders`;")).WillReturnError(errors.New("table is locked"))
+	expectHistory(mock, "failed", sqlmock.AnyArg())
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(" + lockName + ")")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	err = migrate(t, mock, db)
+	assert.ErrorContains(t, err, "table is locked")
+	var partial *migrator.PartialError
+	assert.False(t, errors.As(err, &partial))
+
+	// the statements before the one which failed were applied
+	db, mock, err = sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(" + lockName + ", 0)")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS `orders`;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS `users`;")).WillReturnError(errors.New("table is locked"))
+	expectHistory(mock, "partial", sqlmock.AnyArg())
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT RELEASE_LOCK(" + lockName + ")")).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	err = migrate(t, mock, db)
+	assert.ErrorContains(t, err, "table is locked")
+	assert.ErrorAs(t, err, &partial)
+}
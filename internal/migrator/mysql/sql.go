@@ -0,0 +1,15 @@
+package mysql
+
+import (
+	"strings"
+)
+
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`, "\x00", "")
+
+func quoteIdentifier(val string) string {
+	return "`" + strings.ReplaceAll(val, "`", "``") + "`"
+}
+
+func quoteLiteral(val string) string {
+	return `'` + literalEscaper.Replace(val) + `'`
+}
@@ -0,0 +1,91 @@
+package migrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+// PlanVersion is the version of the plan file format
+const PlanVersion = "1"
+
+// ErrDrift is returned when the database schema changed since a plan was created
+var ErrDrift = errors.New("the database has changed since the plan was created")
+
+// Plan is a migration computed against a database which is saved so it can be reviewed and applied later
+type Plan struct {
+	Version     string             `json:"version"`
+	Driver      string             `json:"driver"`
+	Fingerprint string             `json:"fingerprint"` // fingerprint of the database schema the plan was computed against
+	Checksum    string             `json:"checksum"`    // SHA-256 of the target schema document
+	Commit      string             `json:"commit,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Schema      *schema.SchemaJson `json:"schema"`           // target schema
+	Changes     json.RawMessage    `json:"changes"`          // changes the plan applies
+	SQL         string             `json:"sql"`              // sql which the plan executes
+	Online      bool               `json:"online,omitempty"` // the sql alters the existing tables with the online statements
+}
+
+// NewPlan returns a plan for the changes computed against the database schema from
+func NewPlan(driver string, from *schema.SchemaJson, to *schema.SchemaJson, changes []MigrateChanges, sql string) (*Plan, error) {
+	fingerprint, err := schema.Fingerprint(from)
+	if err != nil {
+		return nil, fmt.Errorf("error generating fingerprint: %w", err)
+	}
+	buf, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding changes: %w", err)
+	}
+	target := *to
+	target.Database.Url = "${DATABASE_URL}" // don't save the credentials, the plan is applied to the database provided
+	return &Plan{
+		Version:     PlanVersion,
+		Driver:      driver,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now().UTC(),
+		Schema:      &target,
+		Changes:     buf,
+		SQL:         sql,
+	}, nil
+}
+
+// MigrateChanges returns the changes the plan applies
+func (p *Plan) MigrateChanges() ([]MigrateChanges, error) {
+	var changes []MigrateChanges
+	if err := json.Unmarshal(p.Changes, &changes); err != nil {
+		return nil, fmt.Errorf("error decoding changes: %w", err)
+	}
+	return changes, nil
+}
+
+// LoadPlan loads a plan from a file
+func LoadPlan(filename string) (*Plan, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(buf, &plan); err != nil {
+		return nil, fmt.Errorf("error decoding plan %s: %w", filename, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("plan %s has version %s but only version %s is supported", filename, plan.Version, PlanVersion)
+	}
+	if plan.Schema == nil {
+		return nil, fmt.Errorf("plan %s is missing the schema", filename)
+	}
+	return &plan, nil
+}
+
+// Save writes the plan to a file
+func (p *Plan) Save(filename string) error {
+	buf, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
+)
+
+// onlineGenerator alters the tables which are in use without holding the ACCESS EXCLUSIVE lock while the table is
+// scanned or rewritten. The scans are instead done by statements which allow reads and writes to continue, such as
+// building indexes concurrently and validating constraints which were added as not valid.
+type onlineGenerator struct {
+	PostgresMigrator
+}
+
+var _ migrator.TableGenerator = (*onlineGenerator)(nil)
+var _ migrator.ColumnSwapper = (*onlineGenerator)(nil)
+
+// swapColumnSuffix is appended to the name of a column for the column of the new type which is swapped in for it
+const swapColumnSuffix = "_shift_new"
+
+// backfillBatchSize is the number of rows copied to the column which is swapped in by each batch of the backfill
+const backfillBatchSize = 10000
+
+func (o *onlineGenerator) GenerateCreateIndex(table string, index types.IndexDetail) string {
+	return o.createIndex(table, index, true)
+}
+
+func (o *onlineGenerator) GenerateDropIndex(table string, index string) string {
+	return o.dropIndex(table, index, true)
+}
+
+// GenerateAddForeignKey adds the foreign key without checking the existing rows which are then checked by the validate
+func (o *onlineGenerator) GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s NOT VALID;\nALTER TABLE %s VALIDATE CONSTRAINT %s;", o.QuoteTable(table), migrator.GenerateForeignKeyConstraint(fk, o), o.QuoteTable(table), quoteIdentifier(fk.Name))
+}
+
+// GenerateAddUniqueConstraint builds the index of the constraint concurrently and then adds the constraint using it
+func (o *onlineGenerator) GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string {
+	index := types.IndexDetail{Name: unique.Name, IsUnique: true}
+	for _, column := range unique.Columns {
+		index.Columns = append(index.Columns, types.IndexColumnDetail{Name: column})
+	}
+	return fmt.Sprintf("%s\nALTER TABLE %s ADD CONSTRAINT %s UNIQUE USING INDEX %s;", o.createIndex(table, index, true), o.QuoteTable(table), quoteIdentifier(unique.Name), quoteIdentifier(unique.Name))
+}
+
+func (o *onlineGenerator) GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string {
+	check.IsNotValid = true
+	return o.PostgresMigrator.GenerateAddCheckConstraint(table, check)
+}
+
+// GenerateAlterColumn sets not null once a check constraint proving the column has no nulls is validated, which lets
+// postgres skip the scan it would otherwise do while holding the ACCESS EXCLUSIVE lock
+func (o *onlineGenerator) GenerateAlterColumn(table string, column types.ColumnDetail, changes []migrator.MigrateColumnChangeTypeType) []string {
+	var setNotNull bool
+	var rest []migrator.MigrateColumnChangeTypeType
+	for _, change := range changes {
+		if change == migrator.ColumnNullableChanged && !column.IsNullable {
+			setNotNull = true
+			continue
+		}
+		rest = append(rest, change)
+	}
+	res := o.PostgresMigrator.GenerateAlterColumn(table, column, rest)
+	if setNotNull {
+		res = append(res, o.setNotNull(table, column.Name)...)
+	}
+	return res
+}
+
+// setNotNull returns the statements which set the column to not null using a temporary check constraint
+func (o *onlineGenerator) setNotNull(table string, column string) []string {
+	_, name := splitQualifiedName(table)
+	check := types.CheckConstraintDetail{Name: name + "_" + column + "_shift_not_null", Expression: o.QuoteColumn(column) + " IS NOT NULL", IsNotValid: true}
+	return append(o.PostgresMigrator.GenerateAddCheckConstraint(table, check),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", o.QuoteTable(table), o.QuoteColumn(column)),
+		o.GenerateDropCheckConstraint(table, check.Name),
+	)
+}
+
+// GenerateSwapColumn changes the type of the column by adding a column of the new type which a trigger keeps in sync
+// while the existing rows are copied over in batches, each committed on its own. The existing column is then dropped
+// and the new one renamed to take its place, which moves the column to the end of the table. The statements are
+// executed in several transactions, or none without --transaction, so a migration which fails part way can leave the
+// new column and the trigger behind.
+func (o *onlineGenerator) GenerateSwapColumn(table string, column types.ColumnDetail) []string {
+	namespace, name := splitQualifiedName(table)
+	newColumn := column.Name + swapColumnSuffix
+	columnType := column.UDTName
+	cast := o.QuoteColumn(column.Name) + "::" + columnType
+	if column.Enum != nil {
+		// there's no implicit cast to an enum so the existing value is converted through text
+		columnType = o.GenerateColumnType(column)
+		cast = o.QuoteColumn(column.Name) + "::text::" + columnType
+	}
+	function := o.QuoteTable(qualifiedName(namespace, name+"_"+column.Name+"_shift_sync"))
+	trigger := quoteIdentifier(name + "_" + column.Name + "_shift_sync")
+	uncopied := fmt.Sprintf("%s IS NULL AND %s IS NOT NULL", o.QuoteColumn(newColumn), o.QuoteColumn(column.Name))
+	res := []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", o.QuoteTable(table), o.QuoteColumn(newColumn), columnType)}
+	if column.Default != nil && *column.Default != "" {
+		res = append(res, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", o.QuoteTable(table), o.QuoteColumn(newColumn), o.QuoteDefaultValue(*column.Default, column)))
+	}
+	// the body is quoted as a string rather than with dollar quotes so the statements can be split without parsing it
+	body := fmt.Sprintf("BEGIN NEW.%s := NEW.%s; RETURN NEW; END", o.QuoteColumn(newColumn), cast)
+	res = append(res,
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS '%s';", function, strings.ReplaceAll(body, "'", "''")),
+		fmt.Sprintf("CREATE TRIGGER %s BEFORE INSERT OR UPDATE ON %s FOR EACH ROW EXECUTE FUNCTION %s();", trigger, o.QuoteTable(table), function),
+		// only the rows which haven't been copied are updated so the backfill can be run again if it's interrupted. the
+		// batch is repeated by the migration until no rows are left, each in a transaction of its own so the row locks
+		// aren't held for the whole table, and the update after it copies the rest when the statements are run by hand.
+		fmt.Sprintf("UPDATE %s SET %s = %s WHERE ctid = ANY(ARRAY(SELECT ctid FROM %s WHERE %s LIMIT %d));", o.QuoteTable(table), o.QuoteColumn(newColumn), cast, o.QuoteTable(table), uncopied, backfillBatchSize),
+		fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s;", o.QuoteTable(table), o.QuoteColumn(newColumn), cast, uncopied),
+	)
+	if !column.IsNullable {
+		res = append(res, o.setNotNull(table, newColumn)...)
+	}
+	res = append(res,
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s;", trigger, o.QuoteTable(table)),
+		fmt.Sprintf("DROP FUNCTION IF EXISTS %s();", function),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", o.QuoteTable(table), o.QuoteColumn(column.Name)),
+		o.GenerateRenameColumn(table, newColumn, column.Name),
+	)
+	if column.Description != nil && *column.Description != "" {
+		res = append(res, o.GenerateColumnComment(table, column.Name, *column.Description))
+	}
+	return res
+}
@@ -1,11 +1,16 @@
 package postgres
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jhaynie/shift/internal/diff"
 	"github.com/jhaynie/shift/internal/migrator"
 	"github.com/jhaynie/shift/internal/migrator/types"
@@ -18,24 +23,60 @@ type PostgresMigrator struct {
 
 var _ migrator.Migrator = (*PostgresMigrator)(nil)
 var _ migrator.TableGenerator = (*PostgresMigrator)(nil)
+var _ migrator.NamespaceGenerator = (*PostgresMigrator)(nil)
+var _ migrator.OnlineGenerator = (*PostgresMigrator)(nil)
+var _ migrator.PreflightGenerator = (*PostgresMigrator)(nil)
 
 func (p *PostgresMigrator) Process(dbschema *schema.SchemaJson) error {
-	for _, table := range dbschema.Tables {
+	// the tables in the default namespace are the same as the tables without one
+	dbschema.Database.Schemas = slices.DeleteFunc(dbschema.Database.Schemas, func(namespace string) bool {
+		return namespace == defaultNamespace
+	})
+	for t, table := range dbschema.Tables {
+		if table.Schema != nil && *table.Schema == defaultNamespace {
+			table.Schema = nil
+		}
 		for i, col := range table.Columns {
 			col.NativeType = ToNativeType(col)
 			// if this is a serial type, we need to set the default to the generated auto increment sequence
 			if col.Type == schema.SchemaJsonTablesElemColumnsElemTypeInt && col.AutoIncrement != nil && *col.AutoIncrement && col.Default == nil {
 				col.Default = &schema.SchemaJsonTablesElemColumnsElemDefault{
-					Postgres: util.Ptr(fmt.Sprintf("nextval('%s_%s_seq'::regclass)", table.Name, col.Name)),
+					Postgres: util.Ptr(fmt.Sprintf("nextval('%s_%s_seq'::regclass)", schema.TableQualifiedName(table), col.Name)),
 				}
 			}
 			table.Columns[i] = col
 		}
+		dbschema.Tables[t] = table
 	}
 	return nil
 }
 
+// noTransaction matches the statements which postgres can't execute (or use the result of) inside a transaction
+var noTransaction = regexp.MustCompile(`(?is)^(CREATE\s+(UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX\s+\w+)\s+CONCURRENTLY\b|^ALTER\s+TYPE\s+.+\s+ADD\s+VALUE\b`)
+
+// isolated matches the statements of the online changes which scan or update the whole table. they're executed in a
+// transaction of their own so the locks taken by the statements before them aren't held while they run.
+var isolated = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+.+\s+VALIDATE\s+CONSTRAINT\b|^UPDATE\s`)
+
+// batch matches the updates of the online changes which copy a batch of the rows. they're repeated until they update
+// no rows.
+var batch = regexp.MustCompile(`(?is)^UPDATE\s.+\sWHERE\s+ctid\s*=\s*ANY\s*\(ARRAY\s*\(SELECT\s.+\sLIMIT\s+\d+\)\);$`)
+
+// flagStatements sets how each of the statements is executed
+func flagStatements(args migrator.MigratorArgs, statements []migrator.Statement) {
+	for i, statement := range statements {
+		statements[i].NoTransaction = noTransaction.MatchString(statement.SQL)
+		statements[i].Isolated = args.Online && isolated.MatchString(statement.SQL)
+		statements[i].Repeat = args.Online && batch.MatchString(statement.SQL)
+	}
+}
+
 func (p *PostgresMigrator) Migrate(args migrator.MigratorArgs) error {
+	unlock, err := p.lock(args)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if args.Drop {
 		var out strings.Builder
 		ts := time.Now()
@@ -44,45 +85,143 @@ func (p *PostgresMigrator) Migrate(args migrator.MigratorArgs) error {
 		}
 		args.Logger.Info("generated sql in %v", time.Since(ts))
 		ts = time.Now()
+		// the statements are executed in a single transaction so nothing is applied if one fails
 		if _, err := args.DB.ExecContext(args.Context, out.String()); err != nil {
-			return err
+			return recordMigration(args, out.String(), ts, err)
 		}
 		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, out.String(), ts, nil)
 	} else {
-		var queries strings.Builder
-		if err := diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, args.Diff, &queries); err != nil {
+		if err := diff.Refresh(&args, schema.DatabaseDriverPostgres); err != nil {
 			return err
 		}
-		ts := time.Now()
-		if _, err := args.DB.ExecContext(args.Context, queries.String()); err != nil {
+		if len(args.Diff) == 0 {
+			args.Logger.Info("no changes remain after acquiring the migration lock")
+			return nil
+		}
+		if err := diff.Preflight(args, schema.DatabaseDriverPostgres); err != nil {
 			return err
 		}
+		statements, err := diff.GenerateStatements(schema.DatabaseDriverPostgres, args.Diff, diff.WithOnline(args.Online))
+		if err != nil {
+			return err
+		}
+		flagStatements(args, statements)
+		var queries strings.Builder
+		for _, statement := range statements {
+			queries.WriteString(statement.SQL)
+			queries.WriteString("\n")
+		}
+		ts := time.Now()
+		if err := migrator.ExecuteStatements(args.Context, args.Logger, args.DB, args.Diff, statements, executeOptions(args)); err != nil {
+			return recordMigration(args, queries.String(), ts, err)
+		}
 		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, queries.String(), ts, nil)
 	}
-	return nil
+}
+
+// lockNotAvailable is the error code of a statement which timed out waiting for a lock
+const lockNotAvailable = "55P03"
+
+// executeOptions returns the options for executing the statements of the migration. The timeouts are set on the
+// connection so they apply to each statement.
+func executeOptions(args migrator.MigratorArgs) migrator.ExecuteOptions {
+	opts := migrator.ExecuteOptions{
+		Transactional: !args.NoTransaction,
+		Retries:       args.Retries,
+		Retryable: func(err error) bool {
+			var pgerr *pgconn.PgError
+			return errors.As(err, &pgerr) && pgerr.Code == lockNotAvailable
+		},
+	}
+	if args.LockTimeout > 0 {
+		opts.Setup = append(opts.Setup, fmt.Sprintf("SET lock_timeout = %d;", max(args.LockTimeout.Milliseconds(), 1)))
+		opts.Teardown = append(opts.Teardown, "RESET lock_timeout;")
+	}
+	if args.StatementTimeout > 0 {
+		opts.Setup = append(opts.Setup, fmt.Sprintf("SET statement_timeout = %d;", max(args.StatementTimeout.Milliseconds(), 1)))
+		opts.Teardown = append(opts.Teardown, "RESET statement_timeout;")
+	}
+	return opts
+}
+
+// advisoryLockKey is the key of the advisory lock held while migrating a database
+const advisoryLockKey = 0x7368696674 // shift
+
+// lock takes an advisory lock on a dedicated connection since the lock is held by the session which took it
+func (p *PostgresMigrator) lock(args migrator.MigratorArgs) (func(), error) {
+	conn, err := args.DB.Conn(args.Context)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.WaitForLock(args.Context, args.Logger, args.LockWait, func() (bool, error) {
+		var ok bool
+		err := conn.QueryRowContext(args.Context, "SELECT pg_try_advisory_lock($1)", advisoryLockKey).Scan(&ok)
+		return ok, err
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		var ok bool
+		if err := conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey).Scan(&ok); err != nil {
+			args.Logger.Warn("error releasing the migration lock: %s", err)
+		}
+		conn.Close()
+	}, nil
 }
 
 func (p *PostgresMigrator) ToSchema(args migrator.ToSchemaArgs) (*schema.SchemaJson, error) {
-	tables, err := migrator.GenerateInfoTables(args.Context, args.Logger, args.DB, migrator.WithTableFilter(args.TableFilter))
+	namespaces := []string{defaultNamespace}
+	for _, namespace := range args.Namespaces {
+		if !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	tables, err := migrator.GenerateInfoTables(args.Context, args.Logger, args.DB, migrator.WithTableFilter(args.TableFilter), migrator.WithTableSchemas(namespaces), migrator.WithDefaultTableSchema(defaultNamespace))
 	if err != nil {
 		return nil, fmt.Errorf("error generating table schema: %w", err)
 	}
-	tableComments, err := getTableDescriptions(args.Context, args.Logger, args.DB)
+	existingNamespaces, err := getNamespaces(args.Context, args.Logger, args.DB, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("error generating schemas: %w", err)
+	}
+	tableComments, err := getTableDescriptions(args.Context, args.Logger, args.DB, namespaces)
 	if err != nil {
 		return nil, fmt.Errorf("error generating table descriptions: %w", err)
 	}
-	columnComments, err := getColumnDescriptions(args.Context, args.Logger, args.DB)
+	columnComments, err := getColumnDescriptions(args.Context, args.Logger, args.DB, namespaces)
 	if err != nil {
 		return nil, fmt.Errorf("error generating column descriptions: %w", err)
 	}
-	autoIncrements, err := getTableAutoIncrements(args.Context, args.Logger, args.DB)
+	autoIncrements, err := getTableAutoIncrements(args.Context, args.Logger, args.DB, namespaces)
 	if err != nil {
 		return nil, fmt.Errorf("error generating column auto increments: %w", err)
 	}
+	indexes, err := getTableIndexes(args.Context, args.Logger, args.DB, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table indexes: %w", err)
+	}
+	foreignKeys, err := getTableForeignKeys(args.Context, args.Logger, args.DB, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table foreign keys: %w", err)
+	}
+	checks, err := getTableChecks(args.Context, args.Logger, args.DB, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table checks: %w", err)
+	}
+	enums, err := getEnums(args.Context, args.Logger, args.DB)
+	if err != nil {
+		return nil, fmt.Errorf("error generating enums: %w", err)
+	}
 	for table, detail := range tables {
 		if tableComment, ok := tableComments[table]; ok && tableComment != "" {
 			detail.Description = &tableComment
 		}
+		detail.Indexes = indexes[table]
+		detail.ForeignKeys = foreignKeys[table]
+		detail.Checks = checks[table]
 		if comments, ok := columnComments[table]; ok {
 			for i, column := range detail.Columns {
 				if columnComment, ok := comments[column.Name]; ok && columnComment != "" {
@@ -92,11 +231,20 @@ func (p *PostgresMigrator) ToSchema(args migrator.ToSchemaArgs) (*schema.SchemaJ
 			}
 		}
 		for i, column := range detail.Columns {
-			dt, _, err := dataTypeToType(column.DataType, column.UDTName)
-			if err != nil {
-				return nil, fmt.Errorf("error converting column %s with table: %s. %s", column.Name, table, err)
+			if enum := schema.FindEnum(enums, strings.TrimPrefix(column.UDTName, "_")); enum != nil {
+				// the enum values are stored as strings and the default is cast to the enum type
+				column.DataType = string(schema.SchemaJsonTablesElemColumnsElemTypeString)
+				column.Enum = &enum.Name
+				if column.Default != nil {
+					column.Default = util.Ptr(strings.TrimSuffix(*column.Default, "::"+enum.Name))
+				}
+			} else {
+				dt, _, err := dataTypeToType(column.DataType, column.UDTName)
+				if err != nil {
+					return nil, fmt.Errorf("error converting column %s with table: %s. %s", column.Name, table, err)
+				}
+				column.DataType = string(dt)
 			}
-			column.DataType = string(dt)
 			for _, constraint := range detail.Constraints {
 				if constraint.Column == column.Name && constraint.Type == "PRIMARY KEY" {
 					column.IsPrimaryKey = true
@@ -116,13 +264,37 @@ func (p *PostgresMigrator) ToSchema(args migrator.ToSchemaArgs) (*schema.SchemaJ
 			detail.Columns[i] = column
 		}
 	}
-	return schema.GenerateSchemaJsonFromInfoTables(args.Logger, schema.DatabaseDriverPostgres, tables)
+	res, err := schema.GenerateSchemaJsonFromInfoTables(args.Logger, schema.DatabaseDriverPostgres, tables)
+	if err != nil {
+		return nil, err
+	}
+	res.Enums = enums
+	// the existing schemas are included so that only the missing ones are created by a diff
+	for _, namespace := range existingNamespaces {
+		if namespace != defaultNamespace {
+			res.Database.Schemas = append(res.Database.Schemas, namespace)
+		}
+	}
+	return res, nil
 }
 
 // ------------- TableGenerator ------------
 
 func (p *PostgresMigrator) FromSchema(schemajson *schema.SchemaJson, out io.Writer) error {
-	for _, table := range schemajson.Tables {
+	// the schemas are created first since the tables are created in them
+	for _, namespace := range schema.Namespaces(schemajson) {
+		if namespace != defaultNamespace {
+			io.WriteString(out, p.GenerateCreateNamespace(namespace))
+			io.WriteString(out, "\n")
+		}
+	}
+	// the enums are created first since the tables use them as column types
+	for _, enum := range schemajson.Enums {
+		io.WriteString(out, p.GenerateCreateEnum(enum.Name, enum.Values))
+		io.WriteString(out, "\n")
+	}
+	details := make([]types.TableDetail, len(schemajson.Tables))
+	for t, table := range schemajson.Tables {
 		columns := make([]types.ColumnDetail, 0)
 		for i, col := range table.Columns {
 			val, err := schema.SchemaColumnToColumn(schema.DatabaseDriverPostgres, col, i+1, ToNativeType(col))
@@ -131,17 +303,29 @@ func (p *PostgresMigrator) FromSchema(schemajson *schema.SchemaJson, out io.Writ
 			}
 			columns = append(columns, *val)
 		}
-		statements := migrator.GenerateCreateStatement(table.Name, types.TableDetail{
-			Columns:     columns,
-			Description: table.Description,
-			Constraints: make([]types.ConstraintDetail, 0), // TODO
-		}, p)
-		io.WriteString(out, statements)
+		details[t] = types.TableDetail{
+			Columns:           columns,
+			Description:       table.Description,
+			Constraints:       make([]types.ConstraintDetail, 0), // TODO
+			Indexes:           schema.SchemaIndexesToIndexes(table.Indexes),
+			ForeignKeys:       schema.SchemaTableForeignKeys(table),
+			PrimaryKey:        schema.TablePrimaryKey(table),
+			UniqueConstraints: schema.SchemaTableUniqueConstraints(table),
+			Checks:            schema.SchemaTableChecks(table),
+		}
+		io.WriteString(out, migrator.GenerateCreateStatement(schema.TableQualifiedName(table), details[t], p))
+	}
+	// the foreign keys are added once all the tables exist since the tables can reference each other
+	for t, table := range schemajson.Tables {
+		io.WriteString(out, migrator.GenerateAddForeignKeys(schema.TableQualifiedName(table), details[t], p))
 	}
 	return nil
 }
 
 func (p *PostgresMigrator) QuoteTable(val string) string {
+	if namespace, name := splitQualifiedName(val); namespace != defaultNamespace {
+		return quoteIdentifier(namespace) + "." + quoteIdentifier(name)
+	}
 	return quoteIdentifier(val)
 }
 
@@ -177,10 +361,225 @@ func (p *PostgresMigrator) GenerateColumnComment(table string, column string, va
 	return fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;", p.QuoteTable(table), p.QuoteColumn(column), p.QuoteLiteral(val))
 }
 
+func (p *PostgresMigrator) GenerateColumnType(column types.ColumnDetail) string {
+	if column.IsAutoIncrementing {
+		return "SERIAL"
+	}
+	if column.Enum != nil {
+		// the enum type is created with a quoted name so it has to be referenced the same way
+		return quoteIdentifier(*column.Enum) + toMaybeArray("", column.IsArray)
+	}
+	return column.UDTName
+}
+
+func (p *PostgresMigrator) GenerateLength(column string) string {
+	return "char_length(" + column + ")"
+}
+
+// GenerateInvalidCast checks the text of the value against the input of the type which needs postgres 16
+func (p *PostgresMigrator) GenerateInvalidCast(column string, to types.ColumnDetail) string {
+	return fmt.Sprintf("NOT pg_input_is_valid(%s::text, '%s')", column, strings.ReplaceAll(p.GenerateColumnType(to), "'", "''"))
+}
+
+func (p *PostgresMigrator) GenerateColumnAttributes(column types.ColumnDetail) []string {
+	return nil
+}
+
+func (p *PostgresMigrator) GenerateAlterColumn(table string, column types.ColumnDetail, changes []migrator.MigrateColumnChangeTypeType) []string {
+	var res []string
+	statements := make([]string, 0)
+	for _, change := range changes {
+		switch change {
+		case migrator.ColumnDescriptionChanged:
+			var val string
+			if column.Description != nil {
+				val = *column.Description
+			}
+			res = append(res, p.GenerateColumnComment(table, column.Name, val))
+		case migrator.ColumnTypeChanged:
+			if column.Enum != nil {
+				// there's no implicit cast to an enum so the existing value is converted through text
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" TYPE "+p.GenerateColumnType(column)+" USING "+p.QuoteColumn(column.Name)+"::text::"+p.GenerateColumnType(column))
+			} else {
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" TYPE "+column.UDTName)
+			}
+		case migrator.ColumnDefaultChanged:
+			if column.Default == nil || *column.Default == "" {
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" DROP DEFAULT")
+			} else {
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" SET DEFAULT "+p.QuoteDefaultValue(*column.Default, column))
+			}
+		case migrator.ColumnNullableChanged:
+			if column.IsNullable {
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" DROP NOT NULL")
+			} else {
+				statements = append(statements, "ALTER COLUMN "+p.QuoteColumn(column.Name)+" SET NOT NULL")
+			}
+		default:
+			panic("change " + change + " not handled")
+		}
+	}
+	if len(statements) > 0 {
+		res = append(res, fmt.Sprintf("ALTER TABLE %s %s;", p.QuoteTable(table), strings.Join(statements, ", ")))
+	}
+	return res
+}
+
+func (p *PostgresMigrator) GenerateDropColumn(table string, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s CASCADE;", p.QuoteTable(table), p.QuoteColumn(column))
+}
+
+func (p *PostgresMigrator) GenerateRenameColumn(table string, column string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", p.QuoteTable(table), p.QuoteColumn(column), p.QuoteColumn(name))
+}
+
+func (p *PostgresMigrator) GenerateDropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE;", p.QuoteTable(table))
+}
+
+// GenerateRenameTable renames the table to the name which is unqualified since the table stays in its schema
+func (p *PostgresMigrator) GenerateRenameTable(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", p.QuoteTable(table), p.QuoteTable(name))
+}
+
+func (p *PostgresMigrator) GenerateCreateIndex(table string, index types.IndexDetail) string {
+	return p.createIndex(table, index, false)
+}
+
+// createIndex returns the statement creating the index, concurrently if asked so writes to the table aren't blocked.
+// A concurrent build which fails leaves an invalid index behind which is treated as missing, so the index is dropped
+// first rather than skipped with IF NOT EXISTS which would match the invalid index by its name and leave it invalid.
+func (p *PostgresMigrator) createIndex(table string, index types.IndexDetail, concurrently bool) string {
+	var sql strings.Builder
+	sql.WriteString(p.dropIndex(table, index.Name, concurrently))
+	sql.WriteString("\nCREATE ")
+	if index.IsUnique {
+		sql.WriteString("UNIQUE ")
+	}
+	sql.WriteString("INDEX ")
+	if concurrently {
+		sql.WriteString("CONCURRENTLY ")
+	}
+	sql.WriteString(quoteIdentifier(index.Name))
+	sql.WriteString(" ON ")
+	sql.WriteString(p.QuoteTable(table))
+	if index.Method != nil && *index.Method != "" {
+		sql.WriteString(" USING ")
+		sql.WriteString(*index.Method)
+	}
+	sql.WriteString(" (")
+	sql.WriteString(migrator.GenerateIndexKeys(index, p))
+	sql.WriteString(")")
+	if index.Where != nil && *index.Where != "" {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(*index.Where)
+	}
+	sql.WriteString(";")
+	return sql.String()
+}
+
+func (p *PostgresMigrator) GenerateDropIndex(table string, index string) string {
+	return p.dropIndex(table, index, false)
+}
+
+// dropIndex returns the statement dropping the index, concurrently if asked so queries on the table aren't blocked
+func (p *PostgresMigrator) dropIndex(table string, index string, concurrently bool) string {
+	// the index is in the same namespace as the table
+	namespace, _ := splitQualifiedName(table)
+	var option string
+	if concurrently {
+		option = "CONCURRENTLY "
+	}
+	return fmt.Sprintf("DROP INDEX %sIF EXISTS %s;", option, p.QuoteTable(qualifiedName(namespace, index)))
+}
+
+func (p *PostgresMigrator) GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateForeignKeyConstraint(fk, p))
+}
+
+func (p *PostgresMigrator) GenerateDropForeignKey(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *PostgresMigrator) GenerateAddPrimaryKey(table string, columns []string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", p.QuoteTable(table), migrator.GenerateColumnList(columns, p))
+}
+
+func (p *PostgresMigrator) GenerateDropPrimaryKey(table string) string {
+	// postgres names the primary key constraint <table>_pkey unless it was created with a name
+	_, name := splitQualifiedName(table)
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.QuoteTable(table), quoteIdentifier(name+"_pkey"))
+}
+
+func (p *PostgresMigrator) GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateUniqueConstraint(unique, p))
+}
+
+func (p *PostgresMigrator) GenerateDropUniqueConstraint(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *PostgresMigrator) GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string {
+	if !check.IsNotValid {
+		return []string{fmt.Sprintf("ALTER TABLE %s ADD %s;", p.QuoteTable(table), migrator.GenerateCheckConstraint(check, p))}
+	}
+	// adding the constraint as not valid skips the scan of the existing rows which is instead done by the validate which
+	// only takes a lock that allows reads and writes to continue
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ADD %s NOT VALID;", p.QuoteTable(table), migrator.GenerateCheckConstraint(check, p)),
+		fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s;", p.QuoteTable(table), quoteIdentifier(check.Name)),
+	}
+}
+
+func (p *PostgresMigrator) GenerateDropCheckConstraint(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.QuoteTable(table), quoteIdentifier(name))
+}
+
+func (p *PostgresMigrator) GenerateCreateEnum(name string, values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = p.QuoteLiteral(value)
+	}
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", quoteIdentifier(name), strings.Join(quoted, ", "))
+}
+
+func (p *PostgresMigrator) GenerateAddEnumValue(name string, value migrator.MigrateEnumValue) string {
+	var position string
+	switch {
+	case value.Before != "":
+		position = " BEFORE " + p.QuoteLiteral(value.Before)
+	case value.After != "":
+		position = " AFTER " + p.QuoteLiteral(value.After)
+	}
+	return fmt.Sprintf("ALTER TYPE %s ADD VALUE IF NOT EXISTS %s%s;", quoteIdentifier(name), p.QuoteLiteral(value.Value), position)
+}
+
+func (p *PostgresMigrator) GenerateDropEnum(name string) string {
+	return fmt.Sprintf("DROP TYPE IF EXISTS %s;", quoteIdentifier(name))
+}
+
+func (p *PostgresMigrator) GenerateCreateNamespace(name string) string {
+	return fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", quoteIdentifier(name))
+}
+
+// Online returns the generator which alters the existing tables without long locks
+func (p *PostgresMigrator) Online() migrator.TableGenerator {
+	return &onlineGenerator{}
+}
+
 func (p *PostgresMigrator) ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType {
 	return ToNativeType(column)
 }
 
+// recordMigration records the migration in the history table along with the error it failed with, which is returned
+func recordMigration(args migrator.MigratorArgs, sql string, started time.Time, failure error) error {
+	plan, err := diff.FormatPlan(args.Diff)
+	if err != nil {
+		return errors.Join(failure, err)
+	}
+	return migrator.RecordMigration(args, "postgres", plan, sql, started, failure)
+}
+
 func init() {
 	var m PostgresMigrator
 	for _, proto := range []string{"postgres", "postgresql"} {
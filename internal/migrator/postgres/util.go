@@ -7,13 +7,14 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/jhaynie/shift/internal/migrator"
 	"github.com/jhaynie/shift/internal/migrator/types"
 	"github.com/jhaynie/shift/internal/schema"
 	"github.com/jhaynie/shift/internal/util"
 	"github.com/shopmonkeyus/go-common/logger"
 )
 
-func execute(ctx context.Context, logger logger.Logger, db *sql.DB, query string, args ...any) (*sql.Rows, error) {
+func execute(ctx context.Context, logger logger.Logger, db migrator.Queryer, query string, args ...any) (*sql.Rows, error) {
 	logger.Trace("sql: %s", query)
 	res, err := db.QueryContext(ctx, query, args...)
 	if err != nil && err != sql.ErrNoRows {
@@ -22,7 +23,65 @@ func execute(ctx context.Context, logger logger.Logger, db *sql.DB, query string
 	return res, err
 }
 
+// defaultNamespace is the schema of the tables which don't have one
+const defaultNamespace = "public"
+
+// withNamespaces returns the query with the predicate for the namespaces filled in
+func withNamespaces(query string, namespaces []string) string {
+	quoted := make([]string, len(namespaces))
+	for i, namespace := range namespaces {
+		quoted[i] = quoteValue(namespace)
+	}
+	return fmt.Sprintf(query, strings.Join(quoted, ","))
+}
+
+// qualifiedName returns the name of a table which is qualified by the namespace unless it's the default namespace
+func qualifiedName(namespace string, name string) string {
+	if namespace == defaultNamespace {
+		return name
+	}
+	return schema.QualifiedName(namespace, name)
+}
+
+// splitQualifiedName returns the namespace and the name of a table which is only qualified outside the default namespace
+func splitQualifiedName(val string) (string, string) {
+	if i := strings.Index(val, "."); i > 0 {
+		return val[:i], val[i+1:]
+	}
+	return defaultNamespace, val
+}
+
+var namespacesSQL = util.CleanSQL(`SELECT
+	nspname
+FROM
+	pg_namespace
+WHERE
+	nspname IN (%s)
+ORDER BY nspname
+`)
+
+// getNamespaces returns the namespaces which exist from the ones provided
+func getNamespaces(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) ([]string, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(namespacesSQL, namespaces))
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name string
+			if err := res.Scan(&name); err != nil {
+				return nil, err
+			}
+			found = append(found, name)
+		}
+	}
+	return found, nil
+}
+
 var tableCommentSQL = util.CleanSQL(`SELECT
+    n.nspname,
     c.relname,
     COALESCE(obj_description(c.oid), '')
 FROM
@@ -30,14 +89,14 @@ FROM
 JOIN
     pg_namespace n ON n.oid = c.relnamespace
 WHERE
-    n.nspname = 'public'
+    n.nspname IN (%s)
     AND c.relkind = 'r'
 		AND c.oid IS NOT NULL
 `)
 
 // getTableDescriptions will return a map of table to table comment
-func getTableDescriptions(ctx context.Context, logger logger.Logger, db *sql.DB) (map[string]string, error) {
-	res, err := execute(ctx, logger, db, tableCommentSQL)
+func getTableDescriptions(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string]string, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(tableCommentSQL, namespaces))
 	if err != nil {
 		return nil, err
 	}
@@ -45,35 +104,37 @@ func getTableDescriptions(ctx context.Context, logger logger.Logger, db *sql.DB)
 	if res != nil {
 		defer res.Close()
 		for res.Next() {
-			var name, comment string
-			if err := res.Scan(&name, &comment); err != nil {
+			var namespace, name, comment string
+			if err := res.Scan(&namespace, &name, &comment); err != nil {
 				return nil, err
 			}
-			tables[name] = comment
+			tables[qualifiedName(namespace, name)] = comment
 		}
 	}
 	return tables, nil
 }
 
 var columnCommentSQL = util.CleanSQL(`SELECT
-	col.table_name,
-	col.column_name,
+	n.nspname,
+	c.relname,
+	a.attname,
   COALESCE(pg_catalog.col_description(c.oid, a.attnum),'')
 FROM
-	information_schema.columns col
-JOIN
-	pg_attribute a ON a.attname = col.column_name
+	pg_attribute a
 JOIN
 	pg_class c ON c.oid = a.attrelid
+JOIN
+	pg_namespace n ON n.oid = c.relnamespace
 WHERE
-	col.table_schema = 'public'
+	n.nspname IN (%s)
+	AND c.relkind = 'r'
 	AND a.attnum > 0
-	AND c.oid IS NOT NULL
+	AND NOT a.attisdropped
 `)
 
 // getColumnDescriptions will return a map of table to a map of column comments
-func getColumnDescriptions(ctx context.Context, logger logger.Logger, db *sql.DB) (map[string]map[string]string, error) {
-	res, err := execute(ctx, logger, db, columnCommentSQL)
+func getColumnDescriptions(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string]map[string]string, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(columnCommentSQL, namespaces))
 	if err != nil {
 		return nil, err
 	}
@@ -81,10 +142,11 @@ func getColumnDescriptions(ctx context.Context, logger logger.Logger, db *sql.DB
 	if res != nil {
 		defer res.Close()
 		for res.Next() {
-			var table, column, comment string
-			if err := res.Scan(&table, &column, &comment); err != nil {
+			var namespace, name, column, comment string
+			if err := res.Scan(&namespace, &name, &column, &comment); err != nil {
 				return nil, err
 			}
+			table := qualifiedName(namespace, name)
 			columns := tables[table]
 			if columns == nil {
 				tables[table] = make(map[string]string)
@@ -122,22 +184,23 @@ func dataTypeToType(val string, nativeType string) (schema.SchemaJsonTablesElemC
 }
 
 var tableIdentitySQL = util.CleanSQL(`SELECT
+	table_schema,
 	table_name,
 	column_name
 FROM
     information_schema.columns
 WHERE
 	data_type = 'integer'
-	AND (is_identity = 'YES' OR column_default LIKE 'nextval%')
-	AND table_name IN (
-  	SELECT table_name FROM information_schema.tables 
-  	WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('pg_catalog','information_schema') 
+	AND (is_identity = 'YES' OR column_default LIKE 'nextval%%')
+	AND (table_schema, table_name) IN (
+  	SELECT table_schema, table_name FROM information_schema.tables 
+  	WHERE table_type = 'BASE TABLE' AND table_schema IN (%s) 
   	AND table_catalog = current_database() 
 	)`)
 
 // getTableAutoIncrements returns a map of table to column of those columns which are auto incrementing
-func getTableAutoIncrements(ctx context.Context, logger logger.Logger, db *sql.DB) (map[string]map[string]bool, error) {
-	res, err := execute(ctx, logger, db, tableIdentitySQL)
+func getTableAutoIncrements(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string]map[string]bool, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(tableIdentitySQL, namespaces))
 	if err != nil {
 		return nil, err
 	}
@@ -145,14 +208,15 @@ func getTableAutoIncrements(ctx context.Context, logger logger.Logger, db *sql.D
 	if res != nil {
 		defer res.Close()
 		for res.Next() {
-			var name, column string
-			if err := res.Scan(&name, &column); err != nil {
+			var namespace, name, column string
+			if err := res.Scan(&namespace, &name, &column); err != nil {
 				return nil, err
 			}
-			kv := tables[name]
+			table := qualifiedName(namespace, name)
+			kv := tables[table]
 			if kv == nil {
 				kv = make(map[string]bool)
-				tables[name] = kv
+				tables[table] = kv
 			}
 			kv[column] = true
 		}
@@ -171,6 +235,9 @@ func ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJ
 	if column.NativeType != nil && column.NativeType.Postgres != nil {
 		return column.NativeType
 	}
+	if column.Enum != nil {
+		return schema.ToNativeType(schema.DatabaseDriverPostgres, toMaybeArray(*column.Enum, column.IsArray))
+	}
 	switch column.Type {
 	case schema.SchemaJsonTablesElemColumnsElemTypeBoolean:
 		return schema.ToNativeType(schema.DatabaseDriverPostgres, toMaybeArray("bool", column.IsArray))
@@ -299,3 +366,263 @@ func formatDefault(column types.ColumnDetail) (*string, error) {
 	}
 	return val, nil
 }
+
+var tableIndexesSQL = util.CleanSQL(`SELECT
+	n.nspname,
+	t.relname,
+	i.relname,
+	ix.indisunique,
+	am.amname,
+	COALESCE(pg_get_expr(ix.indpred, ix.indrelid, true), ''),
+	pg_get_indexdef(ix.indexrelid),
+	COALESCE(a.attname, ''),
+	(ix.indoption[k.n - 1] & 1) = 1,
+	ix.indisvalid
+FROM
+	pg_index ix
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_class t ON t.oid = ix.indrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_am am ON am.oid = i.relam
+CROSS JOIN LATERAL generate_series(1, ix.indnkeyatts) AS k(n)
+LEFT JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = ix.indkey[k.n - 1]
+WHERE
+	n.nspname IN (%s)
+	AND t.relkind = 'r'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid AND c.contype IN ('p', 'u', 'x')
+	)
+ORDER BY n.nspname, t.relname, i.relname, k.n
+`)
+
+// indexKeysFromDefinition returns the key part of an index definition as returned by pg_get_indexdef
+func indexKeysFromDefinition(def string, method string) string {
+	offset := strings.Index(def, " USING "+method+" (")
+	if offset < 0 {
+		return ""
+	}
+	start := offset + len(" USING "+method+" ")
+	end := util.MatchingParen(def, start)
+	if end < 0 {
+		return ""
+	}
+	return def[start+1 : end]
+}
+
+// getTableIndexes returns a map of table to the indexes for the table which aren't backing a constraint. The invalid
+// indexes left behind by a failed concurrent build are skipped so they're treated as missing.
+func getTableIndexes(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string][]types.IndexDetail, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(tableIndexesSQL, namespaces))
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]types.IndexDetail)
+	if res != nil {
+		defer res.Close()
+		var current *types.IndexDetail
+		var currentTable string
+		invalid := make(map[string]bool)
+		for res.Next() {
+			var namespace, relname, name, method, predicate, def, column string
+			var unique, descending, valid bool
+			if err := res.Scan(&namespace, &relname, &name, &unique, &method, &predicate, &def, &column, &descending, &valid); err != nil {
+				return nil, err
+			}
+			table := qualifiedName(namespace, relname)
+			if !valid {
+				if !invalid[table+"."+name] {
+					invalid[table+"."+name] = true
+					logger.Warn("index %s of %s is invalid, which a failed concurrent build leaves behind, so it's treated as missing and rebuilt by the migration", name, table)
+				}
+				continue
+			}
+			if current == nil || current.Name != name || currentTable != table {
+				tables[table] = append(tables[table], types.IndexDetail{
+					Name:     name,
+					IsUnique: unique,
+					Method:   util.Ptr(method),
+				})
+				current = &tables[table][len(tables[table])-1]
+				currentTable = table
+				if predicate != "" {
+					current.Where = util.Ptr(predicate)
+				}
+			}
+			if column == "" {
+				// one of the keys is an expression so we use the keys as defined by the database
+				current.Expression = util.Ptr(indexKeysFromDefinition(def, method))
+				current.Columns = nil
+			} else if current.Expression == nil {
+				current.Columns = append(current.Columns, types.IndexColumnDetail{Name: column, IsDescending: descending})
+			}
+		}
+	}
+	return tables, nil
+}
+
+var tableForeignKeysSQL = util.CleanSQL(`SELECT
+	n.nspname,
+	t.relname,
+	c.conname,
+	a.attname,
+	rn.nspname,
+	rt.relname,
+	ra.attname,
+	c.confdeltype,
+	c.confupdtype,
+	c.condeferrable AND c.condeferred,
+	array_length(c.conkey, 1) > 1
+FROM
+	pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class rt ON rt.oid = c.confrelid
+JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = c.confkey[1]
+WHERE
+	n.nspname IN (%s)
+	AND c.contype = 'f'
+ORDER BY n.nspname, t.relname, c.conname
+`)
+
+// foreignKeyAction converts the action code used by pg_constraint into the referential action
+func foreignKeyAction(val string) string {
+	switch val {
+	case "r":
+		return "restrict"
+	case "c":
+		return "cascade"
+	case "n":
+		return "set null"
+	case "d":
+		return "set default"
+	}
+	return "no action"
+}
+
+// getTableForeignKeys returns a map of table to the single column foreign keys for the table. The foreign keys of
+// more than one column aren't supported so they're skipped with a warning.
+func getTableForeignKeys(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string][]types.ForeignKeyDetail, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(tableForeignKeysSQL, namespaces))
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]types.ForeignKeyDetail)
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var namespace, table, name, column, refNamespace, refTable, refColumn, onDelete, onUpdate string
+			var deferrable, composite bool
+			if err := res.Scan(&namespace, &table, &name, &column, &refNamespace, &refTable, &refColumn, &onDelete, &onUpdate, &deferrable, &composite); err != nil {
+				return nil, err
+			}
+			table = qualifiedName(namespace, table)
+			if composite {
+				logger.Warn("skipping foreign key %s of %s since foreign keys of more than one column aren't supported", name, table)
+				continue
+			}
+			tables[table] = append(tables[table], types.ForeignKeyDetail{
+				Name:            name,
+				Column:          column,
+				ReferenceTable:  qualifiedName(refNamespace, refTable),
+				ReferenceColumn: refColumn,
+				OnDelete:        util.Ptr(foreignKeyAction(onDelete)),
+				OnUpdate:        util.Ptr(foreignKeyAction(onUpdate)),
+				IsDeferrable:    deferrable,
+			})
+		}
+	}
+	return tables, nil
+}
+
+var tableChecksSQL = util.CleanSQL(`SELECT
+	n.nspname,
+	t.relname,
+	c.conname,
+	pg_get_constraintdef(c.oid),
+	COALESCE(a.attname, '')
+FROM
+	pg_constraint c
+JOIN pg_class t ON t.oid = c.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+LEFT JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1] AND array_length(c.conkey, 1) = 1
+WHERE
+	n.nspname IN (%s)
+	AND c.contype = 'c'
+ORDER BY n.nspname, t.relname, c.conname
+`)
+
+// checkExpression returns the expression from a check constraint definition in the form CHECK (expr) [NOT VALID]
+func checkExpression(def string) string {
+	start := strings.Index(def, "(")
+	if start < 0 {
+		return def
+	}
+	end := util.MatchingParen(def, start)
+	if end < 0 {
+		return def
+	}
+	return util.TrimParens(def[start : end+1])
+}
+
+// getTableChecks returns a map of table to the check constraints for the table
+func getTableChecks(ctx context.Context, logger logger.Logger, db migrator.Queryer, namespaces []string) (map[string][]types.CheckConstraintDetail, error) {
+	res, err := execute(ctx, logger, db, withNamespaces(tableChecksSQL, namespaces))
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]types.CheckConstraintDetail)
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var namespace, table, name, def, column string
+			if err := res.Scan(&namespace, &table, &name, &def, &column); err != nil {
+				return nil, err
+			}
+			table = qualifiedName(namespace, table)
+			tables[table] = append(tables[table], types.CheckConstraintDetail{
+				Name:       name,
+				Expression: checkExpression(def),
+				Column:     column,
+				IsNotValid: strings.HasSuffix(def, " NOT VALID"),
+			})
+		}
+	}
+	return tables, nil
+}
+
+var enumsSQL = util.CleanSQL(`SELECT
+	t.typname,
+	e.enumlabel
+FROM
+	pg_type t
+JOIN pg_enum e ON e.enumtypid = t.oid
+JOIN pg_namespace n ON n.oid = t.typnamespace
+WHERE
+	n.nspname = 'public'
+ORDER BY t.typname, e.enumsortorder
+`)
+
+// getEnums returns the enum types in name order with their values in sort order
+func getEnums(ctx context.Context, logger logger.Logger, db migrator.Queryer) ([]schema.SchemaJsonEnumsElem, error) {
+	res, err := execute(ctx, logger, db, enumsSQL)
+	if err != nil {
+		return nil, err
+	}
+	var enums []schema.SchemaJsonEnumsElem
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name, value string
+			if err := res.Scan(&name, &value); err != nil {
+				return nil, err
+			}
+			if len(enums) == 0 || enums[len(enums)-1].Name != name {
+				enums = append(enums, schema.SchemaJsonEnumsElem{Name: name})
+			}
+			enums[len(enums)-1].Values = append(enums[len(enums)-1].Values, value)
+		}
+	}
+	return enums, nil
+}
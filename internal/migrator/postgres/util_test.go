@@ -1,11 +1,25 @@
 package postgres
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fatih/color"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
 	"github.com/jhaynie/shift/internal/migrator/types"
 	"github.com/jhaynie/shift/internal/schema"
 	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -192,3 +206,982 @@ func TestIsFunctionCall(t *testing.T) {
 	assert.False(t, util.IsFunctionCall("'foo'"))
 	assert.False(t, util.IsFunctionCall("'foo'::jsonb"))
 }
+
+func TestIndexKeysFromDefinition(t *testing.T) {
+	assert.Equal(t, "email, created_at DESC", indexKeysFromDefinition("CREATE INDEX users_email_idx ON public.users USING btree (email, created_at DESC)", "btree"))
+	assert.Equal(t, "lower((email)::text)", indexKeysFromDefinition("CREATE UNIQUE INDEX users_lower_idx ON public.users USING btree (lower((email)::text)) WHERE (deleted_at IS NULL)", "btree"))
+	assert.Equal(t, "data", indexKeysFromDefinition("CREATE INDEX users_data_idx ON public.users USING gin (data)", "gin"))
+	assert.Equal(t, "", indexKeysFromDefinition("CREATE INDEX users_data_idx ON public.users USING gin (data)", "btree"))
+}
+
+func TestGetTableIndexes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(withNamespaces(tableIndexesSQL, []string{"public", "sales"}))).WillReturnRows(sqlmock.NewRows([]string{"namespace", "table", "index", "unique", "method", "predicate", "def", "column", "desc", "valid"}).
+		AddRow("public", "users", "users_email_idx", false, "btree", "", "CREATE INDEX users_email_idx ON public.users USING btree (email, created_at DESC)", "email", false, true).
+		AddRow("public", "users", "users_email_idx", false, "btree", "", "CREATE INDEX users_email_idx ON public.users USING btree (email, created_at DESC)", "created_at", true, true).
+		AddRow("public", "users", "users_lower_idx", true, "btree", "deleted_at IS NULL", "CREATE UNIQUE INDEX users_lower_idx ON public.users USING btree (lower((email)::text)) WHERE (deleted_at IS NULL)", "", false, true).
+		AddRow("sales", "orders", "orders_data_idx", false, "gin", "", "CREATE INDEX orders_data_idx ON sales.orders USING gin (data)", "data", false, true).
+		AddRow("sales", "orders", "orders_sku_idx", true, "btree", "", "CREATE UNIQUE INDEX orders_sku_idx ON sales.orders USING btree (sku)", "sku", false, false))
+	indexes, err := getTableIndexes(context.Background(), logger.NewTestLogger(), db, []string{"public", "sales"})
+	assert.NoError(t, err)
+	assert.Len(t, indexes, 2)
+	assert.Len(t, indexes["users"], 2)
+	assert.Equal(t, types.IndexDetail{
+		Name:    "users_email_idx",
+		Method:  util.Ptr("btree"),
+		Columns: []types.IndexColumnDetail{{Name: "email"}, {Name: "created_at", IsDescending: true}},
+	}, indexes["users"][0])
+	assert.Equal(t, types.IndexDetail{
+		Name:       "users_lower_idx",
+		Method:     util.Ptr("btree"),
+		IsUnique:   true,
+		Expression: util.Ptr("lower((email)::text)"),
+		Where:      util.Ptr("deleted_at IS NULL"),
+	}, indexes["users"][1])
+	assert.Len(t, indexes["sales.orders"], 1)
+	assert.Equal(t, "gin", *indexes["sales.orders"][0].Method)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGenerateCreateIndex(t *testing.T) {
+	var p PostgresMigrator
+	assert.Equal(t, `DROP INDEX IF EXISTS "users_email_idx";
+CREATE INDEX "users_email_idx" ON users (email, "created_at" DESC);`, p.GenerateCreateIndex("users", types.IndexDetail{
+		Name:    "users_email_idx",
+		Columns: []types.IndexColumnDetail{{Name: "email"}, {Name: "created_at", IsDescending: true}},
+	}))
+	assert.Equal(t, `DROP INDEX IF EXISTS "users_lower_idx";
+CREATE UNIQUE INDEX "users_lower_idx" ON users USING btree (lower(email)) WHERE deleted_at IS NULL;`, p.GenerateCreateIndex("users", types.IndexDetail{
+		Name:       "users_lower_idx",
+		Expression: util.Ptr("lower(email)"),
+		Where:      util.Ptr("deleted_at IS NULL"),
+		Method:     util.Ptr("btree"),
+		IsUnique:   true,
+	}))
+	assert.Equal(t, `DROP INDEX IF EXISTS "users_lower_idx";`, p.GenerateDropIndex("users", "users_lower_idx"))
+	assert.Equal(t, `DROP INDEX IF EXISTS sales."orders_total_idx";
+CREATE INDEX "orders_total_idx" ON sales.orders ("total");`, p.GenerateCreateIndex("sales.orders", types.IndexDetail{
+		Name:    "orders_total_idx",
+		Columns: []types.IndexColumnDetail{{Name: "total"}},
+	}))
+	assert.Equal(t, `DROP INDEX IF EXISTS sales."orders_total_idx";`, p.GenerateDropIndex("sales.orders", "orders_total_idx"))
+}
+
+func TestGetTableForeignKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(withNamespaces(tableForeignKeysSQL, []string{"public", "sales"}))).WillReturnRows(sqlmock.NewRows([]string{"namespace", "table", "name", "column", "ref_namespace", "ref_table", "ref_column", "on_delete", "on_update", "deferrable", "composite"}).
+		AddRow("public", "orders", "orders_user_id_fkey", "user_id", "public", "users", "id", "c", "a", false, false).
+		AddRow("public", "orders", "orders_item_fk", "item_id", "sales", "items", "id", "n", "r", true, false).
+		AddRow("public", "orders", "orders_variant_fk", "item_id", "sales", "variants", "item_id", "a", "a", false, true))
+	foreignKeys, err := getTableForeignKeys(context.Background(), logger.NewTestLogger(), db, []string{"public", "sales"})
+	assert.NoError(t, err)
+	assert.Len(t, foreignKeys["orders"], 2)
+	assert.Equal(t, types.ForeignKeyDetail{
+		Name:            "orders_user_id_fkey",
+		Column:          "user_id",
+		ReferenceTable:  "users",
+		ReferenceColumn: "id",
+		OnDelete:        util.Ptr("cascade"),
+		OnUpdate:        util.Ptr("no action"),
+	}, foreignKeys["orders"][0])
+	assert.Equal(t, types.ForeignKeyDetail{
+		Name:            "orders_item_fk",
+		Column:          "item_id",
+		ReferenceTable:  "sales.items",
+		ReferenceColumn: "id",
+		OnDelete:        util.Ptr("set null"),
+		OnUpdate:        util.Ptr("restrict"),
+		IsDeferrable:    true,
+	}, foreignKeys["orders"][1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectLock(mock sqlmock.Sqlmock, ok bool) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).WithArgs(advisoryLockKey).WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(ok))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).WithArgs(advisoryLockKey).WillReturnRows(sqlmock.NewRows([]string{"pg_advisory_unlock"}).AddRow(true))
+}
+
+// expectHistoryTable expects the history table to be created and the columns added to it since it was first created to
+// be added if missing is true
+func expectHistoryTable(mock sqlmock.Sqlmock, missing bool) {
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "shift_migrations"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	var p PostgresMigrator
+	for _, column := range [][2]string{{"status", "varchar(16)"}, {"error_message", "text"}} {
+		query := mock.ExpectQuery(regexp.QuoteMeta(`SELECT "shift_migrations".` + p.QuoteColumn(column[0]) + ` FROM "shift_migrations" WHERE 1 = 0`))
+		if !missing {
+			query.WillReturnRows(sqlmock.NewRows([]string{column[0]}))
+			continue
+		}
+		query.WillReturnError(errors.New(`column "` + column[0] + `" does not exist`))
+		mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "shift_migrations" ADD COLUMN ` + p.QuoteColumn(column[0]) + ` ` + column[1] + `;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+func TestMigrateRecordsHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{{Change: migrator.DropTable, Table: "orders"}}
+	expectLock(mock, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS orders CASCADE;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	expectHistoryTable(mock, false)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO shift_migrations (checksum, plan, statements, started_at, finished_at, duration_ms, os_user, git_commit, from_schema, to_schema, status, error_message) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`)).
+		WithArgs("abc123", sqlmock.AnyArg(), "DROP TABLE IF EXISTS orders CASCADE;\n", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, nil, "applied", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectUnlock(mock)
+	var p PostgresMigrator
+	assert.NoError(t, p.Migrate(migrator.MigratorArgs{
+		Context:  context.Background(),
+		Logger:   logger.NewTestLogger(),
+		DB:       db,
+		Diff:     changes,
+		Checksum: "abc123",
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateRecordsFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{{Change: migrator.DropTable, Table: "orders"}, {Change: migrator.DropTable, Table: "items"}}
+	statements := "DROP TABLE IF EXISTS orders CASCADE;\nDROP TABLE IF EXISTS items CASCADE;\n"
+	insert := regexp.QuoteMeta(`INSERT INTO shift_migrations (checksum, plan, statements, started_at, finished_at, duration_ms, os_user, git_commit, from_schema, to_schema, status, error_message) VALUES`)
+	failure := "error applying change 2 (drop table items): " + assert.AnError.Error() + ". statement: DROP TABLE IF EXISTS items CASCADE;"
+
+	// nothing is applied when the transaction is rolled back, the columns missing from a history table created by an
+	// earlier version are added
+	expectLock(mock, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS orders CASCADE;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS items CASCADE;`)).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	expectHistoryTable(mock, true)
+	mock.ExpectExec(insert).
+		WithArgs("abc123", sqlmock.AnyArg(), statements, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, nil, "failed", failure+" (rolled back)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectUnlock(mock)
+	var p PostgresMigrator
+	args := migrator.MigratorArgs{
+		Context:  context.Background(),
+		Logger:   logger.NewTestLogger(),
+		DB:       db,
+		Diff:     changes,
+		Checksum: "abc123",
+	}
+	err = p.Migrate(args)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// the statements before the one which failed are applied without a transaction
+	expectLock(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS orders CASCADE;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS items CASCADE;`)).WillReturnError(assert.AnError)
+	expectHistoryTable(mock, false)
+	mock.ExpectExec(insert).
+		WithArgs("abc123", sqlmock.AnyArg(), statements, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, nil, "partial", failure).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	expectUnlock(mock)
+	args.NoTransaction = true
+	err = p.Migrate(args)
+	var partial *migrator.PartialError
+	assert.ErrorAs(t, err, &partial)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateTransactionPhases(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{
+		{Change: migrator.AlterEnum, Enum: &migrator.MigrateEnum{Name: "status", Values: []migrator.MigrateEnumValue{{Value: "archived"}}}},
+		{Change: migrator.DropTable, Table: "orders"},
+		{Change: migrator.DropTable, Table: "items"},
+	}
+	// the enum value can't be added in the transaction so it's applied first and the drops are rolled back together
+	expectLock(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TYPE status ADD VALUE IF NOT EXISTS 'archived';`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS orders CASCADE;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS items CASCADE;`)).WillReturnError(errors.New("permission denied"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+	var p PostgresMigrator
+	err = p.Migrate(migrator.MigratorArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+		Diff:    changes,
+	})
+	assert.EqualError(t, err, "error applying change 3 (drop table items): permission denied. statement: DROP TABLE IF EXISTS items CASCADE; (rolled back)")
+	var serr *migrator.StatementError
+	assert.ErrorAs(t, err, &serr)
+	assert.Equal(t, 2, serr.Index)
+	assert.Equal(t, "items", serr.Change.Table)
+	assert.True(t, serr.RolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateLockTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	expectLock(mock, false)
+	expectLock(mock, false)
+	var p PostgresMigrator
+	err = p.Migrate(migrator.MigratorArgs{
+		Context:  context.Background(),
+		Logger:   logger.NewTestLogger(),
+		DB:       db,
+		Diff:     []migrator.MigrateChanges{{Change: migrator.DropTable, Table: "orders"}},
+		LockWait: time.Millisecond,
+	})
+	assert.ErrorIs(t, err, migrator.ErrLockTimeout)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGenerateForeignKey(t *testing.T) {
+	var p PostgresMigrator
+	assert.Equal(t, `ALTER TABLE orders ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES users (id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;`, p.GenerateAddForeignKey("orders", types.ForeignKeyDetail{
+		Name:            "orders_user_id_fkey",
+		Column:          "user_id",
+		ReferenceTable:  "users",
+		ReferenceColumn: "id",
+		OnDelete:        util.Ptr("cascade"),
+		IsDeferrable:    true,
+	}))
+	assert.Equal(t, `ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_user_id_fkey";`, p.GenerateDropForeignKey("orders", "orders_user_id_fkey"))
+}
+
+func TestFormatForeignKeyDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)}}},
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "users", Column: "id", Name: util.Ptr("orders_user_id_fkey")}},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)}}},
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "users", Column: "id", OnDelete: util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade)}},
+			}},
+			{Name: "items", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "order_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "orders", Column: "id"}},
+			}},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	// the constraint is dropped before anything else and added after the tables have been created
+	assert.Equal(t, `ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_user_id_fkey"; CREATE TABLE IF NOT EXISTS items ( id int8 NOT NULL PRIMARY KEY, "order_id" int8 NOT NULL ); ALTER TABLE items ADD CONSTRAINT "items_order_id_fkey" FOREIGN KEY ("order_id") REFERENCES orders (id); ALTER TABLE orders ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES users (id) ON DELETE CASCADE;`, util.CleanSQL(out.String()))
+}
+
+func TestFormatConstraintDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "membership", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "team_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Unique: util.Ptr(true)},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "membership", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "team_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+			},
+				PrimaryKey:        []string{"team_id", "user_id"},
+				UniqueConstraints: []schema.SchemaJsonTablesElemUniqueConstraintsElem{{Name: "membership_team_email_key", Columns: []string{"team_id", "email"}}},
+			},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `ALTER TABLE membership DROP CONSTRAINT IF EXISTS "membership_pkey";
+ALTER TABLE membership DROP CONSTRAINT IF EXISTS "membership_email_key";
+ALTER TABLE membership ADD PRIMARY KEY ("team_id", "user_id");
+ALTER TABLE membership ADD CONSTRAINT "membership_team_email_key" UNIQUE ("team_id", email);
+`, out.String())
+
+	out.Reset()
+	to.Tables[0].Name = "other"
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, []migrator.MigrateChanges{{Change: migrator.CreateTable, Table: "other", Ref: to.Tables[0]}}, &out))
+	assert.Contains(t, out.String(), `PRIMARY KEY ("team_id", "user_id"),`)
+	assert.Contains(t, out.String(), `CONSTRAINT "membership_team_email_key" UNIQUE ("team_id", email)`)
+}
+
+func TestGetTableChecks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(withNamespaces(tableChecksSQL, []string{"public"}))).WillReturnRows(sqlmock.NewRows([]string{"namespace", "table", "name", "def", "column"}).
+		AddRow("public", "orders", "orders_discount_check", "CHECK ((discount <= price))", "").
+		AddRow("public", "orders", "orders_status_check", "CHECK (((status)::text <> ''::text)) NOT VALID", "status"))
+	checks, err := getTableChecks(context.Background(), logger.NewTestLogger(), db, []string{"public"})
+	assert.NoError(t, err)
+	assert.Equal(t, []types.CheckConstraintDetail{
+		{Name: "orders_discount_check", Expression: "discount <= price"},
+		{Name: "orders_status_check", Expression: "(status)::text <> ''::text", Column: "status", IsNotValid: true},
+	}, checks["orders"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFormatCheckDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "price", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Checks: []schema.SchemaJsonTablesElemColumnsElemChecksElem{{Name: "orders_price_check", Expression: "price >= 0"}}},
+				{Name: "discount", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "price", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				{Name: "discount", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+			},
+				Checks: []schema.SchemaJsonTablesElemChecksElem{
+					{Name: "orders_price_check", Expression: "price > 0"},
+					{Name: "orders_discount_check", Expression: "discount <= price", NotValid: util.Ptr(true)},
+				},
+			},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_price_check";
+ALTER TABLE orders ADD CONSTRAINT "orders_price_check" CHECK (price > 0);
+ALTER TABLE orders ADD CONSTRAINT "orders_discount_check" CHECK (discount <= price) NOT VALID;
+ALTER TABLE orders VALIDATE CONSTRAINT "orders_discount_check";
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, []migrator.MigrateChanges{{Change: migrator.CreateTable, Table: "orders", Ref: to.Tables[0]}}, &out))
+	assert.Contains(t, out.String(), `CONSTRAINT "orders_discount_check" CHECK (discount <= price)`)
+	assert.NotContains(t, out.String(), "NOT VALID")
+}
+
+func TestGetEnums(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(enumsSQL)).WillReturnRows(sqlmock.NewRows([]string{"typname", "enumlabel"}).
+		AddRow("color", "red").
+		AddRow("color", "green").
+		AddRow("order_status", "pending").
+		AddRow("order_status", "shipped"))
+	enums, err := getEnums(context.Background(), logger.NewTestLogger(), db)
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.SchemaJsonEnumsElem{
+		{Name: "color", Values: []string{"red", "green"}},
+		{Name: "order_status", Values: []string{"pending", "shipped"}},
+	}, enums)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestToNativeTypeEnum(t *testing.T) {
+	column := schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Enum: util.Ptr("order_status")}
+	assert.Equal(t, "order_status", *ToNativeType(column).Postgres)
+	column.IsArray = true
+	assert.Equal(t, "order_status[]", *ToNativeType(column).Postgres)
+}
+
+func TestFormatEnumDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{
+			{Name: "order_status", Values: []string{"pending", "shipped"}},
+			{Name: "color", Values: []string{"red"}},
+		},
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Enum: util.Ptr("order_status")},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{
+			{Name: "order_status", Values: []string{"new", "pending", "paid", "shipped", "it's delivered"}},
+			{Name: "order_size", Values: []string{"small", "large"}},
+		},
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Enum: util.Ptr("order_status")},
+				{Name: "size", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Enum: util.Ptr("order_size")},
+			}},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS 'new' BEFORE 'pending';
+ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS 'paid' AFTER 'pending';
+ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS $_P_$it's delivered$_P_$;
+CREATE TYPE "order_size" AS ENUM ('small', 'large');
+ALTER TABLE orders ADD COLUMN size "order_size" NOT NULL;
+DROP TYPE IF EXISTS color;
+`, out.String())
+}
+
+func TestGetNamespaces(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(withNamespaces(namespacesSQL, []string{"public", "sales", "billing"}))).WillReturnRows(sqlmock.NewRows([]string{"nspname"}).
+		AddRow("public").
+		AddRow("sales"))
+	namespaces, err := getNamespaces(context.Background(), logger.NewTestLogger(), db, []string{"public", "sales", "billing"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"public", "sales"}, namespaces)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQualifiedName(t *testing.T) {
+	assert.Equal(t, "orders", qualifiedName("public", "orders"))
+	assert.Equal(t, "sales.orders", qualifiedName("sales", "orders"))
+	namespace, name := splitQualifiedName("orders")
+	assert.Equal(t, "public", namespace)
+	assert.Equal(t, "orders", name)
+	namespace, name = splitQualifiedName("sales.orders")
+	assert.Equal(t, "sales", namespace)
+	assert.Equal(t, "orders", name)
+	var p PostgresMigrator
+	assert.Equal(t, "sales.orders", p.QuoteTable("sales.orders"))
+	assert.Equal(t, `"Sales"."Orders"`, p.QuoteTable("Sales.Orders"))
+	assert.Equal(t, `ALTER TABLE sales.orders DROP CONSTRAINT IF EXISTS "orders_pkey";`, p.GenerateDropPrimaryKey("sales.orders"))
+}
+
+func TestProcessNamespaces(t *testing.T) {
+	dbschema := &schema.SchemaJson{
+		Database: schema.SchemaJsonDatabase{Schemas: []string{"public", "billing"}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "users", Schema: util.Ptr("public"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, AutoIncrement: util.Ptr(true)},
+			}},
+			{Name: "orders", Schema: util.Ptr("sales"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, AutoIncrement: util.Ptr(true)},
+			}},
+		},
+	}
+	var p PostgresMigrator
+	assert.NoError(t, p.Process(dbschema))
+	assert.Equal(t, []string{"billing"}, dbschema.Database.Schemas)
+	assert.Nil(t, dbschema.Tables[0].Schema)
+	assert.Equal(t, "nextval('users_id_seq'::regclass)", *dbschema.Tables[0].Columns[0].Default.Postgres)
+	assert.Equal(t, "nextval('sales.orders_id_seq'::regclass)", *dbschema.Tables[1].Columns[0].Default.Postgres)
+	assert.Equal(t, []string{"billing", "sales"}, schema.Namespaces(dbschema))
+
+	var out strings.Builder
+	assert.NoError(t, p.FromSchema(dbschema, &out))
+	assert.Contains(t, out.String(), "CREATE SCHEMA IF NOT EXISTS billing;\nCREATE SCHEMA IF NOT EXISTS sales;\n")
+	assert.Contains(t, out.String(), "CREATE TABLE IF NOT EXISTS sales.orders (")
+}
+
+func TestFormatNamespaceDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			}},
+		},
+	}
+	// the same table name in another schema is a different table
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			from.Tables[0],
+			{Name: "orders", Schema: util.Ptr("sales"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "order_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "orders", Column: "id"}},
+			}},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, migrator.CreateNamespace, changes[0].Change)
+	assert.Equal(t, "sales", changes[0].Namespace)
+	assert.Equal(t, "sales.orders", changes[1].Table)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `CREATE SCHEMA IF NOT EXISTS sales; CREATE TABLE IF NOT EXISTS sales.orders ( id int8 NOT NULL PRIMARY KEY, "order_id" int8 NOT NULL ); ALTER TABLE sales.orders ADD CONSTRAINT "orders_order_id_fkey" FOREIGN KEY ("order_id") REFERENCES orders (id);`, util.CleanSQL(out.String()))
+
+	// the schema already exists once it's been introspected
+	from.Database.Schemas = []string{"sales"}
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, migrator.CreateTable, changes[0].Change)
+}
+
+func TestFormatRenameDiff(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Schema: util.Ptr("sales"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "total", Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "purchases", Schema: util.Ptr("sales"), RenamedFrom: util.Ptr("orders"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "amount", RenamedFrom: util.Ptr("total"), Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat},
+			}},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `ALTER TABLE sales.orders RENAME TO purchases; ALTER TABLE sales.purchases RENAME COLUMN "total" TO amount;`, util.CleanSQL(out.String()))
+}
+
+func TestGenerateStatements(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			}},
+		},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{Name: "items", Description: util.Ptr("the items; sold"), Columns: []schema.SchemaJsonTablesElemColumnsElem{
+				{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+				{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Description: util.Ptr("(the name")},
+			}},
+		},
+	}
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	statements, err := diff.GenerateStatements(schema.DatabaseDriverPostgres, changes)
+	assert.NoError(t, err)
+	var sql []string
+	for _, statement := range statements {
+		assert.Equal(t, changes[statement.Change].Table, map[int]string{0: "orders", 1: "items"}[statement.Change])
+		sql = append(sql, util.CleanSQL(statement.SQL))
+	}
+	assert.Equal(t, []string{
+		`DROP TABLE IF EXISTS orders CASCADE;`,
+		`CREATE TABLE IF NOT EXISTS items ( id int8 NOT NULL PRIMARY KEY, name text NOT NULL );`,
+		`COMMENT ON TABLE items IS 'the items; sold';`,
+		`COMMENT ON COLUMN items.name IS '(the name';`,
+	}, sql)
+
+	// the statements are the same as the sql diff
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, util.CleanSQL(out.String()), strings.Join(sql, " "))
+}
+
+func TestOfflineDiff(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.yaml")
+	to := filepath.Join(dir, "to.yaml")
+	// the database url isn't needed since the protocol is provided
+	assert.NoError(t, os.WriteFile(from, []byte(`version: "1"
+database:
+  url: ${DATABASE_URL}
+tables:
+  - name: orders
+    columns:
+      - name: id
+        type: int
+        primaryKey: true
+`), 0644))
+	assert.NoError(t, os.WriteFile(to, []byte(`version: "1"
+database:
+  url: ${DATABASE_URL}
+tables:
+  - name: orders
+    columns:
+      - name: id
+        type: int
+        primaryKey: true
+      - name: note
+        type: string
+        nullable: true
+`), 0644))
+	_, err := migrator.Load(from)
+	assert.Error(t, err)
+	fromSchema, err := migrator.LoadWithProtocol(from, "postgres")
+	assert.NoError(t, err)
+	toSchema, err := migrator.LoadWithProtocol(to, "postgres")
+	assert.NoError(t, err)
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, toSchema, fromSchema)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out))
+	assert.Equal(t, `ALTER TABLE orders ADD COLUMN note text;`, util.CleanSQL(out.String()))
+
+	_, err = migrator.LoadWithProtocol(to, "oracle")
+	assert.EqualError(t, err, "protocol: oracle not supported")
+}
+
+var updateSnapshots = flag.Bool("update", false, "update the snapshot files in testdata")
+
+// assertSnapshot compares the output with the snapshot file or writes the snapshot file when run with -update
+func assertSnapshot(t *testing.T, filename string, actual string) {
+	if *updateSnapshots {
+		assert.NoError(t, os.WriteFile(filename, []byte(actual), 0644))
+		return
+	}
+	buf, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, string(buf), actual)
+}
+
+func TestPlanSnapshot(t *testing.T) {
+	color.NoColor = true
+	from, err := migrator.LoadWithProtocol("../../testdata/plan/from.yaml", "postgres")
+	assert.NoError(t, err)
+	to, err := migrator.LoadWithProtocol("../../testdata/plan/to.yaml", "postgres")
+	assert.NoError(t, err)
+	// the plan is the same each time regardless of the map ordering
+	for i := 0; i < 10; i++ {
+		changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+		assert.NoError(t, err)
+		var sql, text strings.Builder
+		assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &sql))
+		assert.NoError(t, diff.FormatDiff(diff.FormatText, schema.DatabaseDriverPostgres, changes, &text))
+		assertSnapshot(t, "../../testdata/plan/postgres.sql", sql.String())
+		assertSnapshot(t, "../../testdata/plan/postgres.txt", text.String())
+	}
+
+	// the changes saved in a plan are applied as they were planned
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var sql strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &sql))
+	plan, err := migrator.NewPlan("postgres", from, to, changes, sql.String())
+	assert.NoError(t, err)
+	planned, err := plan.MigrateChanges()
+	assert.NoError(t, err)
+	assert.Equal(t, changes, planned)
+}
+
+func TestFormatOnlineDiff(t *testing.T) {
+	users := schema.SchemaJsonTablesElem{Name: "users", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)}}}
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{users, {Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			{Name: "total", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Nullable: util.Ptr(true)},
+			{Name: "code", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Nullable: util.Ptr(true)},
+			{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)},
+			{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+			{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+		}}},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{users, {Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			{Name: "total", Type: schema.SchemaJsonTablesElemColumnsElemTypeFloat, Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Postgres: util.Ptr("0")}},
+			{Name: "code", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true), Unique: util.Ptr(true)},
+			{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(false)},
+			{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, References: &schema.SchemaJsonTablesElemColumnsElemReferences{Table: "users", Column: "id"}},
+			{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+		}, Indexes: []schema.SchemaJsonTablesElemIndexesElem{{Name: "orders_email_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "email"}}}}}},
+	}
+	var p PostgresMigrator
+	assert.NoError(t, p.Process(from))
+	assert.NoError(t, p.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverPostgres, changes, &out, diff.WithOnline(true)))
+	// total is swapped for a column of the new type while code is changed in place since its unique constraint uses it
+	assert.Equal(t, `ALTER TABLE orders ADD COLUMN IF NOT EXISTS "total_shift_new" double precision;
+ALTER TABLE orders ALTER COLUMN "total_shift_new" SET DEFAULT 0;
+CREATE OR REPLACE FUNCTION "orders_total_shift_sync"() RETURNS trigger LANGUAGE plpgsql AS 'BEGIN NEW."total_shift_new" := NEW."total"::double precision; RETURN NEW; END';
+CREATE TRIGGER "orders_total_shift_sync" BEFORE INSERT OR UPDATE ON orders FOR EACH ROW EXECUTE FUNCTION "orders_total_shift_sync"();
+UPDATE orders SET "total_shift_new" = "total"::double precision WHERE ctid = ANY(ARRAY(SELECT ctid FROM orders WHERE "total_shift_new" IS NULL AND "total" IS NOT NULL LIMIT 10000));
+UPDATE orders SET "total_shift_new" = "total"::double precision WHERE "total_shift_new" IS NULL AND "total" IS NOT NULL;
+ALTER TABLE orders ADD CONSTRAINT "orders_total_shift_new_shift_not_null" CHECK ("total_shift_new" IS NOT NULL) NOT VALID;
+ALTER TABLE orders VALIDATE CONSTRAINT "orders_total_shift_new_shift_not_null";
+ALTER TABLE orders ALTER COLUMN "total_shift_new" SET NOT NULL;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_total_shift_new_shift_not_null";
+DROP TRIGGER IF EXISTS "orders_total_shift_sync" ON orders;
+DROP FUNCTION IF EXISTS "orders_total_shift_sync"();
+ALTER TABLE orders DROP COLUMN "total";
+ALTER TABLE orders RENAME COLUMN "total_shift_new" TO "total";
+ALTER TABLE orders ALTER COLUMN code TYPE text;
+ALTER TABLE orders ADD CONSTRAINT "orders_status_shift_not_null" CHECK (status IS NOT NULL) NOT VALID;
+ALTER TABLE orders VALIDATE CONSTRAINT "orders_status_shift_not_null";
+ALTER TABLE orders ALTER COLUMN status SET NOT NULL;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_status_shift_not_null";
+DROP INDEX CONCURRENTLY IF EXISTS "orders_code_key";
+CREATE UNIQUE INDEX CONCURRENTLY "orders_code_key" ON orders (code);
+ALTER TABLE orders ADD CONSTRAINT "orders_code_key" UNIQUE USING INDEX "orders_code_key";
+DROP INDEX CONCURRENTLY IF EXISTS "orders_email_idx";
+CREATE INDEX CONCURRENTLY "orders_email_idx" ON orders (email);
+ALTER TABLE orders ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES users (id) NOT VALID;
+ALTER TABLE orders VALIDATE CONSTRAINT "orders_user_id_fkey";
+`, out.String())
+
+	// only the in place type change still blocks
+	assert.Len(t, changes, 1)
+	assert.Equal(t, []diff.Hazard{
+		{Risk: diff.RiskBlocking, Table: "orders", Column: "code", Reason: "changes the type of column code of orders which rewrites the table"},
+	}, diff.Classify(schema.DatabaseDriverPostgres, changes[0], diff.WithOnline(true)))
+	assert.Len(t, diff.Classify(schema.DatabaseDriverPostgres, changes[0]), 6)
+
+	// the swapped column is split along with the rest of the statements
+	statements, err := diff.GenerateStatements(schema.DatabaseDriverPostgres, changes, diff.WithOnline(true))
+	assert.NoError(t, err)
+	assert.Len(t, statements, 26)
+	assert.Equal(t, `CREATE OR REPLACE FUNCTION "orders_total_shift_sync"() RETURNS trigger LANGUAGE plpgsql AS 'BEGIN NEW."total_shift_new" := NEW."total"::double precision; RETURN NEW; END';`, statements[2].SQL)
+
+	// only the batch of the backfill is repeated, the update after it copies the rows it missed
+	flagStatements(migrator.MigratorArgs{Online: true}, statements)
+	for i, statement := range statements {
+		assert.Equal(t, i == 4, statement.Repeat, statement.SQL)
+	}
+	assert.True(t, statements[5].Isolated)
+}
+
+func TestMigrateOnlinePhases(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{{
+		Change:  migrator.AlterTable,
+		Table:   "orders",
+		Ref:     schema.SchemaJsonTablesElem{Name: "orders"},
+		Columns: []migrator.MigrateColumn{{Change: migrator.AlterColumn, Name: "status", Ref: schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString}, Changes: []migrator.MigrateColumnChangeTypeType{migrator.ColumnNullableChanged}}},
+		Indexes: []migrator.MigrateIndex{{Change: migrator.CreateIndex, Name: "orders_status_idx", Ref: schema.SchemaJsonTablesElemIndexesElem{Name: "orders_status_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "status"}}}}},
+	}}
+	// the validate runs in a transaction of its own so the lock taken to add the constraint isn't held while it scans
+	expectLock(mock, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE orders ADD CONSTRAINT "orders_status_shift_not_null" CHECK (status IS NOT NULL) NOT VALID;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE orders VALIDATE CONSTRAINT "orders_status_shift_not_null";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE orders ALTER COLUMN status SET NOT NULL;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE orders DROP CONSTRAINT IF EXISTS "orders_status_shift_not_null";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// an invalid index left by a failed concurrent build is dropped first so it's rebuilt
+	mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX CONCURRENTLY IF EXISTS "orders_status_idx";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE INDEX CONCURRENTLY "orders_status_idx" ON orders (status);`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectHistoryTable(mock, false)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO shift_migrations`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectUnlock(mock)
+	var p PostgresMigrator
+	assert.NoError(t, p.Migrate(migrator.MigratorArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+		Diff:    changes,
+		Online:  true,
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateRebuildsInvalidIndex(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	// the invalid index is treated as missing so it's created again, which IF NOT EXISTS would skip
+	changes := []migrator.MigrateChanges{{
+		Change:  migrator.AlterTable,
+		Table:   "orders",
+		Ref:     schema.SchemaJsonTablesElem{Name: "orders"},
+		Indexes: []migrator.MigrateIndex{{Change: migrator.CreateIndex, Name: "orders_status_idx", Ref: schema.SchemaJsonTablesElemIndexesElem{Name: "orders_status_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "status"}}}}},
+	}}
+	expectLock(mock, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX IF EXISTS "orders_status_idx";`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE INDEX "orders_status_idx" ON orders (status);`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	expectHistoryTable(mock, false)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO shift_migrations`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectUnlock(mock)
+	var p PostgresMigrator
+	assert.NoError(t, p.Migrate(migrator.MigratorArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+		Diff:    changes,
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteOptions(t *testing.T) {
+	opts := executeOptions(migrator.MigratorArgs{LockTimeout: 3 * time.Second, StatementTimeout: 5 * time.Minute, Retries: 5})
+	assert.True(t, opts.Transactional)
+	assert.Equal(t, 5, opts.Retries)
+	assert.Equal(t, []string{"SET lock_timeout = 3000;", "SET statement_timeout = 300000;"}, opts.Setup)
+	assert.Equal(t, []string{"RESET lock_timeout;", "RESET statement_timeout;"}, opts.Teardown)
+	// only the statements which timed out waiting for a lock are retried
+	assert.True(t, opts.Retryable(&migrator.StatementError{Err: &pgconn.PgError{Code: lockNotAvailable}}))
+	assert.False(t, opts.Retryable(&migrator.StatementError{Err: &pgconn.PgError{Code: "57014"}}))
+	assert.False(t, opts.Retryable(errors.New("connection refused")))
+
+	opts = executeOptions(migrator.MigratorArgs{NoTransaction: true})
+	assert.False(t, opts.Transactional)
+	assert.Empty(t, opts.Setup)
+	assert.Empty(t, opts.Teardown)
+}
+
+func TestVerify(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{
+		{Change: migrator.DropTable, Table: "orders"},
+		{Change: migrator.DropTable, Table: "items"},
+	}
+	// the statement which fails is rolled back to the savepoint so the statements after it are still verified
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SET lock_timeout = 500;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT shift_verify`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS orders CASCADE;`)).WillReturnError(errors.New("permission denied"))
+	mock.ExpectExec(regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT shift_verify`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT shift_verify`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS items CASCADE;`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`RELEASE SAVEPOINT shift_verify`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the schema is read within the transaction which is then rolled back
+	for i := 0; i < 9; i++ {
+		mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"column"}))
+	}
+	mock.ExpectRollback()
+	var p PostgresMigrator
+	result, err := p.Verify(migrator.MigratorArgs{
+		Context:     context.Background(),
+		Logger:      logger.NewTestLogger(),
+		DB:          db,
+		ToSchema:    &schema.SchemaJson{},
+		Diff:        changes,
+		LockTimeout: 500 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.OK())
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, 0, result.Errors[0].Index)
+	assert.Equal(t, "DROP TABLE IF EXISTS orders CASCADE;", result.Errors[0].Statement)
+	assert.Empty(t, result.Remaining)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyConcurrently(t *testing.T) {
+	assert.Equal(t, `CREATE UNIQUE INDEX IF NOT EXISTS "orders_sku_idx" ON orders ("sku");`, concurrently.ReplaceAllString(`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS "orders_sku_idx" ON orders ("sku");`, "$1"))
+	assert.Equal(t, `DROP INDEX IF EXISTS "orders_sku_idx";`, concurrently.ReplaceAllString(`DROP INDEX CONCURRENTLY IF EXISTS "orders_sku_idx";`, "$1"))
+	assert.Equal(t, `ALTER TABLE orders VALIDATE CONSTRAINT "orders_user_id_fkey";`, concurrently.ReplaceAllString(`ALTER TABLE orders VALIDATE CONSTRAINT "orders_user_id_fkey";`, "$1"))
+}
+
+func TestPreflightChecks(t *testing.T) {
+	from := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)},
+			{Name: "code", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)},
+			{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(100)},
+			{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+		}}},
+	}
+	to := &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+			{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(false)},
+			{Name: "code", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Nullable: util.Ptr(true)},
+			{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(20)},
+			{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Unique: util.Ptr(true)},
+		}}},
+	}
+	var p PostgresMigrator
+	assert.NoError(t, p.Process(from))
+	assert.NoError(t, p.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverPostgres, to, from)
+	assert.NoError(t, err)
+	checks, err := diff.PreflightChecks(schema.DatabaseDriverPostgres, changes)
+	assert.NoError(t, err)
+	assert.Equal(t, []migrator.PreflightCheck{
+		{
+			Reason: "column status of orders is becoming not null but has nulls",
+			Count:  `SELECT COUNT(*) FROM orders WHERE status IS NULL`,
+			Sample: `SELECT id FROM orders WHERE status IS NULL LIMIT 5`,
+		},
+		{
+			Reason:      "column code of orders is changing to int8 but has values which can't be converted",
+			Count:       `SELECT COUNT(*) FROM orders WHERE code IS NOT NULL AND NOT pg_input_is_valid(code::text, 'int8')`,
+			Sample:      `SELECT id FROM orders WHERE code IS NOT NULL AND NOT pg_input_is_valid(code::text, 'int8') LIMIT 5`,
+			SkipOnError: true,
+		},
+		{
+			Reason: "column name of orders is shrinking to a max length of 20 but has longer values",
+			Count:  `SELECT COUNT(*) FROM orders WHERE char_length(name) > 20`,
+			Sample: `SELECT id FROM orders WHERE char_length(name) > 20 LIMIT 5`,
+		},
+		{
+			Reason: "unique constraint orders_email_key is being added to orders but (email) has duplicates",
+			Count:  `SELECT COALESCE(SUM(n), 0) FROM (SELECT COUNT(*) AS n FROM orders WHERE email IS NOT NULL GROUP BY email HAVING COUNT(*) > 1) d`,
+			Sample: `SELECT email FROM orders WHERE email IS NOT NULL GROUP BY email HAVING COUNT(*) > 1 LIMIT 5`,
+		},
+	}, checks)
+}
+
+func TestMigratePreflight(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	changes := []migrator.MigrateChanges{{
+		Change: migrator.AlterTable,
+		Table:  "orders",
+		Ref:    schema.SchemaJsonTablesElem{Name: "orders", Columns: []schema.SchemaJsonTablesElemColumnsElem{{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)}}},
+		Columns: []migrator.MigrateColumn{{
+			Change:   migrator.AlterColumn,
+			Name:     "status",
+			Ref:      schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(false)},
+			Previous: schema.SchemaJsonTablesElemColumnsElem{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)},
+			Changes:  []migrator.MigrateColumnChangeTypeType{migrator.ColumnNullableChanged},
+		}},
+	}}
+	// the migration is aborted before any statements are executed
+	expectLock(mock, true)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM orders WHERE status IS NULL`)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM orders WHERE status IS NULL LIMIT 5`)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(12))
+	expectUnlock(mock)
+	var p PostgresMigrator
+	err = p.Migrate(migrator.MigratorArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+		Diff:    changes,
+	})
+	var perr *migrator.PreflightError
+	assert.ErrorAs(t, err, &perr)
+	assert.Equal(t, []string{"id=7", "id=12"}, perr.Failures[0].Samples)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/schema"
+)
+
+var _ migrator.Verifier = (*PostgresMigrator)(nil)
+
+// verifySavepoint is taken before each statement which is verified so a statement which fails can be rolled back
+// without aborting the transaction and the statements after it are still checked
+const verifySavepoint = "shift_verify"
+
+// concurrently matches the CONCURRENTLY of the index statements which can't be executed inside a transaction. the
+// statements are verified without it since the index they build is the same.
+var concurrently = regexp.MustCompile(`(?is)^((CREATE\s+(UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX\s+\w+)\s+)CONCURRENTLY\s+`)
+
+// Verify applies the changes inside a transaction which is always rolled back. Each statement is executed after a
+// savepoint so every statement which fails is reported, and the batches of a backfill are repeated as they are when
+// migrating. The enum values which are added can't be used until they're committed so a statement using one reports an
+// error even though it would succeed when migrating.
+func (p *PostgresMigrator) Verify(args migrator.MigratorArgs) (*migrator.VerifyResult, error) {
+	statements, err := diff.GenerateStatements(schema.DatabaseDriverPostgres, args.Diff, diff.WithOnline(args.Online))
+	if err != nil {
+		return nil, err
+	}
+	flagStatements(args, statements)
+	tx, err := args.DB.BeginTx(args.Context, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			args.Logger.Warn("error rolling back the verification: %s", err)
+		}
+	}()
+	// the timeouts are set for the transaction only since they're undone when it's rolled back
+	for _, q := range executeOptions(args).Setup {
+		args.Logger.Trace("sql: %s", q)
+		if _, err := tx.ExecContext(args.Context, q); err != nil {
+			return nil, err
+		}
+	}
+	var result migrator.VerifyResult
+	for _, statement := range statements {
+		q := concurrently.ReplaceAllString(statement.SQL, "$1")
+		if _, err := tx.ExecContext(args.Context, "SAVEPOINT "+verifySavepoint); err != nil {
+			return nil, err
+		}
+		if err := verifyStatement(args, tx, statement, q); err != nil {
+			result.Errors = append(result.Errors, &migrator.StatementError{Index: statement.Change, Change: args.Diff[statement.Change], Statement: statement.SQL, Err: err})
+			if _, err := tx.ExecContext(args.Context, "ROLLBACK TO SAVEPOINT "+verifySavepoint); err != nil {
+				return nil, fmt.Errorf("error rolling back to the savepoint: %w", err)
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(args.Context, "RELEASE SAVEPOINT "+verifySavepoint); err != nil {
+			return nil, err
+		}
+	}
+	verified, err := p.ToSchema(migrator.ToSchemaArgs{
+		Context:    args.Context,
+		Logger:     args.Logger,
+		DB:         tx,
+		Namespaces: schema.Namespaces(args.ToSchema),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Remaining, err = diff.Diff(args.Logger, schema.DatabaseDriverPostgres, args.ToSchema, verified)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// verifyStatement executes the statement, repeating it until it affects no rows if it's repeated when migrating
+func verifyStatement(args migrator.MigratorArgs, tx *sql.Tx, statement migrator.Statement, q string) error {
+	for {
+		args.Logger.Trace("sql: %s", q)
+		res, err := tx.ExecContext(args.Context, q)
+		if err != nil || !statement.Repeat {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+	}
+}
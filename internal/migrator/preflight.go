@@ -0,0 +1,123 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+// PreflightSampleSize is the number of the offending rows whose keys are reported by a preflight check
+const PreflightSampleSize = 5
+
+// PreflightCheck is a check of the existing rows of a table which would make a change fail when it's applied, such
+// as nulls in a column which is becoming not null
+type PreflightCheck struct {
+	Change      int    // index of the change the check is for
+	Reason      string // what's wrong with the rows the check finds
+	Count       string // query for the number of rows the check finds
+	Sample      string // query for the keys of a sample of the rows the check finds, empty if the table has no keys
+	SkipOnError bool   // the query isn't supported by every version of the database so it's skipped if it fails
+}
+
+// PreflightFailure is a preflight check which found rows
+type PreflightFailure struct {
+	Check   PreflightCheck
+	Count   int64
+	Samples []string // keys of a sample of the rows
+}
+
+func (f PreflightFailure) String() string {
+	msg := fmt.Sprintf("%s in %d %s", f.Check.Reason, f.Count, util.Plural(int(f.Count), "row", "rows"))
+	if len(f.Samples) > 0 {
+		msg += " (sample: " + strings.Join(f.Samples, "; ") + ")"
+	}
+	return msg
+}
+
+// PreflightError is returned when the existing rows of the tables would make the changes fail
+type PreflightError struct {
+	Failures []PreflightFailure
+}
+
+func (e *PreflightError) Error() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "aborting since the existing rows would make the migration fail, %d preflight %s failed:", len(e.Failures), util.Plural(len(e.Failures), "check", "checks"))
+	for _, failure := range e.Failures {
+		msg.WriteString("\n  - ")
+		msg.WriteString(failure.String())
+	}
+	return msg.String()
+}
+
+// Preflight runs the checks and returns a PreflightError with the ones which found rows
+func Preflight(ctx context.Context, logger logger.Logger, db Queryer, checks []PreflightCheck) error {
+	var failures []PreflightFailure
+	for _, check := range checks {
+		var count int64
+		logger.Trace("sql: %s", check.Count)
+		if err := db.QueryRowContext(ctx, check.Count).Scan(&count); err != nil {
+			if check.SkipOnError {
+				logger.Warn("skipping the preflight check for %s: %s", check.Reason, err)
+				continue
+			}
+			return fmt.Errorf("error running the preflight check for %s: %w", check.Reason, err)
+		}
+		if count == 0 {
+			continue
+		}
+		failure := PreflightFailure{Check: check, Count: count}
+		if check.Sample != "" {
+			samples, err := preflightSamples(ctx, logger, db, check.Sample)
+			if err != nil {
+				return fmt.Errorf("error sampling the rows for %s: %w", check.Reason, err)
+			}
+			failure.Samples = samples
+		}
+		failures = append(failures, failure)
+	}
+	if len(failures) > 0 {
+		return &PreflightError{Failures: failures}
+	}
+	return nil
+}
+
+// preflightSamples returns the keys of the sampled rows formatted as column=value
+func preflightSamples(ctx context.Context, logger logger.Logger, db Queryer, query string) ([]string, error) {
+	logger.Trace("sql: %s", query)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var samples []string
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		keys := make([]string, len(columns))
+		for i, value := range values {
+			switch v := value.(type) {
+			case nil:
+				keys[i] = columns[i] + "=NULL"
+			case []byte:
+				keys[i] = columns[i] + "=" + string(v)
+			default:
+				keys[i] = fmt.Sprintf("%s=%v", columns[i], v)
+			}
+		}
+		samples = append(samples, strings.Join(keys, ", "))
+	}
+	return samples, rows.Err()
+}
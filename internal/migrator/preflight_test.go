@@ -0,0 +1,51 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreflight(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	checks := []PreflightCheck{
+		{Change: 0, Reason: "column status of orders is becoming not null but has nulls", Count: `SELECT COUNT(*) FROM orders WHERE "status" IS NULL`, Sample: `SELECT "id" FROM orders WHERE "status" IS NULL LIMIT 5`},
+		{Change: 0, Reason: "column code of orders is changing to int8 but has values which can't be converted", Count: `SELECT COUNT(*) FROM orders WHERE "code" IS NOT NULL AND NOT pg_input_is_valid("code"::text, 'integer')`, SkipOnError: true},
+		{Change: 1, Reason: "unique constraint users_email_key is being added to users but (email) has duplicates", Count: `SELECT COALESCE(SUM(n), 0) FROM (SELECT COUNT(*) AS n FROM users WHERE "email" IS NOT NULL GROUP BY "email" HAVING COUNT(*) > 1) d`, Sample: `SELECT "email" FROM users WHERE "email" IS NOT NULL GROUP BY "email" HAVING COUNT(*) > 1 LIMIT 5`},
+		{Change: 2, Reason: "column name of items is shrinking to a max length of 10 but has longer values", Count: `SELECT COUNT(*) FROM items WHERE char_length("name") > 10`},
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(checks[0].Count)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(checks[0].Sample)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(4).AddRow(9))
+	// the check which isn't supported by the database is skipped
+	mock.ExpectQuery(regexp.QuoteMeta(checks[1].Count)).WillReturnError(errors.New("function pg_input_is_valid(text, unknown) does not exist"))
+	mock.ExpectQuery(regexp.QuoteMeta(checks[2].Count)).WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("2"))
+	mock.ExpectQuery(regexp.QuoteMeta(checks[2].Sample)).WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow([]byte("a@example.com")))
+	mock.ExpectQuery(regexp.QuoteMeta(checks[3].Count)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	err = Preflight(context.Background(), logger.NewTestLogger(), db, checks)
+	var perr *PreflightError
+	assert.ErrorAs(t, err, &perr)
+	assert.Len(t, perr.Failures, 2)
+	assert.Equal(t, int64(3), perr.Failures[0].Count)
+	assert.Equal(t, []string{"id=1", "id=4", "id=9"}, perr.Failures[0].Samples)
+	assert.EqualError(t, err, `aborting since the existing rows would make the migration fail, 2 preflight checks failed:
+  - column status of orders is becoming not null but has nulls in 3 rows (sample: id=1; id=4; id=9)
+  - unique constraint users_email_key is being added to users but (email) has duplicates in 2 rows (sample: email=a@example.com)`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPreflightError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM orders WHERE "status" IS NULL`)).WillReturnError(errors.New("permission denied"))
+	err = Preflight(context.Background(), logger.NewTestLogger(), db, []PreflightCheck{{Reason: "column status of orders is becoming not null but has nulls", Count: `SELECT COUNT(*) FROM orders WHERE "status" IS NULL`}})
+	assert.EqualError(t, err, "error running the preflight check for column status of orders is becoming not null but has nulls: permission denied")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
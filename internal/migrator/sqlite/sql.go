@@ -0,0 +1,27 @@
+package sqlite
+
+import (
+	"strings"
+)
+
+func quoteIdentifier(val string) string {
+	return `"` + strings.ReplaceAll(val, `"`, `""`) + `"`
+}
+
+func quoteLiteral(val string) string {
+	return `'` + strings.ReplaceAll(strings.ReplaceAll(val, "\x00", ""), `'`, `''`) + `'`
+}
+
+func unquoteIdentifier(val string) string {
+	if len(val) >= 2 {
+		switch {
+		case val[0] == '"' && val[len(val)-1] == '"':
+			return strings.ReplaceAll(val[1:len(val)-1], `""`, `"`)
+		case val[0] == '`' && val[len(val)-1] == '`':
+			return strings.ReplaceAll(val[1:len(val)-1], "``", "`")
+		case val[0] == '[' && val[len(val)-1] == ']':
+			return val[1 : len(val)-1]
+		}
+	}
+	return val
+}
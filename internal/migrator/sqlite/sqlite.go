@@ -0,0 +1,458 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+)
+
+type SqliteMigrator struct {
+}
+
+var _ migrator.Migrator = (*SqliteMigrator)(nil)
+var _ migrator.TableGenerator = (*SqliteMigrator)(nil)
+var _ migrator.TableRebuilder = (*SqliteMigrator)(nil)
+var _ migrator.PreflightGenerator = (*SqliteMigrator)(nil)
+
+func (p *SqliteMigrator) Process(dbschema *schema.SchemaJson) error {
+	if len(dbschema.Database.Schemas) > 0 {
+		return fmt.Errorf("database has schemas but sqlite doesn't support schemas")
+	}
+	resolveEnums(dbschema)
+	for t, table := range dbschema.Tables {
+		if table.Schema != nil && *table.Schema != "" {
+			return fmt.Errorf("table %s has schema %s but sqlite doesn't support schemas", table.Name, *table.Schema)
+		}
+		// sqlite has no support for comments so we drop them to keep them from always showing up as a change
+		table.Description = nil
+		for i, col := range table.Columns {
+			col.NativeType = ToNativeType(col)
+			col.Description = nil
+			table.Columns[i] = col
+		}
+		for _, index := range table.Indexes {
+			// sqlite only has btree indexes so anything else can't be honored
+			if index.Method != nil && *index.Method != schema.SchemaJsonTablesElemIndexesElemMethodBtree {
+				return fmt.Errorf("index %s for table %s has method %s which isn't supported by sqlite", index.Name, table.Name, *index.Method)
+			}
+		}
+		dbschema.Tables[t] = table
+	}
+	return nil
+}
+
+func (p *SqliteMigrator) Migrate(args migrator.MigratorArgs) error {
+	unlock, err := p.lock(args)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if args.Drop {
+		var out strings.Builder
+		ts := time.Now()
+		if err := p.FromSchema(args.ToSchema, &out); err != nil {
+			return err
+		}
+		args.Logger.Info("generated sql in %v", time.Since(ts))
+		ts = time.Now()
+		// the statements are executed outside of a transaction so the ones before the one which failed were applied
+		if _, err := args.DB.ExecContext(args.Context, out.String()); err != nil {
+			return recordMigration(args, out.String(), ts, &migrator.PartialError{Err: err})
+		}
+		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, out.String(), ts, nil)
+	} else {
+		if err := diff.Refresh(&args, schema.DatabaseDriverSQLite); err != nil {
+			return err
+		}
+		if len(args.Diff) == 0 {
+			args.Logger.Info("no changes remain after acquiring the migration lock")
+			return nil
+		}
+		if err := diff.Preflight(args, schema.DatabaseDriverSQLite); err != nil {
+			return err
+		}
+		var queries strings.Builder
+		if err := diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverSQLite, args.Diff, &queries); err != nil {
+			return err
+		}
+		ts := time.Now()
+		if err := p.execute(args, queries.String()); err != nil {
+			return recordMigration(args, queries.String(), ts, err)
+		}
+		args.Logger.Info("executed sql in %v", time.Since(ts))
+		return recordMigration(args, queries.String(), ts, nil)
+	}
+}
+
+// foreignKeyViolationSampleSize is the number of the rows violating a foreign key which are reported
+const foreignKeyViolationSampleSize = 5
+
+// execute runs the statements of the migration in a transaction so a rebuild which fails part way is rolled back. The
+// foreign keys are turned off while the tables are rebuilt, which sqlite only allows outside of a transaction, and the
+// foreign keys of the tables which were created or altered are checked before the transaction is committed instead.
+// They aren't checked if they were off to begin with since the rows weren't being checked before the migration.
+func (p *SqliteMigrator) execute(args migrator.MigratorArgs, queries string) error {
+	conn, err := args.DB.Conn(args.Context)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var foreignKeys bool
+	if err := conn.QueryRowContext(args.Context, "PRAGMA foreign_keys;").Scan(&foreignKeys); err != nil {
+		return err
+	}
+	if foreignKeys {
+		if _, err := conn.ExecContext(args.Context, "PRAGMA foreign_keys = OFF;"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON;"); err != nil {
+				args.Logger.Warn("error turning the foreign keys back on: %s", err)
+			}
+		}()
+	}
+	tx, err := conn.BeginTx(args.Context, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	args.Logger.Trace("sql: %s", queries)
+	if _, err := tx.ExecContext(args.Context, queries); err != nil {
+		return err
+	}
+	if foreignKeys {
+		var violations []string
+		for _, changeset := range args.Diff {
+			if changeset.Change != migrator.CreateTable && changeset.Change != migrator.AlterTable {
+				continue
+			}
+			found, err := p.foreignKeyViolations(args.Context, tx, changeset.Table, foreignKeyViolationSampleSize-len(violations))
+			if err != nil {
+				return err
+			}
+			violations = append(violations, found...)
+			if len(violations) == foreignKeyViolationSampleSize {
+				break
+			}
+		}
+		if len(violations) > 0 {
+			return fmt.Errorf("aborting since the migration would leave rows which violate their foreign keys: %s", strings.Join(violations, "; "))
+		}
+	}
+	return tx.Commit()
+}
+
+// foreignKeyViolations returns a sample of up to limit rows of the table which violate its foreign keys
+func (p *SqliteMigrator) foreignKeyViolations(ctx context.Context, tx *sql.Tx, table string, limit int) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA foreign_key_check(%s);", p.QuoteTable(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var violations []string
+	for len(violations) < limit && rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, err
+		}
+		if rowid.Valid {
+			violations = append(violations, fmt.Sprintf("row %d of %s references a missing row of %s", rowid.Int64, table, parent))
+		} else {
+			violations = append(violations, fmt.Sprintf("a row of %s references a missing row of %s", table, parent))
+		}
+	}
+	return violations, rows.Err()
+}
+
+// lock inserts the row of the lock table which only one migration can hold. The row is left behind if a migration
+// is killed so the owner is recorded to know which one.
+func (p *SqliteMigrator) lock(args migrator.MigratorArgs) (func(), error) {
+	if _, err := args.DB.ExecContext(args.Context, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+   "id" INTEGER NOT NULL PRIMARY KEY,
+   "owner" TEXT NOT NULL,
+   "acquired_at" DATETIME NOT NULL
+);`, migrator.LockTable)); err != nil {
+		return nil, fmt.Errorf("error creating %s table: %w", migrator.LockTable, err)
+	}
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	if err := migrator.WaitForLock(args.Context, args.Logger, args.LockWait, func() (bool, error) {
+		res, err := args.DB.ExecContext(args.Context, fmt.Sprintf("INSERT INTO %s (id, owner, acquired_at) VALUES (1, ?, ?) ON CONFLICT DO NOTHING", migrator.LockTable), owner, time.Now().UTC())
+		if err != nil {
+			return false, err
+		}
+		count, err := res.RowsAffected()
+		return count == 1, err
+	}); err != nil {
+		var holder string
+		if qerr := args.DB.QueryRowContext(args.Context, fmt.Sprintf("SELECT owner FROM %s WHERE id = 1", migrator.LockTable)).Scan(&holder); qerr == nil {
+			return nil, fmt.Errorf("%w. the lock is held by %s and can be removed from the %s table if it's no longer running", err, holder, migrator.LockTable)
+		}
+		return nil, err
+	}
+	return func() {
+		if _, err := args.DB.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND owner = ?", migrator.LockTable), owner); err != nil {
+			args.Logger.Warn("error releasing the migration lock: %s", err)
+		}
+	}, nil
+}
+
+func (p *SqliteMigrator) ToSchema(args migrator.ToSchemaArgs) (*schema.SchemaJson, error) {
+	tables, err := getInfoTables(args.Context, args.Logger, args.DB, args.TableFilter)
+	if err != nil {
+		return nil, fmt.Errorf("error generating table schema: %w", err)
+	}
+	for table, detail := range tables {
+		for i, column := range detail.Columns {
+			dt, err := dataTypeToType(column.DataType)
+			if err != nil {
+				return nil, fmt.Errorf("error converting column %s with table: %s. %s", column.Name, table, err)
+			}
+			column.DataType = string(dt)
+			column.Default, err = formatDefault(column)
+			if err != nil {
+				return nil, fmt.Errorf("error validating column: %s table: %s default value: %s", column.Name, table, err)
+			}
+			detail.Columns[i] = column
+		}
+	}
+	return schema.GenerateSchemaJsonFromInfoTables(args.Logger, schema.DatabaseDriverSQLite, tables)
+}
+
+func (p *SqliteMigrator) FromSchema(schemajson *schema.SchemaJson, out io.Writer) error {
+	resolveEnums(schemajson)
+	details := make([]types.TableDetail, len(schemajson.Tables))
+	for t, table := range schemajson.Tables {
+		columns := make([]types.ColumnDetail, 0)
+		for i, col := range table.Columns {
+			val, err := schema.SchemaColumnToColumn(schema.DatabaseDriverSQLite, col, i+1, ToNativeType(col))
+			if err != nil {
+				return fmt.Errorf("error creating column: %s for table: %s. %s", col.Name, table.Name, err)
+			}
+			columns = append(columns, *val)
+		}
+		details[t] = types.TableDetail{
+			Columns:           columns,
+			Description:       table.Description,
+			Constraints:       make([]types.ConstraintDetail, 0),
+			Indexes:           schema.SchemaIndexesToIndexes(table.Indexes),
+			ForeignKeys:       schema.SchemaTableForeignKeys(table),
+			PrimaryKey:        schema.TablePrimaryKey(table),
+			UniqueConstraints: schema.SchemaTableUniqueConstraints(table),
+			Checks:            schema.SchemaTableChecks(table),
+		}
+		io.WriteString(out, migrator.GenerateCreateStatement(table.Name, details[t], p))
+	}
+	// the foreign keys are added once all the tables exist since the tables can reference each other
+	for t, table := range schemajson.Tables {
+		io.WriteString(out, migrator.GenerateAddForeignKeys(table.Name, details[t], p))
+	}
+	return nil
+}
+
+// ------------- TableGenerator ------------
+
+func (p *SqliteMigrator) QuoteTable(val string) string {
+	return quoteIdentifier(val)
+}
+
+func (p *SqliteMigrator) QuoteColumn(val string) string {
+	return quoteIdentifier(val)
+}
+
+func (p *SqliteMigrator) QuoteLiteral(val string) string {
+	return quoteLiteral(val)
+}
+
+func (p *SqliteMigrator) QuoteDefaultValue(val string, column types.ColumnDetail) string {
+	if util.IsFunctionCall(val) {
+		// sqlite requires expressions to be wrapped in parens
+		if val[0:1] != "(" {
+			val = "(" + val + ")"
+		}
+		return val
+	}
+	if column.DataType == "string" {
+		val = p.QuoteLiteral(val)
+	}
+	return val
+}
+
+func (p *SqliteMigrator) GenerateTableComment(table string, val string) string {
+	return "" // not supported
+}
+
+func (p *SqliteMigrator) GenerateColumnComment(table string, column string, val string) string {
+	return "" // not supported
+}
+
+func (p *SqliteMigrator) GenerateColumnType(column types.ColumnDetail) string {
+	return column.UDTName
+}
+
+func (p *SqliteMigrator) GenerateLength(column string) string {
+	return "length(" + column + ")"
+}
+
+// GenerateInvalidCast doesn't check the values since sqlite stores any value in a column regardless of its type
+func (p *SqliteMigrator) GenerateInvalidCast(column string, to types.ColumnDetail) string {
+	return ""
+}
+
+func (p *SqliteMigrator) GenerateColumnAttributes(column types.ColumnDetail) []string {
+	if column.IsAutoIncrementing && column.IsPrimaryKey {
+		return []string{"AUTOINCREMENT"}
+	}
+	return nil
+}
+
+func (p *SqliteMigrator) GenerateAlterColumn(table string, column types.ColumnDetail, changes []migrator.MigrateColumnChangeTypeType) []string {
+	// sqlite can't alter a column in place, any change other than the description is handled by GenerateRebuildTable
+	return nil
+}
+
+func (p *SqliteMigrator) GenerateDropColumn(table string, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", p.QuoteTable(table), p.QuoteColumn(column))
+}
+
+func (p *SqliteMigrator) GenerateRenameColumn(table string, column string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", p.QuoteTable(table), p.QuoteColumn(column), p.QuoteColumn(name))
+}
+
+func (p *SqliteMigrator) GenerateDropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", p.QuoteTable(table))
+}
+
+func (p *SqliteMigrator) GenerateRenameTable(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", p.QuoteTable(table), p.QuoteTable(name))
+}
+
+// GenerateRebuildTable follows the procedure from https://www.sqlite.org/lang_altertable.html#otheralter
+func (p *SqliteMigrator) GenerateRebuildTable(table string, detail types.TableDetail, columns []string) []string {
+	newTable := "_shift_new_" + table
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = p.QuoteColumn(column)
+	}
+	// index names are global so the indexes can only be created once the old table (and its indexes) are gone
+	indexes := detail.Indexes
+	detail.Indexes = nil
+	// a table left behind by a rebuild which was interrupted is dropped so its rows aren't copied over
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s;", p.QuoteTable(newTable)),
+		strings.TrimSpace(migrator.GenerateCreateStatement(newTable, detail, p)),
+	}
+	if len(quoted) > 0 {
+		statements = append(statements, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", p.QuoteTable(newTable), strings.Join(quoted, ", "), strings.Join(quoted, ", "), p.QuoteTable(table)))
+	}
+	statements = append(statements,
+		fmt.Sprintf("DROP TABLE %s;", p.QuoteTable(table)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", p.QuoteTable(newTable), p.QuoteTable(table)),
+	)
+	for _, index := range indexes {
+		statements = append(statements, p.GenerateCreateIndex(table, index))
+	}
+	return statements
+}
+
+func (p *SqliteMigrator) GenerateCreateIndex(table string, index types.IndexDetail) string {
+	var sql strings.Builder
+	sql.WriteString("CREATE ")
+	if index.IsUnique {
+		sql.WriteString("UNIQUE ")
+	}
+	sql.WriteString("INDEX IF NOT EXISTS ")
+	sql.WriteString(quoteIdentifier(index.Name))
+	sql.WriteString(" ON ")
+	sql.WriteString(p.QuoteTable(table))
+	sql.WriteString(" (")
+	sql.WriteString(migrator.GenerateIndexKeys(index, p))
+	sql.WriteString(")")
+	if index.Where != nil && *index.Where != "" {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(*index.Where)
+	}
+	sql.WriteString(";")
+	return sql.String()
+}
+
+func (p *SqliteMigrator) GenerateDropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s;", quoteIdentifier(index))
+}
+
+func (p *SqliteMigrator) GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string {
+	return "" // sqlite can't add a constraint to an existing table, foreign key changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateDropForeignKey(table string, name string) string {
+	return "" // sqlite can't drop a constraint from an existing table, foreign key changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateAddPrimaryKey(table string, columns []string) string {
+	return "" // sqlite can't change the primary key of an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateDropPrimaryKey(table string) string {
+	return "" // sqlite can't change the primary key of an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string {
+	return "" // sqlite can't add a constraint to an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateDropUniqueConstraint(table string, name string) string {
+	return "" // sqlite can't drop a constraint from an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string {
+	return nil // sqlite can't add a constraint to an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateDropCheckConstraint(table string, name string) string {
+	return "" // sqlite can't drop a constraint from an existing table, constraint changes are handled by GenerateRebuildTable
+}
+
+func (p *SqliteMigrator) GenerateCreateEnum(name string, values []string) string {
+	return "" // sqlite has no enum types, the values are enforced with a check constraint, see resolveEnums
+}
+
+func (p *SqliteMigrator) GenerateAddEnumValue(name string, value migrator.MigrateEnumValue) string {
+	return "" // sqlite has no enum types, the values are enforced with a check constraint, see resolveEnums
+}
+
+func (p *SqliteMigrator) GenerateDropEnum(name string) string {
+	return "" // sqlite has no enum types, the values are enforced with a check constraint, see resolveEnums
+}
+
+func (p *SqliteMigrator) ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType {
+	return ToNativeType(column)
+}
+
+// recordMigration records the migration in the history table along with the error it failed with, which is returned
+func recordMigration(args migrator.MigratorArgs, sql string, started time.Time, failure error) error {
+	plan, err := diff.FormatPlan(args.Diff)
+	if err != nil {
+		return errors.Join(failure, err)
+	}
+	return migrator.RecordMigration(args, "sqlite", plan, sql, started, failure)
+}
+
+func init() {
+	var m SqliteMigrator
+	migrator.Register("sqlite", &m)
+	migrator.RegisterGenerator("sqlite", &m)
+}
@@ -0,0 +1,1112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhaynie/shift/internal/diff"
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newTestSchema() *schema.SchemaJson {
+	return &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "user",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true), AutoIncrement: util.Ptr(true)},
+					{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, MaxLength: util.Ptr(64), Nullable: util.Ptr(true)},
+					{Name: "age", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Nullable: util.Ptr(true)},
+					{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Sqlite: util.Ptr("new")}},
+					{Name: "created", Type: schema.SchemaJsonTablesElemColumnsElemTypeDatetime, Default: &schema.SchemaJsonTablesElemColumnsElemDefault{Sqlite: util.Ptr("datetime('now')")}},
+				},
+			},
+		},
+	}
+}
+
+func newTestDB(t *testing.T, dbschema *schema.SchemaJson) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1) // each connection to :memory: is a new database
+	var m SqliteMigrator
+	assert.NoError(t, m.Process(dbschema))
+	var out strings.Builder
+	assert.NoError(t, m.FromSchema(dbschema, &out))
+	_, err = db.Exec(out.String())
+	assert.NoError(t, err)
+	return db
+}
+
+func TestFromSchema(t *testing.T) {
+	dbschema := newTestSchema()
+	var m SqliteMigrator
+	assert.NoError(t, m.Process(dbschema))
+	var out strings.Builder
+	assert.NoError(t, m.FromSchema(dbschema, &out))
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "user" ( "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR(64), "age" INTEGER, "status" TEXT DEFAULT 'new', "created" DATETIME DEFAULT (datetime('now')) );`, util.CleanSQL(out.String()))
+}
+
+func TestProcessUnsupportedSchemas(t *testing.T) {
+	dbschema := newTestSchema()
+	dbschema.Tables[0].Schema = util.Ptr("auth")
+	var m SqliteMigrator
+	assert.EqualError(t, m.Process(dbschema), "table user has schema auth but sqlite doesn't support schemas")
+	dbschema.Database.Schemas = []string{"auth"}
+	assert.EqualError(t, m.Process(dbschema), "database has schemas but sqlite doesn't support schemas")
+}
+
+func TestToSchema(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+	var m SqliteMigrator
+	res, err := m.ToSchema(migrator.ToSchemaArgs{
+		Context: context.Background(),
+		Logger:  logger.NewTestLogger(),
+		DB:      db,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res.Tables, 1)
+	table := res.Tables[0]
+	assert.Equal(t, "user", table.Name)
+	assert.Len(t, table.Columns, 5)
+	assert.Equal(t, "id", table.Columns[0].Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeInt, table.Columns[0].Type)
+	assert.True(t, *table.Columns[0].PrimaryKey)
+	assert.True(t, *table.Columns[0].AutoIncrement)
+	assert.False(t, *table.Columns[0].Nullable)
+	assert.Equal(t, "name", table.Columns[1].Name)
+	assert.Equal(t, 64, *table.Columns[1].MaxLength)
+	assert.True(t, *table.Columns[1].Nullable)
+	assert.Equal(t, "new", *table.Columns[3].Default.Sqlite)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemTypeDatetime, table.Columns[4].Type)
+	assert.Equal(t, "datetime('now')", *table.Columns[4].Default.Sqlite)
+
+	// the schema we created from should have no differences
+	to := newTestSchema()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, res)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	res, err = m.ToSchema(migrator.ToSchemaArgs{
+		Context:     context.Background(),
+		Logger:      logger.NewTestLogger(),
+		DB:          db,
+		TableFilter: []string{"other"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Tables)
+}
+
+func TestMigrateRebuild(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+	_, err := db.Exec(`INSERT INTO "user" (name, age) VALUES ('a', 1), ('b', 2)`)
+	assert.NoError(t, err)
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+
+	to := newTestSchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(128)       // type change
+	to.Tables[0].Columns[2].Nullable = util.Ptr(false)      // nullability change
+	to.Tables[0].Columns = append(to.Tables[0].Columns[:3], // drop status
+		to.Tables[0].Columns[4],
+		schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)},
+	)
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverSQLite, changes, &out))
+	assert.Equal(t, `DROP TABLE IF EXISTS "_shift_new_user";
+CREATE TABLE IF NOT EXISTS "_shift_new_user" (
+   "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+   "name" VARCHAR(128),
+   "age" INTEGER NOT NULL,
+   "created" DATETIME DEFAULT (datetime('now')),
+   "email" TEXT
+);
+INSERT INTO "_shift_new_user" ("id", "name", "age", "created") SELECT "id", "name", "age", "created" FROM "user";
+DROP TABLE "user";
+ALTER TABLE "_shift_new_user" RENAME TO "user";
+`, out.String())
+
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT count(*) FROM "user" WHERE name IN ('a','b')`).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func newTestIndexes() []schema.SchemaJsonTablesElemIndexesElem {
+	return []schema.SchemaJsonTablesElemIndexesElem{
+		{Name: "user_name_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "name"}, {Name: "created", Order: util.Ptr(schema.SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)}}},
+		{Name: "user_lower_name_idx", Expression: util.Ptr("lower(name)"), Unique: util.Ptr(true), Where: util.Ptr("status = 'active'")},
+	}
+}
+
+func TestMigrateIndexes(t *testing.T) {
+	dbschema := newTestSchema()
+	dbschema.Tables[0].Indexes = newTestIndexes()
+	db := newTestDB(t, dbschema)
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, newTestIndexes(), from.Tables[0].Indexes)
+
+	to := newTestSchema()
+	to.Tables[0].Indexes = newTestIndexes()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	to.Tables[0].Indexes = []schema.SchemaJsonTablesElemIndexesElem{
+		{Name: "user_name_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "name"}}},
+		{Name: "user_age_idx", Columns: []schema.SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "age"}}},
+	}
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Len(t, changes[0].Indexes, 3)
+
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverSQLite, changes, &out))
+	assert.Equal(t, `DROP INDEX IF EXISTS "user_name_idx";
+DROP INDEX IF EXISTS "user_lower_name_idx";
+CREATE INDEX IF NOT EXISTS "user_name_idx" ON "user" ("name");
+CREATE INDEX IF NOT EXISTS "user_age_idx" ON "user" ("age");
+`, out.String())
+
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestMigrateRebuildWithIndexes(t *testing.T) {
+	dbschema := newTestSchema()
+	dbschema.Tables[0].Indexes = newTestIndexes()
+	db := newTestDB(t, dbschema)
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+
+	to := newTestSchema()
+	to.Tables[0].Columns[2].Nullable = util.Ptr(false)
+	to.Tables[0].Indexes = newTestIndexes()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+
+	// the indexes should have been recreated on the rebuilt table
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func newTestForeignKeySchema() *schema.SchemaJson {
+	dbschema := newTestSchema()
+	dbschema.Tables[0].Columns = append(dbschema.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{
+		Name:     "team_id",
+		Type:     schema.SchemaJsonTablesElemColumnsElemTypeInt,
+		Nullable: util.Ptr(true),
+		References: &schema.SchemaJsonTablesElemColumnsElemReferences{
+			Table:      "team",
+			Column:     "id",
+			OnDelete:   util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade),
+			Deferrable: util.Ptr(true),
+		},
+	})
+	dbschema.Tables = append(dbschema.Tables, schema.SchemaJsonTablesElem{
+		Name: "team",
+		Columns: []schema.SchemaJsonTablesElemColumnsElem{
+			{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+		},
+	})
+	return dbschema
+}
+
+func TestMigrateForeignKeys(t *testing.T) {
+	db := newTestDB(t, newTestForeignKeySchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db, TableFilter: []string{"user"}})
+	assert.NoError(t, err)
+	ref := from.Tables[0].Columns[5].References
+	assert.NotNil(t, ref)
+	assert.Equal(t, "team", ref.Table)
+	assert.Equal(t, "id", ref.Column)
+	assert.Equal(t, "user_team_id_fkey", *ref.Name)
+	assert.Equal(t, schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade, *ref.OnDelete)
+	assert.Nil(t, ref.OnUpdate)
+	assert.True(t, *ref.Deferrable)
+
+	from, err = m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestForeignKeySchema()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// changing the action requires the table to be rebuilt since sqlite can't alter constraints
+	to.Tables[0].Columns[5].References.OnDelete = util.Ptr(schema.SchemaJsonTablesElemColumnsElemReferencesOnDeleteSetNull)
+	to.Tables[0].Columns[5].References.Deferrable = nil
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Len(t, changes[0].ForeignKeys, 2)
+	var out strings.Builder
+	assert.NoError(t, diff.FormatDiff(diff.FormatSQL, schema.DatabaseDriverSQLite, changes, &out))
+	assert.Contains(t, out.String(), `CONSTRAINT "user_team_id_fkey" FOREIGN KEY ("team_id") REFERENCES "team" ("id") ON DELETE SET NULL`)
+	assert.NotContains(t, out.String(), "DEFERRABLE")
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// dropping the reference should remove the constraint
+	to.Tables[0].Columns[5].References = nil
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: after,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	after, err = m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db, TableFilter: []string{"user"}})
+	assert.NoError(t, err)
+	assert.Nil(t, after.Tables[0].Columns[5].References)
+}
+
+func TestMigrateRebuildTransaction(t *testing.T) {
+	db := newTestDB(t, newTestForeignKeySchema())
+	defer db.Close()
+	// a table left behind by a rebuild which was interrupted isn't reused
+	_, err := db.Exec(`CREATE TABLE "_shift_new_user" ("id" INTEGER); INSERT INTO "_shift_new_user" VALUES (999);`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "team" (id) VALUES (1); INSERT INTO "user" (name, age, team_id) VALUES ('a', 1, 1);`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`PRAGMA foreign_keys = ON;`)
+	assert.NoError(t, err)
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestForeignKeySchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(128)
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	args := migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}
+	assert.NoError(t, m.Migrate(args))
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT count(*) FROM "user" WHERE id = 999`).Scan(&count))
+	assert.Equal(t, 0, count)
+	assert.NoError(t, db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = '_shift_new_user'`).Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// the rebuild is rolled back when it leaves rows which violate their foreign keys
+	_, err = db.Exec(`PRAGMA foreign_keys = OFF; INSERT INTO "user" (name, age, team_id) VALUES ('b', 2, 404); PRAGMA foreign_keys = ON;`)
+	assert.NoError(t, err)
+	from, err = m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to = newTestForeignKeySchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(64)
+	assert.NoError(t, m.Process(to))
+	args.FromSchema, args.ToSchema = from, to
+	args.Diff, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	err = m.Migrate(args)
+	assert.ErrorContains(t, err, "violate their foreign keys")
+	assert.ErrorContains(t, err, "references a missing row of team")
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, from, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	var foreignKeys bool
+	assert.NoError(t, db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys))
+	assert.True(t, foreignKeys)
+
+	// the rows violating the foreign keys of the tables which aren't changed don't abort the migration
+	to = newTestForeignKeySchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(128)
+	to.Tables[1].Columns = append(to.Tables[1].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "name", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	args.FromSchema, args.ToSchema = from, to
+	args.Diff, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Migrate(args))
+
+	// nor do they when the foreign keys weren't on to begin with
+	_, err = db.Exec(`PRAGMA foreign_keys = OFF;`)
+	assert.NoError(t, err)
+	from = to
+	to = newTestForeignKeySchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(256)
+	to.Tables[1].Columns = from.Tables[1].Columns
+	assert.NoError(t, m.Process(to))
+	args.FromSchema, args.ToSchema = from, to
+	args.Diff, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, args.Diff)
+	assert.NoError(t, m.Migrate(args))
+	assert.NoError(t, db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys))
+	assert.False(t, foreignKeys)
+}
+
+func newTestConstraintSchema() *schema.SchemaJson {
+	return &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "membership",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "team_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "user_id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+					{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Unique: util.Ptr(true)},
+					{Name: "role", Type: schema.SchemaJsonTablesElemColumnsElemTypeString},
+				},
+				PrimaryKey: []string{"user_id", "team_id"},
+				UniqueConstraints: []schema.SchemaJsonTablesElemUniqueConstraintsElem{
+					{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+				},
+			},
+		},
+	}
+}
+
+func TestMigrateConstraints(t *testing.T) {
+	db := newTestDB(t, newTestConstraintSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	table := from.Tables[0]
+	assert.Equal(t, []string{"user_id", "team_id"}, table.PrimaryKey)
+	assert.True(t, *table.Columns[2].Unique)
+	assert.Equal(t, []schema.SchemaJsonTablesElemUniqueConstraintsElem{{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}}}, table.UniqueConstraints)
+
+	to := newTestConstraintSchema()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// change the order of the primary key, drop the unique column and widen the unique constraint
+	to.Tables[0].PrimaryKey = []string{"team_id", "user_id"}
+	to.Tables[0].Columns[2].Unique = nil
+	to.Tables[0].UniqueConstraints[0].Columns = []string{"team_id", "role", "email"}
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Len(t, changes[0].Constraints, 5)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team_id", "user_id"}, after.Tables[0].PrimaryKey)
+	assert.Nil(t, after.Tables[0].Columns[2].Unique)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// the constraints should be enforced
+	_, err = db.Exec(`INSERT INTO membership (team_id, user_id, email, role) VALUES (1, 1, 'a', 'admin')`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO membership (team_id, user_id, email, role) VALUES (1, 1, 'b', 'member')`)
+	assert.Error(t, err)
+}
+
+func newTestCheckSchema() *schema.SchemaJson {
+	return &schema.SchemaJson{
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "orders",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+					{Name: "price", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, Checks: []schema.SchemaJsonTablesElemColumnsElemChecksElem{{Name: "orders_price_check", Expression: "price >= 0"}}},
+					{Name: "discount", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt},
+				},
+				Checks: []schema.SchemaJsonTablesElemChecksElem{
+					{Name: "orders_discount_check", Expression: "discount <= price"},
+				},
+			},
+		},
+	}
+}
+
+func TestMigrateChecks(t *testing.T) {
+	db := newTestDB(t, newTestCheckSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.SchemaJsonTablesElemChecksElem{
+		{Name: "orders_discount_check", Expression: "discount <= price"},
+		{Name: "orders_price_check", Expression: "price >= 0"},
+	}, from.Tables[0].Checks)
+
+	to := newTestCheckSchema()
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// change the expression of one check and drop the other
+	to.Tables[0].Columns[1].Checks = nil
+	to.Tables[0].Checks[0].Expression = "discount < price"
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Len(t, changes[0].Constraints, 3)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.SchemaJsonTablesElemChecksElem{{Name: "orders_discount_check", Expression: "discount < price"}}, after.Tables[0].Checks)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// the check should be enforced
+	_, err = db.Exec(`INSERT INTO orders (id, price, discount) VALUES (1, -1, -2)`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders (id, price, discount) VALUES (2, 1, 1)`)
+	assert.Error(t, err)
+}
+
+func newTestEnumSchema() *schema.SchemaJson {
+	return &schema.SchemaJson{
+		Enums: []schema.SchemaJsonEnumsElem{{Name: "order_status", Values: []string{"pending", "shipped"}}},
+		Tables: []schema.SchemaJsonTablesElem{
+			{
+				Name: "orders",
+				Columns: []schema.SchemaJsonTablesElemColumnsElem{
+					{Name: "id", Type: schema.SchemaJsonTablesElemColumnsElemTypeInt, PrimaryKey: util.Ptr(true)},
+					{Name: "status", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Enum: util.Ptr("order_status")},
+				},
+			},
+		},
+	}
+}
+
+func TestMigrateEnums(t *testing.T) {
+	db := newTestDB(t, newTestEnumSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.SchemaJsonTablesElemChecksElem{
+		{Name: "orders_status_check", Expression: `"status" IN ('pending', 'shipped')`},
+	}, from.Tables[0].Checks)
+
+	to := newTestEnumSchema()
+	assert.NoError(t, m.Process(to))
+	assert.NoError(t, m.Process(to)) // processing again shouldn't add the check twice
+	assert.Len(t, to.Tables[0].Columns[1].Checks, 1)
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// adding a value to the enum changes the check which requires a rebuild
+	to = newTestEnumSchema()
+	to.Enums[0].Values = append(to.Enums[0].Values, "delivered")
+	assert.NoError(t, m.Process(to))
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	_, err = db.Exec(`INSERT INTO orders (id, status) VALUES (1, 'delivered')`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders (id, status) VALUES (2, 'returned')`)
+	assert.Error(t, err)
+}
+
+func TestMigrateRenames(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+	_, err := db.Exec(`INSERT INTO user (id, name, age) VALUES (1, 'bob', 42)`)
+	assert.NoError(t, err)
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+
+	// renaming the table and a column while changing another column needs a rebuild after the renames
+	to := newTestSchema()
+	to.Tables[0].Name = "account"
+	to.Tables[0].RenamedFrom = util.Ptr("user")
+	to.Tables[0].Columns[1].Name = "full_name"
+	to.Tables[0].Columns[1].RenamedFrom = util.Ptr("name")
+	to.Tables[0].Columns[2].Type = schema.SchemaJsonTablesElemColumnsElemTypeFloat
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "user", changes[0].RenamedFrom)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+	var name string
+	var age float64
+	assert.NoError(t, db.QueryRow(`SELECT full_name, age FROM account WHERE id = 1`).Scan(&name, &age))
+	assert.Equal(t, "bob", name)
+	assert.Equal(t, float64(42), age)
+
+	// the renames have been applied so there's nothing left to change
+	from, err = m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestMigrateRecordsHistory(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	started := time.Now().Add(-time.Second)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+		Checksum:   "abc123",
+		Commit:     "deadbeef",
+	}))
+
+	records, err = migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "abc123", record.Checksum)
+	assert.Equal(t, "deadbeef", record.Commit)
+	assert.Equal(t, `ALTER TABLE "user" ADD COLUMN "email" TEXT;`, util.CleanSQL(record.SQL))
+	assert.Contains(t, record.Plan, "[+] email")
+	assert.NotContains(t, record.Plan, "\x1b[")
+	assert.NotEmpty(t, record.User)
+	assert.True(t, record.StartedAt.After(started))
+	assert.False(t, record.FinishedAt.Before(record.StartedAt))
+	assert.Equal(t, migrator.MigrationApplied, record.Status)
+	assert.Empty(t, record.Error)
+
+	found, err := migrator.GetMigration(context.Background(), "sqlite", db, record.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, record, *found)
+	found, err = migrator.GetMigration(context.Background(), "sqlite", db, record.ID+1)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	// the history table is managed by shift so it isn't part of the schema
+	dbschema, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	for _, table := range dbschema.Tables {
+		assert.NotEqual(t, migrator.HistoryTable, table.Name)
+	}
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, dbschema)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestMigrateRecordsFailure(t *testing.T) {
+	db := newTestDB(t, newTestForeignKeySchema())
+	defer db.Close()
+	// the history table created by an earlier version is missing the status of the migrations
+	_, err := db.Exec(`CREATE TABLE "shift_migrations" (
+   "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+   "checksum" VARCHAR(64) NOT NULL,
+   "plan" TEXT NOT NULL,
+   "statements" TEXT NOT NULL,
+   "started_at" DATETIME NOT NULL,
+   "finished_at" DATETIME NOT NULL,
+   "duration_ms" INTEGER NOT NULL,
+   "os_user" VARCHAR(255) NOT NULL,
+   "git_commit" VARCHAR(64),
+   "from_schema" TEXT,
+   "to_schema" TEXT
+);
+INSERT INTO "shift_migrations" (checksum, plan, statements, started_at, finished_at, duration_ms, os_user) VALUES ('abc', '', '', '2024-11-05 10:30:15', '2024-11-05 10:30:16', 1000, 'test');`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO "user" (name, age, team_id) VALUES ('a', 1, 404); PRAGMA foreign_keys = ON;`)
+	assert.NoError(t, err)
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestForeignKeySchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(128)
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	failure := m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+		Checksum:   "def",
+	})
+	assert.ErrorContains(t, failure, "violate their foreign keys")
+
+	// the migration is recorded as failed since its transaction was rolled back
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "def", records[0].Checksum)
+	assert.Equal(t, migrator.MigrationFailed, records[0].Status)
+	assert.Equal(t, failure.Error(), records[0].Error)
+	assert.Contains(t, records[0].SQL, `DROP TABLE IF EXISTS "_shift_new_user";`)
+	assert.Equal(t, migrator.MigrationApplied, records[1].Status)
+	assert.Empty(t, records[1].Error)
+}
+
+func TestMigrateRollback(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}))
+
+	// the schemas are recorded so the migration can be reversed
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.NotNil(t, records[0].FromSchema)
+	assert.NotNil(t, records[0].ToSchema)
+	assert.Equal(t, "${DATABASE_URL}", records[0].ToSchema.Database.Url)
+	assert.Equal(t, from.Tables, records[0].FromSchema.Tables)
+	assert.Equal(t, to.Tables, records[0].ToSchema.Tables)
+
+	target, irreversible, err := diff.ReverseSchema(logger.NewTestLogger(), schema.DatabaseDriverSQLite, records[0].ToSchema, records[0].FromSchema)
+	assert.NoError(t, err)
+	assert.Empty(t, irreversible)
+	current, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, target, current)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: current,
+		ToSchema:   target,
+		Diff:       changes,
+	}))
+
+	current, err = m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, from, current)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestMigrateLock(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	args := migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+		LockWait:   time.Millisecond,
+	}
+
+	// another migration holds the lock
+	unlock, err := m.lock(args)
+	assert.NoError(t, err)
+	err = m.Migrate(args)
+	assert.ErrorIs(t, err, migrator.ErrLockTimeout)
+	assert.ErrorContains(t, err, "the lock is held by")
+	unlock()
+
+	assert.NoError(t, m.Migrate(args))
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	// the changes were applied by the migration which held the lock first so there's nothing left to do
+	assert.NoError(t, m.Migrate(args))
+	records, err = migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	// the lock is released and isn't part of the schema
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM shift_lock`).Scan(&count))
+	assert.Equal(t, 0, count)
+	dbschema, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Len(t, dbschema.Tables, len(to.Tables))
+}
+
+func TestMigrateDrift(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	fingerprint, err := schema.Fingerprint(from)
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+
+	// the database changed after the plan was created
+	_, err = db.Exec(`ALTER TABLE user ADD COLUMN nickname TEXT`)
+	assert.NoError(t, err)
+	err = m.Migrate(migrator.MigratorArgs{
+		Context:     context.Background(),
+		Logger:      logger.NewTestLogger(),
+		DB:          db,
+		FromSchema:  from,
+		ToSchema:    to,
+		Diff:        changes,
+		Fingerprint: fingerprint,
+	})
+	assert.ErrorIs(t, err, migrator.ErrDrift)
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestMigratePlan(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	plan, err := migrator.NewPlan("sqlite", from, to, changes, "")
+	assert.NoError(t, err)
+	planned, err := plan.MigrateChanges()
+	assert.NoError(t, err)
+
+	// the changes of the plan are applied rather than the ones for the schema since the database hasn't changed
+	target := newTestSchema()
+	target.Tables[0].Columns = append(target.Tables[0].Columns, to.Tables[0].Columns[len(to.Tables[0].Columns)-1], schema.SchemaJsonTablesElemColumnsElem{Name: "phone", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(target))
+	assert.NoError(t, m.Migrate(migrator.MigratorArgs{
+		Context:     context.Background(),
+		Logger:      logger.NewTestLogger(),
+		DB:          db,
+		FromSchema:  from,
+		ToSchema:    target,
+		Diff:        planned,
+		Fingerprint: plan.Fingerprint,
+	}))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestMigrateUncheckedDestructive(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	to := newTestSchema()
+	to.Tables[0].Columns = append(to.Tables[0].Columns, schema.SchemaJsonTablesElemColumnsElem{Name: "email", Type: schema.SchemaJsonTablesElemColumnsElemTypeString, Nullable: util.Ptr(true)})
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	args := migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	}
+
+	// the column added while the migration was waiting would be dropped without being checked
+	_, err = db.Exec(`ALTER TABLE user ADD COLUMN nickname TEXT`)
+	assert.NoError(t, err)
+	err = m.Migrate(args)
+	var derr *diff.DestructiveError
+	assert.ErrorAs(t, err, &derr)
+	assert.Equal(t, []diff.Hazard{{Risk: diff.RiskDestructive, Table: "user", Column: "nickname", Reason: "drops column nickname from user and its data"}}, derr.Hazards)
+	assert.EqualError(t, err, "aborting since the database changed while waiting for the migration lock and the changes which remain are destructive without being checked:\n  - drops column nickname from user and its data")
+	records, err := migrator.GetMigrationHistory(context.Background(), "sqlite", db)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	// the drop is applied once it's declared in the schema
+	to.Drops = []schema.SchemaJsonDropsElem{{Table: "user", Column: util.Ptr("nickname")}}
+	assert.NoError(t, m.Migrate(args))
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	changes, err = diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// or when the migration allows destructive changes
+	to.Drops = nil
+	_, err = db.Exec(`ALTER TABLE user ADD COLUMN nickname TEXT`)
+	assert.NoError(t, err)
+	args.AllowDestructive = true
+	assert.NoError(t, m.Migrate(args))
+}
+
+func TestParseCheckClauses(t *testing.T) {
+	checks := parseCheckClauses("orders", `CREATE TABLE "orders" (
+   "price" INTEGER NOT NULL CHECK (price >= 0),
+   "status" TEXT NOT NULL,
+   CONSTRAINT "orders_status_check" CHECK (status IN ('a', 'b)')),
+   CHECK ((price < 100))
+)`)
+	assert.Equal(t, []types.CheckConstraintDetail{
+		{Name: "orders_check1", Expression: "price >= 0"},
+		{Name: "orders_status_check", Expression: "status IN ('a', 'b)')"},
+		{Name: "orders_check2", Expression: "price < 100"},
+	}, checks)
+}
+
+func TestParseUniqueClauses(t *testing.T) {
+	clauses := parseUniqueClauses(`CREATE TABLE "membership" (
+   "team_id" INTEGER NOT NULL,
+   "role" TEXT NOT NULL,
+   CONSTRAINT "membership_team_role_key" UNIQUE ("team_id", "role"),
+   CONSTRAINT other UNIQUE (role)
+)`)
+	assert.Equal(t, map[string]string{"team_id,role": "membership_team_role_key", "role": "other"}, clauses)
+}
+
+func TestParseForeignKeyClauses(t *testing.T) {
+	clauses := parseForeignKeyClauses(`CREATE TABLE "user" (
+   "id" INTEGER NOT NULL PRIMARY KEY,
+   "team_id" INTEGER,
+   "org_id" INTEGER,
+   CONSTRAINT "user_team_fk" FOREIGN KEY ("team_id") REFERENCES "team" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+   FOREIGN KEY (org_id) REFERENCES org (id) NOT DEFERRABLE INITIALLY DEFERRED
+)`)
+	assert.Equal(t, foreignKeyClause{name: "user_team_fk", deferrable: true}, clauses["team_id"])
+	assert.Equal(t, foreignKeyClause{}, clauses["org_id"])
+}
+
+func TestParseIndexSQL(t *testing.T) {
+	keys, where := parseIndexSQL(`CREATE INDEX "a_idx" ON "user" ("name", "created" DESC)`)
+	assert.Equal(t, `"name", "created" DESC`, keys)
+	assert.Equal(t, "", where)
+	keys, where = parseIndexSQL(`CREATE UNIQUE INDEX IF NOT EXISTS a_idx on user (lower(name)) WHERE status = 'active'`)
+	assert.Equal(t, "lower(name)", keys)
+	assert.Equal(t, "status = 'active'", where)
+}
+
+func TestDataTypeToType(t *testing.T) {
+	assertType := func(expect schema.SchemaJsonTablesElemColumnsElemType, dataType string) {
+		val, err := dataTypeToType(dataType)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, val)
+	}
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeInt, "INTEGER")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeInt, "bigint")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeString, "VARCHAR(255)")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeString, "BLOB")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeString, "")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeFloat, "REAL")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeFloat, "DECIMAL(10,2)")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeBoolean, "BOOLEAN")
+	assertType(schema.SchemaJsonTablesElemColumnsElemTypeDatetime, "DATETIME")
+	_, err := dataTypeToType("GEOMETRY")
+	assert.EqualError(t, err, "unhandled data type: GEOMETRY")
+}
+
+func TestDSNFromURL(t *testing.T) {
+	assert.Equal(t, "./local.db", DSNFromURL("sqlite://./local.db"))
+	assert.Equal(t, "/tmp/local.db", DSNFromURL("sqlite:///tmp/local.db"))
+	assert.Equal(t, ":memory:", DSNFromURL("sqlite://:memory:"))
+	assert.Equal(t, "file.db?_pragma=foreign_keys(1)", DSNFromURL("sqlite:file.db?_pragma=foreign_keys(1)"))
+}
+
+func TestMigratePreflight(t *testing.T) {
+	db := newTestDB(t, newTestSchema())
+	defer db.Close()
+	_, err := db.Exec(`INSERT INTO user (id, name) VALUES (1, 'a'), (2, 'a'), (3, NULL), (4, 'a much longer name')`)
+	assert.NoError(t, err)
+
+	var m SqliteMigrator
+	from, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	// the name becomes unique, not null and shorter which none of the existing rows allow
+	to := newTestSchema()
+	to.Tables[0].Columns[1].MaxLength = util.Ptr(8)
+	to.Tables[0].Columns[1].Nullable = util.Ptr(false)
+	to.Tables[0].Columns[1].Unique = util.Ptr(true)
+	assert.NoError(t, m.Process(to))
+	changes, err := diff.Diff(logger.NewTestLogger(), schema.DatabaseDriverSQLite, to, from)
+	assert.NoError(t, err)
+	err = m.Migrate(migrator.MigratorArgs{
+		Context:    context.Background(),
+		Logger:     logger.NewTestLogger(),
+		DB:         db,
+		FromSchema: from,
+		ToSchema:   to,
+		Diff:       changes,
+	})
+	var perr *migrator.PreflightError
+	assert.ErrorAs(t, err, &perr)
+	assert.Len(t, perr.Failures, 3)
+	assert.Equal(t, int64(1), perr.Failures[0].Count)
+	assert.Equal(t, []string{"id=3"}, perr.Failures[0].Samples)
+	assert.Equal(t, int64(1), perr.Failures[1].Count)
+	assert.Equal(t, []string{"id=4"}, perr.Failures[1].Samples)
+	assert.Equal(t, int64(2), perr.Failures[2].Count)
+	assert.Equal(t, []string{"name=a"}, perr.Failures[2].Samples)
+
+	// nothing was changed
+	after, err := m.ToSchema(migrator.ToSchemaArgs{Context: context.Background(), Logger: logger.NewTestLogger(), DB: db})
+	assert.NoError(t, err)
+	assert.Equal(t, from, after)
+}
@@ -0,0 +1,594 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jhaynie/shift/internal/migrator"
+	"github.com/jhaynie/shift/internal/migrator/types"
+	"github.com/jhaynie/shift/internal/schema"
+	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
+)
+
+func execute(ctx context.Context, logger logger.Logger, db migrator.Queryer, query string, args ...any) (*sql.Rows, error) {
+	logger.Trace("sql: %s", query)
+	res, err := db.QueryContext(ctx, query, args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return res, nil
+}
+
+var tablesSQL = util.CleanSQL(`SELECT
+	name,
+	sql
+FROM
+	sqlite_master
+WHERE
+	type = 'table'
+	AND name NOT LIKE 'sqlite_%'
+ORDER BY name
+`)
+
+var tableInfoSQL = `SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`
+
+var isAutoIncrement = regexp.MustCompile(`(?i)\bAUTOINCREMENT\b`)
+
+// getInfoTables returns the table details for the database, optionally filtered to the provided tables
+func getInfoTables(ctx context.Context, logger logger.Logger, db migrator.Queryer, filterTables []string) (map[string]*types.TableDetail, error) {
+	res, err := execute(ctx, logger, db, tablesSQL)
+	if err != nil {
+		return nil, err
+	}
+	tableSQL := make(map[string]string)
+	var names []string
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name string
+			var ddl sql.NullString
+			if err := res.Scan(&name, &ddl); err != nil {
+				return nil, err
+			}
+			if migrator.IsShiftTable(name) {
+				continue // skip the tables managed by shift
+			}
+			if len(filterTables) > 0 && !util.Contains(filterTables, name) {
+				continue // skip if we're filtering tables
+			}
+			names = append(names, name)
+			tableSQL[name] = ddl.String
+		}
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+	}
+	tables := make(map[string]*types.TableDetail)
+	for _, name := range names {
+		table := &types.TableDetail{
+			Columns:     make([]types.ColumnDetail, 0),
+			Constraints: make([]types.ConstraintDetail, 0),
+		}
+		columns, primaryKey, err := getTableColumns(ctx, logger, db, name)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching columns for table: %s. %w", name, err)
+		}
+		for _, column := range columns {
+			if column.IsPrimaryKey {
+				// sqlite only allows AUTOINCREMENT on the INTEGER PRIMARY KEY column
+				column.IsAutoIncrementing = len(primaryKey) == 1 && strings.EqualFold(column.UDTName, "INTEGER") && isAutoIncrement.MatchString(tableSQL[name])
+			}
+			table.Columns = append(table.Columns, column)
+		}
+		for _, column := range primaryKey {
+			table.Constraints = append(table.Constraints, types.ConstraintDetail{
+				Name:   name + "_pkey",
+				Type:   "PRIMARY KEY",
+				Column: column,
+			})
+		}
+		uniques, err := getTableUniqueConstraints(ctx, logger, db, name, tableSQL[name])
+		if err != nil {
+			return nil, fmt.Errorf("error fetching unique constraints for table: %s. %w", name, err)
+		}
+		for _, unique := range uniques {
+			for _, column := range unique.Columns {
+				table.Constraints = append(table.Constraints, types.ConstraintDetail{
+					Name:   unique.Name,
+					Type:   "UNIQUE",
+					Column: column,
+				})
+			}
+		}
+		indexes, err := getTableIndexes(ctx, logger, db, name)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching indexes for table: %s. %w", name, err)
+		}
+		table.Indexes = indexes
+		foreignKeys, err := getTableForeignKeys(ctx, logger, db, name, tableSQL[name])
+		if err != nil {
+			return nil, fmt.Errorf("error fetching foreign keys for table: %s. %w", name, err)
+		}
+		table.ForeignKeys = foreignKeys
+		table.Checks = parseCheckClauses(name, tableSQL[name])
+		tables[name] = table
+	}
+	return tables, nil
+}
+
+// getTableColumns returns the columns for a table along with the primary key columns in key order
+func getTableColumns(ctx context.Context, logger logger.Logger, db migrator.Queryer, table string) ([]types.ColumnDetail, []string, error) {
+	res, err := execute(ctx, logger, db, tableInfoSQL, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	var columns []types.ColumnDetail
+	positions := make(map[string]int64)
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var cid, notnull, pk int64
+			var name, dataType string
+			var columnDefault sql.NullString
+			if err := res.Scan(&cid, &name, &dataType, &notnull, &columnDefault, &pk); err != nil {
+				return nil, nil, err
+			}
+			if pk > 0 {
+				positions[name] = pk
+			}
+			var detail types.ColumnDetail
+			detail.Name = name
+			detail.Ordinal = cid + 1
+			detail.UDTName = dataType
+			detail.DataType = dataType
+			detail.IsNullable = notnull == 0 && pk == 0
+			detail.IsPrimaryKey = pk > 0
+			if columnDefault.Valid {
+				detail.Default = &columnDefault.String
+			}
+			if m := lengthRegex.FindStringSubmatch(dataType); m != nil {
+				if val, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+					detail.MaxLength = &val
+				}
+			}
+			columns = append(columns, detail)
+		}
+		if err := res.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	// the pk value is the position of the column within the primary key
+	primaryKey := make([]string, 0, len(positions))
+	for name := range positions {
+		primaryKey = append(primaryKey, name)
+	}
+	slices.SortFunc(primaryKey, func(a, b string) int {
+		return int(positions[a] - positions[b])
+	})
+	return columns, primaryKey, nil
+}
+
+// only include the indexes backing a UNIQUE constraint
+var uniqueListSQL = `SELECT name FROM pragma_index_list(?) WHERE origin = 'u' ORDER BY seq`
+
+var uniqueClauseRegex = regexp.MustCompile(`(?is)CONSTRAINT\s+` + identifierPattern + `\s+UNIQUE\s*\(([^)]*)\)`)
+
+// parseUniqueClauses returns the constraint name for each named table level unique constraint in a CREATE TABLE
+// statement keyed by the comma separated columns since sqlite doesn't keep the name of the constraint
+func parseUniqueClauses(val string) map[string]string {
+	res := make(map[string]string)
+	for _, m := range uniqueClauseRegex.FindAllStringSubmatch(val, -1) {
+		var columns []string
+		for _, column := range strings.Split(m[2], ",") {
+			columns = append(columns, unquoteIdentifier(strings.TrimSpace(column)))
+		}
+		res[strings.Join(columns, ",")] = unquoteIdentifier(m[1])
+	}
+	return res
+}
+
+// getTableUniqueConstraints returns the unique constraints for a table
+func getTableUniqueConstraints(ctx context.Context, logger logger.Logger, db migrator.Queryer, table string, ddl string) ([]types.UniqueConstraintDetail, error) {
+	res, err := execute(ctx, logger, db, uniqueListSQL, table)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []string
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name string
+			if err := res.Scan(&name); err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, name)
+		}
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		res.Close() // close before running the queries below in case we only have a single connection
+	}
+	clauses := parseUniqueClauses(ddl)
+	var uniques []types.UniqueConstraintDetail
+	for _, index := range indexes {
+		columns, _, err := getIndexColumns(ctx, logger, db, index)
+		if err != nil {
+			return nil, err
+		}
+		unique := types.UniqueConstraintDetail{Columns: make([]string, len(columns))}
+		for i, column := range columns {
+			unique.Columns[i] = column.Name
+		}
+		unique.Name = clauses[strings.Join(unique.Columns, ",")]
+		if unique.Name == "" {
+			unique.Name = table + "_" + strings.Join(unique.Columns, "_") + "_key"
+		}
+		uniques = append(uniques, unique)
+	}
+	return uniques, nil
+}
+
+var checkClauseRegex = regexp.MustCompile(`(?i)(?:CONSTRAINT\s+` + identifierPattern + `\s+)?\bCHECK\s*\(`)
+
+// parseCheckClauses returns the check constraints from a CREATE TABLE statement since sqlite has no other way to
+// get them. a check without a name is given one based on the table since it can't otherwise be matched to the schema
+func parseCheckClauses(table string, val string) []types.CheckConstraintDetail {
+	var checks []types.CheckConstraintDetail
+	var unnamed int
+	for _, m := range checkClauseRegex.FindAllStringSubmatchIndex(val, -1) {
+		start := m[1] - 1
+		end := util.MatchingParen(val, start)
+		if end < 0 {
+			continue
+		}
+		check := types.CheckConstraintDetail{Expression: util.TrimParens(val[start : end+1])}
+		if m[2] >= 0 {
+			check.Name = unquoteIdentifier(val[m[2]:m[3]])
+		} else {
+			unnamed++
+			check.Name = fmt.Sprintf("%s_check%d", table, unnamed)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// only include indexes created with CREATE INDEX and not those backing a PRIMARY KEY or UNIQUE constraint
+var indexListSQL = `SELECT name, "unique" FROM pragma_index_list(?) WHERE origin = 'c' ORDER BY name`
+
+var indexInfoSQL = `SELECT name, "desc" FROM pragma_index_xinfo(?) WHERE key = 1 ORDER BY seqno`
+
+var indexSQL = `SELECT sql FROM sqlite_master WHERE type = 'index' AND name = ?`
+
+var indexOnRegex = regexp.MustCompile(`(?i)\sON\s`)
+var indexWhereRegex = regexp.MustCompile(`(?is)^WHERE\s+(.+?);?$`)
+
+// parseIndexSQL returns the keys and where predicate from a CREATE INDEX statement
+func parseIndexSQL(val string) (string, string) {
+	loc := indexOnRegex.FindStringIndex(val)
+	if loc == nil {
+		return "", ""
+	}
+	start := strings.Index(val[loc[1]:], "(")
+	if start < 0 {
+		return "", ""
+	}
+	start += loc[1]
+	end := util.MatchingParen(val, start)
+	if end < 0 {
+		return "", ""
+	}
+	keys := strings.TrimSpace(val[start+1 : end])
+	if m := indexWhereRegex.FindStringSubmatch(strings.TrimSpace(val[end+1:])); m != nil {
+		return keys, strings.TrimSpace(m[1])
+	}
+	return keys, ""
+}
+
+func getTableIndexes(ctx context.Context, logger logger.Logger, db migrator.Queryer, table string) ([]types.IndexDetail, error) {
+	res, err := execute(ctx, logger, db, indexListSQL, table)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []types.IndexDetail
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name string
+			var unique int64
+			if err := res.Scan(&name, &unique); err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, types.IndexDetail{Name: name, IsUnique: unique == 1})
+		}
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		res.Close() // close before running the queries below in case we only have a single connection
+	}
+	for i, index := range indexes {
+		var ddl sql.NullString
+		if err := db.QueryRowContext(ctx, indexSQL, index.Name).Scan(&ddl); err != nil {
+			return nil, fmt.Errorf("error fetching sql for index: %s. %w", index.Name, err)
+		}
+		keys, where := parseIndexSQL(ddl.String)
+		if where != "" {
+			index.Where = util.Ptr(where)
+		}
+		columns, isExpression, err := getIndexColumns(ctx, logger, db, index.Name)
+		if err != nil {
+			return nil, err
+		}
+		if isExpression {
+			index.Expression = util.Ptr(keys)
+		} else {
+			index.Columns = columns
+		}
+		indexes[i] = index
+	}
+	return indexes, nil
+}
+
+// getIndexColumns returns the columns for an index and true if any of the keys are an expression
+func getIndexColumns(ctx context.Context, logger logger.Logger, db migrator.Queryer, index string) ([]types.IndexColumnDetail, bool, error) {
+	res, err := execute(ctx, logger, db, indexInfoSQL, index)
+	if err != nil {
+		return nil, false, err
+	}
+	var columns []types.IndexColumnDetail
+	var isExpression bool
+	if res != nil {
+		defer res.Close()
+		for res.Next() {
+			var name sql.NullString
+			var desc int64
+			if err := res.Scan(&name, &desc); err != nil {
+				return nil, false, err
+			}
+			if !name.Valid {
+				isExpression = true
+				continue
+			}
+			columns = append(columns, types.IndexColumnDetail{Name: name.String, IsDescending: desc == 1})
+		}
+		if err := res.Err(); err != nil {
+			return nil, false, err
+		}
+	}
+	return columns, isExpression, nil
+}
+
+var foreignKeyListSQL = `SELECT id, seq, "table", "from", "to", on_update, on_delete FROM pragma_foreign_key_list(?) ORDER BY id, seq`
+
+var primaryKeySQL = `SELECT name FROM pragma_table_info(?) WHERE pk = 1`
+
+const identifierPattern = "(\"(?:[^\"]|\"\")+\"|`[^`]+`|\\[[^\\]]+\\]|[\\w$]+)"
+
+var foreignKeyClauseRegex = regexp.MustCompile(`(?is)(?:CONSTRAINT\s+` + identifierPattern + `\s+)?FOREIGN\s+KEY\s*\(\s*` + identifierPattern + `\s*\)\s*REFERENCES\s+[^,]*`)
+var deferredRegex = regexp.MustCompile(`(?i)\bDEFERRABLE\s+INITIALLY\s+DEFERRED\b`)
+var notDeferrableRegex = regexp.MustCompile(`(?i)\bNOT\s+DEFERRABLE\b`)
+
+type foreignKeyClause struct {
+	name       string
+	deferrable bool
+}
+
+// parseForeignKeyClauses returns the constraint name and whether the constraint is deferred for each table level
+// foreign key in a CREATE TABLE statement since sqlite doesn't return either in pragma_foreign_key_list
+func parseForeignKeyClauses(val string) map[string]foreignKeyClause {
+	res := make(map[string]foreignKeyClause)
+	for _, m := range foreignKeyClauseRegex.FindAllStringSubmatch(val, -1) {
+		var clause foreignKeyClause
+		if m[1] != "" {
+			clause.name = unquoteIdentifier(m[1])
+		}
+		clause.deferrable = deferredRegex.MatchString(m[0]) && !notDeferrableRegex.MatchString(m[0])
+		res[unquoteIdentifier(m[2])] = clause
+	}
+	return res
+}
+
+// getTableForeignKeys returns the single column foreign keys for a table
+func getTableForeignKeys(ctx context.Context, logger logger.Logger, db migrator.Queryer, table string, ddl string) ([]types.ForeignKeyDetail, error) {
+	res, err := execute(ctx, logger, db, foreignKeyListSQL, table)
+	if err != nil {
+		return nil, err
+	}
+	var foreignKeys []types.ForeignKeyDetail
+	if res != nil {
+		defer res.Close()
+		multiple := make(map[int64]string) // referenced table of the foreign keys of more than one column
+		var ids []int64
+		for res.Next() {
+			var id, seq int64
+			var refTable, column, onUpdate, onDelete string
+			var refColumn sql.NullString
+			if err := res.Scan(&id, &seq, &refTable, &column, &refColumn, &onUpdate, &onDelete); err != nil {
+				return nil, err
+			}
+			if seq > 0 {
+				multiple[id] = refTable
+				continue
+			}
+			ids = append(ids, id)
+			foreignKeys = append(foreignKeys, types.ForeignKeyDetail{
+				Column:          column,
+				ReferenceTable:  refTable,
+				ReferenceColumn: refColumn.String,
+				OnDelete:        util.Ptr(strings.ToLower(onDelete)),
+				OnUpdate:        util.Ptr(strings.ToLower(onUpdate)),
+			})
+		}
+		if err := res.Err(); err != nil {
+			return nil, err
+		}
+		res.Close() // close before running the queries below in case we only have a single connection
+		clauses := parseForeignKeyClauses(ddl)
+		var single []types.ForeignKeyDetail
+		for i, fk := range foreignKeys {
+			if refTable, ok := multiple[ids[i]]; ok {
+				// the table is rebuilt without it when it's changed so the warning says it would be lost
+				logger.Warn("skipping the foreign key of %s referencing %s since foreign keys of more than one column aren't supported, rebuilding the table drops it", table, refTable)
+				continue
+			}
+			clause := clauses[fk.Column]
+			fk.Name = clause.name
+			if fk.Name == "" {
+				fk.Name = table + "_" + fk.Column + "_fkey"
+			}
+			fk.IsDeferrable = clause.deferrable
+			if fk.ReferenceColumn == "" {
+				// a reference without a column refers to the primary key of the referenced table
+				if err := db.QueryRowContext(ctx, primaryKeySQL, fk.ReferenceTable).Scan(&fk.ReferenceColumn); err != nil {
+					return nil, fmt.Errorf("error fetching primary key for table: %s. %w", fk.ReferenceTable, err)
+				}
+			}
+			single = append(single, fk)
+		}
+		foreignKeys = single
+	}
+	return foreignKeys, nil
+}
+
+var lengthRegex = regexp.MustCompile(`(?i)^(?:VAR)?CHAR(?:ACTER)?\s*\((\d+)\)$`)
+
+// see https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+// enumCheckName returns the name of the check constraint which enforces the enum values for a column
+func enumCheckName(table string, column string) string {
+	return table + "_" + column + "_check"
+}
+
+// resolveEnums adds a check constraint to the columns which reference an enum since sqlite has no enum types
+func resolveEnums(dbschema *schema.SchemaJson) {
+	for _, table := range dbschema.Tables {
+		for i, col := range table.Columns {
+			if col.Enum == nil {
+				continue
+			}
+			enum := schema.FindEnum(dbschema.Enums, *col.Enum)
+			if enum == nil {
+				continue
+			}
+			name := enumCheckName(table.Name, col.Name)
+			if slices.ContainsFunc(schema.TableChecks(table), func(check schema.SchemaJsonTablesElemChecksElem) bool {
+				return check.Name == name
+			}) {
+				continue
+			}
+			values := make([]string, len(enum.Values))
+			for j, value := range enum.Values {
+				values[j] = quoteLiteral(value)
+			}
+			col.Checks = append(col.Checks, schema.SchemaJsonTablesElemColumnsElemChecksElem{
+				Name:       name,
+				Expression: fmt.Sprintf("%s IN (%s)", quoteIdentifier(col.Name), strings.Join(values, ", ")),
+			})
+			table.Columns[i] = col
+		}
+	}
+}
+
+func dataTypeToType(val string) (schema.SchemaJsonTablesElemColumnsElemType, error) {
+	dt := strings.ToUpper(val)
+	switch {
+	case strings.Contains(dt, "BOOL"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeBoolean, nil
+	case strings.Contains(dt, "DATE"), strings.Contains(dt, "TIME"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeDatetime, nil
+	case strings.Contains(dt, "INT"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeInt, nil
+	case strings.Contains(dt, "CHAR"), strings.Contains(dt, "CLOB"), strings.Contains(dt, "TEXT"), strings.Contains(dt, "BLOB"), strings.Contains(dt, "JSON"), strings.Contains(dt, "UUID"), dt == "":
+		return schema.SchemaJsonTablesElemColumnsElemTypeString, nil
+	case strings.Contains(dt, "REAL"), strings.Contains(dt, "FLOA"), strings.Contains(dt, "DOUB"), strings.Contains(dt, "NUMERIC"), strings.Contains(dt, "DECIMAL"):
+		return schema.SchemaJsonTablesElemColumnsElemTypeFloat, nil
+	}
+	return "", fmt.Errorf("unhandled data type: %s", val)
+}
+
+func ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType {
+	if column.NativeType != nil && column.NativeType.Sqlite != nil {
+		return column.NativeType
+	}
+	if column.IsArray {
+		// sqlite has no native array types so we store them as json text
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "TEXT")
+	}
+	switch column.Type {
+	case schema.SchemaJsonTablesElemColumnsElemTypeBoolean:
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "BOOLEAN")
+	case schema.SchemaJsonTablesElemColumnsElemTypeDatetime:
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "DATETIME")
+	case schema.SchemaJsonTablesElemColumnsElemTypeFloat:
+		if column.Length != nil && column.Length.Scale != nil {
+			return schema.ToNativeType(schema.DatabaseDriverSQLite, fmt.Sprintf("DECIMAL(%d,%s)", column.Length.Precision, strconv.FormatFloat(*column.Length.Scale, 'f', 0, 32)))
+		}
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "REAL")
+	case schema.SchemaJsonTablesElemColumnsElemTypeInt:
+		// AUTOINCREMENT is only allowed on a column declared exactly as INTEGER
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "INTEGER")
+	case schema.SchemaJsonTablesElemColumnsElemTypeString:
+		if column.Subtype != nil {
+			switch *column.Subtype {
+			case schema.SchemaJsonTablesElemColumnsElemSubtypeBinary, schema.SchemaJsonTablesElemColumnsElemSubtypeBit:
+				return schema.ToNativeType(schema.DatabaseDriverSQLite, "BLOB")
+			case schema.SchemaJsonTablesElemColumnsElemSubtypeJson, schema.SchemaJsonTablesElemColumnsElemSubtypeUuid:
+				return schema.ToNativeType(schema.DatabaseDriverSQLite, "TEXT")
+			}
+		}
+		if column.MaxLength != nil && *column.MaxLength > 0 {
+			return schema.ToNativeType(schema.DatabaseDriverSQLite, fmt.Sprintf("VARCHAR(%d)", *column.MaxLength))
+		}
+		return schema.ToNativeType(schema.DatabaseDriverSQLite, "TEXT")
+	}
+	return nil
+}
+
+func formatDefault(column types.ColumnDetail) (*string, error) {
+	val := column.Default
+	if val != nil && *val != "" {
+		s := *val
+		// expressions are stored wrapped in parens, e.g. (datetime('now'))
+		if s[0:1] == "(" && s[len(s)-1:] == ")" && util.IsFunctionCall(s[1:len(s)-1]) {
+			return util.Ptr(s[1 : len(s)-1]), nil
+		}
+		if util.IsFunctionCall(s) {
+			return val, nil
+		}
+		switch column.DataType {
+		case "string", "datetime":
+			if s[0:1] == "'" && len(s) > 1 {
+				return util.Ptr(strings.ReplaceAll(s[1:len(s)-1], "''", "'")), nil
+			}
+		case "int", "float":
+			if !util.IsNumber.MatchString(s) {
+				return nil, fmt.Errorf("invalid %s value: %s. should be: %s", column.DataType, s, util.IsNumber.String())
+			}
+		case "boolean":
+			switch strings.ToLower(s) {
+			case "1", "true":
+				return util.Ptr("true"), nil
+			case "0", "false":
+				return util.Ptr("false"), nil
+			default:
+				return nil, fmt.Errorf("invalid boolean value: %s. should be either true or false", s)
+			}
+		}
+	}
+	return val, nil
+}
+
+// DSNFromURL converts a sqlite://path url into the file name expected by the sqlite driver
+func DSNFromURL(urlstr string) string {
+	for _, prefix := range []string{"sqlite://", "sqlite:"} {
+		if strings.HasPrefix(urlstr, prefix) {
+			return urlstr[len(prefix):]
+		}
+	}
+	return urlstr
+}
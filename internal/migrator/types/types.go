@@ -1,9 +1,15 @@
 package types
 
 type TableDetail struct {
-	Columns     []ColumnDetail
-	Constraints []ConstraintDetail
-	Description *string
+	Columns           []ColumnDetail
+	Constraints       []ConstraintDetail
+	Indexes           []IndexDetail
+	ForeignKeys       []ForeignKeyDetail
+	PrimaryKey        []string
+	UniqueConstraints []UniqueConstraintDetail
+	Checks            []CheckConstraintDetail
+	Description       *string
+	Namespace         string // the schema (namespace) of the table, empty for the default
 }
 
 type ColumnDetail struct {
@@ -16,6 +22,7 @@ type ColumnDetail struct {
 	NumericPrecision   *int64
 	NumericScale       *int64
 	Description        *string
+	Enum               *string // the name of the enum type for the column
 	IsNullable         bool
 	IsPrimaryKey       bool
 	IsUnique           bool
@@ -28,3 +35,39 @@ type ConstraintDetail struct {
 	Type   string
 	Column string
 }
+
+type IndexDetail struct {
+	Name       string
+	Columns    []IndexColumnDetail
+	Expression *string
+	Where      *string
+	Method     *string
+	IsUnique   bool
+}
+
+type IndexColumnDetail struct {
+	Name         string
+	IsDescending bool
+}
+
+type ForeignKeyDetail struct {
+	Name            string
+	Column          string
+	ReferenceTable  string
+	ReferenceColumn string
+	OnDelete        *string
+	OnUpdate        *string
+	IsDeferrable    bool
+}
+
+type UniqueConstraintDetail struct {
+	Name    string
+	Columns []string
+}
+
+type CheckConstraintDetail struct {
+	Name       string
+	Expression string
+	Column     string // the column the check is defined on when it only references a single column
+	IsNotValid bool
+}
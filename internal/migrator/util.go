@@ -14,6 +14,7 @@ import (
 )
 
 var infoTablesQuery = `SELECT
+	table_schema,
 	table_name,
 	column_name,
 	ordinal_position,
@@ -27,39 +28,43 @@ var infoTablesQuery = `SELECT
 FROM
 	information_schema.columns
 WHERE
-	table_name IN (
+	(table_schema, table_name) IN (
 		SELECT
+			table_schema,
 			table_name
 		FROM
 			information_schema.tables
 		WHERE
 			table_type = '%s'
 			AND table_schema NOT IN (%s)
-			AND table_catalog = %s
+			AND table_catalog = %s%s
 	)
-ORDER BY table_name, ordinal_position`
+ORDER BY table_schema, table_name, ordinal_position`
 
+// check constraints are left out since they aren't tied to key columns, each driver reads them with their expression
 var infoConstraintsQuery = `SELECT
 	tc.constraint_name,
+	tc.table_schema,
 	tc.table_name,
-	c.column_name,
+	kcu.column_name,
 	tc.constraint_type
 FROM
 	information_schema.table_constraints tc
-JOIN information_schema.constraint_column_usage AS ccu USING (constraint_schema, constraint_name) 
-JOIN information_schema.columns AS c ON c.table_schema = tc.constraint_schema
-  AND tc.table_name = c.table_name AND ccu.column_name = c.column_name
+JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema
+  AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name
 WHERE
 	tc.table_schema NOT IN (%s)
-	AND tc.table_catalog = %s
+	AND tc.table_catalog = %s%s
 	AND tc.constraint_type != 'CHECK'
-ORDER BY tc.table_name`
+ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position`
 
 type infoQueryConfig struct {
 	extraSchemaExcludes  []string
 	tableTypeOverride    string
 	tableCatalogOverride string
 	filterTables         []string
+	tableSchemas         []string
+	defaultTableSchema   string
 }
 
 type WithOption func(config *infoQueryConfig)
@@ -67,6 +72,7 @@ type WithOption func(config *infoQueryConfig)
 var defaultTableExcludes = []string{"pg_catalog", "information_schema"}
 var defaultBaseTableTable = "BASE TABLE"
 var defaultTableCatalog = "current_database()"
+var defaultTableSchema = "public"
 
 func singleQuote(val string) string {
 	return `'` + val + `'`
@@ -80,6 +86,14 @@ func mapSingleQuote(val []string) []string {
 	return res
 }
 
+// tableSchemasPredicate returns the predicate for limiting the table_schema to the configured schemas if any
+func tableSchemasPredicate(column string, config *infoQueryConfig) string {
+	if len(config.tableSchemas) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s IN (%s)", column, strings.Join(mapSingleQuote(config.tableSchemas), ","))
+}
+
 func generateInfoTableQuery(config *infoQueryConfig) string {
 	excludes := append(append([]string{}, defaultTableExcludes...), config.extraSchemaExcludes...)
 	tableCatalog := defaultTableCatalog
@@ -93,7 +107,7 @@ func generateInfoTableQuery(config *infoQueryConfig) string {
 			tableCatalog = singleQuote(tableCatalog)
 		}
 	}
-	return util.CleanSQL(fmt.Sprintf(infoTablesQuery, override, strings.Join(mapSingleQuote(excludes), ","), tableCatalog))
+	return util.CleanSQL(fmt.Sprintf(infoTablesQuery, override, strings.Join(mapSingleQuote(excludes), ","), tableCatalog, tableSchemasPredicate("table_schema", config)))
 }
 
 func generateInfoTableConstraintsQuery(config *infoQueryConfig) string {
@@ -105,14 +119,23 @@ func generateInfoTableConstraintsQuery(config *infoQueryConfig) string {
 			tableCatalog = singleQuote(tableCatalog)
 		}
 	}
-	return util.CleanSQL(fmt.Sprintf(infoConstraintsQuery, strings.Join(mapSingleQuote(excludes), ","), tableCatalog))
+	return util.CleanSQL(fmt.Sprintf(infoConstraintsQuery, strings.Join(mapSingleQuote(excludes), ","), tableCatalog, tableSchemasPredicate("tc.table_schema", config)))
 }
 
 func generateDefaultInfoQueryConfig() *infoQueryConfig {
 	var config infoQueryConfig
+	config.defaultTableSchema = defaultTableSchema
 	return &config
 }
 
+// tableKey returns the key for a table which is qualified by the table schema unless it's the default schema
+func (config *infoQueryConfig) tableKey(tableSchema string, tableName string) (string, string) {
+	if tableSchema == config.defaultTableSchema {
+		return tableName, ""
+	}
+	return schema.QualifiedName(tableSchema, tableName), tableSchema
+}
+
 // WithTableCatalog allows settings an override for the table_catalog predicate which defaults to current_database()
 func WithTableCatalog(val string) WithOption {
 	return func(config *infoQueryConfig) {
@@ -134,6 +157,21 @@ func WithTableSchemaExcludes(tables []string) WithOption {
 	}
 }
 
+// WithTableSchemas allows limiting the table_schema predicate to specific table schemas
+func WithTableSchemas(schemas []string) WithOption {
+	return func(config *infoQueryConfig) {
+		config.tableSchemas = schemas
+	}
+}
+
+// WithDefaultTableSchema allows setting an override for the table schema which defaults to public. The tables in the
+// default schema are returned by their name and the tables in any other schema by their qualified name.
+func WithDefaultTableSchema(val string) WithOption {
+	return func(config *infoQueryConfig) {
+		config.defaultTableSchema = val
+	}
+}
+
 // WithTableFilter allows filtering for specific tables
 func WithTableFilter(tables []string) WithOption {
 	return func(config *infoQueryConfig) {
@@ -142,7 +180,7 @@ func WithTableFilter(tables []string) WithOption {
 }
 
 // GenerateInfoTables is a utility for generating generic tables from an database that supports the information_schema standard
-func GenerateInfoTables(ctx context.Context, logger logger.Logger, db *sql.DB, opts ...WithOption) (map[string]*types.TableDetail, error) {
+func GenerateInfoTables(ctx context.Context, logger logger.Logger, db Queryer, opts ...WithOption) (map[string]*types.TableDetail, error) {
 	config := generateDefaultInfoQueryConfig()
 	for _, opt := range opts {
 		opt(config)
@@ -157,23 +195,28 @@ func GenerateInfoTables(ctx context.Context, logger logger.Logger, db *sql.DB, o
 	if res != nil {
 		defer res.Close()
 		for res.Next() {
-			var tableName, columnName, dataType, nullable, udtName string
+			var tableSchema, tableName, columnName, dataType, nullable, udtName string
 			var columnDefault sql.NullString
 			var maxLength, numericPrecision, numericScale sql.NullInt64
 			var ordinal int64
-			if err := res.Scan(&tableName, &columnName, &ordinal, &columnDefault, &nullable, &dataType, &maxLength, &numericPrecision, &numericScale, &udtName); err != nil {
+			if err := res.Scan(&tableSchema, &tableName, &columnName, &ordinal, &columnDefault, &nullable, &dataType, &maxLength, &numericPrecision, &numericScale, &udtName); err != nil {
 				return nil, err
 			}
-			if len(config.filterTables) > 0 && !util.Contains(config.filterTables, tableName) {
+			key, namespace := config.tableKey(tableSchema, tableName)
+			if IsShiftTable(key) {
+				continue // skip the tables managed by shift
+			}
+			if len(config.filterTables) > 0 && !util.Contains(config.filterTables, tableName) && !util.Contains(config.filterTables, key) {
 				continue // skip if we're filtering tables
 			}
-			table := tables[tableName]
+			table := tables[key]
 			if table == nil {
 				table = &types.TableDetail{
 					Columns:     make([]types.ColumnDetail, 0),
 					Constraints: make([]types.ConstraintDetail, 0),
+					Namespace:   namespace,
 				}
-				tables[tableName] = table
+				tables[key] = table
 			}
 			var detail types.ColumnDetail
 			detail.Name = columnName
@@ -206,11 +249,12 @@ func GenerateInfoTables(ctx context.Context, logger logger.Logger, db *sql.DB, o
 		if cres != nil {
 			defer cres.Close()
 			for cres.Next() {
-				var name, tablename, column, ctype string
-				if err := cres.Scan(&name, &tablename, &column, &ctype); err != nil {
+				var name, tableSchema, tableName, column, ctype string
+				if err := cres.Scan(&name, &tableSchema, &tableName, &column, &ctype); err != nil {
 					return nil, err
 				}
-				table := tables[tablename]
+				key, _ := config.tableKey(tableSchema, tableName)
+				table := tables[key]
 				if table != nil {
 					table.Constraints = append(table.Constraints, types.ConstraintDetail{
 						Name:   name,
@@ -231,9 +275,63 @@ type TableGenerator interface {
 	QuoteDefaultValue(val string, column types.ColumnDetail) string
 	GenerateTableComment(table string, val string) string
 	GenerateColumnComment(table string, column string, val string) string
+	GenerateColumnType(column types.ColumnDetail) string
+	GenerateColumnAttributes(column types.ColumnDetail) []string
+	GenerateAlterColumn(table string, column types.ColumnDetail, changes []MigrateColumnChangeTypeType) []string
+	GenerateDropColumn(table string, column string) string
+	GenerateRenameColumn(table string, column string, name string) string
+	GenerateDropTable(table string) string
+	GenerateRenameTable(table string, name string) string
+	GenerateCreateIndex(table string, index types.IndexDetail) string
+	GenerateDropIndex(table string, index string) string
+	GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string
+	GenerateDropForeignKey(table string, name string) string
+	GenerateAddPrimaryKey(table string, columns []string) string
+	GenerateDropPrimaryKey(table string) string
+	GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string
+	GenerateDropUniqueConstraint(table string, name string) string
+	GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string
+	GenerateDropCheckConstraint(table string, name string) string
+	GenerateCreateEnum(name string, values []string) string
+	GenerateAddEnumValue(name string, value MigrateEnumValue) string
+	GenerateDropEnum(name string) string
 	ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType
 }
 
+// TableRebuilder is implemented by a TableGenerator for databases which cannot alter a column in place. The table is
+// instead recreated with the new definition and the data for the columns provided is copied over from the old table.
+type TableRebuilder interface {
+	GenerateRebuildTable(table string, detail types.TableDetail, columns []string) []string
+}
+
+// NamespaceGenerator is implemented by a TableGenerator for databases which support more than one schema (namespace)
+// of tables within a database
+type NamespaceGenerator interface {
+	GenerateCreateNamespace(name string) string
+}
+
+// OnlineGenerator is implemented by a TableGenerator for databases which can alter a table that's in use without
+// holding locks which block reads or writes for long. Online returns the generator of those statements which are
+// used for the tables which already exist.
+type OnlineGenerator interface {
+	Online() TableGenerator
+}
+
+// ColumnSwapper is implemented by an online TableGenerator which changes the type of a column by adding a column of
+// the new type, copying the data over while keeping it in sync and swapping it for the column instead of rewriting the
+// table in place. The column can't be used by a key, index or constraint since they would be dropped with it.
+type ColumnSwapper interface {
+	GenerateSwapColumn(table string, column types.ColumnDetail) []string
+}
+
+// PreflightGenerator is implemented by a TableGenerator which can check whether the existing rows of a table satisfy
+// the new definition of a column before it's changed. GenerateInvalidCast returns the condition which is true for the
+// values of the column which can't be converted to the new type, or an empty string if they can't be checked.
+type PreflightGenerator interface {
+	GenerateLength(column string) string
+	GenerateInvalidCast(column string, to types.ColumnDetail) string
+}
+
 var generators = make(map[string]TableGenerator)
 
 func RegisterGenerator(protocol string, generator TableGenerator) {
@@ -244,16 +342,12 @@ func GetGenerator(protocol string) TableGenerator {
 	return generators[protocol]
 }
 
-func GenerateColumnStatement(column types.ColumnDetail, generator TableGenerator, unique []string) string {
+func GenerateColumnStatement(column types.ColumnDetail, generator TableGenerator) string {
 	var sql strings.Builder
 	sql.WriteString(generator.QuoteColumn(column.Name))
 	sql.WriteString(" ")
 	var attrs []string
-	if column.IsAutoIncrementing {
-		sql.WriteString("SERIAL")
-	} else {
-		sql.WriteString(column.UDTName)
-	}
+	sql.WriteString(generator.GenerateColumnType(column))
 	if !column.IsNullable && column.Default == nil {
 		attrs = append(attrs, "NOT NULL")
 	}
@@ -261,12 +355,13 @@ func GenerateColumnStatement(column types.ColumnDetail, generator TableGenerator
 		val := generator.QuoteDefaultValue(*column.Default, column)
 		attrs = append(attrs, "DEFAULT "+val)
 	}
-	if column.IsUnique && len(unique) <= 1 {
+	if column.IsUnique {
 		attrs = append(attrs, "UNIQUE")
 	}
 	if column.IsPrimaryKey {
 		attrs = append(attrs, "PRIMARY KEY")
 	}
+	attrs = append(attrs, generator.GenerateColumnAttributes(column)...)
 	if len(attrs) > 0 {
 		sql.WriteString(" ")
 		sql.WriteString(strings.Join(attrs, " "))
@@ -274,14 +369,38 @@ func GenerateColumnStatement(column types.ColumnDetail, generator TableGenerator
 	return sql.String()
 }
 
-func GetTableUniques(table types.TableDetail) []string {
-	var unique []string
+// GetTablePrimaryKey returns the ordered columns which make up the primary key for the table which is either the
+// table PrimaryKey or the columns marked as a primary key
+func GetTablePrimaryKey(table types.TableDetail) []string {
+	if len(table.PrimaryKey) > 0 {
+		return table.PrimaryKey
+	}
+	var primaryKey []string
 	for _, column := range table.Columns {
-		if column.IsUnique {
-			unique = append(unique, column.Name)
+		if column.IsPrimaryKey {
+			primaryKey = append(primaryKey, column.Name)
 		}
 	}
-	return unique
+	return primaryKey
+}
+
+// GenerateColumnList returns the quoted columns separated by a comma
+func GenerateColumnList(columns []string, generator TableGenerator) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = generator.QuoteColumn(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// GenerateUniqueConstraint returns the constraint definition for a unique constraint
+func GenerateUniqueConstraint(unique types.UniqueConstraintDetail, generator TableGenerator) string {
+	return fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", generator.QuoteColumn(unique.Name), GenerateColumnList(unique.Columns, generator))
+}
+
+// GenerateCheckConstraint returns the constraint definition for a check constraint
+func GenerateCheckConstraint(check types.CheckConstraintDetail, generator TableGenerator) string {
+	return fmt.Sprintf("CONSTRAINT %s CHECK (%s)", generator.QuoteColumn(check.Name), check.Expression)
 }
 
 func GenerateCreateStatement(name string, table types.TableDetail, generator TableGenerator) string {
@@ -289,30 +408,110 @@ func GenerateCreateStatement(name string, table types.TableDetail, generator Tab
 	sql.WriteString("CREATE TABLE IF NOT EXISTS ")
 	sql.WriteString(generator.QuoteTable(name))
 	sql.WriteString(" (\n")
-	uniques := GetTableUniques(table)
-	for i, column := range table.Columns {
-		sql.WriteString("   ")
-		sql.WriteString(GenerateColumnStatement(column, generator, uniques))
-		if i+1 < len(table.Columns) || len(uniques) > 1 {
-			sql.WriteString(",\n")
-		} else {
-			sql.WriteString("\n")
-		}
+	primaryKey := GetTablePrimaryKey(table)
+	var lines []string
+	for _, column := range table.Columns {
+		// a single column primary key is defined inline since some databases require it for auto incrementing columns
+		column.IsPrimaryKey = len(primaryKey) == 1 && primaryKey[0] == column.Name
+		lines = append(lines, "   "+GenerateColumnStatement(column, generator))
+	}
+	if len(primaryKey) > 1 {
+		lines = append(lines, fmt.Sprintf("   PRIMARY KEY (%s)", GenerateColumnList(primaryKey, generator)))
 	}
-	if len(uniques) > 1 {
-		sql.WriteString(fmt.Sprintf("\tUNIQUE (%s)\n", strings.Join(uniques, ",")))
+	for _, unique := range table.UniqueConstraints {
+		lines = append(lines, "   "+GenerateUniqueConstraint(unique, generator))
 	}
-	sql.WriteString(");\n")
+	for _, check := range table.Checks {
+		lines = append(lines, "   "+GenerateCheckConstraint(check, generator))
+	}
+	if InlineForeignKeys(generator) {
+		for _, fk := range table.ForeignKeys {
+			lines = append(lines, "   "+GenerateForeignKeyConstraint(fk, generator))
+		}
+	}
+	sql.WriteString(strings.Join(lines, ",\n"))
+	sql.WriteString("\n);\n")
 	if table.Description != nil {
-		sql.WriteString(generator.GenerateTableComment(name, *table.Description))
-		sql.WriteString("\n")
+		if comment := generator.GenerateTableComment(name, *table.Description); comment != "" {
+			sql.WriteString(comment)
+			sql.WriteString("\n")
+		}
 	}
 	for _, column := range table.Columns {
 		if column.Description != nil {
-			sql.WriteString(generator.GenerateColumnComment(name, column.Name, *column.Description))
-			sql.WriteString("\n")
+			// some databases only support column comments inline with the column definition
+			if comment := generator.GenerateColumnComment(name, column.Name, *column.Description); comment != "" {
+				sql.WriteString(comment)
+				sql.WriteString("\n")
+			}
+		}
+	}
+	for _, index := range table.Indexes {
+		sql.WriteString(generator.GenerateCreateIndex(name, index))
+		sql.WriteString("\n")
+	}
+	return sql.String()
+}
+
+// GenerateIndexKeys returns the key part of an index definition which is either the expression or the ordered columns
+func GenerateIndexKeys(index types.IndexDetail, generator TableGenerator) string {
+	if index.Expression != nil && *index.Expression != "" {
+		return *index.Expression
+	}
+	columns := make([]string, len(index.Columns))
+	for i, column := range index.Columns {
+		columns[i] = generator.QuoteColumn(column.Name)
+		if column.IsDescending {
+			columns[i] += " DESC"
 		}
 	}
+	return strings.Join(columns, ", ")
+}
+
+// InlineForeignKeys returns true if the foreign keys must be defined as part of the CREATE TABLE statement. Databases
+// which rebuild tables to alter them can't add a constraint to an existing table.
+func InlineForeignKeys(generator TableGenerator) bool {
+	_, ok := generator.(TableRebuilder)
+	return ok
+}
+
+// GenerateForeignKeyConstraint returns the constraint definition for a foreign key
+func GenerateForeignKeyConstraint(fk types.ForeignKeyDetail, generator TableGenerator) string {
+	var sql strings.Builder
+	sql.WriteString("CONSTRAINT ")
+	sql.WriteString(generator.QuoteColumn(fk.Name))
+	sql.WriteString(" FOREIGN KEY (")
+	sql.WriteString(generator.QuoteColumn(fk.Column))
+	sql.WriteString(") REFERENCES ")
+	sql.WriteString(generator.QuoteTable(fk.ReferenceTable))
+	sql.WriteString(" (")
+	sql.WriteString(generator.QuoteColumn(fk.ReferenceColumn))
+	sql.WriteString(")")
+	if fk.OnDelete != nil && *fk.OnDelete != "" {
+		sql.WriteString(" ON DELETE ")
+		sql.WriteString(strings.ToUpper(*fk.OnDelete))
+	}
+	if fk.OnUpdate != nil && *fk.OnUpdate != "" {
+		sql.WriteString(" ON UPDATE ")
+		sql.WriteString(strings.ToUpper(*fk.OnUpdate))
+	}
+	if fk.IsDeferrable {
+		sql.WriteString(" DEFERRABLE INITIALLY DEFERRED")
+	}
+	return sql.String()
+}
+
+// GenerateAddForeignKeys returns the statements to add the foreign keys for a table once all the tables have been
+// created, unless the generator requires them to be defined inline with the table
+func GenerateAddForeignKeys(name string, table types.TableDetail, generator TableGenerator) string {
+	if InlineForeignKeys(generator) {
+		return ""
+	}
+	var sql strings.Builder
+	for _, fk := range table.ForeignKeys {
+		sql.WriteString(generator.GenerateAddForeignKey(name, fk))
+		sql.WriteString("\n")
+	}
 	return sql.String()
 }
 
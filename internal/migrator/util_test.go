@@ -19,7 +19,7 @@ func TestGenerateDefaultNoRows(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -33,7 +33,7 @@ func TestGenerateDefaultNoRowsError(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnError(sql.ErrNoRows)
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -47,7 +47,7 @@ func TestGenerateWithTableCatalog(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = 'catalog' \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = 'catalog' \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableCatalog("catalog"))
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -61,7 +61,7 @@ func TestGenerateWithTableCatalogAsFunctions(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = catalog\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = catalog\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableCatalog("catalog()"))
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -75,7 +75,7 @@ func TestGenerateWithTableType(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'type' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'type' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableType("type"))
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -89,7 +89,7 @@ func TestGenerateWithTableSchemaExcludes(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema','table'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema','table'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{}))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableSchemaExcludes([]string{"table"}))
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -103,8 +103,8 @@ func TestGenerateSingleTable(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("table", "column", int64(1), nil, "NO", "text", nil, nil, nil, "text"))
-	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_name, c.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.constraint_column_usage AS ccu USING \\(constraint_schema, constraint_name\\) JOIN information_schema.columns AS c ON c.table_schema = tc.constraint_schema AND tc.table_name = c.table_name AND ccu.column_name = c.column_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_name").WithoutArgs().WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "table", "column", int64(1), nil, "NO", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_schema, tc.table_name, kcu.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position").WithoutArgs().WillReturnError(sql.ErrNoRows)
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -129,8 +129,8 @@ func TestGenerateSingleTableWithNullable(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("table", "column", int64(1), nil, "YES", "text", nil, nil, nil, "text"))
-	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_name, c.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.constraint_column_usage AS ccu USING \\(constraint_schema, constraint_name\\) JOIN information_schema.columns AS c ON c.table_schema = tc.constraint_schema AND tc.table_name = c.table_name AND ccu.column_name = c.column_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_name").WithoutArgs().WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "table", "column", int64(1), nil, "YES", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_schema, tc.table_name, kcu.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position").WithoutArgs().WillReturnError(sql.ErrNoRows)
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -155,8 +155,8 @@ func TestGenerateSingleTableWithDefault(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("table", "column", int64(1), util.Ptr("default"), "YES", "text", nil, nil, nil, "text"))
-	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_name, c.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.constraint_column_usage AS ccu USING \\(constraint_schema, constraint_name\\) JOIN information_schema.columns AS c ON c.table_schema = tc.constraint_schema AND tc.table_name = c.table_name AND ccu.column_name = c.column_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_name").WithoutArgs().WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "table", "column", int64(1), util.Ptr("default"), "YES", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_schema, tc.table_name, kcu.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position").WithoutArgs().WillReturnError(sql.ErrNoRows)
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -182,8 +182,8 @@ func TestGenerateSingleTableWithPrimaryKey(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("table", "column", int64(1), util.Ptr("default"), "YES", "text", nil, nil, nil, "text"))
-	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_name, c.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.constraint_column_usage AS ccu USING \\(constraint_schema, constraint_name\\) JOIN information_schema.columns AS c ON c.table_schema = tc.constraint_schema AND tc.table_name = c.table_name AND ccu.column_name = c.column_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_name").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "table_name", "column_name", "constraint_type"}).AddRow("table_pk", "table", "column", "PRIMARY KEY"))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "table", "column", int64(1), util.Ptr("default"), "YES", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_schema, tc.table_name, kcu.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "table_schema", "table_name", "column_name", "constraint_type"}).AddRow("table_pk", "public", "table", "column", "PRIMARY KEY"))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db)
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -246,6 +246,86 @@ func (g *noOpGenerator) GenerateColumnComment(table string, column string, val s
 	return fmt.Sprintf("COMMENT ON COLUMN %s.%s IS '%s';", table, column, val)
 }
 
+func (g *noOpGenerator) GenerateColumnType(column types.ColumnDetail) string {
+	return column.UDTName
+}
+
+func (g *noOpGenerator) GenerateColumnAttributes(column types.ColumnDetail) []string {
+	return nil
+}
+
+func (g *noOpGenerator) GenerateAlterColumn(table string, column types.ColumnDetail, changes []MigrateColumnChangeTypeType) []string {
+	return nil
+}
+
+func (g *noOpGenerator) GenerateDropColumn(table string, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, column)
+}
+
+func (g *noOpGenerator) GenerateRenameColumn(table string, column string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", table, column, name)
+}
+
+func (g *noOpGenerator) GenerateDropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE %s;", table)
+}
+
+func (g *noOpGenerator) GenerateRenameTable(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", table, name)
+}
+
+func (g *noOpGenerator) GenerateCreateIndex(table string, index types.IndexDetail) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s);", index.Name, table, GenerateIndexKeys(index, g))
+}
+
+func (g *noOpGenerator) GenerateDropIndex(table string, index string) string {
+	return fmt.Sprintf("DROP INDEX %s;", index)
+}
+
+func (g *noOpGenerator) GenerateAddForeignKey(table string, fk types.ForeignKeyDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", table, GenerateForeignKeyConstraint(fk, g))
+}
+
+func (g *noOpGenerator) GenerateDropForeignKey(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", table, name)
+}
+
+func (g *noOpGenerator) GenerateAddPrimaryKey(table string, columns []string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", table, GenerateColumnList(columns, g))
+}
+
+func (g *noOpGenerator) GenerateDropPrimaryKey(table string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY;", table)
+}
+
+func (g *noOpGenerator) GenerateAddUniqueConstraint(table string, unique types.UniqueConstraintDetail) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", table, GenerateUniqueConstraint(unique, g))
+}
+
+func (g *noOpGenerator) GenerateDropUniqueConstraint(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", table, name)
+}
+
+func (g *noOpGenerator) GenerateAddCheckConstraint(table string, check types.CheckConstraintDetail) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s;", table, GenerateCheckConstraint(check, g))}
+}
+
+func (g *noOpGenerator) GenerateDropCheckConstraint(table string, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", table, name)
+}
+
+func (g *noOpGenerator) GenerateCreateEnum(name string, values []string) string {
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s);", name, strings.Join(values, ", "))
+}
+
+func (g *noOpGenerator) GenerateAddEnumValue(name string, value MigrateEnumValue) string {
+	return fmt.Sprintf("ALTER TYPE %s ADD VALUE %s;", name, value.Value)
+}
+
+func (g *noOpGenerator) GenerateDropEnum(name string) string {
+	return fmt.Sprintf("DROP TYPE %s;", name)
+}
+
 func (g *noOpGenerator) ToNativeType(column schema.SchemaJsonTablesElemColumnsElem) *schema.SchemaJsonTablesElemColumnsElemNativeType {
 	return nil
 }
@@ -344,14 +424,107 @@ func TestGenerateCreateStatementWithCompoundUnique(t *testing.T) {
 	}, &noOpGenerator{})
 	assert.NotEmpty(t, res)
 	res = util.CleanSQL(res)
-	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL PRIMARY KEY, b varchar(255) NOT NULL, c varchar(255) NOT NULL, UNIQUE (b,c) );`, res)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL PRIMARY KEY, b varchar(255) NOT NULL UNIQUE, c varchar(255) NOT NULL UNIQUE );`, res)
+}
+
+func TestGenerateCreateStatementWithUniqueConstraints(t *testing.T) {
+	res := GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)", IsPrimaryKey: true},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)"},
+			{Name: "c", DataType: "string", UDTName: "varchar(255)"},
+		},
+		UniqueConstraints: []types.UniqueConstraintDetail{
+			{Name: "test_b_c_key", Columns: []string{"b", "c"}},
+			{Name: "test_c_key", Columns: []string{"c"}},
+		},
+	}, &noOpGenerator{})
+	assert.NotEmpty(t, res)
+	res = util.CleanSQL(res)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL PRIMARY KEY, b varchar(255) NOT NULL, c varchar(255) NOT NULL, CONSTRAINT test_b_c_key UNIQUE (b, c), CONSTRAINT test_c_key UNIQUE (c) );`, res)
+}
+
+func TestGenerateCreateStatementWithChecks(t *testing.T) {
+	res := GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "int", UDTName: "integer", IsPrimaryKey: true},
+			{Name: "b", DataType: "int", UDTName: "integer"},
+		},
+		Checks: []types.CheckConstraintDetail{
+			{Name: "test_a_check", Expression: "a > 0"},
+			{Name: "test_a_b_check", Expression: "a < b", IsNotValid: true},
+		},
+	}, &noOpGenerator{})
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a integer NOT NULL PRIMARY KEY, b integer NOT NULL, CONSTRAINT test_a_check CHECK (a > 0), CONSTRAINT test_a_b_check CHECK (a < b) );`, util.CleanSQL(res))
+}
+
+func TestGenerateCreateStatementWithCompositePrimaryKey(t *testing.T) {
+	res := GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)", IsPrimaryKey: true},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)", IsPrimaryKey: true},
+			{Name: "c", DataType: "string", UDTName: "varchar(255)"},
+		},
+	}, &noOpGenerator{})
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL, b varchar(255) NOT NULL, c varchar(255) NOT NULL, PRIMARY KEY (a, b) );`, util.CleanSQL(res))
+
+	// the table primary key takes precedence and sets the order of the columns
+	res = GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)"},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)"},
+		},
+		PrimaryKey: []string{"b", "a"},
+	}, &noOpGenerator{})
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL, b varchar(255) NOT NULL, PRIMARY KEY (b, a) );`, util.CleanSQL(res))
+
+	res = GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)"},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)"},
+		},
+		PrimaryKey: []string{"b"},
+	}, &noOpGenerator{})
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL, b varchar(255) NOT NULL PRIMARY KEY );`, util.CleanSQL(res))
+}
+
+func TestGenerateCreateStatementWithIndexes(t *testing.T) {
+	res := GenerateCreateStatement("test", types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)", IsPrimaryKey: true},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)"},
+		},
+		Indexes: []types.IndexDetail{
+			{Name: "test_a_b_idx", Columns: []types.IndexColumnDetail{{Name: "a"}, {Name: "b", IsDescending: true}}},
+			{Name: "test_lower_b_idx", Expression: util.Ptr("lower(b)")},
+		},
+	}, &noOpGenerator{})
+	assert.NotEmpty(t, res)
+	res = util.CleanSQL(res)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL PRIMARY KEY, b varchar(255) NOT NULL ); CREATE INDEX test_a_b_idx ON test (a, b DESC); CREATE INDEX test_lower_b_idx ON test (lower(b));`, res)
+}
+
+func TestGenerateAddForeignKeys(t *testing.T) {
+	table := types.TableDetail{
+		Columns: []types.ColumnDetail{
+			{Name: "a", DataType: "string", UDTName: "varchar(255)", IsPrimaryKey: true},
+			{Name: "b", DataType: "string", UDTName: "varchar(255)"},
+		},
+		ForeignKeys: []types.ForeignKeyDetail{
+			{Name: "test_b_fkey", Column: "b", ReferenceTable: "other", ReferenceColumn: "id", OnDelete: util.Ptr("cascade"), OnUpdate: util.Ptr("set null"), IsDeferrable: true},
+		},
+	}
+	res := util.CleanSQL(GenerateCreateStatement("test", table, &noOpGenerator{}))
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS test ( a varchar(255) NOT NULL PRIMARY KEY, b varchar(255) NOT NULL );`, res)
+	res = GenerateAddForeignKeys("test", table, &noOpGenerator{})
+	assert.Equal(t, "ALTER TABLE test ADD CONSTRAINT test_b_fkey FOREIGN KEY (b) REFERENCES other (id) ON DELETE CASCADE ON UPDATE SET NULL DEFERRABLE INITIALLY DEFERRED;\n", res)
 }
 
 func TestGenerateSingleTableWithTableFilter(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
-	mock.ExpectQuery("SELECT table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name IN \\( SELECT table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("table", "column", int64(1), nil, "YES", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "table", "column", int64(1), nil, "YES", "text", nil, nil, nil, "text"))
 	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableFilter([]string{"foo"}))
 	assert.NoError(t, err)
 	assert.NotNil(t, res)
@@ -360,3 +533,29 @@ func TestGenerateSingleTableWithTableFilter(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGenerateWithTableSchemas(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT table_schema, table_name, column_name, ordinal_position, column_default, is_nullable, data_type, character_maximum_length, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE \\(table_schema, table_name\\) IN \\( SELECT table_schema, table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN \\('pg_catalog','information_schema'\\) AND table_catalog = current_database\\(\\) AND table_schema IN \\('public','sales'\\) \\) ORDER BY table_schema, table_name, ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "orders", "id", int64(1), nil, "NO", "text", nil, nil, nil, "text").AddRow("sales", "orders", "id", int64(1), nil, "NO", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name, tc.table_schema, tc.table_name, kcu.column_name, tc.constraint_type FROM information_schema.table_constraints tc JOIN information_schema.key_column_usage AS kcu ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema AND kcu.table_name = tc.table_name WHERE tc.table_schema NOT IN \\('pg_catalog','information_schema'\\) AND tc.table_catalog = current_database\\(\\) AND tc.table_schema IN \\('public','sales'\\) AND tc.constraint_type != 'CHECK' ORDER BY tc.table_schema, tc.table_name, tc.constraint_name, kcu.ordinal_position").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "table_schema", "table_name", "column_name", "constraint_type"}).AddRow("orders_pkey", "sales", "orders", "id", "PRIMARY KEY"))
+	res, err := GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableSchemas([]string{"public", "sales"}))
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "", res["orders"].Namespace)
+	assert.Empty(t, res["orders"].Constraints)
+	assert.Equal(t, "sales", res["sales.orders"].Namespace)
+	assert.Len(t, res["sales.orders"].Constraints, 1)
+	assert.Equal(t, "orders_pkey", res["sales.orders"].Constraints[0].Name)
+
+	mock.ExpectQuery("SELECT table_schema, table_name").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name", "column_name", "ordinal_position", "column_default", "is_nullable", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "udt_name"}).AddRow("public", "orders", "id", int64(1), nil, "NO", "text", nil, nil, nil, "text").AddRow("sales", "orders", "id", int64(1), nil, "NO", "text", nil, nil, nil, "text"))
+	mock.ExpectQuery("SELECT tc.constraint_name").WithoutArgs().WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "table_schema", "table_name", "column_name", "constraint_type"}))
+	res, err = GenerateInfoTables(context.Background(), logger.NewTestLogger(), db, WithTableSchemas([]string{"public", "sales"}), WithTableFilter([]string{"sales.orders"}))
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.NotNil(t, res["sales.orders"])
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,34 @@
+package migrator
+
+import "fmt"
+
+// VerifyResult is the outcome of applying a migration inside a transaction which was rolled back
+type VerifyResult struct {
+	Errors    []*StatementError // the statements which failed
+	Remaining []MigrateChanges  // the differences between the target schema and the schema within the transaction
+}
+
+// OK returns true if every statement was applied and the schema within the transaction matched the target schema
+func (r *VerifyResult) OK() bool {
+	return len(r.Errors) == 0 && len(r.Remaining) == 0
+}
+
+// Verifier is implemented by the migrators for the databases which can execute DDL inside a transaction
+type Verifier interface {
+	// Verify applies the changes inside a transaction, reads the schema within it and compares it to the target schema.
+	// The transaction is always rolled back.
+	Verify(args MigratorArgs) (*VerifyResult, error)
+}
+
+// Verify applies the migration inside a transaction which is always rolled back and reports whether it would succeed
+func Verify(protocol string, args MigratorArgs) (*VerifyResult, error) {
+	migrator := migrators[protocol]
+	if migrator == nil {
+		return nil, fmt.Errorf("protocol: %s not supported", protocol)
+	}
+	verifier, ok := migrator.(Verifier)
+	if !ok {
+		return nil, fmt.Errorf("verifying isn't supported for %s", protocol)
+	}
+	return verifier.Verify(args)
+}
@@ -3,6 +3,8 @@ package schema
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/jhaynie/shift/internal/migrator/types"
 	"github.com/jhaynie/shift/internal/util"
@@ -79,9 +81,20 @@ func GenerateSchemaJsonFromInfoTables(logger logger.Logger, driver DatabaseDrive
 	schemaJson.Version = DefaultVersion
 	schemaJson.Database.Url = "${DATABASE_URL}"
 	schemaJson.Tables = make([]SchemaJsonTablesElem, 0)
-	for table, detail := range tables {
+	// the tables are sorted by name so the schema generated is the same each time
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	for _, table := range names {
+		detail := tables[table]
 		var elem SchemaJsonTablesElem
 		elem.Name = table
+		if detail.Namespace != "" {
+			elem.Schema = util.Ptr(detail.Namespace)
+			elem.Name = strings.TrimPrefix(table, detail.Namespace+".")
+		}
 		elem.Description = detail.Description
 		elem.Columns = make([]SchemaJsonTablesElemColumnsElem, len(detail.Columns))
 		for i, column := range detail.Columns {
@@ -95,6 +108,7 @@ func GenerateSchemaJsonFromInfoTables(logger logger.Logger, driver DatabaseDrive
 				AutoIncrement: util.Ptr(column.IsAutoIncrementing),
 				PrimaryKey:    util.Ptr(column.IsPrimaryKey),
 				IsArray:       column.IsArray,
+				Enum:          column.Enum,
 			}
 			if column.MaxLength != nil && *column.MaxLength > 0 {
 				col.MaxLength = util.Ptr(int(*column.MaxLength))
@@ -109,11 +123,74 @@ func GenerateSchemaJsonFromInfoTables(logger logger.Logger, driver DatabaseDrive
 			}
 			elem.Columns[i] = col
 		}
+		for _, index := range detail.Indexes {
+			elem.Indexes = append(elem.Indexes, IndexToSchemaIndex(index))
+		}
+		for _, fk := range detail.ForeignKeys {
+			for i, col := range elem.Columns {
+				if col.Name == fk.Column {
+					elem.Columns[i].References = ForeignKeyToReferences(fk)
+					break
+				}
+			}
+		}
+		primaryKey, uniques := constraintsToKeys(detail.Constraints)
+		if len(primaryKey) > 1 {
+			elem.PrimaryKey = primaryKey
+		}
+		for _, unique := range uniques {
+			// a single column constraint with the default name is the same as marking the column unique
+			if len(unique.Columns) == 1 && unique.Name == UniqueConstraintName(elem.Name, unique.Columns[0]) {
+				if i := columnIndex(elem.Columns, unique.Columns[0]); i >= 0 {
+					elem.Columns[i].Unique = util.Ptr(true)
+					continue
+				}
+			}
+			elem.UniqueConstraints = append(elem.UniqueConstraints, unique)
+		}
+		for _, check := range detail.Checks {
+			if check.Column != "" {
+				if i := columnIndex(elem.Columns, check.Column); i >= 0 {
+					elem.Columns[i].Checks = append(elem.Columns[i].Checks, SchemaJsonTablesElemColumnsElemChecksElem{Name: check.Name, Expression: check.Expression})
+					continue
+				}
+			}
+			elem.Checks = append(elem.Checks, SchemaJsonTablesElemChecksElem{Name: check.Name, Expression: check.Expression})
+		}
 		schemaJson.Tables = append(schemaJson.Tables, elem)
 	}
 	return &schemaJson, nil
 }
 
+func columnIndex(columns []SchemaJsonTablesElemColumnsElem, name string) int {
+	for i, col := range columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// constraintsToKeys returns the ordered primary key columns and the unique constraints from the constraint rows
+// which are expected to be ordered by the column position within each constraint
+func constraintsToKeys(constraints []types.ConstraintDetail) ([]string, []SchemaJsonTablesElemUniqueConstraintsElem) {
+	var primaryKey []string
+	var uniques []SchemaJsonTablesElemUniqueConstraintsElem
+	for _, constraint := range constraints {
+		switch constraint.Type {
+		case "PRIMARY KEY":
+			primaryKey = append(primaryKey, constraint.Column)
+		case "UNIQUE":
+			if len(uniques) > 0 && uniques[len(uniques)-1].Name == constraint.Name {
+				uniques[len(uniques)-1].Columns = append(uniques[len(uniques)-1].Columns, constraint.Column)
+			} else {
+				uniques = append(uniques, SchemaJsonTablesElemUniqueConstraintsElem{Name: constraint.Name, Columns: []string{constraint.Column}})
+			}
+		}
+	}
+	return primaryKey, uniques
+}
+
 func validateDefaultValue(detail types.ColumnDetail, column SchemaJsonTablesElemColumnsElem) error {
 	if detail.Default != nil && !util.IsFunctionCall(*detail.Default) {
 		switch column.Type {
@@ -169,9 +246,8 @@ func SchemaColumnToColumn(driver DatabaseDriverType, column SchemaJsonTablesElem
 	if column.PrimaryKey != nil {
 		detail.IsPrimaryKey = *column.PrimaryKey
 	}
-	if column.Unique != nil {
-		detail.IsUnique = *column.Unique
-	}
+	// unique columns are generated as table unique constraints, see TableUniqueConstraints
+	detail.Enum = column.Enum
 	if column.MaxLength != nil && *column.MaxLength > 0 {
 		detail.MaxLength = util.Ptr(int64(*column.MaxLength))
 	}
@@ -184,3 +260,266 @@ func SchemaColumnToColumn(driver DatabaseDriverType, column SchemaJsonTablesElem
 	detail.Ordinal = int64(ordinal)
 	return &detail, nil
 }
+
+// IndexToSchemaIndex converts an index detail into the schema index definition
+func IndexToSchemaIndex(index types.IndexDetail) SchemaJsonTablesElemIndexesElem {
+	elem := SchemaJsonTablesElemIndexesElem{
+		Name:       index.Name,
+		Expression: index.Expression,
+		Where:      index.Where,
+	}
+	if index.IsUnique {
+		elem.Unique = util.Ptr(true)
+	}
+	// btree is the default so we only include the method when it's something else
+	if index.Method != nil && *index.Method != string(SchemaJsonTablesElemIndexesElemMethodBtree) {
+		elem.Method = util.Ptr(SchemaJsonTablesElemIndexesElemMethod(*index.Method))
+	}
+	for _, column := range index.Columns {
+		col := SchemaJsonTablesElemIndexesElemColumnsElem{Name: column.Name}
+		if column.IsDescending {
+			col.Order = util.Ptr(SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc)
+		}
+		elem.Columns = append(elem.Columns, col)
+	}
+	return elem
+}
+
+// SchemaIndexToIndex converts a schema index definition into an index detail
+func SchemaIndexToIndex(index SchemaJsonTablesElemIndexesElem) types.IndexDetail {
+	detail := types.IndexDetail{
+		Name:       index.Name,
+		Expression: index.Expression,
+		Where:      index.Where,
+	}
+	if index.Unique != nil {
+		detail.IsUnique = *index.Unique
+	}
+	if index.Method != nil {
+		detail.Method = util.Ptr(string(*index.Method))
+	}
+	detail.Columns = make([]types.IndexColumnDetail, len(index.Columns))
+	for i, column := range index.Columns {
+		detail.Columns[i] = types.IndexColumnDetail{
+			Name:         column.Name,
+			IsDescending: column.Order != nil && *column.Order == SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc,
+		}
+	}
+	return detail
+}
+
+// SchemaIndexesToIndexes converts the schema index definitions for a table into index details
+func SchemaIndexesToIndexes(indexes []SchemaJsonTablesElemIndexesElem) []types.IndexDetail {
+	res := make([]types.IndexDetail, len(indexes))
+	for i, index := range indexes {
+		res[i] = SchemaIndexToIndex(index)
+	}
+	return res
+}
+
+// ForeignKeyName returns the name of the foreign key constraint for a column reference
+func ForeignKeyName(table string, column string, ref SchemaJsonTablesElemColumnsElemReferences) string {
+	if ref.Name != nil && *ref.Name != "" {
+		return *ref.Name
+	}
+	return table + "_" + column + "_fkey"
+}
+
+// ForeignKeyToReferences converts a foreign key detail into the schema column reference
+func ForeignKeyToReferences(fk types.ForeignKeyDetail) *SchemaJsonTablesElemColumnsElemReferences {
+	ref := &SchemaJsonTablesElemColumnsElemReferences{
+		Name:   util.Ptr(fk.Name),
+		Table:  fk.ReferenceTable,
+		Column: fk.ReferenceColumn,
+	}
+	// no action is the default so we only include the actions when they're something else
+	if fk.OnDelete != nil && *fk.OnDelete != string(SchemaJsonTablesElemColumnsElemReferencesOnDeleteNoAction) {
+		ref.OnDelete = util.Ptr(SchemaJsonTablesElemColumnsElemReferencesOnDelete(*fk.OnDelete))
+	}
+	if fk.OnUpdate != nil && *fk.OnUpdate != string(SchemaJsonTablesElemColumnsElemReferencesOnUpdateNoAction) {
+		ref.OnUpdate = util.Ptr(SchemaJsonTablesElemColumnsElemReferencesOnUpdate(*fk.OnUpdate))
+	}
+	if fk.IsDeferrable {
+		ref.Deferrable = util.Ptr(true)
+	}
+	return ref
+}
+
+// ReferencesToForeignKey converts a schema column reference into a foreign key detail
+func ReferencesToForeignKey(table string, column string, ref SchemaJsonTablesElemColumnsElemReferences) types.ForeignKeyDetail {
+	fk := types.ForeignKeyDetail{
+		Name:            ForeignKeyName(table, column, ref),
+		Column:          column,
+		ReferenceTable:  ref.Table,
+		ReferenceColumn: ref.Column,
+	}
+	if ref.OnDelete != nil {
+		fk.OnDelete = util.Ptr(string(*ref.OnDelete))
+	}
+	if ref.OnUpdate != nil {
+		fk.OnUpdate = util.Ptr(string(*ref.OnUpdate))
+	}
+	if ref.Deferrable != nil {
+		fk.IsDeferrable = *ref.Deferrable
+	}
+	return fk
+}
+
+// SchemaTableForeignKeys returns the foreign keys for the columns in a table which have a reference
+func SchemaTableForeignKeys(table SchemaJsonTablesElem) []types.ForeignKeyDetail {
+	var res []types.ForeignKeyDetail
+	for _, col := range table.Columns {
+		if col.References != nil {
+			res = append(res, ReferencesToForeignKey(table.Name, col.Name, *col.References))
+		}
+	}
+	return res
+}
+
+// UniqueConstraintName returns the name of the unique constraint generated for a column marked with unique
+func UniqueConstraintName(table string, column string) string {
+	return table + "_" + column + "_key"
+}
+
+// TablePrimaryKey returns the ordered columns which make up the primary key for a table which is either the
+// table primaryKey or the columns marked with primaryKey
+func TablePrimaryKey(table SchemaJsonTablesElem) []string {
+	if len(table.PrimaryKey) > 0 {
+		return table.PrimaryKey
+	}
+	var res []string
+	for _, col := range table.Columns {
+		if col.PrimaryKey != nil && *col.PrimaryKey {
+			res = append(res, col.Name)
+		}
+	}
+	return res
+}
+
+// TableUniqueConstraints returns the unique constraints for a table along with a constraint for each column marked
+// with unique which doesn't already have one defined with the same name
+func TableUniqueConstraints(table SchemaJsonTablesElem) []SchemaJsonTablesElemUniqueConstraintsElem {
+	res := append([]SchemaJsonTablesElemUniqueConstraintsElem{}, table.UniqueConstraints...)
+	for _, col := range table.Columns {
+		if col.Unique == nil || !*col.Unique {
+			continue
+		}
+		name := UniqueConstraintName(table.Name, col.Name)
+		var found bool
+		for _, unique := range res {
+			if unique.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, SchemaJsonTablesElemUniqueConstraintsElem{Name: name, Columns: []string{col.Name}})
+		}
+	}
+	return res
+}
+
+// SchemaTableUniqueConstraints returns the unique constraint details for a table
+func SchemaTableUniqueConstraints(table SchemaJsonTablesElem) []types.UniqueConstraintDetail {
+	var res []types.UniqueConstraintDetail
+	for _, unique := range TableUniqueConstraints(table) {
+		res = append(res, types.UniqueConstraintDetail{Name: unique.Name, Columns: unique.Columns})
+	}
+	return res
+}
+
+// TableChecks returns the check constraints for a table along with the check constraints defined on its columns
+func TableChecks(table SchemaJsonTablesElem) []SchemaJsonTablesElemChecksElem {
+	res := append([]SchemaJsonTablesElemChecksElem{}, table.Checks...)
+	for _, col := range table.Columns {
+		for _, check := range col.Checks {
+			res = append(res, SchemaJsonTablesElemChecksElem(check))
+		}
+	}
+	return res
+}
+
+// SchemaTableChecks returns the check constraint details for a table
+func SchemaTableChecks(table SchemaJsonTablesElem) []types.CheckConstraintDetail {
+	var res []types.CheckConstraintDetail
+	for _, check := range TableChecks(table) {
+		res = append(res, SchemaCheckToCheck(check))
+	}
+	return res
+}
+
+// SchemaCheckToCheck converts a schema check constraint definition into a check constraint detail
+func SchemaCheckToCheck(check SchemaJsonTablesElemChecksElem) types.CheckConstraintDetail {
+	detail := types.CheckConstraintDetail{Name: check.Name, Expression: check.Expression}
+	if check.NotValid != nil {
+		detail.IsNotValid = *check.NotValid
+	}
+	return detail
+}
+
+// FindEnum returns the enum with the name or nil if not found
+func FindEnum(enums []SchemaJsonEnumsElem, name string) *SchemaJsonEnumsElem {
+	for i, enum := range enums {
+		if enum.Name == name {
+			return &enums[i]
+		}
+	}
+	return nil
+}
+
+// QualifiedName returns the name qualified by the namespace or just the name when there's no namespace
+func QualifiedName(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// TableQualifiedName returns the name of the table qualified by its schema when it has one
+func TableQualifiedName(table SchemaJsonTablesElem) string {
+	if table.Schema == nil {
+		return table.Name
+	}
+	return QualifiedName(*table.Schema, table.Name)
+}
+
+// TableRenamedFrom returns the qualified previous name of the table or an empty string when it isn't renamed
+func TableRenamedFrom(table SchemaJsonTablesElem) string {
+	if table.RenamedFrom == nil || *table.RenamedFrom == "" {
+		return ""
+	}
+	if table.Schema == nil {
+		return *table.RenamedFrom
+	}
+	return QualifiedName(*table.Schema, *table.RenamedFrom)
+}
+
+// FindTable returns the table by its qualified name or nil if not found
+func FindTable(tables []SchemaJsonTablesElem, name string) *SchemaJsonTablesElem {
+	for i, table := range tables {
+		if TableQualifiedName(table) == name {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// Namespaces returns the sorted schemas (namespaces) configured for the database along with the ones used by the tables
+func Namespaces(dbschema *SchemaJson) []string {
+	found := make(map[string]bool)
+	var res []string
+	for _, namespace := range dbschema.Database.Schemas {
+		if !found[namespace] {
+			found[namespace] = true
+			res = append(res, namespace)
+		}
+	}
+	for _, table := range dbschema.Tables {
+		if table.Schema != nil && !found[*table.Schema] {
+			found[*table.Schema] = true
+			res = append(res, *table.Schema)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
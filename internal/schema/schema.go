@@ -1,11 +1,14 @@
 package schema
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -46,19 +49,249 @@ func Load(filename string) (*SchemaJson, error) {
 	if s, ok := schema.Database.Url.(string); ok {
 		schema.Database.Url = os.ExpandEnv(s)
 	}
-	for _, table := range schema.Tables {
+	for _, namespace := range schema.Database.Schemas {
+		if !validateName(namespace) {
+			return nil, fmt.Errorf("schema `%s` has an invalid name", namespace)
+		}
+	}
+	if err := validateEnums(schema.Enums); err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool)
+	for t, table := range schema.Tables {
 		if !validateName(table.Name) {
 			return nil, fmt.Errorf("table `%s` has an invalid name", table.Name)
 		}
+		if table.Schema != nil && !validateName(*table.Schema) {
+			return nil, fmt.Errorf("table `%s` has an invalid schema `%s`", table.Name, *table.Schema)
+		}
+		if tables[TableQualifiedName(table)] {
+			return nil, fmt.Errorf("table `%s` is defined more than once", TableQualifiedName(table))
+		}
+		tables[TableQualifiedName(table)] = true
 		for _, col := range table.Columns {
 			if !validateName(col.Name) {
 				return nil, fmt.Errorf("column `%s` in table `%s` has an invalid name", col.Name, table.Name)
 			}
+			if col.Enum != nil {
+				if FindEnum(schema.Enums, *col.Enum) == nil {
+					return nil, fmt.Errorf("column `%s` in table `%s` references enum `%s` which doesn't exist", col.Name, table.Name, *col.Enum)
+				}
+				if col.Type != SchemaJsonTablesElemColumnsElemTypeString {
+					return nil, fmt.Errorf("column `%s` in table `%s` references enum `%s` but isn't a string", col.Name, table.Name, *col.Enum)
+				}
+			}
+		}
+		if err := validateIndexes(table); err != nil {
+			return nil, err
+		}
+		if err := validatePrimaryKey(table); err != nil {
+			return nil, err
 		}
+		if err := validateUniqueConstraints(table); err != nil {
+			return nil, err
+		}
+		if err := validateChecks(table); err != nil {
+			return nil, err
+		}
+		schema.Tables[t].Indexes = columnIndexes(table)
+	}
+	if err := validateRenames(schema.Tables); err != nil {
+		return nil, err
 	}
 	return &schema, nil
 }
 
+// validateRenames checks that a renamed table or column isn't renamed from one which is still defined since the
+// previous one would be both kept and renamed
+func validateRenames(tables []SchemaJsonTablesElem) error {
+	for _, table := range tables {
+		if table.RenamedFrom != nil {
+			if !validateName(*table.RenamedFrom) {
+				return fmt.Errorf("table `%s` is renamed from `%s` which is an invalid name", table.Name, *table.RenamedFrom)
+			}
+			if FindTable(tables, TableRenamedFrom(table)) != nil {
+				return fmt.Errorf("table `%s` is renamed from `%s` which is still defined", table.Name, *table.RenamedFrom)
+			}
+		}
+		for _, col := range table.Columns {
+			if col.RenamedFrom == nil {
+				continue
+			}
+			if !validateName(*col.RenamedFrom) {
+				return fmt.Errorf("column `%s` in table `%s` is renamed from `%s` which is an invalid name", col.Name, table.Name, *col.RenamedFrom)
+			}
+			if columnIndex(table.Columns, *col.RenamedFrom) >= 0 {
+				return fmt.Errorf("column `%s` in table `%s` is renamed from `%s` which is still defined", col.Name, table.Name, *col.RenamedFrom)
+			}
+		}
+	}
+	return nil
+}
+
+// getIndexName returns the name of the index generated for a column marked with index
+func getIndexName(table string, column string) string {
+	return strings.ToLower("idx_" + table + "_" + column)
+}
+
+// columnIndexes returns the table indexes along with an index for each column marked with index which
+// doesn't already have one defined with the same name
+func columnIndexes(table SchemaJsonTablesElem) []SchemaJsonTablesElemIndexesElem {
+	indexes := table.Indexes
+	for _, col := range table.Columns {
+		if col.Index == nil || !*col.Index {
+			continue
+		}
+		name := getIndexName(table.Name, col.Name)
+		var found bool
+		for _, index := range indexes {
+			if index.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			indexes = append(indexes, SchemaJsonTablesElemIndexesElem{
+				Name:    name,
+				Columns: []SchemaJsonTablesElemIndexesElemColumnsElem{{Name: col.Name}},
+			})
+		}
+	}
+	return indexes
+}
+
+func validateIndexes(table SchemaJsonTablesElem) error {
+	names := make(map[string]bool)
+	for _, index := range table.Indexes {
+		if !validateName(index.Name) {
+			return fmt.Errorf("index `%s` in table `%s` has an invalid name", index.Name, table.Name)
+		}
+		if names[index.Name] {
+			return fmt.Errorf("index `%s` in table `%s` is defined more than once", index.Name, table.Name)
+		}
+		names[index.Name] = true
+		hasExpression := index.Expression != nil && *index.Expression != ""
+		if hasExpression && len(index.Columns) > 0 {
+			return fmt.Errorf("index `%s` in table `%s` cannot have both columns and an expression", index.Name, table.Name)
+		}
+		if !hasExpression && len(index.Columns) == 0 {
+			return fmt.Errorf("index `%s` in table `%s` must have either columns or an expression", index.Name, table.Name)
+		}
+		for _, col := range index.Columns {
+			var found bool
+			for _, column := range table.Columns {
+				if column.Name == col.Name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("index `%s` in table `%s` references column `%s` which doesn't exist", index.Name, table.Name, col.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func validateEnums(enums []SchemaJsonEnumsElem) error {
+	names := make(map[string]bool)
+	for _, enum := range enums {
+		if !validateName(enum.Name) {
+			return fmt.Errorf("enum `%s` has an invalid name", enum.Name)
+		}
+		if names[enum.Name] {
+			return fmt.Errorf("enum `%s` is defined more than once", enum.Name)
+		}
+		names[enum.Name] = true
+		if len(enum.Values) == 0 {
+			return fmt.Errorf("enum `%s` must have at least one value", enum.Name)
+		}
+		seen := make(map[string]bool)
+		for _, value := range enum.Values {
+			if seen[value] {
+				return fmt.Errorf("enum `%s` has the value `%s` more than once", enum.Name, value)
+			}
+			seen[value] = true
+		}
+	}
+	return nil
+}
+
+func hasColumn(table SchemaJsonTablesElem, name string) bool {
+	for _, column := range table.Columns {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePrimaryKey(table SchemaJsonTablesElem) error {
+	if len(table.PrimaryKey) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, name := range table.PrimaryKey {
+		if !hasColumn(table, name) {
+			return fmt.Errorf("primary key in table `%s` references column `%s` which doesn't exist", table.Name, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("primary key in table `%s` references column `%s` more than once", table.Name, name)
+		}
+		seen[name] = true
+	}
+	for _, col := range table.Columns {
+		if col.PrimaryKey != nil && *col.PrimaryKey && !seen[col.Name] {
+			return fmt.Errorf("column `%s` in table `%s` is marked as a primary key but isn't part of the table primary key", col.Name, table.Name)
+		}
+	}
+	return nil
+}
+
+func validateUniqueConstraints(table SchemaJsonTablesElem) error {
+	names := make(map[string]bool)
+	for _, unique := range table.UniqueConstraints {
+		if !validateName(unique.Name) {
+			return fmt.Errorf("unique constraint `%s` in table `%s` has an invalid name", unique.Name, table.Name)
+		}
+		if names[unique.Name] {
+			return fmt.Errorf("unique constraint `%s` in table `%s` is defined more than once", unique.Name, table.Name)
+		}
+		names[unique.Name] = true
+		if len(unique.Columns) == 0 {
+			return fmt.Errorf("unique constraint `%s` in table `%s` must have at least one column", unique.Name, table.Name)
+		}
+		seen := make(map[string]bool)
+		for _, name := range unique.Columns {
+			if !hasColumn(table, name) {
+				return fmt.Errorf("unique constraint `%s` in table `%s` references column `%s` which doesn't exist", unique.Name, table.Name, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("unique constraint `%s` in table `%s` references column `%s` more than once", unique.Name, table.Name, name)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+func validateChecks(table SchemaJsonTablesElem) error {
+	names := make(map[string]bool)
+	for _, check := range TableChecks(table) {
+		if !validateName(check.Name) {
+			return fmt.Errorf("check constraint `%s` in table `%s` has an invalid name", check.Name, table.Name)
+		}
+		if names[check.Name] {
+			return fmt.Errorf("check constraint `%s` in table `%s` is defined more than once", check.Name, table.Name)
+		}
+		names[check.Name] = true
+		if strings.TrimSpace(check.Expression) == "" {
+			return fmt.Errorf("check constraint `%s` in table `%s` must have an expression", check.Name, table.Name)
+		}
+	}
+	return nil
+}
+
 type SchemaJsonForOutput struct {
 	// The URL to the Shift schema.
 	Schema string `json:"$schema" yaml:"-" mapstructure:"-"`
@@ -69,6 +302,22 @@ type SchemaJsonForOutput struct {
 	// The database configuration for the migration to use.
 	Database SchemaJsonDatabase `json:"database" yaml:"database" mapstructure:"database"`
 
+	// The enum types which can be used by the columns of the tables.
+	Enums []SchemaJsonEnumsElem `json:"enums,omitempty" yaml:"enums,omitempty" mapstructure:"enums,omitempty"`
+
 	// The tables to manage in the migration.
 	Tables []SchemaJsonTablesElem `json:"tables" yaml:"tables" mapstructure:"tables"`
 }
+
+// Fingerprint returns the SHA-256 of the enums and tables of a schema which changes whenever the schema does
+func Fingerprint(dbschema *SchemaJson) (string, error) {
+	buf, err := json.Marshal(struct {
+		Enums  []SchemaJsonEnumsElem  `json:"enums"`
+		Tables []SchemaJsonTablesElem `json:"tables"`
+	}{dbschema.Enums, dbschema.Tables})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -2,10 +2,13 @@ package schema
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jhaynie/shift/internal/migrator/types"
 	"github.com/jhaynie/shift/internal/util"
+	"github.com/shopmonkeyus/go-common/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -161,3 +164,474 @@ func TestValidateDefaultValue(t *testing.T) {
 	assert.EqualError(t, validateDefaultValue(types.ColumnDetail{Default: util.Ptr("a")}, SchemaJsonTablesElemColumnsElem{Name: "f", Type: SchemaJsonTablesElemColumnsElemTypeFloat}), `invalid float default value: a for column: f. should be: ^-?\d+(.\d+)?$`)
 	assert.EqualError(t, validateDefaultValue(types.ColumnDetail{Default: util.Ptr("a")}, SchemaJsonTablesElemColumnsElem{Name: "f", Type: SchemaJsonTablesElemColumnsElemTypeBoolean}), `invalid boolean default value: a for column: f. should be either true or false`)
 }
+
+func writeTestSchema(t *testing.T, content string) string {
+	fn := filepath.Join(t.TempDir(), "schema.yaml")
+	assert.NoError(t, os.WriteFile(fn, []byte(content), 0644))
+	return fn
+}
+
+func TestIndexName(t *testing.T) {
+	assert.Equal(t, "idx_a_b", getIndexName("a", "b"))
+	assert.Equal(t, "idx_a_b", getIndexName("A", "b"))
+	assert.Equal(t, "idx_a_b", getIndexName("A", "B"))
+	assert.Equal(t, "idx_a_b", getIndexName("a", "B"))
+}
+
+func TestLoadIndexes(t *testing.T) {
+	s, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: users
+    columns:
+      - name: id
+        type: int
+      - name: email
+        type: string
+        index: true
+      - name: name
+        type: string
+        index: true
+    indexes:
+      - name: idx_users_name
+        columns:
+          - name: name
+            order: desc
+      - name: users_lower_email_idx
+        expression: lower(email)
+        unique: true
+        where: deleted_at IS NULL
+`))
+	assert.NoError(t, err)
+	assert.Len(t, s.Tables[0].Indexes, 3)
+	assert.Equal(t, "idx_users_name", s.Tables[0].Indexes[0].Name)
+	assert.Equal(t, SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc, *s.Tables[0].Indexes[0].Columns[0].Order)
+	assert.Equal(t, "users_lower_email_idx", s.Tables[0].Indexes[1].Name)
+	assert.Equal(t, "lower(email)", *s.Tables[0].Indexes[1].Expression)
+	assert.True(t, *s.Tables[0].Indexes[1].Unique)
+	assert.Equal(t, "deleted_at IS NULL", *s.Tables[0].Indexes[1].Where)
+	assert.Equal(t, SchemaJsonTablesElemIndexesElem{Name: "idx_users_email", Columns: []SchemaJsonTablesElemIndexesElemColumnsElem{{Name: "email"}}}, s.Tables[0].Indexes[2])
+}
+
+func TestLoadInvalidIndexes(t *testing.T) {
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: users
+    columns:
+      - name: id
+        type: int
+    indexes:
+`
+	_, err := Load(writeTestSchema(t, header+`      - name: users_id_idx
+`))
+	assert.EqualError(t, err, "index `users_id_idx` in table `users` must have either columns or an expression")
+	_, err = Load(writeTestSchema(t, header+`      - name: users_id_idx
+        expression: abs(id)
+        columns:
+          - name: id
+`))
+	assert.EqualError(t, err, "index `users_id_idx` in table `users` cannot have both columns and an expression")
+	_, err = Load(writeTestSchema(t, header+`      - name: users_id_idx
+        columns:
+          - name: foo
+`))
+	assert.EqualError(t, err, "index `users_id_idx` in table `users` references column `foo` which doesn't exist")
+	_, err = Load(writeTestSchema(t, header+`      - name: users_id_idx
+        columns:
+          - name: id
+      - name: users_id_idx
+        columns:
+          - name: id
+`))
+	assert.EqualError(t, err, "index `users_id_idx` in table `users` is defined more than once")
+}
+
+func TestIndexConversion(t *testing.T) {
+	detail := types.IndexDetail{
+		Name:     "a_idx",
+		Columns:  []types.IndexColumnDetail{{Name: "a"}, {Name: "b", IsDescending: true}},
+		Method:   util.Ptr("btree"),
+		IsUnique: true,
+	}
+	index := IndexToSchemaIndex(detail)
+	assert.Nil(t, index.Method)
+	assert.True(t, *index.Unique)
+	assert.Nil(t, index.Columns[0].Order)
+	assert.Equal(t, SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc, *index.Columns[1].Order)
+	detail.Method = nil
+	assert.Equal(t, detail, SchemaIndexToIndex(index))
+	detail.Method = util.Ptr("gin")
+	assert.Equal(t, SchemaJsonTablesElemIndexesElemMethodGin, *IndexToSchemaIndex(detail).Method)
+}
+
+func TestLoadConstraints(t *testing.T) {
+	s, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: membership
+    columns:
+      - name: team_id
+        type: int
+      - name: user_id
+        type: int
+      - name: email
+        type: string
+        unique: true
+      - name: role
+        type: string
+    primaryKey: [user_id, team_id]
+    uniqueConstraints:
+      - name: membership_team_role_key
+        columns: [team_id, role]
+`))
+	assert.NoError(t, err)
+	table := s.Tables[0]
+	assert.Equal(t, []string{"user_id", "team_id"}, TablePrimaryKey(table))
+	assert.Equal(t, []SchemaJsonTablesElemUniqueConstraintsElem{
+		{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+		{Name: "membership_email_key", Columns: []string{"email"}},
+	}, TableUniqueConstraints(table))
+}
+
+func TestLoadInvalidConstraints(t *testing.T) {
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: users
+    columns:
+      - name: id
+        type: int
+        primaryKey: true
+      - name: email
+        type: string
+`
+	_, err := Load(writeTestSchema(t, header+`    primaryKey: [email]
+`))
+	assert.EqualError(t, err, "column `id` in table `users` is marked as a primary key but isn't part of the table primary key")
+	_, err = Load(writeTestSchema(t, header+`    primaryKey: [id, foo]
+`))
+	assert.EqualError(t, err, "primary key in table `users` references column `foo` which doesn't exist")
+	_, err = Load(writeTestSchema(t, header+`    primaryKey: [id, id]
+`))
+	assert.EqualError(t, err, "primary key in table `users` references column `id` more than once")
+	_, err = Load(writeTestSchema(t, header+`    uniqueConstraints:
+      - name: users_email_key
+        columns: [foo]
+`))
+	assert.EqualError(t, err, "unique constraint `users_email_key` in table `users` references column `foo` which doesn't exist")
+	_, err = Load(writeTestSchema(t, header+`    uniqueConstraints:
+      - name: users_email_key
+        columns: [email]
+      - name: users_email_key
+        columns: [id, email]
+`))
+	assert.EqualError(t, err, "unique constraint `users_email_key` in table `users` is defined more than once")
+}
+
+func TestGenerateConstraints(t *testing.T) {
+	res, err := GenerateSchemaJsonFromInfoTables(logger.NewTestLogger(), DatabaseDriverPostgres, map[string]*types.TableDetail{
+		"membership": {
+			Columns: []types.ColumnDetail{
+				{Name: "team_id", DataType: "int", IsPrimaryKey: true},
+				{Name: "user_id", DataType: "int", IsPrimaryKey: true},
+				{Name: "email", DataType: "string"},
+				{Name: "role", DataType: "string"},
+			},
+			Constraints: []types.ConstraintDetail{
+				{Name: "membership_email_key", Type: "UNIQUE", Column: "email"},
+				{Name: "membership_pkey", Type: "PRIMARY KEY", Column: "user_id"},
+				{Name: "membership_pkey", Type: "PRIMARY KEY", Column: "team_id"},
+				{Name: "membership_role_uniq", Type: "UNIQUE", Column: "role"},
+				{Name: "membership_team_role_key", Type: "UNIQUE", Column: "team_id"},
+				{Name: "membership_team_role_key", Type: "UNIQUE", Column: "role"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	table := res.Tables[0]
+	assert.Equal(t, []string{"user_id", "team_id"}, table.PrimaryKey)
+	assert.True(t, *table.Columns[2].Unique)
+	assert.Nil(t, table.Columns[3].Unique)
+	assert.Equal(t, []SchemaJsonTablesElemUniqueConstraintsElem{
+		{Name: "membership_role_uniq", Columns: []string{"role"}},
+		{Name: "membership_team_role_key", Columns: []string{"team_id", "role"}},
+	}, table.UniqueConstraints)
+}
+
+func TestLoadChecks(t *testing.T) {
+	s, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: orders
+    columns:
+      - name: price
+        type: int
+        checks:
+          - name: orders_price_check
+            expression: price >= 0
+      - name: discount
+        type: int
+    checks:
+      - name: orders_discount_check
+        expression: discount <= price
+        notValid: true
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.CheckConstraintDetail{
+		{Name: "orders_discount_check", Expression: "discount <= price", IsNotValid: true},
+		{Name: "orders_price_check", Expression: "price >= 0"},
+	}, SchemaTableChecks(s.Tables[0]))
+}
+
+func TestLoadInvalidChecks(t *testing.T) {
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: orders
+    columns:
+      - name: price
+        type: int
+        checks:
+          - name: orders_price_check
+            expression: price >= 0
+`
+	_, err := Load(writeTestSchema(t, header+`    checks:
+      - name: orders_price_check
+        expression: price > 0
+`))
+	assert.EqualError(t, err, "check constraint `orders_price_check` in table `orders` is defined more than once")
+	_, err = Load(writeTestSchema(t, header+`    checks:
+      - name: orders-check
+        expression: price > 0
+`))
+	assert.EqualError(t, err, "check constraint `orders-check` in table `orders` has an invalid name")
+	_, err = Load(writeTestSchema(t, header+`    checks:
+      - name: orders_check
+        expression: " "
+`))
+	assert.EqualError(t, err, "check constraint `orders_check` in table `orders` must have an expression")
+}
+
+func TestLoadEnums(t *testing.T) {
+	s, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+enums:
+  - name: order_status
+    values: [pending, shipped]
+tables:
+  - name: orders
+    columns:
+      - name: status
+        type: string
+        enum: order_status
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaJsonEnumsElem{{Name: "order_status", Values: []string{"pending", "shipped"}}}, s.Enums)
+	assert.Equal(t, "order_status", *s.Tables[0].Columns[0].Enum)
+	assert.Equal(t, &s.Enums[0], FindEnum(s.Enums, "order_status"))
+	assert.Nil(t, FindEnum(s.Enums, "status"))
+}
+
+func TestLoadInvalidEnums(t *testing.T) {
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+enums:
+  - name: order_status
+    values: [pending, shipped]
+`
+	_, err := Load(writeTestSchema(t, header+`  - name: order_status
+    values: [pending]
+tables: []
+`))
+	assert.EqualError(t, err, "enum `order_status` is defined more than once")
+	_, err = Load(writeTestSchema(t, header+`  - name: order-size
+    values: [small]
+tables: []
+`))
+	assert.EqualError(t, err, "enum `order-size` has an invalid name")
+	_, err = Load(writeTestSchema(t, header+`  - name: order_size
+    values: [small, small]
+tables: []
+`))
+	assert.EqualError(t, err, "enum `order_size` has the value `small` more than once")
+	_, err = Load(writeTestSchema(t, header+`tables:
+  - name: orders
+    columns:
+      - name: status
+        type: string
+        enum: status
+`))
+	assert.EqualError(t, err, "column `status` in table `orders` references enum `status` which doesn't exist")
+	_, err = Load(writeTestSchema(t, header+`tables:
+  - name: orders
+    columns:
+      - name: status
+        type: int
+        enum: order_status
+`))
+	assert.EqualError(t, err, "column `status` in table `orders` references enum `order_status` but isn't a string")
+}
+
+func TestLoadNamespaces(t *testing.T) {
+	s, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+  schemas: [audit]
+tables:
+  - name: orders
+    columns:
+      - name: id
+        type: int
+  - name: orders
+    schema: sales
+    columns:
+      - name: id
+        type: int
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", TableQualifiedName(s.Tables[0]))
+	assert.Equal(t, "sales.orders", TableQualifiedName(s.Tables[1]))
+	assert.Equal(t, []string{"audit", "sales"}, Namespaces(s))
+}
+
+func TestLoadInvalidNamespaces(t *testing.T) {
+	_, err := Load(writeTestSchema(t, `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+  schemas: [audit-log]
+tables: []
+`))
+	assert.EqualError(t, err, "schema `audit-log` has an invalid name")
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: orders
+    schema: sales
+    columns:
+      - name: id
+        type: int
+`
+	_, err = Load(writeTestSchema(t, header+`  - name: orders
+    schema: sales
+    columns:
+      - name: id
+        type: int
+`))
+	assert.EqualError(t, err, "table `sales.orders` is defined more than once")
+	_, err = Load(writeTestSchema(t, header+`  - name: items
+    schema: sales-x
+    columns:
+      - name: id
+        type: int
+`))
+	assert.EqualError(t, err, "table `items` has an invalid schema `sales-x`")
+}
+
+func TestLoadInvalidRenames(t *testing.T) {
+	header := `version: "1"
+database:
+  url: postgres://localhost:5432/db1
+tables:
+  - name: orders
+    columns:
+      - name: id
+        type: int
+`
+	_, err := Load(writeTestSchema(t, header+`  - name: purchases
+    renamedFrom: orders
+    columns:
+      - name: id
+        type: int
+`))
+	assert.EqualError(t, err, "table `purchases` is renamed from `orders` which is still defined")
+	_, err = Load(writeTestSchema(t, header+`  - name: purchases
+    renamedFrom: order-list
+    columns:
+      - name: id
+        type: int
+`))
+	assert.EqualError(t, err, "table `purchases` is renamed from `order-list` which is an invalid name")
+	_, err = Load(writeTestSchema(t, header+`      - name: order_id
+        renamedFrom: id
+        type: int
+`))
+	assert.EqualError(t, err, "column `order_id` in table `orders` is renamed from `id` which is still defined")
+	s, err := Load(writeTestSchema(t, header+`  - name: purchases
+    schema: sales
+    renamedFrom: orders
+    columns:
+      - name: id
+        type: int
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "sales.orders", TableRenamedFrom(s.Tables[1]))
+	assert.Equal(t, "", TableRenamedFrom(s.Tables[0]))
+}
+
+func TestGenerateNamespaces(t *testing.T) {
+	res, err := GenerateSchemaJsonFromInfoTables(logger.NewTestLogger(), DatabaseDriverPostgres, map[string]*types.TableDetail{
+		"orders":       {Columns: []types.ColumnDetail{{Name: "id", DataType: "int"}}},
+		"sales.orders": {Namespace: "sales", Columns: []types.ColumnDetail{{Name: "id", DataType: "int"}}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, res.Tables, 2)
+	names := make([]string, 0, len(res.Tables))
+	for _, table := range res.Tables {
+		assert.Equal(t, "orders", table.Name)
+		names = append(names, TableQualifiedName(table))
+	}
+	assert.ElementsMatch(t, []string{"orders", "sales.orders"}, names)
+}
+
+func TestGenerateChecks(t *testing.T) {
+	res, err := GenerateSchemaJsonFromInfoTables(logger.NewTestLogger(), DatabaseDriverPostgres, map[string]*types.TableDetail{
+		"orders": {
+			Columns: []types.ColumnDetail{
+				{Name: "price", DataType: "int"},
+				{Name: "discount", DataType: "int"},
+			},
+			Checks: []types.CheckConstraintDetail{
+				{Name: "orders_discount_check", Expression: "discount <= price"},
+				{Name: "orders_price_check", Expression: "price >= 0", Column: "price"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	table := res.Tables[0]
+	assert.Equal(t, []SchemaJsonTablesElemColumnsElemChecksElem{{Name: "orders_price_check", Expression: "price >= 0"}}, table.Columns[0].Checks)
+	assert.Empty(t, table.Columns[1].Checks)
+	assert.Equal(t, []SchemaJsonTablesElemChecksElem{{Name: "orders_discount_check", Expression: "discount <= price"}}, table.Checks)
+}
+
+func TestFingerprint(t *testing.T) {
+	dbschema := &SchemaJson{
+		Database: SchemaJsonDatabase{Url: "postgres://localhost/a"},
+		Tables: []SchemaJsonTablesElem{
+			{Name: "users", Columns: []SchemaJsonTablesElemColumnsElem{{Name: "id", Type: SchemaJsonTablesElemColumnsElemTypeInt}}},
+		},
+	}
+	fingerprint, err := Fingerprint(dbschema)
+	assert.NoError(t, err)
+	assert.Len(t, fingerprint, 64)
+
+	// the database isn't part of the fingerprint
+	dbschema.Database.Url = "postgres://localhost/b"
+	val, err := Fingerprint(dbschema)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, val)
+
+	dbschema.Tables[0].Columns[0].Type = SchemaJsonTablesElemColumnsElemTypeString
+	val, err = Fingerprint(dbschema)
+	assert.NoError(t, err)
+	assert.NotEqual(t, fingerprint, val)
+}
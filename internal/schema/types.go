@@ -14,6 +14,13 @@ type SchemaJson struct {
 	// The database configuration for the migration to use.
 	Database SchemaJsonDatabase `json:"database" yaml:"database" mapstructure:"database"`
 
+	// The tables and columns which have been removed from the tables and which
+	// migrations are allowed to drop along with their data.
+	Drops []SchemaJsonDropsElem `json:"drops,omitempty" yaml:"drops,omitempty" mapstructure:"drops,omitempty"`
+
+	// The enum types which can be used by the columns of the tables.
+	Enums []SchemaJsonEnumsElem `json:"enums,omitempty" yaml:"enums,omitempty" mapstructure:"enums,omitempty"`
+
 	// The tables to manage in the migration.
 	Tables []SchemaJsonTablesElem `json:"tables" yaml:"tables" mapstructure:"tables"`
 
@@ -23,6 +30,10 @@ type SchemaJson struct {
 
 // The database configuration for the migration to use.
 type SchemaJsonDatabase struct {
+	// The additional database schemas (namespaces) to manage along with the default
+	// schema. Only supported by postgres.
+	Schemas []string `json:"schemas,omitempty" yaml:"schemas,omitempty" mapstructure:"schemas,omitempty"`
+
 	// Url corresponds to the JSON schema field "url".
 	Url interface{} `json:"url" yaml:"url" mapstructure:"url"`
 }
@@ -45,29 +56,162 @@ func (j *SchemaJsonDatabase) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// The table or column which is dropped
+type SchemaJsonDropsElem struct {
+	// The name of the column which is dropped. The whole table is dropped if not
+	// set.
+	Column *string `json:"column,omitempty" yaml:"column,omitempty" mapstructure:"column,omitempty"`
+
+	// The name of the table which is dropped or whose column is dropped, qualified
+	// with its schema if it isn't in the default schema.
+	Table string `json:"table" yaml:"table" mapstructure:"table"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonDropsElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["table"]; raw != nil && !ok {
+		return fmt.Errorf("field table in SchemaJsonDropsElem: required")
+	}
+	type Plain SchemaJsonDropsElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = SchemaJsonDropsElem(plain)
+	return nil
+}
+
+// The enum definition
+type SchemaJsonEnumsElem struct {
+	// The name of the enum.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// The ordered values allowed by the enum.
+	Values []string `json:"values" yaml:"values" mapstructure:"values"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonEnumsElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonEnumsElem: required")
+	}
+	if _, ok := raw["values"]; raw != nil && !ok {
+		return fmt.Errorf("field values in SchemaJsonEnumsElem: required")
+	}
+	type Plain SchemaJsonEnumsElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if plain.Values != nil && len(plain.Values) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "values", 1)
+	}
+	*j = SchemaJsonEnumsElem(plain)
+	return nil
+}
+
 // The table definition
 type SchemaJsonTablesElem struct {
+	// Allow migrations to make destructive changes to the table such as dropping its
+	// columns.
+	AllowDrop *bool `json:"allowDrop,omitempty" yaml:"allowDrop,omitempty" mapstructure:"allowDrop,omitempty"`
+
+	// The check constraints for the table.
+	Checks []SchemaJsonTablesElemChecksElem `json:"checks,omitempty" yaml:"checks,omitempty" mapstructure:"checks,omitempty"`
+
 	// The columns that are part of the table.
 	Columns []SchemaJsonTablesElemColumnsElem `json:"columns" yaml:"columns" mapstructure:"columns"`
 
 	// The description of the table.
 	Description *string `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description,omitempty"`
 
+	// The indexes for the table.
+	Indexes []SchemaJsonTablesElemIndexesElem `json:"indexes,omitempty" yaml:"indexes,omitempty" mapstructure:"indexes,omitempty"`
+
 	// The name of the table.
 	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// The ordered columns that make up the primary key for the table. Use this
+	// instead of primaryKey on the column for a composite primary key.
+	PrimaryKey []string `json:"primaryKey,omitempty" yaml:"primaryKey,omitempty" mapstructure:"primaryKey,omitempty"`
+
+	// The previous name of the table in the same schema. The existing table is
+	// renamed instead of being dropped and created.
+	RenamedFrom *string `json:"renamedFrom,omitempty" yaml:"renamedFrom,omitempty" mapstructure:"renamedFrom,omitempty"`
+
+	// The database schema (namespace) of the table. Defaults to the default schema of
+	// the database. Only supported by postgres.
+	Schema *string `json:"schema,omitempty" yaml:"schema,omitempty" mapstructure:"schema,omitempty"`
+
+	// The unique constraints for the table.
+	UniqueConstraints []SchemaJsonTablesElemUniqueConstraintsElem `json:"uniqueConstraints,omitempty" yaml:"uniqueConstraints,omitempty" mapstructure:"uniqueConstraints,omitempty"`
+}
+
+// The check constraint definition
+type SchemaJsonTablesElemChecksElem struct {
+	// The boolean expression that every row must satisfy.
+	Expression string `json:"expression" yaml:"expression" mapstructure:"expression"`
+
+	// The name of the constraint.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Add the constraint to an existing table without checking the existing rows and
+	// then validate them in a separate statement which doesn't block writes. Only
+	// supported by Postgres.
+	NotValid *bool `json:"notValid,omitempty" yaml:"notValid,omitempty" mapstructure:"notValid,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemChecksElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["expression"]; raw != nil && !ok {
+		return fmt.Errorf("field expression in SchemaJsonTablesElemChecksElem: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonTablesElemChecksElem: required")
+	}
+	type Plain SchemaJsonTablesElemChecksElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = SchemaJsonTablesElemChecksElem(plain)
+	return nil
 }
 
 // The column definition
 type SchemaJsonTablesElemColumnsElem struct {
+	// Allow migrations to make destructive changes to the column such as changing it
+	// to a type which loses data.
+	AllowDrop *bool `json:"allowDrop,omitempty" yaml:"allowDrop,omitempty" mapstructure:"allowDrop,omitempty"`
+
 	// Whether the column is auto-incrementing.
 	AutoIncrement *bool `json:"autoIncrement,omitempty" yaml:"autoIncrement,omitempty" mapstructure:"autoIncrement,omitempty"`
 
+	// The check constraints for the column.
+	Checks []SchemaJsonTablesElemColumnsElemChecksElem `json:"checks,omitempty" yaml:"checks,omitempty" mapstructure:"checks,omitempty"`
+
 	// The specific native database default value if no value is provided.
 	Default *SchemaJsonTablesElemColumnsElemDefault `json:"default,omitempty" yaml:"default,omitempty" mapstructure:"default,omitempty"`
 
 	// The description of the column.
 	Description *string `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description,omitempty"`
 
+	// The name of the enum which holds the values allowed for the column. The column
+	// type must be string.
+	Enum *string `json:"enum,omitempty" yaml:"enum,omitempty" mapstructure:"enum,omitempty"`
+
 	// Whether the column is indexed.
 	Index *bool `json:"index,omitempty" yaml:"index,omitempty" mapstructure:"index,omitempty"`
 
@@ -95,6 +239,10 @@ type SchemaJsonTablesElemColumnsElem struct {
 	// The foreign key reference for the column.
 	References *SchemaJsonTablesElemColumnsElemReferences `json:"references,omitempty" yaml:"references,omitempty" mapstructure:"references,omitempty"`
 
+	// The previous name of the column. The existing column is renamed instead of
+	// being dropped and created.
+	RenamedFrom *string `json:"renamedFrom,omitempty" yaml:"renamedFrom,omitempty" mapstructure:"renamedFrom,omitempty"`
+
 	// The generic subtype of the column.
 	Subtype *SchemaJsonTablesElemColumnsElemSubtype `json:"subtype,omitempty" yaml:"subtype,omitempty" mapstructure:"subtype,omitempty"`
 
@@ -105,6 +253,41 @@ type SchemaJsonTablesElemColumnsElem struct {
 	Unique *bool `json:"unique,omitempty" yaml:"unique,omitempty" mapstructure:"unique,omitempty"`
 }
 
+// The check constraint definition
+type SchemaJsonTablesElemColumnsElemChecksElem struct {
+	// The boolean expression that every row must satisfy.
+	Expression string `json:"expression" yaml:"expression" mapstructure:"expression"`
+
+	// The name of the constraint.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Add the constraint to an existing table without checking the existing rows and
+	// then validate them in a separate statement which doesn't block writes. Only
+	// supported by Postgres.
+	NotValid *bool `json:"notValid,omitempty" yaml:"notValid,omitempty" mapstructure:"notValid,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemColumnsElemChecksElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["expression"]; raw != nil && !ok {
+		return fmt.Errorf("field expression in SchemaJsonTablesElemColumnsElemChecksElem: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonTablesElemColumnsElemChecksElem: required")
+	}
+	type Plain SchemaJsonTablesElemColumnsElemChecksElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = SchemaJsonTablesElemColumnsElemChecksElem(plain)
+	return nil
+}
+
 // The specific native database default value if no value is provided.
 type SchemaJsonTablesElemColumnsElemDefault struct {
 	// The native MySQL default value.
@@ -173,10 +356,94 @@ type SchemaJsonTablesElemColumnsElemReferences struct {
 	// The foreign column the column references.
 	Column string `json:"column" yaml:"column" mapstructure:"column"`
 
+	// Whether the constraint check is deferred until the end of the transaction.
+	Deferrable *bool `json:"deferrable,omitempty" yaml:"deferrable,omitempty" mapstructure:"deferrable,omitempty"`
+
+	// The name of the foreign key constraint. Defaults to <table>_<column>_fkey.
+	Name *string `json:"name,omitempty" yaml:"name,omitempty" mapstructure:"name,omitempty"`
+
+	// The action to take when the referenced row is deleted.
+	OnDelete *SchemaJsonTablesElemColumnsElemReferencesOnDelete `json:"onDelete,omitempty" yaml:"onDelete,omitempty" mapstructure:"onDelete,omitempty"`
+
+	// The action to take when the referenced column is updated.
+	OnUpdate *SchemaJsonTablesElemColumnsElemReferencesOnUpdate `json:"onUpdate,omitempty" yaml:"onUpdate,omitempty" mapstructure:"onUpdate,omitempty"`
+
 	// The foreign table the column references.
 	Table string `json:"table" yaml:"table" mapstructure:"table"`
 }
 
+type SchemaJsonTablesElemColumnsElemReferencesOnDelete string
+
+const SchemaJsonTablesElemColumnsElemReferencesOnDeleteCascade SchemaJsonTablesElemColumnsElemReferencesOnDelete = "cascade"
+const SchemaJsonTablesElemColumnsElemReferencesOnDeleteNoAction SchemaJsonTablesElemColumnsElemReferencesOnDelete = "no action"
+const SchemaJsonTablesElemColumnsElemReferencesOnDeleteRestrict SchemaJsonTablesElemColumnsElemReferencesOnDelete = "restrict"
+const SchemaJsonTablesElemColumnsElemReferencesOnDeleteSetDefault SchemaJsonTablesElemColumnsElemReferencesOnDelete = "set default"
+const SchemaJsonTablesElemColumnsElemReferencesOnDeleteSetNull SchemaJsonTablesElemColumnsElemReferencesOnDelete = "set null"
+
+var enumValues_SchemaJsonTablesElemColumnsElemReferencesOnDelete = []interface{}{
+	"no action",
+	"restrict",
+	"cascade",
+	"set null",
+	"set default",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemColumnsElemReferencesOnDelete) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SchemaJsonTablesElemColumnsElemReferencesOnDelete {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SchemaJsonTablesElemColumnsElemReferencesOnDelete, v)
+	}
+	*j = SchemaJsonTablesElemColumnsElemReferencesOnDelete(v)
+	return nil
+}
+
+type SchemaJsonTablesElemColumnsElemReferencesOnUpdate string
+
+const SchemaJsonTablesElemColumnsElemReferencesOnUpdateCascade SchemaJsonTablesElemColumnsElemReferencesOnUpdate = "cascade"
+const SchemaJsonTablesElemColumnsElemReferencesOnUpdateNoAction SchemaJsonTablesElemColumnsElemReferencesOnUpdate = "no action"
+const SchemaJsonTablesElemColumnsElemReferencesOnUpdateRestrict SchemaJsonTablesElemColumnsElemReferencesOnUpdate = "restrict"
+const SchemaJsonTablesElemColumnsElemReferencesOnUpdateSetDefault SchemaJsonTablesElemColumnsElemReferencesOnUpdate = "set default"
+const SchemaJsonTablesElemColumnsElemReferencesOnUpdateSetNull SchemaJsonTablesElemColumnsElemReferencesOnUpdate = "set null"
+
+var enumValues_SchemaJsonTablesElemColumnsElemReferencesOnUpdate = []interface{}{
+	"no action",
+	"restrict",
+	"cascade",
+	"set null",
+	"set default",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemColumnsElemReferencesOnUpdate) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SchemaJsonTablesElemColumnsElemReferencesOnUpdate {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SchemaJsonTablesElemColumnsElemReferencesOnUpdate, v)
+	}
+	*j = SchemaJsonTablesElemColumnsElemReferencesOnUpdate(v)
+	return nil
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (j *SchemaJsonTablesElemColumnsElemReferences) UnmarshalJSON(b []byte) error {
 	var raw map[string]interface{}
@@ -298,6 +565,169 @@ func (j *SchemaJsonTablesElemColumnsElem) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// The index definition
+type SchemaJsonTablesElemIndexesElem struct {
+	// The ordered columns that are part of the index.
+	Columns []SchemaJsonTablesElemIndexesElemColumnsElem `json:"columns,omitempty" yaml:"columns,omitempty" mapstructure:"columns,omitempty"`
+
+	// The expression to index instead of columns.
+	Expression *string `json:"expression,omitempty" yaml:"expression,omitempty" mapstructure:"expression,omitempty"`
+
+	// The index method to use.
+	Method *SchemaJsonTablesElemIndexesElemMethod `json:"method,omitempty" yaml:"method,omitempty" mapstructure:"method,omitempty"`
+
+	// The name of the index.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Whether the index is unique.
+	Unique *bool `json:"unique,omitempty" yaml:"unique,omitempty" mapstructure:"unique,omitempty"`
+
+	// The predicate for a partial index.
+	Where *string `json:"where,omitempty" yaml:"where,omitempty" mapstructure:"where,omitempty"`
+}
+
+// The index column definition
+type SchemaJsonTablesElemIndexesElemColumnsElem struct {
+	// The name of the column.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// The sort direction of the column in the index.
+	Order *SchemaJsonTablesElemIndexesElemColumnsElemOrder `json:"order,omitempty" yaml:"order,omitempty" mapstructure:"order,omitempty"`
+}
+
+type SchemaJsonTablesElemIndexesElemColumnsElemOrder string
+
+const SchemaJsonTablesElemIndexesElemColumnsElemOrderAsc SchemaJsonTablesElemIndexesElemColumnsElemOrder = "asc"
+const SchemaJsonTablesElemIndexesElemColumnsElemOrderDesc SchemaJsonTablesElemIndexesElemColumnsElemOrder = "desc"
+
+var enumValues_SchemaJsonTablesElemIndexesElemColumnsElemOrder = []interface{}{
+	"asc",
+	"desc",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemIndexesElemColumnsElemOrder) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SchemaJsonTablesElemIndexesElemColumnsElemOrder {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SchemaJsonTablesElemIndexesElemColumnsElemOrder, v)
+	}
+	*j = SchemaJsonTablesElemIndexesElemColumnsElemOrder(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemIndexesElemColumnsElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonTablesElemIndexesElemColumnsElem: required")
+	}
+	type Plain SchemaJsonTablesElemIndexesElemColumnsElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = SchemaJsonTablesElemIndexesElemColumnsElem(plain)
+	return nil
+}
+
+type SchemaJsonTablesElemIndexesElemMethod string
+
+const SchemaJsonTablesElemIndexesElemMethodBtree SchemaJsonTablesElemIndexesElemMethod = "btree"
+const SchemaJsonTablesElemIndexesElemMethodGin SchemaJsonTablesElemIndexesElemMethod = "gin"
+const SchemaJsonTablesElemIndexesElemMethodGist SchemaJsonTablesElemIndexesElemMethod = "gist"
+const SchemaJsonTablesElemIndexesElemMethodHash SchemaJsonTablesElemIndexesElemMethod = "hash"
+
+var enumValues_SchemaJsonTablesElemIndexesElemMethod = []interface{}{
+	"btree",
+	"gin",
+	"gist",
+	"hash",
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemIndexesElemMethod) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var ok bool
+	for _, expected := range enumValues_SchemaJsonTablesElemIndexesElemMethod {
+		if reflect.DeepEqual(v, expected) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return fmt.Errorf("invalid value (expected one of %#v): %#v", enumValues_SchemaJsonTablesElemIndexesElemMethod, v)
+	}
+	*j = SchemaJsonTablesElemIndexesElemMethod(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemIndexesElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonTablesElemIndexesElem: required")
+	}
+	type Plain SchemaJsonTablesElemIndexesElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*j = SchemaJsonTablesElemIndexesElem(plain)
+	return nil
+}
+
+// The unique constraint definition
+type SchemaJsonTablesElemUniqueConstraintsElem struct {
+	// The ordered columns that must be unique together.
+	Columns []string `json:"columns" yaml:"columns" mapstructure:"columns"`
+
+	// The name of the constraint.
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (j *SchemaJsonTablesElemUniqueConstraintsElem) UnmarshalJSON(b []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if _, ok := raw["columns"]; raw != nil && !ok {
+		return fmt.Errorf("field columns in SchemaJsonTablesElemUniqueConstraintsElem: required")
+	}
+	if _, ok := raw["name"]; raw != nil && !ok {
+		return fmt.Errorf("field name in SchemaJsonTablesElemUniqueConstraintsElem: required")
+	}
+	type Plain SchemaJsonTablesElemUniqueConstraintsElem
+	var plain Plain
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	if plain.Columns != nil && len(plain.Columns) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "columns", 1)
+	}
+	*j = SchemaJsonTablesElemUniqueConstraintsElem(plain)
+	return nil
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (j *SchemaJsonTablesElem) UnmarshalJSON(b []byte) error {
 	var raw map[string]interface{}
@@ -315,6 +745,9 @@ func (j *SchemaJsonTablesElem) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, &plain); err != nil {
 		return err
 	}
+	if plain.PrimaryKey != nil && len(plain.PrimaryKey) < 1 {
+		return fmt.Errorf("field %s length: must be >= %d", "primaryKey", 1)
+	}
 	*j = SchemaJsonTablesElem(plain)
 	return nil
 }
@@ -0,0 +1,28 @@
+CREATE SCHEMA IF NOT EXISTS billing;
+ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS 'delivered';
+CREATE TYPE currency AS ENUM ('usd', 'eur');
+DROP TABLE IF EXISTS "old_items" CASCADE;
+DROP TABLE IF EXISTS "old_orders" CASCADE;
+CREATE TABLE IF NOT EXISTS billing.invoices (
+   id int8 NOT NULL PRIMARY KEY,
+   currency currency NOT NULL
+);
+CREATE TABLE IF NOT EXISTS orders (
+   id int8 NOT NULL PRIMARY KEY,
+   "user_id" int8 NOT NULL,
+   status "order_status" NOT NULL
+);
+CREATE TABLE IF NOT EXISTS items (
+   id int8 NOT NULL PRIMARY KEY,
+   "order_id" int8 NOT NULL,
+   "invoice_id" int8
+);
+ALTER TABLE users ALTER COLUMN name TYPE varchar(128);
+ALTER TABLE users ADD COLUMN email text;
+ALTER TABLE users DROP COLUMN "legacy_flag" CASCADE;
+DROP INDEX IF EXISTS "idx_users_email";
+CREATE INDEX "idx_users_email" ON users (email);
+DROP TYPE IF EXISTS "legacy_kind";
+ALTER TABLE orders ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE items ADD CONSTRAINT "items_order_id_fkey" FOREIGN KEY ("order_id") REFERENCES orders (id);
+ALTER TABLE items ADD CONSTRAINT "items_invoice_id_fkey" FOREIGN KEY ("invoice_id") REFERENCES billing.invoices (id);
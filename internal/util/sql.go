@@ -16,3 +16,71 @@ func CleanSQL(val string) string {
 func IsFunctionCall(val string) bool {
 	return val[0:1] != "'" && strings.Contains(val, "(") && strings.Contains(val, ")")
 }
+
+// MatchingParen returns the offset of the paren which closes the open paren at offset start or -1 if not found
+func MatchingParen(val string, start int) int {
+	var depth int
+	var quote byte
+	for i := start; i < len(val); i++ {
+		c := val[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// TrimParens returns val without the parens which wrap the entire value
+func TrimParens(val string) string {
+	val = strings.TrimSpace(val)
+	for len(val) > 1 && val[0] == '(' && MatchingParen(val, 0) == len(val)-1 {
+		val = strings.TrimSpace(val[1 : len(val)-1])
+	}
+	return val
+}
+
+// SplitSQL returns the statements in val which are separated by a semicolon outside of quotes and parens. Each
+// statement keeps its terminating semicolon.
+func SplitSQL(val string) []string {
+	var statements []string
+	var depth int
+	var quote byte
+	var start int
+	add := func(end int) {
+		if statement := strings.TrimSpace(val[start:end]); statement != "" && statement != ";" {
+			statements = append(statements, statement)
+		}
+		start = end
+	}
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			add(i + 1)
+		}
+	}
+	add(len(val))
+	return statements
+}